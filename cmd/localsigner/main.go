@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/signer"
+)
+
+// localsigner is a development stand-in for a remote signer such as Web3Signer.
+// Point SIGNER_REMOTE_URL at it so the API process never holds the raw key.
+func main() {
+	listen := flag.String("listen", "127.0.0.1:9000", "address to listen on")
+	keystorePath := flag.String("keystore", "", "encrypted keystore file (password from SIGNER_KEYSTORE_PASSWORD)")
+	flag.Parse()
+
+	var (
+		s   *signer.LocalSigner
+		err error
+	)
+	if *keystorePath != "" {
+		s, err = signer.NewKeystoreSigner(*keystorePath, os.Getenv("SIGNER_KEYSTORE_PASSWORD"))
+	} else {
+		s, err = signer.NewLocalSigner(os.Getenv("SIGNER_PRIVATE_KEY"))
+	}
+	if err != nil {
+		log.Fatalf("Failed to load signing key: %v", err)
+	}
+
+	server, err := signer.NewServer(s)
+	if err != nil {
+		log.Fatalf("Failed to create signer server: %v", err)
+	}
+
+	log.Printf("Local signer for %s listening on %s", s.Address().Hex(), *listen)
+	log.Fatal(http.ListenAndServe(*listen, server))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/database"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+)
+
+// rotatekeys re-wraps every stored wallet secret under the current master key version.
+// It is safe to run while the API server is serving traffic.
+func main() {
+	newVersion := flag.Bool("new-version", false, "generate a new master key version first (file key provider only)")
+	batchSize := flag.Int("batch", 100, "rows loaded per batch")
+	flag.Parse()
+
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	walletDB, err := database.ConnectWalletDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to connect to wallet database: %v", err)
+	}
+
+	keyProvider, err := services.NewKeyProvider(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize key provider: %v", err)
+	}
+
+	if *newVersion {
+		fileProvider, ok := keyProvider.(*services.FileKeyProvider)
+		if !ok {
+			log.Fatalf("-new-version requires WALLET_KMS_PROVIDER=file; add the new key to WALLET_DB_MASTER_KEYS instead")
+		}
+
+		version, err := fileProvider.CreateVersion()
+		if err != nil {
+			log.Fatalf("Failed to create master key version: %v", err)
+		}
+		fmt.Printf("Created master key version %d in %s\n", version, fileProvider.Dir)
+
+		// Running servers keep wrapping new secrets with the old version until they reload
+		fmt.Printf("Waiting %s for running servers to pick up version %d...\n", services.FileKeyReloadInterval, version)
+		time.Sleep(services.FileKeyReloadInterval + time.Second)
+	}
+
+	encryptionService, err := services.NewEncryptionService(keyProvider, cfg.WalletDB.EncryptKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize encryption service: %v", err)
+	}
+
+	rotationService := services.NewKeyRotationService(walletDB, encryptionService, *batchSize)
+
+	fmt.Printf("Rotating wallet secrets to master key version %d...\n", keyProvider.CurrentVersion())
+	result, err := rotationService.Rotate()
+	if err != nil {
+		log.Fatalf("Key rotation aborted: %v", err)
+	}
+
+	failed := 0
+	for _, table := range []string{"encrypted_wallets", "wallet_mnemonics", "wallet_backups", "wallet_shares"} {
+		fmt.Printf("%-18s rotated=%d skipped=%d failed=%d\n", table, result.Rotated[table], result.Skipped[table], result.Failed[table])
+		failed += result.Failed[table]
+	}
+
+	// The old master key is still needed by the rows that failed
+	if failed > 0 {
+		log.Fatalf("Key rotation left %d secrets on an older master key version; keep the old key until they are rotated", failed)
+	}
+}
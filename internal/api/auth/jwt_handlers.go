@@ -22,6 +22,8 @@ type Claims struct {
     Email string `json:"email"`
     WalletAddress string `json:"wallet_address"`
     TokenType     string `json:"token_type,omitempty"` // "access" or "refresh"
+    Role          string `json:"role,omitempty"`
+    Permissions   []string `json:"permissions,omitempty"`
     jwt.RegisteredClaims
 }
 
@@ -44,8 +46,8 @@ func (s *TokenService) GetConfig() JWTConfig {
     return s.config
 }
 
-// GenerateToken creates a new JWT token for a user
-func (s *TokenService) GenerateToken(userID uuid.UUID, username, walletAddress string) (string, error) {
+// GenerateToken creates a new JWT token for a user carrying their role and permissions
+func (s *TokenService) GenerateToken(userID uuid.UUID, username, walletAddress, role string, permissions []string) (string, error) {
     // Set expiration time
     expirationTime := time.Now().Add(s.config.TokenDuration)
 
@@ -54,6 +56,8 @@ func (s *TokenService) GenerateToken(userID uuid.UUID, username, walletAddress s
         UserID:   userID.String(),
         Username: username,
         Address:  walletAddress,
+        Role:     role,
+        Permissions: permissions,
         RegisteredClaims: jwt.RegisteredClaims{
             ExpiresAt: jwt.NewNumericDate(expirationTime),
             IssuedAt:  jwt.NewNumericDate(time.Now()),
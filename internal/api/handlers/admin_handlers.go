@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateTokenPriceRequest represents a request to change the gateway token price
+type UpdateTokenPriceRequest struct {
+    PricePerToken string `json:"price_per_token" binding:"required"` // In the contract's smallest fiat unit
+}
+
+// UpdateGasDepositRequest represents a request to change the required gas deposit
+type UpdateGasDepositRequest struct {
+    AmountWei string `json:"amount_wei" binding:"required"`
+}
+
+// UpdateGatewaySignerRequest represents a request to change a payment gateway signer
+type UpdateGatewaySignerRequest struct {
+    Gateway string `json:"gateway" binding:"required"`
+    Signer  string `json:"signer" binding:"required"`
+}
+
+// UpdateUserRoleRequest represents a request to change a user's role
+type UpdateUserRoleRequest struct {
+    Role        string   `json:"role" binding:"required"`
+    Permissions []string `json:"permissions"`
+}
+
+// AdminSearchUsersHandler lists users matching a search query
+func (h *Handler) AdminSearchUsersHandler(c *gin.Context) {
+    limit, offset := parseLimitOffset(c)
+
+    users, total, err := h.AdminService.SearchUsers(services.UserSearchFilter{
+        Query:  c.Query("q"),
+        Role:   c.Query("role"),
+        Limit:  limit,
+        Offset: offset,
+    })
+    if err != nil {
+        h.logAdminAction(c, "admin_search_users", "Admin searched users", "user", c.Query("q"), err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search users"})
+        return
+    }
+
+    h.logAdminAction(c, "admin_search_users", "Admin searched users", "user", c.Query("q"), nil)
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":  total,
+        "limit":  limit,
+        "offset": offset,
+        "users":  users,
+    })
+}
+
+// AdminGetUserHandler returns a single user with their role and permissions
+func (h *Handler) AdminGetUserHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    user, err := h.AdminService.GetUser(id)
+    if err != nil {
+        h.logAdminAction(c, "admin_get_user", "Admin looked up a user", "user", id, err)
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    var wallets []models.Wallet
+    h.DB.Where("user_id = ?", user.UUID).Find(&wallets)
+
+    var transactionCount int64
+    h.DB.Model(&models.Transaction{}).Where("user_id = ?", user.UUID).Count(&transactionCount)
+
+    h.logAdminAction(c, "admin_get_user", "Admin looked up a user", "user", user.UUID.String(), nil)
+
+    c.JSON(http.StatusOK, gin.H{
+        "user":              user,
+        "permissions":       user.PermissionList(),
+        "wallets":           wallets,
+        "transaction_count": transactionCount,
+    })
+}
+
+// AdminUpdateUserRoleHandler changes the role of a user
+func (h *Handler) AdminUpdateUserRoleHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    var req UpdateUserRoleRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Role required."})
+        return
+    }
+
+    user, err := h.AdminService.GetUser(id)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return
+    }
+
+    if err := h.AdminService.SetUserRole(user, req.Role, req.Permissions); err != nil {
+        h.logAdminAction(c, "admin_update_role", "Admin changed role to "+req.Role, "user", user.UUID.String(), err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_update_role", "Admin changed role to "+req.Role, "user", user.UUID.String(), nil)
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "User role updated. Changes apply on the user's next login or token refresh.",
+        "uuid":    user.UUID,
+        "role":    req.Role,
+    })
+}
+
+// AdminSearchTransactionsHandler searches purchase transactions across all users
+func (h *Handler) AdminSearchTransactionsHandler(c *gin.Context) {
+    limit, offset := parseLimitOffset(c)
+
+    filter := services.TransactionSearchFilter{
+        Query:         c.Query("q"),
+        UserID:        c.Query("user_id"),
+        WalletAddress: c.Query("wallet_address"),
+        Status:        c.Query("status"),
+        PaymentMethod: c.Query("payment_method"),
+        Limit:         limit,
+        Offset:        offset,
+    }
+
+    if from := c.Query("from"); from != "" {
+        t, err := time.Parse(time.RFC3339, from)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' date, expected RFC3339"})
+            return
+        }
+        filter.From = &t
+    }
+
+    if to := c.Query("to"); to != "" {
+        t, err := time.Parse(time.RFC3339, to)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' date, expected RFC3339"})
+            return
+        }
+        filter.To = &t
+    }
+
+    transactions, total, err := h.AdminService.SearchTransactions(filter)
+    if err != nil {
+        h.logAdminAction(c, "admin_search_transactions", "Admin searched transactions", "transaction", filter.Query, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search transactions"})
+        return
+    }
+
+    h.logAdminAction(c, "admin_search_transactions", "Admin searched transactions", "transaction", filter.Query, nil)
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":        total,
+        "limit":        limit,
+        "offset":       offset,
+        "transactions": transactions,
+    })
+}
+
+// AdminRefundTransactionHandler refunds a payment through the gateway contract
+func (h *Handler) AdminRefundTransactionHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    var transaction models.Transaction
+    if err := h.DB.Where("payment_id = ? OR uuid::text = ?", id, id).First(&transaction).Error; err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+        return
+    }
+
+    // Claim the refund with a conditional update so only paid purchases are refunded, and only once
+    // when two admins refund at the same time
+    previousStatus := transaction.Status
+    claim := h.DB.Model(&models.Transaction{}).
+        Where("uuid = ? AND status IN ?", transaction.UUID, []string{models.TransactionStatusCompleted, models.TransactionStatusProcessing}).
+        Updates(map[string]interface{}{"status": models.TransactionStatusRefunding, "updated_at": time.Now()})
+    if claim.Error != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start refund"})
+        return
+    }
+    if claim.RowsAffected == 0 {
+        c.JSON(http.StatusConflict, gin.H{"error": "Only paid transactions can be refunded, this one is " + transaction.Status})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+    defer cancel()
+
+    if err := h.BlockchainService.PaymentGateway.ProcessRefund(ctx, transaction.PaymentID); err != nil {
+        // Release the claim so the refund can be tried again
+        if releaseErr := h.DB.Model(&models.Transaction{}).Where("uuid = ? AND status = ?", transaction.UUID, models.TransactionStatusRefunding).
+            Updates(map[string]interface{}{"status": previousStatus, "updated_at": time.Now()}).Error; releaseErr != nil {
+            log.Printf("Failed to release refund of %s: %v", transaction.PaymentID, releaseErr)
+        }
+        h.logAdminAction(c, "admin_refund", "Admin refunded payment", "transaction", transaction.PaymentID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process refund: " + err.Error()})
+        return
+    }
+
+    transaction.Status = models.TransactionStatusRefunded
+    transaction.UpdatedAt = time.Now()
+    if err := h.DB.Model(&models.Transaction{}).Where("uuid = ?", transaction.UUID).
+        Updates(map[string]interface{}{"status": transaction.Status, "updated_at": transaction.UpdatedAt}).Error; err != nil {
+        // The money has moved; the transaction stays refunding so it cannot be refunded twice
+        log.Printf("Refund of %s was processed but could not be recorded: %v", transaction.PaymentID, err)
+        h.logAdminAction(c, "admin_refund", "Admin refunded payment", "transaction", transaction.PaymentID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Refund was processed but could not be recorded, the transaction is left as refunding"})
+        return
+    }
+
+    h.logAdminAction(c, "admin_refund", "Admin refunded payment", "transaction", transaction.PaymentID, nil)
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":    "Refund processed successfully",
+        "payment_id": transaction.PaymentID,
+        "status":     transaction.Status,
+    })
+}
+
+// AdminUpdateTokenPriceHandler updates the token price in the payment gateway contract
+func (h *Handler) AdminUpdateTokenPriceHandler(c *gin.Context) {
+    var req UpdateTokenPriceRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. price_per_token required."})
+        return
+    }
+
+    price, ok := new(big.Int).SetString(req.PricePerToken, 10)
+    if !ok || price.Sign() <= 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price_per_token"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+    defer cancel()
+
+    err := h.BlockchainService.PaymentGateway.UpdateTokenPrice(ctx, price)
+    h.logAdminAction(c, "admin_update_token_price", "Admin set token price to "+price.String(), "contract", h.Config.PaymentGatewayAddress.Hex(), err)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update token price: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":         "Token price updated",
+        "price_per_token": price.String(),
+    })
+}
+
+// AdminUpdateGasDepositHandler updates the required gas deposit in the payment gateway contract
+func (h *Handler) AdminUpdateGasDepositHandler(c *gin.Context) {
+    var req UpdateGasDepositRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. amount_wei required."})
+        return
+    }
+
+    amount, ok := new(big.Int).SetString(req.AmountWei, 10)
+    if !ok || amount.Sign() < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid amount_wei"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+    defer cancel()
+
+    err := h.BlockchainService.PaymentGateway.UpdateGasDepositRequirement(ctx, amount)
+    h.logAdminAction(c, "admin_update_gas_deposit", "Admin set gas deposit to "+amount.String()+" wei", "contract", h.Config.PaymentGatewayAddress.Hex(), err)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update gas deposit: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":    "Gas deposit requirement updated",
+        "amount_wei": amount.String(),
+    })
+}
+
+// AdminUpdateGatewaySignerHandler updates the signer address for a payment gateway
+func (h *Handler) AdminUpdateGatewaySignerHandler(c *gin.Context) {
+    var req UpdateGatewaySignerRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. gateway and signer required."})
+        return
+    }
+
+    if !common.IsHexAddress(req.Signer) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signer address"})
+        return
+    }
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+    defer cancel()
+
+    signer := common.HexToAddress(req.Signer)
+    err := h.BlockchainService.PaymentGateway.UpdateGatewaySigner(ctx, req.Gateway, signer)
+    h.logAdminAction(c, "admin_update_gateway_signer", "Admin set signer for "+req.Gateway+" to "+signer.Hex(), "contract", h.Config.PaymentGatewayAddress.Hex(), err)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update gateway signer: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Gateway signer updated",
+        "gateway": req.Gateway,
+        "signer":  signer.Hex(),
+    })
+}
+
+// AdminWithdrawFeesHandler withdraws accumulated processing fees to the contract owner
+func (h *Handler) AdminWithdrawFeesHandler(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+    defer cancel()
+
+    err := h.BlockchainService.PaymentGateway.WithdrawProcessingFees(ctx)
+    h.logAdminAction(c, "admin_withdraw_fees", "Admin withdrew processing fees", "contract", h.Config.PaymentGatewayAddress.Hex(), err)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw fees: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Processing fees withdrawn",
+    })
+}
+
+// logAdminAction records an admin action in the activity log
+func (h *Handler) logAdminAction(c *gin.Context, action, description, resource, resourceID string, err error) {
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, action, description, resource, resourceID, "failure", err.Error())
+        return
+    }
+    h.ActivityLoggerService.LogFromRequest(c, action, description, resource, resourceID, "success", "")
+}
+
+// parseLimitOffset reads limit/offset pagination parameters
+func parseLimitOffset(c *gin.Context) (int, int) {
+    limit := 20
+    offset := 0
+
+    if parsedLimit, err := strconv.Atoi(c.Query("limit")); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+        limit = parsedLimit
+    }
+
+    if parsedOffset, err := strconv.Atoi(c.Query("offset")); err == nil && parsedOffset >= 0 {
+        offset = parsedOffset
+    }
+
+    return limit, offset
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/gin-gonic/gin"
+)
+
+// maxRevocationsPerRequest limits the approve transactions sent by one revoke request
+const maxRevocationsPerRequest = 20
+
+// RevokeAllowancesRequest represents a request to set ERC-20 allowances to zero
+type RevokeAllowancesRequest struct {
+    Account     string                     `json:"account"` // Address, account ID or label; defaults to the default account
+    Revocations []services.AllowanceTarget `json:"revocations" binding:"required,dive"`
+    Password    string                     `json:"password" binding:"required"`
+    TOTPCode    string                     `json:"totp_code"` // Required when 2FA is enabled
+}
+
+// ListAllowancesHandler lists the ERC-20 allowances granted by one of the user's wallets
+func (h *Handler) ListAllowancesHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    walletAddress, ok := h.selectedWalletAddress(c, user, c.Query("account"))
+    if !ok {
+        return
+    }
+
+    allowances, err := h.AllowanceService.ListAllowances(c.Request.Context(), common.HexToAddress(walletAddress))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to list allowances: %v", err)})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "wallet_address": walletAddress,
+        "allowances":     allowances,
+    })
+}
+
+// RevokeAllowancesHandler sets the chosen allowances to zero, signing with the wallet's stored key
+func (h *Handler) RevokeAllowancesHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req RevokeAllowancesRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Revocations and password required."})
+        return
+    }
+    if len(req.Revocations) == 0 || len(req.Revocations) > maxRevocationsPerRequest {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Between 1 and %d revocations allowed per request", maxRevocationsPerRequest)})
+        return
+    }
+
+    // Non-custodial users revoke by signing a zero approval from /tx/build/approve
+    if h.rejectNonCustodial(c, user.UUID) {
+        return
+    }
+
+    walletAddress, ok := h.selectedWalletAddress(c, user, req.Account)
+    if !ok {
+        return
+    }
+
+    if !h.verifyStepUp(c, user, req.Password, req.TOTPCode, "revoke_allowance", "User attempted to revoke allowances", walletAddress) {
+        return
+    }
+
+    results := h.AllowanceService.Revoke(c.Request.Context(), user.UUID, common.HexToAddress(walletAddress), req.Revocations)
+
+    sent := 0
+    for _, result := range results {
+        status, errMsg := "success", ""
+        if result.Error != "" {
+            status, errMsg = "failure", result.Error
+        } else {
+            sent++
+        }
+        h.ActivityLoggerService.LogFromRequest(c, "revoke_allowance",
+            fmt.Sprintf("User revoked the %s allowance of %s", result.Token, result.Spender),
+            "wallet", walletAddress,
+            status, errMsg)
+    }
+
+    httpStatus := http.StatusOK
+    if sent == 0 {
+        httpStatus = http.StatusBadRequest
+    }
+
+    c.JSON(httpStatus, gin.H{
+        "message": fmt.Sprintf("%d of %d revocations sent", sent, len(results)),
+        "results": results,
+    })
+}
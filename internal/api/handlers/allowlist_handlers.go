@@ -0,0 +1,131 @@
+package handlers
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// maxAllowlistSize caps an uploaded allowlist CSV
+const maxAllowlistSize = 10 << 20
+
+// GetAllowlistProofHandler returns the user's allocation and Merkle proof in a private round
+func (h *Handler) GetAllowlistProofHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    proof, err := h.AllowlistService.Proof(c.Query("round"), user)
+    if err != nil {
+        status := http.StatusBadRequest
+        if err.Error() == "sale round not found" || err.Error() == "account is not on the allowlist" {
+            status = http.StatusNotFound
+        }
+        h.respondAllowlistError(c, status, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"proof": proof})
+}
+
+// AdminUploadAllowlistHandler replaces a round's allowlist from a CSV of account,allocation rows,
+// sent as the "file" form field or as the request body
+func (h *Handler) AdminUploadAllowlistHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    var body io.Reader = http.MaxBytesReader(c.Writer, c.Request.Body, maxAllowlistSize)
+    if fileHeader, err := c.FormFile("file"); err == nil {
+        if fileHeader.Size > maxAllowlistSize {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Allowlist file is too large"})
+            return
+        }
+        file, err := fileHeader.Open()
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read allowlist file"})
+            return
+        }
+        defer file.Close()
+        body = file
+    }
+
+    upload, err := h.AllowlistService.Upload(id, body)
+    if err != nil {
+        h.logAdminAction(c, "admin_upload_allowlist", "Admin uploaded an allowlist", "sale_round", id, err)
+        h.respondAllowlistError(c, http.StatusBadRequest, err)
+        return
+    }
+
+    h.logAdminAction(c, "admin_upload_allowlist", fmt.Sprintf("Admin uploaded an allowlist of %d accounts for %s", upload.Entries, upload.Round.Name), "sale_round", upload.Round.UUID.String(), nil)
+
+    c.JSON(http.StatusOK, gin.H{"allowlist": upload})
+}
+
+// AdminListAllowlistHandler lists a round's allowlist entries
+func (h *Handler) AdminListAllowlistHandler(c *gin.Context) {
+    id := c.Param("id")
+    limit, offset := parseLimitOffset(c)
+
+    entries, total, err := h.AllowlistService.ListEntries(id, limit, offset)
+    if err != nil {
+        h.respondAllowlistError(c, http.StatusInternalServerError, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":   total,
+        "limit":   limit,
+        "offset":  offset,
+        "entries": entries,
+    })
+}
+
+// AdminClearAllowlistHandler removes a round's allowlist, opening it to every buyer
+func (h *Handler) AdminClearAllowlistHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    round, err := h.AllowlistService.Clear(id)
+    if err != nil {
+        h.logAdminAction(c, "admin_clear_allowlist", "Admin cleared an allowlist", "sale_round", id, err)
+        h.respondAllowlistError(c, http.StatusInternalServerError, err)
+        return
+    }
+
+    h.logAdminAction(c, "admin_clear_allowlist", "Admin cleared the allowlist of "+round.Name, "sale_round", round.UUID.String(), nil)
+
+    c.JSON(http.StatusOK, gin.H{"round": round})
+}
+
+// AdminPublishAllowlistRootHandler publishes a round's allowlist root to the payment gateway
+func (h *Handler) AdminPublishAllowlistRootHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+    defer cancel()
+
+    round, err := h.AllowlistService.PublishRoot(ctx, id)
+    if err != nil {
+        h.logAdminAction(c, "admin_publish_allowlist_root", "Admin published an allowlist root", "sale_round", id, err)
+        h.respondAllowlistError(c, http.StatusInternalServerError, err)
+        return
+    }
+
+    h.logAdminAction(c, "admin_publish_allowlist_root", "Admin published the allowlist root of "+round.Name, "sale_round", round.UUID.String(), nil)
+
+    c.JSON(http.StatusOK, gin.H{
+        "round":   round,
+        "tx_hash": round.AllowlistRootTx,
+    })
+}
+
+// respondAllowlistError answers 404 for an unknown round and the given status otherwise
+func (h *Handler) respondAllowlistError(c *gin.Context, status int, err error) {
+    if err.Error() == "sale round not found" {
+        status = http.StatusNotFound
+    }
+    c.JSON(status, gin.H{"error": err.Error()})
+}
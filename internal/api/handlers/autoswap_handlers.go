@@ -35,6 +35,7 @@ func (h *Handler) AutoSwapCifoPurchaseHandler(c *gin.Context) {
         Phone            string  `json:"phone"`
         SuccessURL       string  `json:"success_url"`
         CancelURL        string  `json:"cancel_url"`
+        PromoCode        string  `json:"promo_code"`
     }
     
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -134,6 +135,17 @@ func (h *Handler) AutoSwapCifoPurchaseHandler(c *gin.Context) {
         return
     }
     
+    // Apply the promo code; the swap buys the requested amount and the bonus is sent after it
+    tokenAmount := req.CifoAmount
+    promo, ok := h.applyPromoCode(c, req.PromoCode, &uid, fiatAmount, req.FiatCurrency, tokenAmount, ethPriceUSD, ethPriceIDR)
+    if !ok {
+        return
+    }
+    if promo != nil {
+        fiatAmount = promo.FiatAmount
+        tokenAmount = promo.TokenAmount
+    }
+    
     txUUID := uuid.New()
     orderID := fmt.Sprintf("CIFO-%s", txUUID.String()[:8])
     
@@ -145,7 +157,7 @@ func (h *Handler) AutoSwapCifoPurchaseHandler(c *gin.Context) {
         FiatCurrency:       strings.ToUpper(req.FiatCurrency),
         FiatAmount:         fiatAmount,
         EthAmount:          ethRequired,
-        TokenAmount:        req.CifoAmount,
+        TokenAmount:        tokenAmount,
         TokenSymbol:        "CIFO",
         Status:             models.TransactionStatusPending,
         PaymentMethod:      "midtrans",
@@ -158,11 +170,10 @@ func (h *Handler) AutoSwapCifoPurchaseHandler(c *gin.Context) {
         CreatedAt:          time.Now(),
         UpdatedAt:          time.Now(),
     }
+    promo.Apply(&transaction)
     
-    // Save transaction to database
-    if err := h.DB.Create(&transaction).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction record"})
-        log.Printf("Error creating transaction: %v", err)
+    // Save transaction to database within the sale round's caps and limits
+    if !h.createPurchase(c, &transaction, ethPriceUSD, ethPriceIDR) {
         return
     }
     
@@ -211,6 +222,7 @@ func (h *Handler) AutoSwapCifoPurchaseHandler(c *gin.Context) {
             "cifo_per_eth": cifoPerEthFloat,
             "eth_per_cifo": 1/cifoPerEthFloat,
         },
+        "promo": promo,
     })
 }
 
@@ -349,6 +361,7 @@ func (h *Handler) executeAutoSwap(transaction *models.Transaction) {
     transaction.BlockchainCompleted = true
     transaction.CompletedAt = &now
     transaction.UpdatedAt = now
+    h.PromoService.MarkBonusOwed(transaction)
     
     if err := h.DB.Save(transaction).Error; err != nil {
         log.Printf("Warning: Failed to update transaction after successful swap: %v", err)
@@ -356,4 +369,6 @@ func (h *Handler) executeAutoSwap(transaction *models.Transaction) {
     
     log.Printf("Successfully completed auto-swap of %.8f CIFO tokens via Uniswap, tx: %s",
         transaction.TokenAmount, txHash)
+    
+    h.deliverPromoBonus(transaction)
 }
\ No newline at end of file
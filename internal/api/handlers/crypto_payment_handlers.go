@@ -0,0 +1,265 @@
+package handlers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/big"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// CryptoPaymentRequest is a token purchase paid in ETH or the stablecoin
+type CryptoPaymentRequest struct {
+    Asset             string  `json:"asset" binding:"required"` // ETH or the stablecoin symbol
+    FiatAmount        float64 `json:"fiat_amount" binding:"required"`
+    FiatCurrency      string  `json:"fiat_currency"`      // idr (default) or usd
+    DestinationWallet string  `json:"destination_wallet"` // Defaults to the user's wallet
+}
+
+// ResolveCryptoPaymentRequest settles a held, failed or overpaid crypto payment
+type ResolveCryptoPaymentRequest struct {
+    Action       string `json:"action" binding:"required"` // deliver or refund
+    RefundTxHash string `json:"refund_tx_hash"`            // Confirmed refund to the payer, required to refund
+    Note         string `json:"note"`
+}
+
+// CreateCryptoPaymentHandler opens an order with a fresh deposit address and its EIP-681 payment URI
+func (h *Handler) CreateCryptoPaymentHandler(c *gin.Context) {
+    if h.CryptoPaymentService == nil {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Crypto payments are not enabled"})
+        return
+    }
+
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req CryptoPaymentRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Asset and fiat amount required."})
+        return
+    }
+
+    if req.FiatAmount <= 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Fiat amount must be greater than 0"})
+        return
+    }
+
+    req.FiatCurrency = strings.ToLower(req.FiatCurrency)
+    if req.FiatCurrency == "" {
+        req.FiatCurrency = "idr"
+    }
+    if req.FiatCurrency != "idr" && req.FiatCurrency != "usd" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Currency must be either 'idr' or 'usd'"})
+        return
+    }
+
+    if req.DestinationWallet == "" {
+        req.DestinationWallet = user.WalletAddress
+    }
+    if !common.IsHexAddress(req.DestinationWallet) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "A valid destination wallet address is required"})
+        return
+    }
+
+    asset, err := h.CryptoPaymentService.ResolveAsset(req.Asset)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    ethPriceUSD, ethPriceIDR, err := h.GetEthPrices(c.Request.Context())
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ETH prices"})
+        return
+    }
+
+    ethPrice := ethPriceUSD
+    if req.FiatCurrency == "idr" {
+        ethPrice = ethPriceIDR
+    }
+    ethAmount := req.FiatAmount / ethPrice
+
+    tokenAmount, err := h.getTokenAmount(ethAmount)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to calculate token amount"})
+        return
+    }
+    tokenAmountFloat, err := strconv.ParseFloat(tokenAmount, 64)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse token amount"})
+        return
+    }
+
+    // Price at the active sale round when rounds are configured
+    round, ok := h.activeSaleRound(c)
+    if !ok {
+        return
+    }
+    if round != nil {
+        tokenAmountFloat = roundTokenAmount(round, ethAmount*ethPriceUSD)
+    }
+
+    // ETH is due at the current price, the stablecoin at the USD value of the order
+    amount := ethAmount
+    if !asset.IsETH() {
+        amount = ethAmount * ethPriceUSD
+    }
+    amountDue, _ := new(big.Float).Mul(
+        big.NewFloat(amount),
+        new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(asset.Decimals)), nil)),
+    ).Int(nil)
+
+    txUUID := uuid.New()
+    transaction := &models.Transaction{
+        UUID:               txUUID,
+        UserID:             user.UUID,
+        PaymentID:          fmt.Sprintf("CRYPTO-%s", txUUID.String()[:8]),
+        WalletAddress:      req.DestinationWallet,
+        FiatCurrency:       strings.ToUpper(req.FiatCurrency),
+        FiatAmount:         req.FiatAmount,
+        EthAmount:          ethAmount,
+        TokenAmount:        tokenAmountFloat,
+        TokenSymbol:        "CIFO",
+        Status:             models.TransactionStatusPending,
+        EthPriceAtPurchase: ethPrice,
+        TransactionType:    "send",
+        SwapType:           "",
+        CreatedAt:          time.Now(),
+        UpdatedAt:          time.Now(),
+    }
+
+    h.attributePartner(c, transaction)
+    transaction.FXRate = fxRate(ethPriceUSD, ethPriceIDR)
+
+    payment, err := h.CryptoPaymentService.CreatePayment(c.Request.Context(), transaction, asset, amountDue, h.kycCheck(transaction, ethPriceUSD, ethPriceIDR))
+    if err != nil && h.respondPurchaseRejected(c, transaction, err) {
+        return
+    }
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "crypto_payment_create", "Failed to create crypto payment", "transaction", txUUID.String(), "failure", err.Error())
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment: " + err.Error()})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "crypto_payment_create",
+        fmt.Sprintf("Created %s payment to %s", asset.Symbol, payment.DepositAddress),
+        "transaction", transaction.PaymentID, "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "payment_id":   transaction.PaymentID,
+        "transaction":  transaction,
+        "payment":      payment,
+        "amount_due":   asset.Format(amountDue),
+        "token_amount": transaction.TokenAmount,
+    })
+}
+
+// GetCryptoPaymentHandler returns the status of one of the user's crypto payments
+func (h *Handler) GetCryptoPaymentHandler(c *gin.Context) {
+    if h.CryptoPaymentService == nil {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Crypto payments are not enabled"})
+        return
+    }
+
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    payment, transaction, err := h.CryptoPaymentService.GetPayment(user.UUID, c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "payment":     payment,
+        "transaction": transaction,
+    })
+}
+
+// AdminListCryptoPaymentsHandler lists crypto payments, e.g. underpaid and late ones awaiting review
+func (h *Handler) AdminListCryptoPaymentsHandler(c *gin.Context) {
+    if h.CryptoPaymentService == nil {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Crypto payments are not enabled"})
+        return
+    }
+
+    limit, offset := parseLimitOffset(c)
+    status := c.Query("status")
+
+    payments, total, err := h.CryptoPaymentService.ListPayments(status, c.Query("sweep_status"), limit, offset)
+    if err != nil {
+        h.logAdminAction(c, "admin_list_crypto_payments", "Admin listed crypto payments", "crypto_payment", status, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list crypto payments"})
+        return
+    }
+
+    h.logAdminAction(c, "admin_list_crypto_payments", "Admin listed crypto payments", "crypto_payment", status, nil)
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":    total,
+        "limit":    limit,
+        "offset":   offset,
+        "payments": payments,
+    })
+}
+
+// AdminResolveCryptoPaymentHandler delivers the tokens of an underpaid, late or failed crypto
+// payment, or records the refund of one or of an overpayment
+func (h *Handler) AdminResolveCryptoPaymentHandler(c *gin.Context) {
+    if h.CryptoPaymentService == nil {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Crypto payments are not enabled"})
+        return
+    }
+
+    var req ResolveCryptoPaymentRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. action required."})
+        return
+    }
+
+    id := c.Param("id")
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Minute)
+    defer cancel()
+
+    payment, err := h.CryptoPaymentService.Resolve(ctx, id, req.Action, req.RefundTxHash, req.Note)
+    h.logAdminAction(c, "admin_resolve_crypto_payment", "Admin resolved crypto payment with "+req.Action, "crypto_payment", id, err)
+    if errors.Is(err, services.ErrCryptoPaymentNotResolvable) {
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+        return
+    }
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Crypto payment not found"})
+        return
+    }
+    if err != nil && payment == nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve crypto payment: " + err.Error()})
+        return
+    }
+    if err != nil {
+        // The payment is paid and its delivery is retried in the background
+        c.JSON(http.StatusAccepted, gin.H{
+            "message": "Payment accepted, token delivery will be retried: " + err.Error(),
+            "payment": payment,
+        })
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Crypto payment resolved",
+        "payment": payment,
+    })
+}
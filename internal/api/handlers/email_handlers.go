@@ -0,0 +1,86 @@
+package handlers
+
+import (
+    "net/http"
+    "strings"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/gin-gonic/gin"
+)
+
+// UpdateLanguageRequest represents a request to change the language of the user's emails
+type UpdateLanguageRequest struct {
+    Language string `json:"language" binding:"required"`
+}
+
+// UpdateLanguageHandler sets the language the user's emails are sent in
+func (h *Handler) UpdateLanguageHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req UpdateLanguageRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Language required."})
+        return
+    }
+
+    language := strings.ToLower(strings.TrimSpace(req.Language))
+    if !services.IsSupportedLanguage(language) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported language: " + language})
+        return
+    }
+
+    if err := h.DB.Model(user).Update("language", language).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update language"})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "update_language",
+        "User changed email language to "+language,
+        "user", user.UUID.String(),
+        "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":  "Language updated",
+        "language": language,
+    })
+}
+
+// AdminListEmailsHandler lists the email outbox, optionally filtered by status
+func (h *Handler) AdminListEmailsHandler(c *gin.Context) {
+    limit, offset := parseLimitOffset(c)
+    emails, total, err := h.EmailService.Outbox(c.Query("status"), limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load emails"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":  total,
+        "limit":  limit,
+        "offset": offset,
+        "emails": emails,
+    })
+}
+
+// AdminRetryEmailHandler queues a failed email for delivery again
+func (h *Handler) AdminRetryEmailHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    email, err := h.EmailService.Retry(id)
+    if err != nil {
+        h.logAdminAction(c, "admin_retry_email", "Admin retried an email", "email", id, err)
+        status := http.StatusConflict
+        if err.Error() == "email not found" {
+            status = http.StatusNotFound
+        }
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_retry_email", "Admin retried "+email.Template+" email to "+email.ToEmail, "email", id, nil)
+
+    c.JSON(http.StatusOK, gin.H{"email": email})
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/gin-gonic/gin"
+)
+
+// ExportTransactionsHandler exports the user's purchases and wallet transactions for a period as
+// CSV or JSON. Exports with more records than the sync limit are queued as a job instead.
+func (h *Handler) ExportTransactionsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    req, err := services.ParseExportRequest(c.Query("from"), c.Query("to"), c.Query("format"), c.Query("currency"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    count, err := h.TaxExportService.CountRecords(user.UUID, req)
+    if err != nil {
+        log.Printf("Error counting export records of %s: %v", user.UUID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export transactions"})
+        return
+    }
+
+    if count > int64(h.TaxExportService.SyncLimit) || c.Query("async") == "true" {
+        job, err := h.TaxExportService.CreateJob(user.UUID, req)
+        if err != nil {
+            if errors.Is(err, services.ErrTooManyExports) {
+                c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+                return
+            }
+            log.Printf("Error queueing export of %s: %v", user.UUID, err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue export"})
+            return
+        }
+
+        h.ActivityLoggerService.LogFromRequest(c, "export_transactions", "Queued a transaction export", "tax_export", job.UUID.String(), "success", "")
+
+        c.JSON(http.StatusAccepted, gin.H{
+            "export":       job,
+            "download_url": exportDownloadURL(job),
+        })
+        return
+    }
+
+    content, _, err := h.TaxExportService.Generate(c.Request.Context(), user.UUID, req)
+    if err != nil {
+        log.Printf("Error exporting transactions of %s: %v", user.UUID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export transactions"})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "export_transactions", "Exported transactions", "tax_export", "", "success", "")
+
+    c.Header("Content-Disposition", `attachment; filename="`+req.Filename()+`"`)
+    c.Data(http.StatusOK, req.ContentType(), content)
+}
+
+// ListExportsHandler lists the user's export jobs, newest first
+func (h *Handler) ListExportsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    limit, offset := parseLimitOffset(c)
+    jobs, total, err := h.TaxExportService.Jobs(user.UUID, limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exports"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":   total,
+        "limit":   limit,
+        "offset":  offset,
+        "exports": jobs,
+    })
+}
+
+// GetExportHandler returns the status of one of the user's export jobs
+func (h *Handler) GetExportHandler(c *gin.Context) {
+    job, ok := h.userExport(c)
+    if !ok {
+        return
+    }
+
+    response := gin.H{"export": job}
+    if job.Status == models.TaxExportStatusCompleted && job.Content != nil {
+        response["download_url"] = exportDownloadURL(job)
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// DownloadExportHandler downloads the file of a finished export job
+func (h *Handler) DownloadExportHandler(c *gin.Context) {
+    job, ok := h.userExport(c)
+    if !ok {
+        return
+    }
+
+    if job.Status != models.TaxExportStatusCompleted {
+        c.JSON(http.StatusConflict, gin.H{"error": "Export is " + job.Status})
+        return
+    }
+    if job.Content == nil {
+        c.JSON(http.StatusGone, gin.H{"error": "Export has expired"})
+        return
+    }
+
+    req := services.JobExportRequest(job)
+    c.Header("Content-Disposition", `attachment; filename="`+req.Filename()+`"`)
+    c.Data(http.StatusOK, req.ContentType(), job.Content)
+}
+
+// userExport loads the export job in the id parameter if it belongs to the user
+func (h *Handler) userExport(c *gin.Context) (*models.TaxExport, bool) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return nil, false
+    }
+
+    job, err := h.TaxExportService.Job(user.UUID, c.Param("id"))
+    if err != nil {
+        if err.Error() == "export not found" {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+            return nil, false
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load export"})
+        return nil, false
+    }
+    return job, true
+}
+
+// exportDownloadURL is where the file of an export job is downloaded once it is done
+func exportDownloadURL(job *models.TaxExport) string {
+    return "/api/v1/exports/" + job.UUID.String() + "/download"
+}
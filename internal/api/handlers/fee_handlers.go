@@ -0,0 +1,18 @@
+package handlers
+
+import (
+    "net/http"
+
+    "github.com/gin-gonic/gin"
+)
+
+// GetFeesHandler returns slow, normal and fast fee presets and the fee of each operation in ETH and fiat
+func (h *Handler) GetFeesHandler(c *gin.Context) {
+    estimate, err := h.FeeService.Estimate(c.Request.Context(), c.DefaultQuery("currency", "USD"))
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to estimate fees: " + err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, estimate)
+}
@@ -61,6 +61,12 @@ func (h *Handler) FiatToTokenHandler(c *gin.Context) {
         return
     }
 
+    // Preview the promo code; per-user conditions are checked when buying
+    promo, ok := h.applyPromoCode(c, c.Query("promo_code"), nil, fiatAmount, currency, cifoAmountFloat, ethPriceUSD, ethPriceIDR)
+    if !ok {
+        return
+    }
+
     // Format the response
     response := gin.H{
         "fiat_currency":  strings.ToUpper(currency),
@@ -79,5 +85,9 @@ func (h *Handler) FiatToTokenHandler(c *gin.Context) {
         },
     }
 
+    if promo != nil {
+        response["promo"] = promo
+    }
+
     c.JSON(http.StatusOK, response)
 }
\ No newline at end of file
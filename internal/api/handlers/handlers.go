@@ -51,6 +51,27 @@ type Handler struct {
 
 	WalletService    *services.WalletService  
     SwapService      *services.SwapService    
+    AdminService     *services.AdminService
+    LockoutService   *services.LockoutService
+    TxBuilderService *services.TxBuilderService
+    WalletDiscoveryService *services.WalletDiscoveryService
+    WalletTransferService  *services.WalletTransferService
+    TokenRegistryService   *services.TokenRegistryService
+    PortfolioService       *services.PortfolioService
+    AllowanceService       *services.AllowanceService
+    MessageSigningService  *services.MessageSigningService
+    FeeService             *services.FeeService
+    CryptoPaymentService   *services.CryptoPaymentService // Nil when crypto payments are disabled
+    SaleRoundService       *services.SaleRoundService
+    KYCService             *services.KYCService
+    AllowlistService       *services.AllowlistService
+    VestingService         *services.VestingService
+    ReferralService        *services.ReferralService
+    PromoService           *services.PromoService
+    InvoiceService         *services.InvoiceService
+    TaxExportService       *services.TaxExportService
+    EmailService           *services.EmailService
+    WebhookService         *services.WebhookService
 }
 
 // NewHandler creates a new Handler instance
@@ -64,7 +85,28 @@ func NewHandler(    db *gorm.DB,
     walletService *services.WalletService,
 	transakService *services.TransakService,activityLoggerService *services.ActivityLoggerService, walletStorageService *services.WalletStorageService,
 	encryptionService *services.EncryptionService,
-    swapService *services.SwapService) *Handler {
+    swapService *services.SwapService,
+    adminService *services.AdminService,
+    lockoutService *services.LockoutService,
+    txBuilderService *services.TxBuilderService,
+    walletDiscoveryService *services.WalletDiscoveryService,
+    walletTransferService *services.WalletTransferService,
+    tokenRegistryService *services.TokenRegistryService,
+    portfolioService *services.PortfolioService,
+    allowanceService *services.AllowanceService,
+    messageSigningService *services.MessageSigningService,
+    feeService *services.FeeService,
+    cryptoPaymentService *services.CryptoPaymentService,
+    saleRoundService *services.SaleRoundService,
+    kycService *services.KYCService,
+    allowlistService *services.AllowlistService,
+    vestingService *services.VestingService,
+    referralService *services.ReferralService,
+    promoService *services.PromoService,
+    invoiceService *services.InvoiceService,
+    taxExportService *services.TaxExportService,
+    emailService *services.EmailService,
+    webhookService *services.WebhookService) *Handler {
     return &Handler{
 		DB: 			   db,
         PriceService:          priceService,
@@ -78,6 +120,28 @@ func NewHandler(    db *gorm.DB,
 		ActivityLoggerService: activityLoggerService,
 		WalletStorageService: walletStorageService,
         EncryptionService:    encryptionService,
+        SwapService:          swapService,
+        AdminService:         adminService,
+        LockoutService:       lockoutService,
+        TxBuilderService:     txBuilderService,
+        WalletDiscoveryService: walletDiscoveryService,
+        WalletTransferService:  walletTransferService,
+        TokenRegistryService:   tokenRegistryService,
+        PortfolioService:       portfolioService,
+        AllowanceService:       allowanceService,
+        MessageSigningService:  messageSigningService,
+        FeeService:             feeService,
+        CryptoPaymentService:   cryptoPaymentService,
+        SaleRoundService:       saleRoundService,
+        KYCService:             kycService,
+        AllowlistService:       allowlistService,
+        VestingService:         vestingService,
+        ReferralService:        referralService,
+        PromoService:           promoService,
+        InvoiceService:         invoiceService,
+        TaxExportService:       taxExportService,
+        EmailService:           emailService,
+        WebhookService:         webhookService,
         exchangeRateCache:     make(map[string]float64),
         exchangeRateCacheTTL:  15 * time.Minute, // Cache rates for 15 minutes
         exchangeRateLastFetch: time.Time{},
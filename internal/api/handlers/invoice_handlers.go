@@ -0,0 +1,52 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/gin-gonic/gin"
+)
+
+// GetTransactionInvoiceHandler downloads the invoice PDF of one of the user's purchases
+func (h *Handler) GetTransactionInvoiceHandler(c *gin.Context) {
+    h.sendPurchaseDocument(c, models.InvoiceKindInvoice)
+}
+
+// GetTransactionReceiptHandler downloads the receipt PDF of one of the user's completed purchases
+func (h *Handler) GetTransactionReceiptHandler(c *gin.Context) {
+    h.sendPurchaseDocument(c, models.InvoiceKindReceipt)
+}
+
+// sendPurchaseDocument responds with the invoice or receipt of the purchase in the id parameter
+func (h *Handler) sendPurchaseDocument(c *gin.Context, kind string) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    id := c.Param("id")
+    var transaction models.Transaction
+    err := h.DB.Where("(payment_id = ? OR uuid::text = ?) AND user_id = ? AND token_amount > 0", id, id, user.UUID).
+        First(&transaction).Error
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Transaction not found"})
+        return
+    }
+
+    invoice, content, err := h.InvoiceService.Document(&transaction, kind)
+    if err != nil {
+        if errors.Is(err, services.ErrReceiptNotAvailable) {
+            c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+            return
+        }
+        log.Printf("Error generating %s of %s: %v", kind, transaction.PaymentID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate " + kind})
+        return
+    }
+
+    c.Header("Content-Disposition", `attachment; filename="`+invoice.Number+`.pdf"`)
+    c.Data(http.StatusOK, "application/pdf", content)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// StartKYCRequest applies for a KYC level, defaults to the next one
+type StartKYCRequest struct {
+    Level int `json:"level"`
+}
+
+// SetKYCLevelRequest sets a user's KYC level after a manual review
+type SetKYCLevelRequest struct {
+    Level *int `json:"level" binding:"required"`
+}
+
+// StartKYCHandler registers the user with the KYC provider and returns where to submit documents
+func (h *Handler) StartKYCHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req StartKYCRequest
+    if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+    if req.Level == 0 {
+        req.Level = user.KYCLevel + 1
+    }
+
+    check, verificationURL, err := h.KYCService.StartVerification(c.Request.Context(), user, req.Level)
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "kyc_start", "Failed to start KYC verification", "user", user.UUID.String(), "failure", err.Error())
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "kyc_start", fmt.Sprintf("Started KYC verification for level %d", req.Level), "user", user.UUID.String(), "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "check":            check,
+        "verification_url": verificationURL,
+    })
+}
+
+// GetKYCStatusHandler reports the user's KYC level, purchase limits and how much of them is used
+func (h *Handler) GetKYCStatusHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    ethPriceUSD, ethPriceIDR, err := h.GetEthPrices(c.Request.Context())
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ETH prices"})
+        return
+    }
+
+    status, err := h.KYCService.Status(user, ethPriceIDR/ethPriceUSD)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load KYC status"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"kyc": status})
+}
+
+// KYCWebhookHandler applies verification results pushed by the KYC provider
+func (h *Handler) KYCWebhookHandler(c *gin.Context) {
+    body, err := io.ReadAll(c.Request.Body)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+        return
+    }
+
+    check, err := h.KYCService.HandleWebhook(c.Request.Context(), c.Request.Header, body)
+    if err != nil {
+        log.Printf("KYC webhook rejected: %v", err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    log.Printf("KYC check %s for user %s is %s", check.ApplicantID, check.UserID, check.Status)
+    c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// AdminSetKYCLevelHandler sets a user's KYC level directly
+func (h *Handler) AdminSetKYCLevelHandler(c *gin.Context) {
+    id := c.Param("id")
+    userID, err := uuid.Parse(id)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+        return
+    }
+
+    var req SetKYCLevelRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Level required."})
+        return
+    }
+
+    if err := h.KYCService.SetLevel(userID, *req.Level); err != nil {
+        h.logAdminAction(c, "admin_set_kyc_level", "Admin set a KYC level", "user", id, err)
+        status := http.StatusBadRequest
+        if err.Error() == "user not found" {
+            status = http.StatusNotFound
+        }
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_set_kyc_level", fmt.Sprintf("Admin set KYC level %d", *req.Level), "user", id, nil)
+
+    c.JSON(http.StatusOK, gin.H{"message": "KYC level updated", "level": *req.Level})
+}
+
+// kycCheck is the purchase step that keeps the transaction within its user's KYC limits,
+// converting IDR at the ratio of the ETH prices
+func (h *Handler) kycCheck(transaction *models.Transaction, ethPriceUSD, ethPriceIDR float64) func(tx *gorm.DB) error {
+    return func(tx *gorm.DB) error {
+        return h.KYCService.CheckPurchase(tx, transaction, ethPriceIDR/ethPriceUSD)
+    }
+}
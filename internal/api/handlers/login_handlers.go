@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/gin-gonic/gin"
@@ -36,6 +37,11 @@ type RefreshTokenRequest struct {
     RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
+// UnlockAccountRequest represents a request to unlock an account with an emailed token
+type UnlockAccountRequest struct {
+    Token string `json:"token" binding:"required"`
+}
+
 // LogoutRequest represents a request to logout (invalidate tokens)
 type LogoutRequest struct {
     RefreshToken string `json:"refresh_token" binding:"required"`
@@ -56,10 +62,15 @@ func (h *Handler) LoginHandler(c *gin.Context) {
         return
     }
 
+    // Refuse locked accounts before checking credentials
+    if h.rejectIfLocked(c, &user) {
+        return
+    }
+
     // Verify password
     err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+        h.handleAuthFailure(c, &user, "login", "Invalid username or password")
         return
     }
 
@@ -82,6 +93,11 @@ func (h *Handler) LoginHandler(c *gin.Context) {
         return
     }
 
+    // Clear failed attempts now that the user is fully authenticated
+    if err := h.LockoutService.RegisterSuccess(&user); err != nil {
+        log.Printf("Failed to reset lockout state for %s: %v", user.Username, err)
+    }
+
     // Update last login time
     h.DB.Model(&user).Updates(map[string]interface{}{
         "updated_at":    time.Now(),
@@ -89,7 +105,7 @@ func (h *Handler) LoginHandler(c *gin.Context) {
     })
 
     // Generate a JWT token
-    token, err := h.TokenService.GenerateToken(user.UUID, user.Username, user.WalletAddress)
+    token, err := h.TokenService.GenerateToken(user.UUID, user.Username, user.WalletAddress, user.GetRole(), user.PermissionList())
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
         return
@@ -105,7 +121,7 @@ func (h *Handler) LoginHandler(c *gin.Context) {
     // Calculate expiry time
     expiresAt := time.Now().Add(h.TokenService.GetConfig().TokenDuration)
     
-    h.ActivityLoggerService.LogFromRequest(c, "login", "User successfully logged in", "user", user.Username, "success", "")
+    h.recordSignIn(c, &user)
 
     // Return user data with tokens
     c.JSON(http.StatusOK, LoginResponse{
@@ -118,6 +134,62 @@ func (h *Handler) LoginHandler(c *gin.Context) {
     })
 }
 
+// UnlockAccountHandler unlocks an account using the token sent in the lockout email
+func (h *Handler) UnlockAccountHandler(c *gin.Context) {
+    var req UnlockAccountRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Token required."})
+        return
+    }
+
+    user, err := h.LockoutService.UnlockWithToken(req.Token)
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired unlock token"})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "unlock_account", "User unlocked their account via email", "user", user.Username, "success", "")
+
+    c.JSON(http.StatusOK, gin.H{"message": "Account unlocked. You can now log in."})
+}
+
+// rejectIfLocked responds with 423 and returns true when the account is locked
+func (h *Handler) rejectIfLocked(c *gin.Context, user *models.User) bool {
+    locked, remaining := h.LockoutService.IsLocked(user)
+    if !locked {
+        return false
+    }
+
+    c.JSON(http.StatusLocked, gin.H{
+        "error":       "Account is temporarily locked due to too many failed attempts. Check your email to unlock it.",
+        "retry_after": int(remaining.Seconds()) + 1,
+    })
+    return true
+}
+
+// handleAuthFailure records a failed credential check and responds, locking the account when needed
+func (h *Handler) handleAuthFailure(c *gin.Context, user *models.User, action, message string) {
+    lockedUntil, err := h.LockoutService.RegisterFailure(user)
+    if err != nil {
+        log.Printf("Failed to record auth failure for %s: %v", user.Username, err)
+    }
+
+    if lockedUntil != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "account_locked",
+            fmt.Sprintf("Account locked until %s after repeated failed %s attempts", lockedUntil.UTC().Format(time.RFC3339), action),
+            "user", user.Username, "failure", message)
+
+        c.JSON(http.StatusLocked, gin.H{
+            "error":       "Account is temporarily locked due to too many failed attempts. Check your email to unlock it.",
+            "retry_after": int(time.Until(*lockedUntil).Seconds()) + 1,
+        })
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, action, "Failed authentication attempt", "user", user.Username, "failure", message)
+    c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
 func (h *Handler) GetAccountBalanceHandler(c *gin.Context) {
 	address := c.Param("address")
 	if address == "" {
@@ -204,7 +276,7 @@ func (h *Handler) RefreshTokenHandler(c *gin.Context) {
     h.DB.Model(&user).Update("last_activity", time.Now())
 
     // Generate new access token
-    newToken, err := h.TokenService.GenerateToken(user.UUID, user.Username, user.WalletAddress)
+    newToken, err := h.TokenService.GenerateToken(user.UUID, user.Username, user.WalletAddress, user.GetRole(), user.PermissionList())
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate new token"})
         return
@@ -248,3 +320,21 @@ func (h *Handler) GetEthereumNodeURL() string {
 	return "https://geth-geth.ede2390e1937cf50.dyndns.dappnode.io"	
 }
 
+// recordSignIn logs a successful sign-in and alerts the user when it came from a new IP address
+func (h *Handler) recordSignIn(c *gin.Context, user *models.User) {
+    newLocation, err := h.ActivityLoggerService.RecordSignIn(c, user)
+    if err != nil {
+        log.Printf("Failed to record sign-in for %s: %v", user.Username, err)
+        return
+    }
+    if newLocation {
+        h.sendSecurityAlert(c, user, services.SecurityEventNewSignIn)
+    }
+}
+
+// sendSecurityAlert emails the user about a security-relevant change made from this request
+func (h *Handler) sendSecurityAlert(c *gin.Context, user *models.User, event string) {
+    if err := h.EmailService.SendSecurityAlert(user, event, c.ClientIP(), c.Request.UserAgent()); err != nil {
+        log.Printf("Failed to send %s alert to %s: %v", event, user.Username, err)
+    }
+}
@@ -126,7 +126,16 @@ func (h *Handler) ProcessMidtransWebhookHandler(c *gin.Context) {
                     transaction.Status = models.TransactionStatusFailed
                     transaction.ErrorMessage = fmt.Sprintf("Blockchain error: %v", err)
                     h.DB.Save(&transaction)
+                    return
                 }
+
+                // Tokens were delivered, which also starts the vesting of vesting purchases
+                completedAt := time.Now()
+                transaction.Status = models.TransactionStatusCompleted
+                transaction.BlockchainCompleted = true
+                transaction.CompletedAt = &completedAt
+                transaction.UpdatedAt = completedAt
+                h.DB.Save(&transaction)
             }()
         }
         
@@ -149,6 +158,12 @@ func (h *Handler) ProcessMidtransWebhookHandler(c *gin.Context) {
 
 // CreateMidtransPaymentHandler creates a new Midtrans payment session
 func (h *Handler) CreateMidtransPaymentHandler(c *gin.Context) {
+	// Purchases count towards the user's KYC limits
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
 	// Get parameters from request
 	var req struct {
 		DestinationAddress string  `json:"destination_address"`
@@ -158,6 +173,7 @@ func (h *Handler) CreateMidtransPaymentHandler(c *gin.Context) {
 		Phone              string  `json:"phone"`  // Customer phone
 		CallbackURL        string  `json:"callback_url"`
 		RedirectURL        string  `json:"redirect_url"`
+		PromoCode          string  `json:"promo_code"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -169,7 +185,13 @@ func (h *Handler) CreateMidtransPaymentHandler(c *gin.Context) {
 
 	// Set defaults if not provided
 	if req.DestinationAddress == "" {
-		req.DestinationAddress = h.PriceService.GetTokenAddress().Hex()
+		req.DestinationAddress = user.WalletAddress
+	}
+	if !common.IsHexAddress(req.DestinationAddress) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid destination address",
+		})
+		return
 	}
 
 	if req.Amount <= 0 {
@@ -177,7 +199,7 @@ func (h *Handler) CreateMidtransPaymentHandler(c *gin.Context) {
 	}
 
 	// Get current ETH prices
-	_, ethPriceIDR, err := h.GetEthPrices(c.Request.Context())
+	ethPriceUSD, ethPriceIDR, err := h.GetEthPrices(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to fetch ETH price",
@@ -199,9 +221,61 @@ func (h *Handler) CreateMidtransPaymentHandler(c *gin.Context) {
 		return
 	}
 
+	// Price at the active sale round when rounds are configured
+	round, ok := h.activeSaleRound(c)
+	if !ok {
+		return
+	}
+	if round != nil {
+		cifoAmount = fmt.Sprintf("%.8f", roundTokenAmount(round, req.Amount*ethPriceUSD))
+	}
+
+	cifoAmountFloat, err := strconv.ParseFloat(cifoAmount, 64)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to parse CIFO amount",
+		})
+		return
+	}
+
+	// Apply the promo code's discount or bonus
+	promo, ok := h.applyPromoCode(c, req.PromoCode, &user.UUID, float64(amountInIDR), "idr", cifoAmountFloat, ethPriceUSD, ethPriceIDR)
+	if !ok {
+		return
+	}
+	if promo != nil {
+		amountInIDR = int64(promo.FiatAmount)
+		cifoAmountFloat = promo.TokenAmount
+		cifoAmount = fmt.Sprintf("%.8f", cifoAmountFloat)
+	}
+
 	// Generate a unique order ID
 	orderID := fmt.Sprintf("CIFO-%d", time.Now().UnixNano())
 
+	// Record the order so the notification can settle it, within the sale round's caps and limits
+	transaction := models.Transaction{
+		UUID:               uuid.New(),
+		UserID:             user.UUID,
+		PaymentID:          orderID,
+		WalletAddress:      req.DestinationAddress,
+		FiatCurrency:       "IDR",
+		FiatAmount:         float64(amountInIDR),
+		EthAmount:          req.Amount,
+		TokenAmount:        cifoAmountFloat,
+		TokenSymbol:        "CIFO",
+		Status:             models.TransactionStatusPending,
+		PaymentMethod:      "midtrans",
+		EthPriceAtPurchase: ethPriceIDR,
+		TransactionType:    "send",
+		SwapType:           "",
+		CreatedAt:          time.Now(),
+		UpdatedAt:          time.Now(),
+	}
+	promo.Apply(&transaction)
+	if !h.createPurchase(c, &transaction, ethPriceUSD, ethPriceIDR) {
+		return
+	}
+
 	// Create Midtrans payment request
 	midtransURL := "https://api.midtrans.com/v2/charge"
 	if os.Getenv("APP_ENV") != "production" {
@@ -275,6 +349,7 @@ func (h *Handler) CreateMidtransPaymentHandler(c *gin.Context) {
 	client := &http.Client{}
 	resp, err := client.Do(httpReq)
 	if err != nil {
+		h.failMidtransOrder(&transaction, err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to connect to payment gateway",
 			"details": err.Error(),
@@ -301,9 +376,6 @@ func (h *Handler) CreateMidtransPaymentHandler(c *gin.Context) {
 		return
 	}
 
-	// Store payment information in database (not implemented here)
-	// This would typically include order ID, destination address, amount, etc.
-
 	// Return payment details to client
 	c.JSON(http.StatusOK, gin.H{
 		"order_id": orderID,
@@ -319,9 +391,20 @@ func (h *Handler) CreateMidtransPaymentHandler(c *gin.Context) {
 			"eth_price_idr": ethPriceIDR,
 			"idr_amount":    formatIDRPrice(float64(amountInIDR), false),
 		},
+		"promo": promo,
 	})
 }
 
+// failMidtransOrder marks an order failed when the charge never reached Midtrans
+func (h *Handler) failMidtransOrder(transaction *models.Transaction, err error) {
+	transaction.Status = models.TransactionStatusFailed
+	transaction.ErrorMessage = fmt.Sprintf("Midtrans charge failed: %v", err)
+	transaction.UpdatedAt = time.Now()
+	if err := h.DB.Save(transaction).Error; err != nil {
+		log.Printf("Error marking Midtrans order %s failed: %v", transaction.PaymentID, err)
+	}
+}
+
 // Helper function to verify Midtrans signature
 func verifyMidtransSignature(notification MidtransNotification, serverKey string) bool {
 	// In a real implementation, you would verify the signature here
@@ -753,6 +836,13 @@ func (h *Handler) CreateMidtransToTransakHandler(c *gin.Context) {
         return
     }
     
+    // ETH prices convert IDR amounts for the KYC limits
+    ethPriceUSD, ethPriceIDR, err := h.GetEthPrices(c.Request.Context())
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch ETH prices"})
+        return
+    }
+    
     // Create transaction record
     txUUID := uuid.New()
     orderID := fmt.Sprintf("MIDTRANS-TRANSAK-%s", txUUID.String()[:8])
@@ -785,10 +875,8 @@ func (h *Handler) CreateMidtransToTransakHandler(c *gin.Context) {
 		UpdatedAt:          time.Now(),
 	}
     
-    // Save transaction to database
-    if err := h.DB.Create(&transaction).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction record"})
-        log.Printf("Error creating transaction: %v", err)
+    // Save transaction to database within the sale round's caps and limits
+    if !h.createPurchase(c, &transaction, ethPriceUSD, ethPriceIDR) {
         return
     }
     
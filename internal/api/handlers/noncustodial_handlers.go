@@ -0,0 +1,467 @@
+package handlers
+
+import (
+    "fmt"
+    "math/big"
+    "net/http"
+    "strconv"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum/accounts"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/common/hexutil"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+    "golang.org/x/crypto/bcrypt"
+    "gorm.io/gorm"
+)
+
+// walletLinkChallengeTTL is how long a signed wallet link message stays valid
+const walletLinkChallengeTTL = 10 * time.Minute
+
+// UpdateCustodyModeRequest represents a request to switch custody mode
+type UpdateCustodyModeRequest struct {
+    Mode     string `json:"mode" binding:"required"`
+    Password string `json:"password" binding:"required"`
+}
+
+// LinkWalletRequest represents a request to link an externally held wallet
+type LinkWalletRequest struct {
+    Address   string `json:"address" binding:"required"`
+    Signature string `json:"signature" binding:"required"`
+    Timestamp int64  `json:"timestamp" binding:"required"`
+}
+
+// BuildTransferTxRequest represents a request for an unsigned transfer
+type BuildTransferTxRequest struct {
+    From      string `json:"from"` // Account address, ID or label; defaults to the default account
+    Token     string `json:"token" binding:"required"` // ETH, CIFO, WETH or token address
+    ToAddress string `json:"to_address" binding:"required"`
+    Amount    string `json:"amount" binding:"required"` // Smallest unit (wei)
+}
+
+// BuildApproveTxRequest represents a request for an unsigned approval
+type BuildApproveTxRequest struct {
+    From    string `json:"from"`
+    Token   string `json:"token" binding:"required"`
+    Spender string `json:"spender" binding:"required"`
+    Amount  string `json:"amount" binding:"required"`
+}
+
+// BuildSwapTxRequest represents a request for unsigned swap transactions
+type BuildSwapTxRequest struct {
+    From              string  `json:"from"`
+    FromToken         string  `json:"from_token" binding:"required"`
+    ToToken           string  `json:"to_token" binding:"required"`
+    Amount            string  `json:"amount" binding:"required"`
+    SlippageTolerance float64 `json:"slippage_tolerance"`
+}
+
+// BroadcastTxRequest represents a client-signed raw transaction
+type BroadcastTxRequest struct {
+    RawTx string `json:"raw_tx" binding:"required"`
+}
+
+// UpdateCustodyModeHandler switches the user between custodial and non-custodial mode.
+// Switching to non-custodial deletes every key the server holds for the user.
+func (h *Handler) UpdateCustodyModeHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req UpdateCustodyModeRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Mode and password required."})
+        return
+    }
+
+    if req.Mode != models.CustodyModeCustodial && req.Mode != models.CustodyModeNonCustodial {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be custodial or non_custodial"})
+        return
+    }
+
+    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+        return
+    }
+
+    // The mode change only commits once the credentials are gone, so a failure on either side
+    // leaves the user in the previous mode with their keys intact
+    err := h.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(user).Updates(map[string]interface{}{
+            "custody_mode": req.Mode,
+            "updated_at":   time.Now(),
+        }).Error; err != nil {
+            return fmt.Errorf("failed to update custody mode: %w", err)
+        }
+
+        if req.Mode == models.CustodyModeNonCustodial && h.WalletStorageService != nil {
+            if err := h.WalletStorageService.DeleteAllUserCredentials(user.UUID); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update custody mode"})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "update_custody_mode",
+        fmt.Sprintf("User switched to %s mode", req.Mode),
+        "user", user.Username, "success", "")
+
+    response := gin.H{
+        "message":      "Custody mode updated",
+        "custody_mode": req.Mode,
+    }
+    if req.Mode == models.CustodyModeNonCustodial {
+        response["notice"] = "Stored wallet credentials were deleted. Keep your own backup of your keys."
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// GetWalletLinkChallengeHandler returns the message a user signs to prove wallet ownership
+func (h *Handler) GetWalletLinkChallengeHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    timestamp := time.Now().Unix()
+    c.JSON(http.StatusOK, gin.H{
+        "message":    walletLinkMessage(user.Username, timestamp),
+        "timestamp":  timestamp,
+        "expires_in": int(walletLinkChallengeTTL.Seconds()),
+    })
+}
+
+// LinkWalletHandler links an externally held wallet after verifying a personal_sign signature
+func (h *Handler) LinkWalletHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req LinkWalletRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Address, signature and timestamp required."})
+        return
+    }
+
+    if !common.IsHexAddress(req.Address) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wallet address"})
+        return
+    }
+
+    if age := time.Since(time.Unix(req.Timestamp, 0)); age < 0 || age > walletLinkChallengeTTL {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Challenge expired. Request a new one."})
+        return
+    }
+
+    address := common.HexToAddress(req.Address)
+    if !verifyPersonalSignature(address, walletLinkMessage(user.Username, req.Timestamp), req.Signature) {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Signature does not match wallet address"})
+        return
+    }
+
+    // An address can only belong to one account
+    var count int64
+    h.DB.Model(&models.Wallet{}).Where("LOWER(wallet_address) = LOWER(?) AND user_id <> ?", address.Hex(), user.UUID).Count(&count)
+    if count > 0 {
+        c.JSON(http.StatusConflict, gin.H{"error": "Wallet is already linked to another account"})
+        return
+    }
+
+    owned, err := h.TxBuilderService.UserOwnsAddress(user.UUID, address)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check wallet ownership"})
+        return
+    }
+
+    if !owned {
+        wallet := models.Wallet{
+            UUID:          uuid.New(),
+            UserID:        user.UUID,
+            WalletAddress: address.Hex(),
+            Label:         "External " + address.Hex()[:8],
+            IsDefault:     user.WalletAddress == "",
+            CreatedAt:     time.Now(),
+            UpdatedAt:     time.Now(),
+        }
+        if err := h.DB.Create(&wallet).Error; err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link wallet"})
+            return
+        }
+    }
+
+    if user.WalletAddress == "" {
+        h.DB.Model(user).Updates(map[string]interface{}{
+            "wallet_address": address.Hex(),
+            "updated_at":     time.Now(),
+        })
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "link_wallet", "User linked an external wallet", "wallet", address.Hex(), "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":        "Wallet linked successfully",
+        "wallet_address": address.Hex(),
+    })
+}
+
+// BuildTransferTxHandler returns an unsigned ETH or ERC-20 transfer
+func (h *Handler) BuildTransferTxHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req BuildTransferTxRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    from, ok := h.resolveFromAddress(c, user, req.From)
+    if !ok {
+        return
+    }
+
+    if !common.IsHexAddress(req.ToAddress) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipient address"})
+        return
+    }
+
+    amount, ok := parseWeiAmount(c, req.Amount)
+    if !ok {
+        return
+    }
+
+    tx, err := h.TxBuilderService.BuildTransfer(c.Request.Context(), from, req.Token, common.HexToAddress(req.ToAddress), amount)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to build transfer: %v", err)})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"transactions": []interface{}{tx}})
+}
+
+// BuildApproveTxHandler returns an unsigned ERC-20 approval
+func (h *Handler) BuildApproveTxHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req BuildApproveTxRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    from, ok := h.resolveFromAddress(c, user, req.From)
+    if !ok {
+        return
+    }
+
+    if !common.IsHexAddress(req.Spender) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid spender address"})
+        return
+    }
+
+    amount, ok := parseWeiAmount(c, req.Amount)
+    if !ok {
+        return
+    }
+
+    tx, err := h.TxBuilderService.BuildApprove(c.Request.Context(), from, req.Token, common.HexToAddress(req.Spender), amount)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to build approval: %v", err)})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"transactions": []interface{}{tx}})
+}
+
+// BuildSwapTxHandler returns the unsigned transactions for a Uniswap swap
+func (h *Handler) BuildSwapTxHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req BuildSwapTxRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    from, ok := h.resolveFromAddress(c, user, req.From)
+    if !ok {
+        return
+    }
+
+    amount, ok := parseWeiAmount(c, req.Amount)
+    if !ok {
+        return
+    }
+
+    // Use a default slippage tolerance if not provided
+    if req.SlippageTolerance <= 0 {
+        req.SlippageTolerance = 0.5
+    }
+    if req.SlippageTolerance >= 50 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Slippage tolerance must be below 50%"})
+        return
+    }
+
+    txs, err := h.TxBuilderService.BuildSwap(c.Request.Context(), from, req.FromToken, req.ToToken, amount, req.SlippageTolerance)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to build swap: %v", err)})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "transactions": txs,
+        "notice":       "Sign and broadcast the transactions in order",
+    })
+}
+
+// BroadcastSignedTxHandler broadcasts a client-signed transaction and starts tracking it
+func (h *Handler) BroadcastSignedTxHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req BroadcastTxRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Signed raw transaction required."})
+        return
+    }
+
+    walletTx, err := h.TxBuilderService.Broadcast(c.Request.Context(), user.UUID, req.RawTx)
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "broadcast_tx", "User broadcast a signed transaction", "wallet", user.WalletAddress, "failure", err.Error())
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "broadcast_tx", "User broadcast a signed transaction", "wallet_transaction", walletTx.TxHash, "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":     "Transaction broadcast",
+        "transaction": walletTx,
+    })
+}
+
+// GetWalletTxStatusHandler returns the tracked status of a wallet transaction
+func (h *Handler) GetWalletTxStatusHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    walletTx, err := h.TxBuilderService.RefreshStatus(c.Request.Context(), user.UUID, c.Param("hash"))
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"transaction": walletTx})
+}
+
+// currentUser loads the authenticated user, writing an error response on failure
+func (h *Handler) currentUser(c *gin.Context) (*models.User, bool) {
+    userID, exists := c.Get("user_id")
+    if !exists {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+        return nil, false
+    }
+
+    var user models.User
+    if result := h.DB.Where("uuid = ?", userID).First(&user); result.Error != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        return nil, false
+    }
+
+    return &user, true
+}
+
+// rejectNonCustodial responds with 403 and returns true for users in non-custodial mode, or
+// with 500 when the mode cannot be read
+func (h *Handler) rejectNonCustodial(c *gin.Context, userID uuid.UUID) bool {
+    var user models.User
+    if err := h.DB.Select("custody_mode").Where("uuid = ?", userID).First(&user).Error; err != nil {
+        // Fail closed: never sign with server-held keys when the mode is unknown
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check custody mode"})
+        return true
+    }
+    if !user.IsNonCustodial() {
+        return false
+    }
+
+    c.JSON(http.StatusForbidden, gin.H{
+        "error": "This account is non-custodial. Build the transaction with /wallet/tx/build/* and sign it in your wallet.",
+    })
+    return true
+}
+
+// resolveFromAddress picks the sending account by address, account ID or label,
+// defaulting to the user's wallet
+func (h *Handler) resolveFromAddress(c *gin.Context, user *models.User, requested string) (common.Address, bool) {
+    if requested == "" {
+        if user.WalletAddress == "" || !common.IsHexAddress(user.WalletAddress) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "No wallet address associated with this account"})
+            return common.Address{}, false
+        }
+        return common.HexToAddress(user.WalletAddress), true
+    }
+
+    wallet, err := h.WalletService.ResolveAccount(user.UUID, requested)
+    if err != nil {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Address is not linked to this account"})
+        return common.Address{}, false
+    }
+
+    return common.HexToAddress(wallet.WalletAddress), true
+}
+
+// parseWeiAmount parses a positive base-10 integer amount
+func parseWeiAmount(c *gin.Context, value string) (*big.Int, bool) {
+    amount, ok := new(big.Int).SetString(value, 10)
+    if !ok || amount.Sign() <= 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Amount must be a positive integer in the token's smallest unit"})
+        return nil, false
+    }
+    return amount, true
+}
+
+// walletLinkMessage is the message signed to link a wallet
+func walletLinkMessage(username string, timestamp int64) string {
+    return "Link this wallet to Web3 Tokensale account " + username + "\nTimestamp: " + strconv.FormatInt(timestamp, 10)
+}
+
+// verifyPersonalSignature checks a personal_sign signature over message against address
+func verifyPersonalSignature(address common.Address, message, signatureHex string) bool {
+    signature, err := hexutil.Decode(signatureHex)
+    if err != nil || len(signature) != 65 {
+        return false
+    }
+
+    // Normalise the 27/28 recovery id
+    if signature[64] >= 27 {
+        signature[64] -= 27
+    }
+
+    pubKey, err := crypto.SigToPub(accounts.TextHash([]byte(message)), signature)
+    if err != nil {
+        return false
+    }
+
+    return crypto.PubkeyToAddress(*pubKey) == address
+}
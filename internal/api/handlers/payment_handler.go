@@ -116,6 +116,15 @@ func (h *Handler) CreateFiatToTokenPaymentHandler(c *gin.Context) {
         return
     }
 
+    // Price at the active sale round when rounds are configured
+    round, ok := h.activeSaleRound(c)
+    if !ok {
+        return
+    }
+    if round != nil {
+        tokenAmountFloat = roundTokenAmount(round, ethAmount*ethPriceUSD)
+    }
+
     gasDeposit, err := h.BlockchainService.PaymentGateway.GetRequiredGasDeposit(context.Background())
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get gas deposit"})
@@ -164,10 +173,8 @@ func (h *Handler) CreateFiatToTokenPaymentHandler(c *gin.Context) {
         UpdatedAt:          time.Now(),
     }
 
-    // Save transaction to database
-    if err := h.DB.Create(&transaction).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction record"})
-        log.Printf("Error creating transaction: %v", err)
+    // Save transaction to database within the sale round's caps and limits
+    if !h.createPurchase(c, &transaction, ethPriceUSD, ethPriceIDR) {
         return
     }
 
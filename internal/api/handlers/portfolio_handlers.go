@@ -0,0 +1,153 @@
+package handlers
+
+import (
+    "net/http"
+    "strings"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/gin-gonic/gin"
+)
+
+// UpdatePreferredCurrencyRequest represents a request to change the portfolio valuation currency
+type UpdatePreferredCurrencyRequest struct {
+    Currency string `json:"currency" binding:"required"`
+}
+
+// RegisterTokenRequest represents a request to add a token to the registry
+type RegisterTokenRequest struct {
+    Address string `json:"address" binding:"required"`
+    services.TokenInput
+}
+
+// GetPortfolioHandler returns ETH and registered token balances of all the user's wallets with fiat values
+func (h *Handler) GetPortfolioHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    currency := c.Query("currency")
+    if currency == "" {
+        currency = user.PreferredCurrency
+    }
+
+    portfolio, err := h.PortfolioService.GetPortfolio(c.Request.Context(), user.UUID, currency, c.Query("include_zero") == "true")
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "view_portfolio",
+            "User viewed wallet portfolio",
+            "wallet", user.WalletAddress,
+            "failure", err.Error())
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load portfolio: " + err.Error()})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "view_portfolio",
+        "User viewed wallet portfolio",
+        "wallet", user.WalletAddress,
+        "success", "")
+
+    c.JSON(http.StatusOK, portfolio)
+}
+
+// UpdatePreferredCurrencyHandler sets the fiat currency the user's portfolio is valued in
+func (h *Handler) UpdatePreferredCurrencyHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req UpdatePreferredCurrencyRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Currency required."})
+        return
+    }
+
+    currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+    if _, err := h.PriceService.GetFiatRate(c.Request.Context(), currency); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported currency: " + currency})
+        return
+    }
+
+    if err := h.DB.Model(user).Update("preferred_currency", currency).Error; err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferred currency"})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "update_currency",
+        "User changed preferred currency to "+currency,
+        "user", user.UUID.String(),
+        "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":            "Preferred currency updated",
+        "preferred_currency": currency,
+    })
+}
+
+// ListTokensHandler lists the tokens shown in wallet portfolios
+func (h *Handler) ListTokensHandler(c *gin.Context) {
+    tokens, err := h.TokenRegistryService.ListTokens(false)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tokens"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// AdminListTokensHandler lists all registered tokens, including disabled ones
+func (h *Handler) AdminListTokensHandler(c *gin.Context) {
+    tokens, err := h.TokenRegistryService.ListTokens(true)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list tokens"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// AdminRegisterTokenHandler adds a token to the registry
+func (h *Handler) AdminRegisterTokenHandler(c *gin.Context) {
+    var req RegisterTokenRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Address required."})
+        return
+    }
+
+    token, err := h.TokenRegistryService.RegisterToken(c.Request.Context(), req.Address, req.TokenInput)
+    if err != nil {
+        h.logAdminAction(c, "admin_register_token", "Admin registered a token", "token", req.Address, err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_register_token", "Admin registered token "+token.Symbol, "token", token.Address, nil)
+
+    c.JSON(http.StatusCreated, gin.H{"token": token})
+}
+
+// AdminUpdateTokenHandler changes a token's metadata, price source or visibility
+func (h *Handler) AdminUpdateTokenHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    var req services.TokenInput
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    token, err := h.TokenRegistryService.UpdateToken(id, req)
+    if err != nil {
+        h.logAdminAction(c, "admin_update_token", "Admin updated a token", "token", id, err)
+        status := http.StatusBadRequest
+        if err.Error() == "token not found" {
+            status = http.StatusNotFound
+        }
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_update_token", "Admin updated token "+token.Symbol, "token", token.Address, nil)
+
+    c.JSON(http.StatusOK, gin.H{"token": token})
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/gin-gonic/gin"
+    "github.com/google/uuid"
+)
+
+// AdminListPromoCodesHandler lists every promo code with its redemption count
+func (h *Handler) AdminListPromoCodesHandler(c *gin.Context) {
+    codes, err := h.PromoService.ListCodes()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list promo codes"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"promo_codes": codes})
+}
+
+// AdminCreatePromoCodeHandler creates a promo code
+func (h *Handler) AdminCreatePromoCodeHandler(c *gin.Context) {
+    var input services.PromoCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    promo, err := h.PromoService.CreateCode(input)
+    if err != nil {
+        h.logAdminAction(c, "admin_create_promo_code", "Admin created a promo code", "promo_code", "", err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_create_promo_code", "Admin created promo code "+promo.Code, "promo_code", promo.UUID.String(), nil)
+
+    c.JSON(http.StatusCreated, gin.H{"promo_code": promo})
+}
+
+// AdminUpdatePromoCodeHandler updates a promo code by UUID or code
+func (h *Handler) AdminUpdatePromoCodeHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    var input services.PromoCodeInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    promo, err := h.PromoService.UpdateCode(id, input)
+    if err != nil {
+        h.logAdminAction(c, "admin_update_promo_code", "Admin updated a promo code", "promo_code", id, err)
+        status := http.StatusBadRequest
+        if err.Error() == "promo code not found" {
+            status = http.StatusNotFound
+        }
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_update_promo_code", "Admin updated promo code "+promo.Code, "promo_code", promo.UUID.String(), nil)
+
+    c.JSON(http.StatusOK, gin.H{"promo_code": promo})
+}
+
+// applyPromoCode prices a purchase with the promo code, returning a nil quote when no code is given.
+// It responds and returns false when the code cannot be used.
+func (h *Handler) applyPromoCode(c *gin.Context, code string, userID *uuid.UUID, fiatAmount float64, fiatCurrency string, tokenAmount, ethPriceUSD, ethPriceIDR float64) (*services.PromoQuote, bool) {
+    if code == "" {
+        return nil, true
+    }
+
+    quote, err := h.PromoService.Quote(code, userID, fiatAmount, fiatCurrency, ethPriceIDR/ethPriceUSD, tokenAmount)
+    if err != nil {
+        if errors.Is(err, services.ErrPromoCodeRejected) || errors.Is(err, services.ErrPurchaseRejected) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return nil, false
+        }
+        log.Printf("Error applying promo code %s: %v", code, err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply promo code"})
+        return nil, false
+    }
+    return quote, true
+}
+
+// deliverPromoBonus sends the promo bonus of a completed swap purchase; failures are retried in the background
+func (h *Handler) deliverPromoBonus(transaction *models.Transaction) {
+    if err := h.PromoService.DeliverBonus(transaction); err != nil {
+        log.Printf("Promo bonus of %s not delivered: %v", transaction.PaymentID, err)
+    }
+}
@@ -147,11 +147,18 @@ func (h *Handler) PurchaseCifoHandler(c *gin.Context) {
         gasFeeFiat = gasDepositFloat * ethPriceIDR
     }
 
+    uid, err := uuid.Parse(userID.(string))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+        return
+    }
+
     txUUID := uuid.New()
     orderID := fmt.Sprintf("CIFO-%s", txUUID.String()[:8])
 
     transaction := models.Transaction{
         UUID:               txUUID,
+        UserID:             uid,
         PaymentID:          orderID,
         WalletAddress:      req.DestinationWallet,
         FiatCurrency:       strings.ToUpper(req.FiatCurrency),
@@ -171,10 +178,8 @@ func (h *Handler) PurchaseCifoHandler(c *gin.Context) {
         UpdatedAt:          time.Now(),
     }
 
-	    // Save transaction to database
-    if err := h.DB.Create(&transaction).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction record"})
-        log.Printf("Error creating transaction: %v", err)
+	    // Save transaction to database within the sale round's caps and limits
+    if !h.createPurchase(c, &transaction, ethPriceUSD, ethPriceIDR) {
         return
     }
 
@@ -2,6 +2,7 @@ package handlers
 
 import (
     "fmt"
+    "log"
     "net/http"
     "time"
 
@@ -14,11 +15,31 @@ import (
 // EnableWalletBackupRequest represents a request to enable wallet backup
 type EnableWalletBackupRequest struct {
     Password string `json:"password" binding:"required"`
+    Account  string `json:"account"` // Address, account ID or label; defaults to the default account
 }
 
 // RecoverWalletRequest represents a request to recover wallet credentials
 type RecoverWalletRequest struct {
     Password string `json:"password" binding:"required"`
+    Account  string `json:"account"`
+}
+
+// CreateShareBackupRequest represents a request to split a wallet mnemonic into Shamir shares
+type CreateShareBackupRequest struct {
+    Password   string `json:"password" binding:"required"`
+    Account    string `json:"account"`     // Address, account ID or label; defaults to the default account
+    Threshold  int    `json:"threshold"`   // Shares needed to recover, default 2
+    Shares     int    `json:"shares"`      // Total shares, default 3
+    EmailShare *bool  `json:"email_share"` // Send one share by email, default true
+}
+
+// RecoverFromSharesRequest represents a request to rebuild a mnemonic from Shamir shares
+type RecoverFromSharesRequest struct {
+    Account       string   `json:"account"`
+    Shares        []string `json:"shares" binding:"required"`
+    Password      string   `json:"password" binding:"required"`
+    TOTPCode      string   `json:"totp_code"`       // Required when 2FA is enabled
+    UseVaultShare bool     `json:"use_vault_share"` // Add the server's share when the user holds one too few
 }
 
 // EnableWalletBackupHandler enables wallet credential backup for a user
@@ -54,15 +75,20 @@ func (h *Handler) EnableWalletBackupHandler(c *gin.Context) {
         return
     }
 
-    // Ensure user has a wallet address
-    if user.WalletAddress == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "No wallet associated with this account"})
+    if user.IsNonCustodial() {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Wallet backups are not available for non-custodial accounts"})
+        return
+    }
+
+    // Pick the requested account, or the default one
+    walletAddress, ok := h.selectedWalletAddress(c, &user, req.Account)
+    if !ok {
         return
     }
 
     // Check if credentials are already stored
     uid, _ := uuid.Parse(userID.(string))
-    hasCredentials := h.WalletService.HasStoredCredentials(uid, user.WalletAddress)
+    hasCredentials := h.WalletService.HasStoredCredentials(uid, walletAddress)
     if hasCredentials {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Wallet backup already enabled"})
         return
@@ -130,34 +156,162 @@ func (h *Handler) RecoverWalletHandler(c *gin.Context) {
         return
     }
 
-    // Ensure user has a wallet address
-    if user.WalletAddress == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "No wallet associated with this account"})
+    if user.IsNonCustodial() {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Wallet backups are not available for non-custodial accounts"})
+        return
+    }
+
+    // Pick the requested account, or the default one
+    walletAddress, ok := h.selectedWalletAddress(c, &user, req.Account)
+    if !ok {
         return
     }
 
     // Retrieve wallet credentials
     uid, _ := uuid.Parse(userID.(string))
-    credentials, err := h.WalletService.RecoverWalletFromStorage(uid, user.WalletAddress)
+    credentials, err := h.WalletService.RecoverWalletFromStorage(uid, walletAddress)
     if err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "No wallet backup found"})
         h.ActivityLoggerService.LogFromRequest(c, "recover_wallet", 
             "User attempted to recover wallet credentials", 
-            "wallet", user.WalletAddress, 
+            "wallet", walletAddress, 
             "failure", "No backup found")
         return
     }
 
     h.ActivityLoggerService.LogFromRequest(c, "recover_wallet", 
         "User recovered wallet credentials", 
-        "wallet", user.WalletAddress, 
+        "wallet", walletAddress, 
         "success", "")
 
     // Return the credentials
     c.JSON(http.StatusOK, gin.H{
         "message": "Wallet credentials recovered successfully",
-        "wallet_address": user.WalletAddress,
+        "wallet_address": walletAddress,
         "credentials": credentials,
         "important_notice": "SAVE THESE CREDENTIALS SECURELY!",
     })
-}
\ No newline at end of file
+}
+
+// CreateShareBackupHandler splits the stored mnemonic into M-of-N Shamir shares
+func (h *Handler) CreateShareBackupHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req CreateShareBackupRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    if user.IsNonCustodial() {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Wallet backups are not available for non-custodial accounts"})
+        return
+    }
+
+    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+        h.ActivityLoggerService.LogFromRequest(c, "create_share_backup",
+            "User attempted to create a share backup",
+            "wallet", user.WalletAddress,
+            "failure", "Invalid password")
+        return
+    }
+
+    walletAddress, ok := h.selectedWalletAddress(c, user, req.Account)
+    if !ok {
+        return
+    }
+
+    if req.Threshold == 0 {
+        req.Threshold = 2
+    }
+    if req.Shares == 0 {
+        req.Shares = 3
+    }
+    emailShare := req.EmailShare == nil || *req.EmailShare
+    if emailShare && user.Email == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "An email address is required to send a share by email"})
+        return
+    }
+
+    backup, err := h.WalletStorageService.CreateShareBackup(user.UUID, walletAddress, req.Threshold, req.Shares, emailShare)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to create share backup: %v", err)})
+        return
+    }
+
+    if emailShare {
+        err = h.RecoveryService.SendWalletShareEmail(user.Email, user.Username, walletAddress,
+            backup.EmailShare, backup.EmailIndex, backup.Threshold, backup.TotalShares)
+        if err != nil {
+            // Without the email share the set may not be recoverable, so drop it
+            if err := h.WalletStorageService.DeleteShareSet(backup.SetID); err != nil {
+                log.Printf("Error deleting share backup %s of %s after the email share failed: %v", backup.SetID, walletAddress, err)
+            }
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send the email share, please try again"})
+            return
+        }
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "create_share_backup",
+        fmt.Sprintf("User created a %d-of-%d share backup", backup.Threshold, backup.TotalShares),
+        "wallet", walletAddress,
+        "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":          "Share backup created successfully",
+        "wallet_address":   walletAddress,
+        "backup":           backup,
+        "email_share_sent": emailShare,
+        "important_notice": "SAVE YOUR SHARES SEPARATELY! They are shown only once. One share is kept in our vault.",
+    })
+}
+
+// RecoverFromSharesHandler rebuilds a wallet mnemonic from Shamir shares
+func (h *Handler) RecoverFromSharesHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req RecoverFromSharesRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Shares and password required."})
+        return
+    }
+
+    walletAddress, ok := h.selectedWalletAddress(c, user, req.Account)
+    if !ok {
+        return
+    }
+
+    // The response carries the plaintext mnemonic, so a session alone is not enough
+    if !h.verifyStepUp(c, user, req.Password, req.TOTPCode, "recover_from_shares", "User attempted to recover a wallet from shares", walletAddress) {
+        return
+    }
+
+    mnemonic, err := h.WalletStorageService.RecoverFromShares(user.UUID, walletAddress, req.Shares, req.UseVaultShare)
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "recover_from_shares",
+            "User attempted to recover a wallet from shares",
+            "wallet", walletAddress,
+            "failure", err.Error())
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to recover wallet: %v", err)})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "recover_from_shares",
+        "User recovered a wallet from shares",
+        "wallet", walletAddress,
+        "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":          "Wallet recovered successfully",
+        "wallet_address":   walletAddress,
+        "mnemonic":         mnemonic,
+        "important_notice": "SAVE THIS MNEMONIC SECURELY!",
+    })
+}
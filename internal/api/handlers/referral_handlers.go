@@ -0,0 +1,136 @@
+package handlers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/gin-gonic/gin"
+)
+
+// GetReferralSummaryHandler returns the user's referral code and link, tier and commission balance
+func (h *Handler) GetReferralSummaryHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    summary, err := h.ReferralService.Summary(user)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load referrals"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"referrals": summary})
+}
+
+// GetReferralCommissionsHandler lists the commissions the user earned, newest first
+func (h *Handler) GetReferralCommissionsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    limit, offset := parseLimitOffset(c)
+    commissions, total, err := h.ReferralService.Commissions(&user.UUID, c.Query("status"), limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load referral commissions"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":       total,
+        "limit":       limit,
+        "offset":      offset,
+        "commissions": commissions,
+    })
+}
+
+// GetReferralPayoutsHandler lists the payouts sent to the user, newest first
+func (h *Handler) GetReferralPayoutsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    limit, offset := parseLimitOffset(c)
+    payouts, total, err := h.ReferralService.Payouts(&user.UUID, limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load referral payouts"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":   total,
+        "limit":   limit,
+        "offset":  offset,
+        "payouts": payouts,
+    })
+}
+
+// AdminListReferralCommissionsHandler lists everyone's commissions, optionally by status
+func (h *Handler) AdminListReferralCommissionsHandler(c *gin.Context) {
+    limit, offset := parseLimitOffset(c)
+    commissions, total, err := h.ReferralService.Commissions(nil, c.Query("status"), limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load referral commissions"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":       total,
+        "limit":       limit,
+        "offset":      offset,
+        "commissions": commissions,
+    })
+}
+
+// AdminListReferralPayoutsHandler lists everyone's payouts
+func (h *Handler) AdminListReferralPayoutsHandler(c *gin.Context) {
+    limit, offset := parseLimitOffset(c)
+    payouts, total, err := h.ReferralService.Payouts(nil, limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load referral payouts"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":   total,
+        "limit":   limit,
+        "offset":  offset,
+        "payouts": payouts,
+    })
+}
+
+// AdminPayReferralsHandler starts a payout batch. Each transfer waits to be mined, so the batch runs
+// in the background and its payouts show up in the payout list.
+func (h *Handler) AdminPayReferralsHandler(c *gin.Context) {
+    if h.ReferralService.TokenClient == nil {
+        c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Referral payouts are not enabled"})
+        return
+    }
+
+    h.logAdminAction(c, "admin_pay_referrals", "Admin started a referral payout batch", "referral_payout", "", nil)
+
+    go func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+        defer cancel()
+
+        payouts, err := h.ReferralService.PayOut(ctx)
+        if err != nil {
+            log.Printf("Referral payout batch failed: %v", err)
+            return
+        }
+        completed := 0
+        for _, payout := range payouts {
+            if payout.Status == models.ReferralPayoutStatusCompleted {
+                completed++
+            }
+        }
+        log.Printf("Referral payout batch sent %d of %d payouts", completed, len(payouts))
+    }()
+
+    c.JSON(http.StatusAccepted, gin.H{"message": "Referral payout batch started"})
+}
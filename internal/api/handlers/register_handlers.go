@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -17,6 +18,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
 )
 
 // CreateAccountRequest structure
@@ -42,6 +44,7 @@ type RegisterUserRequest struct {
     Password string `json:"password" binding:"required"`
     FullName string `json:"full_name"`
     Phone    string `json:"phone"`
+    ReferralCode string `json:"referral_code"` // Code of the user who referred them, optional
 }
 
 // RegisterUserResponse represents the response after successful registration
@@ -51,6 +54,7 @@ type RegisterUserResponse struct {
     Email     string    `json:"email"`
     FullName  string    `json:"full_name,omitempty"`
     Phone     string    `json:"phone,omitempty"`
+    ReferralCode string `json:"referral_code"`
     CreatedAt time.Time `json:"created_at"`
 }
 
@@ -246,6 +250,16 @@ func (h *Handler) RegisterUserHandler(c *gin.Context) {
         TwoFactorEnabled: false,
     }
 
+    // Give the user a referral code and credit whoever referred them
+    if err := h.ReferralService.Attribute(&user, req.ReferralCode, c.ClientIP()); err != nil {
+        if errors.Is(err, services.ErrInvalidReferralCode) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referral code"})
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply referral code"})
+        return
+    }
+
     // Save to database
     if result := h.DB.Create(&user); result.Error != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user record"})
@@ -259,6 +273,7 @@ func (h *Handler) RegisterUserHandler(c *gin.Context) {
         Email:     req.Email,
         FullName:  req.FullName,
         Phone:     req.Phone,
+        ReferralCode: user.ReferralCode,
         CreatedAt: now,
     })
 }
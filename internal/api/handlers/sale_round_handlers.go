@@ -0,0 +1,181 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// GetSaleProgressHandler reports every sale round with its progress and the remaining allocation
+func (h *Handler) GetSaleProgressHandler(c *gin.Context) {
+    progress, err := h.SaleRoundService.Progress()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load sale progress"})
+        return
+    }
+
+    var active *services.SaleRoundProgress
+    for i := range progress {
+        if progress[i].Status == services.SaleRoundStatusActive {
+            active = &progress[i]
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "active": active,
+        "rounds": progress,
+    })
+}
+
+// GetSaleAllocationHandler reports what the user bought in the active round and may still buy
+func (h *Handler) GetSaleAllocationHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    allocation, err := h.SaleRoundService.Allocation(user.UUID)
+    if err != nil {
+        h.respondSaleError(c, err)
+        return
+    }
+    if allocation == nil {
+        c.JSON(http.StatusOK, gin.H{"message": "The sale has no rounds, purchases are not limited"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"allocation": allocation})
+}
+
+// AdminListSaleRoundsHandler lists all sale rounds, including disabled ones
+func (h *Handler) AdminListSaleRoundsHandler(c *gin.Context) {
+    rounds, err := h.SaleRoundService.ListRounds()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sale rounds"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"rounds": rounds})
+}
+
+// AdminCreateSaleRoundHandler adds a sale round
+func (h *Handler) AdminCreateSaleRoundHandler(c *gin.Context) {
+    var req services.SaleRoundInput
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    round, err := h.SaleRoundService.CreateRound(req)
+    if err != nil {
+        h.logAdminAction(c, "admin_create_sale_round", "Admin created a sale round", "sale_round", "", err)
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_create_sale_round", "Admin created sale round "+round.Name, "sale_round", round.UUID.String(), nil)
+
+    c.JSON(http.StatusCreated, gin.H{"round": round})
+}
+
+// AdminUpdateSaleRoundHandler changes a sale round's window, price, caps, limits or enabled flag
+func (h *Handler) AdminUpdateSaleRoundHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    var req services.SaleRoundInput
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    round, err := h.SaleRoundService.UpdateRound(id, req)
+    if err != nil {
+        h.logAdminAction(c, "admin_update_sale_round", "Admin updated a sale round", "sale_round", id, err)
+        status := http.StatusBadRequest
+        if err.Error() == "sale round not found" {
+            status = http.StatusNotFound
+        }
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_update_sale_round", "Admin updated sale round "+round.Name, "sale_round", round.UUID.String(), nil)
+
+    c.JSON(http.StatusOK, gin.H{"round": round})
+}
+
+// activeSaleRound returns the open sale round, nil when no rounds are configured.
+// It responds and returns false when the sale is closed.
+func (h *Handler) activeSaleRound(c *gin.Context) (*models.SaleRound, bool) {
+    round, err := h.SaleRoundService.ActiveRound()
+    if err != nil {
+        h.respondSaleError(c, err)
+        return nil, false
+    }
+    return round, true
+}
+
+// createPurchase saves a purchase transaction within the active round's rules and its user's KYC
+// limits, redeeming its promo code in the same database transaction. It responds and returns
+// false when the purchase is rejected or cannot be saved. The purchase is credited to the
+// partner the request names and keeps the IDR/USD rate of the prices it was made at.
+func (h *Handler) createPurchase(c *gin.Context, transaction *models.Transaction, ethPriceUSD, ethPriceIDR float64) bool {
+    h.attributePartner(c, transaction)
+    transaction.FXRate = fxRate(ethPriceUSD, ethPriceIDR)
+
+    redeem := func(tx *gorm.DB) error {
+        return h.PromoService.Redeem(tx, transaction)
+    }
+    err := h.SaleRoundService.CreatePurchase(transaction, h.kycCheck(transaction, ethPriceUSD, ethPriceIDR), redeem)
+    if err != nil {
+        if h.respondPurchaseRejected(c, transaction, err) {
+            return false
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction record"})
+        log.Printf("Error creating transaction: %v", err)
+        return false
+    }
+    return true
+}
+
+// fxRate is the IDR per USD rate implied by the ETH prices, kept on purchases for their invoices
+func fxRate(ethPriceUSD, ethPriceIDR float64) float64 {
+    if ethPriceUSD <= 0 {
+        return 0
+    }
+    return ethPriceIDR / ethPriceUSD
+}
+
+// respondPurchaseRejected answers 400 for a broken sale or promo rule and 403 for a KYC limit,
+// and reports whether the error was one of those
+func (h *Handler) respondPurchaseRejected(c *gin.Context, transaction *models.Transaction, err error) bool {
+    switch {
+    case errors.Is(err, services.ErrKYCLimitExceeded):
+        h.ActivityLoggerService.LogFromRequest(c, "kyc_limit", "Purchase blocked by KYC limit", "user", transaction.UserID.String(), "failure", err.Error())
+        c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+        return true
+    case errors.Is(err, services.ErrPurchaseRejected) || errors.Is(err, services.ErrPromoCodeRejected):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return true
+    }
+    return false
+}
+
+// respondSaleError answers 400 for a broken sale rule and 500 otherwise
+func (h *Handler) respondSaleError(c *gin.Context, err error) {
+    if errors.Is(err, services.ErrPurchaseRejected) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load the sale round"})
+}
+
+// roundTokenAmount prices a purchase of the given USD value at the round's price
+func roundTokenAmount(round *models.SaleRound, usdAmount float64) float64 {
+    return usdAmount / round.PriceUSD
+}
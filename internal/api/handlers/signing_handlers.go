@@ -0,0 +1,218 @@
+package handlers
+
+import (
+    "fmt"
+    "math/big"
+    "net/http"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/gin-gonic/gin"
+)
+
+// defaultPermitDuration is how long a permit stays valid when no deadline is given
+const defaultPermitDuration = time.Hour
+
+// SignMessageRequest represents a request to sign a personal_sign message or EIP-712 typed data
+type SignMessageRequest struct {
+    services.SignRequest
+    Account  string `json:"account"` // Address, account ID or label; defaults to the default account
+    Password string `json:"password"`
+    TOTPCode string `json:"totp_code"`
+}
+
+// SignPermitRequest represents a request to sign an EIP-2612 permit
+type SignPermitRequest struct {
+    Account     string `json:"account"`
+    Token       string `json:"token"` // Defaults to the gateway token
+    Spender     string `json:"spender" binding:"required"`
+    Value       string `json:"value" binding:"required"` // Smallest unit
+    Deadline    int64  `json:"deadline"`                 // Unix time, defaults to one hour from now
+    PreviewOnly bool   `json:"preview_only"`
+    Password    string `json:"password"`
+    TOTPCode    string `json:"totp_code"`
+}
+
+// PreviewSignatureHandler decodes a message into the human-readable preview shown before signing
+func (h *Handler) PreviewSignatureHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req SignMessageRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Method required."})
+        return
+    }
+
+    walletAddress, ok := h.selectedWalletAddress(c, user, req.Account)
+    if !ok {
+        return
+    }
+
+    preview, err := h.MessageSigningService.Preview(c.Request.Context(), common.HexToAddress(walletAddress), req.SignRequest)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"preview": preview})
+}
+
+// SignMessageHandler signs a personal_sign message or EIP-712 typed data with the wallet's stored key
+func (h *Handler) SignMessageHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req SignMessageRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Method required."})
+        return
+    }
+
+    walletAddress, ok := h.signingWallet(c, user, req.Account, req.Password, req.TOTPCode)
+    if !ok {
+        return
+    }
+
+    h.signAndRespond(c, user, walletAddress, req.SignRequest)
+}
+
+// SignPermitHandler builds and signs EIP-2612 permit typed data for the gateway token or another permit token
+func (h *Handler) SignPermitHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req SignPermitRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Spender and value required."})
+        return
+    }
+
+    if !common.IsHexAddress(req.Spender) || (req.Token != "" && !common.IsHexAddress(req.Token)) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Spender and token must be addresses"})
+        return
+    }
+
+    value, ok := new(big.Int).SetString(req.Value, 10)
+    if !ok || value.Sign() < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid value"})
+        return
+    }
+
+    deadline := time.Now().Add(defaultPermitDuration)
+    if req.Deadline != 0 {
+        deadline = time.Unix(req.Deadline, 0)
+        if deadline.Before(time.Now()) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Deadline is in the past"})
+            return
+        }
+    }
+
+    var walletAddress string
+    if req.PreviewOnly {
+        walletAddress, ok = h.selectedWalletAddress(c, user, req.Account)
+    } else {
+        walletAddress, ok = h.signingWallet(c, user, req.Account, req.Password, req.TOTPCode)
+    }
+    if !ok {
+        return
+    }
+
+    var token common.Address
+    if req.Token != "" {
+        token = common.HexToAddress(req.Token)
+    }
+
+    typedData, err := h.MessageSigningService.BuildPermit(c.Request.Context(), common.HexToAddress(walletAddress), token, common.HexToAddress(req.Spender), value, deadline)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    signReq := services.SignRequest{Method: models.SignMethodTypedData, TypedData: typedData}
+    if req.PreviewOnly {
+        preview, err := h.MessageSigningService.Preview(c.Request.Context(), common.HexToAddress(walletAddress), signReq)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"preview": preview, "typed_data": typedData})
+        return
+    }
+
+    h.signAndRespond(c, user, walletAddress, signReq)
+}
+
+// ListSignaturesHandler returns the audit trail of messages signed with the user's custodial keys
+func (h *Handler) ListSignaturesHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    limit, offset := parseLimitOffset(c)
+    signatures, total, err := h.MessageSigningService.ListSignatures(user.UUID, limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list signatures"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":      total,
+        "limit":      limit,
+        "offset":     offset,
+        "signatures": signatures,
+    })
+}
+
+// signingWallet resolves the signing wallet and runs the step-up check. Signing needs 2FA
+// because a signature can authorize transfers without any transaction from the server.
+func (h *Handler) signingWallet(c *gin.Context, user *models.User, account, password, totpCode string) (string, bool) {
+    if h.rejectNonCustodial(c, user.UUID) {
+        return "", false
+    }
+
+    if !user.TwoFactorEnabled {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Enable two-factor authentication to sign messages"})
+        return "", false
+    }
+
+    walletAddress, ok := h.selectedWalletAddress(c, user, account)
+    if !ok {
+        return "", false
+    }
+
+    if !h.verifyStepUp(c, user, password, totpCode, "sign_message", "User attempted to sign a message", walletAddress) {
+        return "", false
+    }
+
+    return walletAddress, true
+}
+
+// signAndRespond signs the request, logs the outcome and writes the response
+func (h *Handler) signAndRespond(c *gin.Context, user *models.User, walletAddress string, req services.SignRequest) {
+    signed, err := h.MessageSigningService.Sign(c.Request.Context(), user.UUID, common.HexToAddress(walletAddress), req, c.ClientIP(), c.Request.UserAgent())
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "sign_message",
+            "User attempted to sign a message",
+            "wallet", walletAddress,
+            "failure", err.Error())
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to sign message: %v", err)})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "sign_message",
+        "User signed: "+signed.Preview.Summary,
+        "message_signature", signed.AuditID.String(),
+        "success", "")
+
+    c.JSON(http.StatusOK, signed)
+}
@@ -27,6 +27,7 @@ func (h *Handler) SwapTokensHandler(c *gin.Context) {
         ToToken           string  `json:"to_token" binding:"required"`
         Amount            string  `json:"amount" binding:"required"`
         SlippageTolerance float64 `json:"slippage_tolerance"`
+        Account           string  `json:"account"` // Address, account ID or label
     }
 
     if err := c.ShouldBindJSON(&req); err != nil {
@@ -63,10 +64,16 @@ func (h *Handler) SwapTokensHandler(c *gin.Context) {
         return
     }
 
+    // Non-custodial users sign swaps in their own wallet
+    if h.rejectNonCustodial(c, uid) {
+        return
+    }
+
     // Execute the swap
     txHash, err := h.SwapService.SwapTokens(
         uid,
         req.Mnemonic,
+        req.Account,
         req.FromToken,
         req.ToToken,
         req.Amount,
@@ -112,8 +119,19 @@ func (h *Handler) GetWalletTransactionsHandler(c *gin.Context) {
         pageSize = ps
     }
 
-    // Parse wallet address from query if provided
+    // Parse wallet address or account selector from query if provided
     walletAddress := c.Query("wallet_address")
+    account := c.Query("account")
+
+    // Optional direction filter: incoming deposits or outgoing transactions
+    direction := c.Query("direction")
+    if direction != "" && direction != models.WalletTxDirectionIncoming && direction != models.WalletTxDirectionOutgoing {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "status":  "error",
+            "message": "direction must be incoming or outgoing",
+        })
+        return
+    }
 
     // Parse user ID
     uid, err := uuid.Parse(userID.(string))
@@ -125,6 +143,18 @@ func (h *Handler) GetWalletTransactionsHandler(c *gin.Context) {
         return
     }
 
+    if account != "" {
+        wallet, err := h.WalletService.ResolveAccount(uid, account)
+        if err != nil {
+            c.JSON(http.StatusNotFound, gin.H{
+                "status":  "error",
+                "message": "Account not found",
+            })
+            return
+        }
+        walletAddress = wallet.WalletAddress
+    }
+
     // Build a query to get transactions for this user
     var transactions []models.WalletTransaction
     query := h.DB.Where("user_id = ?", uid)
@@ -134,6 +164,10 @@ func (h *Handler) GetWalletTransactionsHandler(c *gin.Context) {
         query = query.Where("wallet_address = ?", walletAddress)
     }
 
+    if direction != "" {
+        query = query.Where("direction = ?", direction)
+    }
+
     // Apply pagination
     offset := (page - 1) * pageSize
     
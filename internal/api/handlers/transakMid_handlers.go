@@ -154,10 +154,8 @@ transaction := models.Transaction{
     UpdatedAt:          time.Now(),
 }
     
-    // Save transaction to database
-    if err := h.DB.Create(&transaction).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction record"})
-        log.Printf("Error creating transaction: %v", err)
+    // Save transaction to database within the sale round's caps and limits
+    if !h.createPurchase(c, &transaction, ethPriceUSD, ethPriceIDR) {
         return
     }
     
@@ -320,10 +318,8 @@ func (h *Handler) CreateFiatToCIFOHandler(c *gin.Context) {
         UpdatedAt:          time.Now(),
     }
     
-    // Save transaction to database
-    if err := h.DB.Create(&transaction).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction record"})
-        log.Printf("Error creating transaction: %v", err)
+    // Save transaction to database within the sale round's caps and limits
+    if !h.createPurchase(c, &transaction, ethPriceUSD, ethPriceIDR) {
         return
     }
     
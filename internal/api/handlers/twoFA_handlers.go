@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -128,6 +129,8 @@ func (h *Handler) Verify2FAHandler(c *gin.Context) {
         "message": "Two-factor authentication enabled successfully",
     })
 
+    h.sendSecurityAlert(c, &user, services.SecurityEvent2FAEnabled)
+
     h.ActivityLoggerService.LogFromRequest(c, "enabled_2fa", 
     "User activated 2 fa for their account", 
     "account", user.Email, 
@@ -149,21 +152,31 @@ func (h *Handler) LoginWith2FAHandler(c *gin.Context) {
         return
     }
 
+    // Refuse locked accounts before checking credentials
+    if h.rejectIfLocked(c, &user) {
+        return
+    }
+
     // Verify password
     err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password))
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
+        h.handleAuthFailure(c, &user, "login_2fa", "Invalid username or password")
         return
     }
 
     // If 2FA is enabled, verify code
     if user.TwoFactorEnabled {
         if !h.TOTPService.ValidateCode(user.TwoFactorSecret, req.Code) {
-            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+            h.handleAuthFailure(c, &user, "login_2fa", "Invalid verification code")
             return
         }
     }
 
+    // Clear failed attempts now that the user is fully authenticated
+    if err := h.LockoutService.RegisterSuccess(&user); err != nil {
+        log.Printf("Failed to reset lockout state for %s: %v", user.Username, err)
+    }
+
     // Update last login time
     h.DB.Model(&user).Updates(map[string]interface{}{
         "updated_at":    time.Now(),
@@ -171,7 +184,7 @@ func (h *Handler) LoginWith2FAHandler(c *gin.Context) {
     })
 
     // Generate JWT token
-    token, err := h.TokenService.GenerateToken(user.UUID, user.Username, user.WalletAddress)
+    token, err := h.TokenService.GenerateToken(user.UUID, user.Username, user.WalletAddress, user.GetRole(), user.PermissionList())
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
         return
@@ -186,6 +199,8 @@ func (h *Handler) LoginWith2FAHandler(c *gin.Context) {
     // Calculate expiry time
     expiresAt := time.Now().Add(h.TokenService.GetConfig().TokenDuration)
 
+    h.recordSignIn(c, &user)
+
     c.JSON(http.StatusOK, LoginResponse{
         UUID:          user.UUID.String(),
         Username:      user.Username,
@@ -227,6 +242,8 @@ func (h *Handler) Disable2FAHandler(c *gin.Context) {
     "User disable 2 fa for their account", 
     "account", user.Email, 
     "success", "")  
+
+    h.sendSecurityAlert(c, &user, services.SecurityEvent2FADisabled)
 }
 
 func (h *Handler) Request2FARecovery(c *gin.Context){
@@ -289,8 +306,13 @@ func (h *Handler) Verify2FARecoveryHandler(c *gin.Context) {
         return
     }
 
+    // Refuse locked accounts before checking the code
+    if h.rejectIfLocked(c, &user) {
+        return
+    }
+
     // Check if recovery code exists and is not expired
-    if user.RecoveryExpires.Before(time.Now()) {
+    if user.RecoveryExpires == nil || user.RecoveryExpires.Before(time.Now()) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Recovery code expired. Please request a new one."})
         return
     }
@@ -298,10 +320,15 @@ func (h *Handler) Verify2FARecoveryHandler(c *gin.Context) {
     // Verify recovery code
     err := bcrypt.CompareHashAndPassword([]byte(user.RecoveryCode), []byte(req.Code))
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid recovery code"})
+        h.handleAuthFailure(c, &user, "recovery_2fa", "Invalid recovery code")
         return
     }
 
+    // Clear failed attempts once the recovery code checks out
+    if err := h.LockoutService.RegisterSuccess(&user); err != nil {
+        log.Printf("Failed to reset lockout state for %s: %v", user.Username, err)
+    }
+
     // Generate new 2FA secret
     key, err := h.TOTPService.GenerateSecret(req.Username)
     if err != nil {
@@ -329,6 +356,8 @@ func (h *Handler) Verify2FARecoveryHandler(c *gin.Context) {
     "User recover 2 fa code for their account", 
     "account", user.Email, 
     "success", "")  
+
+    h.sendSecurityAlert(c, &user, services.SecurityEvent2FARecovered)
 }
 // Helper function to generate random codes
 func generateRandomCode(length int) string {
@@ -77,6 +77,7 @@ func (h *Handler) processUniswapPurchase(transaction *models.Transaction) error
     transaction.BlockchainCompleted = true
     transaction.CompletedAt = &now
     transaction.UpdatedAt = now
+    h.PromoService.MarkBonusOwed(transaction)
     
     if err := h.DB.Save(&transaction).Error; err != nil {
         log.Printf("Warning: Failed to update transaction after successful swap: %v", err)
@@ -85,6 +86,8 @@ func (h *Handler) processUniswapPurchase(transaction *models.Transaction) error
     log.Printf("Successfully completed purchase of %.8f CIFO tokens via Uniswap, tx: %s",
         transaction.TokenAmount, txHash)
     
+    h.deliverPromoBonus(transaction)
+    
     return nil
 
 }
\ No newline at end of file
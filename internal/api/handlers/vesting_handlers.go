@@ -0,0 +1,79 @@
+package handlers
+
+import (
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/gin-gonic/gin"
+)
+
+// GetVestingSchedulesHandler lists the user's vesting schedules with what is vested and claimable
+func (h *Handler) GetVestingSchedulesHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    summary, err := h.VestingService.Schedules(user.UUID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load vesting schedules"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"vesting": summary})
+}
+
+// GetVestingClaimsHandler lists the user's vesting claims, newest first
+func (h *Handler) GetVestingClaimsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    limit, offset := parseLimitOffset(c)
+    claims, total, err := h.VestingService.Claims(user.UUID, limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load vesting claims"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":  total,
+        "limit":  limit,
+        "offset": offset,
+        "claims": claims,
+    })
+}
+
+// ClaimVestingHandler releases what a vesting schedule has vested to its beneficiary
+func (h *Handler) ClaimVestingHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    id := c.Param("id")
+    claim, err := h.VestingService.Claim(user.UUID, id)
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "vesting_claim", "Failed to claim vested tokens", "vesting_schedule", id, "failure", err.Error())
+        switch {
+        case claim != nil:
+            c.JSON(http.StatusBadGateway, gin.H{"error": err.Error(), "claim": claim})
+        case err.Error() == "vesting schedule not found":
+            c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        default:
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        }
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "vesting_claim", "Claimed vested tokens", "vesting_schedule", id, "success", "")
+
+    // Sent but not confirmed yet, the claim is settled in the background
+    if claim.Status == models.VestingClaimStatusPending {
+        c.JSON(http.StatusAccepted, gin.H{"claim": claim})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"claim": claim})
+}
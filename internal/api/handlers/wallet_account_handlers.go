@@ -0,0 +1,274 @@
+package handlers
+
+import (
+    "fmt"
+    "net/http"
+    "strings"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/gin-gonic/gin"
+)
+
+// DeriveAccountRequest represents a request to add another account from a user's mnemonic
+type DeriveAccountRequest struct {
+    Mnemonic         string  `json:"mnemonic"` // Optional when the mnemonic is stored
+    Index            *uint32 `json:"index"`    // Defaults to the first unused index
+    Label            string  `json:"label"`
+    StoreCredentials bool    `json:"store_credentials"`
+    Password         string  `json:"password"`  // Required when the stored mnemonic is used
+    TOTPCode         string  `json:"totp_code"` // Required with the password when 2FA is enabled
+}
+
+// DiscoverAccountsRequest represents a request to scan a mnemonic for used accounts
+type DiscoverAccountsRequest struct {
+    Mnemonic string   `json:"mnemonic" binding:"required"`
+    GapLimit int      `json:"gap_limit"` // Consecutive unused accounts before a layout stops, default 20
+    Layouts  []string `json:"layouts"`   // bip44 and/or ledger_live, default both
+}
+
+// AttachAccountsRequest represents a request to add discovered accounts
+type AttachAccountsRequest struct {
+    Mnemonic         string   `json:"mnemonic" binding:"required"`
+    Paths            []string `json:"paths" binding:"required"`
+    StoreCredentials bool     `json:"store_credentials"`
+}
+
+// UpdateAccountRequest represents a request to rename an account
+type UpdateAccountRequest struct {
+    Label string `json:"label" binding:"required"`
+}
+
+// ListWalletAccountsHandler lists the authenticated user's wallet accounts
+func (h *Handler) ListWalletAccountsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    wallets, err := h.WalletService.ListAccounts(user.UUID)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list accounts"})
+        return
+    }
+
+    accounts := make([]gin.H, 0, len(wallets))
+    for _, wallet := range wallets {
+        accounts = append(accounts, accountResponse(&wallet))
+    }
+
+    c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// DeriveWalletAccountHandler derives an additional account from the user's mnemonic
+func (h *Handler) DeriveWalletAccountHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req DeriveAccountRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    // Non-custodial users must bring their own mnemonic and cannot store it
+    if (req.StoreCredentials || req.Mnemonic == "") && user.IsNonCustodial() {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Non-custodial accounts must provide their mnemonic and cannot store credentials"})
+        return
+    }
+
+    // Deriving from the stored mnemonic uses the server's copy of the user's keys
+    if req.Mnemonic == "" && !h.verifyStepUp(c, user, req.Password, req.TOTPCode, "derive_account", "User attempted to add an account from the stored mnemonic", user.WalletAddress) {
+        return
+    }
+
+    wallet, err := h.WalletService.DeriveAdditionalAccount(user.UUID, req.Mnemonic, req.Index, req.Label, req.StoreCredentials)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to derive account: %v", err)})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "derive_account",
+        fmt.Sprintf("User added account %s", wallet.DerivationPath),
+        "wallet", wallet.WalletAddress,
+        "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Account added successfully",
+        "account": accountResponse(wallet),
+    })
+}
+
+// DiscoverWalletAccountsHandler scans the standard derivation paths of a mnemonic
+// and returns the accounts with a balance, nonce or token holdings
+func (h *Handler) DiscoverWalletAccountsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req DiscoverAccountsRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Mnemonic required."})
+        return
+    }
+
+    discovered, err := h.WalletDiscoveryService.Discover(c.Request.Context(), strings.TrimSpace(req.Mnemonic), req.Layouts, req.GapLimit)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to discover accounts: %v", err)})
+        return
+    }
+
+    // Flag accounts the user has already added
+    if wallets, err := h.WalletService.ListAccounts(user.UUID); err == nil {
+        owned := make(map[string]bool, len(wallets))
+        for _, wallet := range wallets {
+            owned[strings.ToLower(wallet.WalletAddress)] = true
+        }
+        for i := range discovered {
+            discovered[i].AlreadyAdded = owned[strings.ToLower(discovered[i].Address)]
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "accounts": discovered,
+        "notice":   "Pick the derivation paths to add and send them to /wallet/import/attach",
+    })
+}
+
+// AttachWalletAccountsHandler adds the selected discovered accounts
+func (h *Handler) AttachWalletAccountsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req AttachAccountsRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Mnemonic and paths required."})
+        return
+    }
+
+    if req.StoreCredentials && user.IsNonCustodial() {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Non-custodial accounts cannot store credentials"})
+        return
+    }
+
+    wallets, err := h.WalletService.AttachDiscoveredAccounts(user.UUID, strings.TrimSpace(req.Mnemonic), req.Paths, req.StoreCredentials)
+    if err != nil && len(wallets) == 0 {
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to add accounts: %v", err)})
+        return
+    }
+
+    // The first attached account becomes the user's wallet if they had none
+    if user.WalletAddress == "" {
+        for _, wallet := range wallets {
+            if wallet.IsDefault {
+                h.DB.Model(user).Update("wallet_address", wallet.WalletAddress)
+            }
+        }
+    }
+
+    accounts := make([]gin.H, 0, len(wallets))
+    for _, wallet := range wallets {
+        accounts = append(accounts, accountResponse(&wallet))
+        h.ActivityLoggerService.LogFromRequest(c, "import_wallet",
+            fmt.Sprintf("User imported discovered account %s", wallet.DerivationPath),
+            "wallet", wallet.WalletAddress,
+            "success", "")
+    }
+
+    response := gin.H{
+        "message":  fmt.Sprintf("%d account(s) added", len(wallets)),
+        "accounts": accounts,
+    }
+    if err != nil {
+        response["error"] = fmt.Sprintf("Some accounts were not added: %v", err)
+    }
+
+    c.JSON(http.StatusOK, response)
+}
+
+// UpdateWalletAccountHandler renames an account
+func (h *Handler) UpdateWalletAccountHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req UpdateAccountRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Label required."})
+        return
+    }
+
+    wallet, err := h.WalletService.UpdateAccountLabel(user.UUID, c.Param("account"), req.Label)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    wallet.Label = req.Label
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Account updated successfully",
+        "account": accountResponse(wallet),
+    })
+}
+
+// SetDefaultWalletAccountHandler makes an account the user's default
+func (h *Handler) SetDefaultWalletAccountHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    wallet, err := h.WalletService.SetDefaultAccount(user.UUID, c.Param("account"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "set_default_account",
+        "User changed the default account",
+        "wallet", wallet.WalletAddress,
+        "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message": "Default account updated",
+        "account": accountResponse(wallet),
+    })
+}
+
+// selectedWalletAddress returns the address picked by an account selector
+// (address, account ID or label), defaulting to the user's wallet address
+func (h *Handler) selectedWalletAddress(c *gin.Context, user *models.User, selector string) (string, bool) {
+    if selector == "" {
+        if user.WalletAddress == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "No wallet associated with this account"})
+            return "", false
+        }
+        return user.WalletAddress, true
+    }
+
+    wallet, err := h.WalletService.ResolveAccount(user.UUID, selector)
+    if err != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+        return "", false
+    }
+
+    return wallet.WalletAddress, true
+}
+
+// accountResponse is the public view of a wallet account
+func accountResponse(wallet *models.Wallet) gin.H {
+    return gin.H{
+        "id":              wallet.UUID,
+        "wallet_address":  wallet.WalletAddress,
+        "label":           wallet.Label,
+        "derivation_path": wallet.DerivationPath,
+        "account_index":   wallet.AccountIndex,
+        "is_default":      wallet.IsDefault,
+        "created_at":      wallet.CreatedAt,
+    }
+}
@@ -9,9 +9,9 @@ import (
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type CreateWalletRequest struct {
@@ -34,6 +34,18 @@ type SwapTokensRequest struct {
     ToToken        string  `json:"to_token" binding:"required"`
     Amount         string  `json:"amount" binding:"required"`
     SlippageTolerance float64 `json:"slippage_tolerance,omitempty"`
+    Account        string  `json:"account,omitempty"` // Address, account ID or label; defaults to the default account
+}
+
+// SendFundsRequest represents a request to send ETH or ERC-20 tokens from a custodial wallet
+type SendFundsRequest struct {
+    Account   string `json:"account"`                       // Address, account ID or label; defaults to the default account
+    Token     string `json:"token" binding:"required"`      // ETH, CIFO, WETH or a token address
+    ToAddress string `json:"to_address" binding:"required"`
+    Amount    string `json:"amount" binding:"required"`     // Smallest unit (wei)
+    Password  string `json:"password"`                      // Required unless dry_run
+    TOTPCode  string `json:"totp_code"`                     // Required when 2FA is enabled
+    DryRun    bool   `json:"dry_run"`                       // Only estimate gas and check balances
 }
 
 // CreateWalletHandler creates a new wallet for the authenticated user
@@ -55,6 +67,9 @@ func (h *Handler) CreateWalletHandler(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
         return
     }
+    if req.StoreCredentials && h.rejectNonCustodial(c, uid) {
+        return
+    }
     // Create wallet
     wallet, mnemonic, err := h.WalletService.CreateUserWallet(uid, req.StoreCredentials)
     if err != nil {
@@ -89,6 +104,9 @@ func (h *Handler) ImportWalletHandler(c *gin.Context) {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
         return
     }
+    if req.StoreCredentials && h.rejectNonCustodial(c, uid) {
+        return
+    }
 
     // Default index to 0 if not provided
     index := req.Index
@@ -139,30 +157,22 @@ func (h *Handler) GetUserWalletBalanceHandler(c *gin.Context) {
         return
     }
 
-    // Ensure user has a wallet address
-    if user.WalletAddress == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "No wallet address associated with this account"})
+    // Pick the requested account, or the default one
+    walletAddress, ok := h.selectedWalletAddress(c, &user, c.Query("account"))
+    if !ok {
         return
     }
 
     // Validate the address
-    if !common.IsHexAddress(user.WalletAddress) {
+    if !common.IsHexAddress(walletAddress) {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid wallet address format"})
         return
     }
 
-    ethAddress := common.HexToAddress(user.WalletAddress)
+    ethAddress := common.HexToAddress(walletAddress)
 
-    // Connect to Ethereum node
-    client, err := ethclient.Dial(h.GetEthereumNodeURL())
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to Ethereum node"})
-        return
-    }
-    defer client.Close()
-
-    // Get ETH balance
-    ethBalance, err := client.BalanceAt(context.Background(), ethAddress, nil)
+    // Get ETH balance over the shared node connection
+    ethBalance, err := h.PortfolioService.EthClient.BalanceAt(c.Request.Context(), ethAddress, nil)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
         return
@@ -202,11 +212,11 @@ func (h *Handler) GetUserWalletBalanceHandler(c *gin.Context) {
 
     h.ActivityLoggerService.LogFromRequest(c, "check_balance", 
     "User checked wallet balance", 
-    "wallet", user.WalletAddress, 
+    "wallet", walletAddress, 
     "success", "")   
     // Prepare response
     response := gin.H{
-        "wallet_address":  user.WalletAddress,
+        "wallet_address":  walletAddress,
         "eth_balance_wei": ethBalance.String(),
         "eth_balance":     fmt.Sprintf("%.6f ETH", ethFloat),
         "eth_value_usd":   fmt.Sprintf("$%.2f USD", usdValue),
@@ -226,3 +236,98 @@ func (h *Handler) GetUserWalletBalanceHandler(c *gin.Context) {
     c.JSON(http.StatusOK, response)
 }
 
+// SendFundsHandler sends ETH or ERC-20 tokens, signing with the wallet's stored credentials
+func (h *Handler) SendFundsHandler(c *gin.Context) {
+    user, ok := h.currentUser(c)
+    if !ok {
+        return
+    }
+
+    var req SendFundsRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request. Token, to_address and amount required."})
+        return
+    }
+
+    if h.rejectNonCustodial(c, user.UUID) {
+        return
+    }
+
+    walletAddress, ok := h.selectedWalletAddress(c, user, req.Account)
+    if !ok {
+        return
+    }
+    from := common.HexToAddress(walletAddress)
+
+    if !common.IsHexAddress(req.ToAddress) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recipient address"})
+        return
+    }
+    to := common.HexToAddress(req.ToAddress)
+
+    amount, ok := parseWeiAmount(c, req.Amount)
+    if !ok {
+        return
+    }
+
+    if req.DryRun {
+        quote, err := h.WalletTransferService.Quote(c.Request.Context(), from, req.Token, to, amount)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to estimate transfer: %v", err)})
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{"quote": quote})
+        return
+    }
+
+    // Sending funds needs the password, and the 2FA code when enabled
+    if !h.verifyStepUp(c, user, req.Password, req.TOTPCode, "send_funds", "User attempted to send funds", walletAddress) {
+        return
+    }
+
+    walletTx, quote, err := h.WalletTransferService.Send(c.Request.Context(), user.UUID, from, req.Token, to, amount)
+    if err != nil {
+        h.ActivityLoggerService.LogFromRequest(c, "send_funds",
+            fmt.Sprintf("User attempted to send %s %s to %s", req.Amount, req.Token, to.Hex()),
+            "wallet", walletAddress,
+            "failure", err.Error())
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": fmt.Sprintf("Failed to send funds: %v", err),
+            "quote": quote,
+        })
+        return
+    }
+
+    h.ActivityLoggerService.LogFromRequest(c, "send_funds",
+        fmt.Sprintf("User sent %s %s to %s", req.Amount, req.Token, to.Hex()),
+        "wallet_transaction", walletTx.TxHash,
+        "success", "")
+
+    c.JSON(http.StatusOK, gin.H{
+        "message":     "Transaction sent",
+        "transaction": walletTx,
+        "quote":       quote,
+    })
+}
+
+// verifyStepUp checks the password, and the 2FA code when enabled, before a signing action.
+// It writes the 401 response and logs the failure when the check fails.
+func (h *Handler) verifyStepUp(c *gin.Context, user *models.User, password, totpCode, action, description, walletAddress string) bool {
+    if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+        h.ActivityLoggerService.LogFromRequest(c, action,
+            description,
+            "wallet", walletAddress,
+            "failure", "Invalid password")
+        return false
+    }
+    if user.TwoFactorEnabled && !h.TOTPService.ValidateCode(user.TwoFactorSecret, totpCode) {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid 2FA code"})
+        h.ActivityLoggerService.LogFromRequest(c, action,
+            description,
+            "wallet", walletAddress,
+            "failure", "Invalid 2FA code")
+        return false
+    }
+    return true
+}
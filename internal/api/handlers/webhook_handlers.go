@@ -0,0 +1,172 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
+    "github.com/gin-gonic/gin"
+)
+
+// attributePartner credits a purchase to the partner named in its X-Partner-Code header, so only
+// that partner's webhook endpoints are sent its events. Unknown codes are ignored.
+func (h *Handler) attributePartner(c *gin.Context, transaction *models.Transaction) {
+    code := c.GetHeader("X-Partner-Code")
+    if code == "" {
+        return
+    }
+
+    partnerCode, err := h.WebhookService.PartnerCode(code)
+    if err != nil {
+        log.Printf("Error attributing purchase %s to partner: %v", transaction.PaymentID, err)
+        return
+    }
+    transaction.PartnerCode = partnerCode
+}
+
+// AdminListWebhooksHandler lists the partner webhook endpoints
+func (h *Handler) AdminListWebhooksHandler(c *gin.Context) {
+    endpoints, err := h.WebhookService.Endpoints()
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load webhook endpoints"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"webhooks": endpoints})
+}
+
+// AdminCreateWebhookHandler registers a partner webhook endpoint. The signing secret is only
+// returned here and when it is rotated.
+func (h *Handler) AdminCreateWebhookHandler(c *gin.Context) {
+    var input services.WebhookEndpointInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    endpoint, err := h.WebhookService.CreateEndpoint(input)
+    if err != nil {
+        h.logAdminAction(c, "admin_create_webhook", "Admin registered a webhook endpoint", "webhook", "", err)
+        status := http.StatusInternalServerError
+        if errors.Is(err, services.ErrInvalidWebhook) {
+            status = http.StatusBadRequest
+        }
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+
+    h.logAdminAction(c, "admin_create_webhook", "Admin registered webhook endpoint "+endpoint.URL, "webhook", endpoint.UUID.String(), nil)
+
+    c.JSON(http.StatusCreated, gin.H{
+        "webhook": endpoint,
+        "secret":  endpoint.Secret,
+    })
+}
+
+// AdminUpdateWebhookHandler changes an endpoint's name, URL, events or whether it is active; its
+// partner code cannot be changed
+func (h *Handler) AdminUpdateWebhookHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    var input services.WebhookEndpointInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+        return
+    }
+
+    endpoint, err := h.WebhookService.UpdateEndpoint(id, input)
+    if err != nil {
+        h.logAdminAction(c, "admin_update_webhook", "Admin updated a webhook endpoint", "webhook", id, err)
+        h.webhookError(c, err)
+        return
+    }
+
+    h.logAdminAction(c, "admin_update_webhook", "Admin updated webhook endpoint "+endpoint.URL, "webhook", id, nil)
+
+    c.JSON(http.StatusOK, gin.H{"webhook": endpoint})
+}
+
+// AdminRotateWebhookSecretHandler replaces an endpoint's signing secret and returns the new one
+func (h *Handler) AdminRotateWebhookSecretHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    endpoint, err := h.WebhookService.RotateSecret(id)
+    if err != nil {
+        h.logAdminAction(c, "admin_rotate_webhook_secret", "Admin rotated a webhook secret", "webhook", id, err)
+        h.webhookError(c, err)
+        return
+    }
+
+    h.logAdminAction(c, "admin_rotate_webhook_secret", "Admin rotated the secret of webhook endpoint "+endpoint.URL, "webhook", id, nil)
+
+    c.JSON(http.StatusOK, gin.H{
+        "webhook": endpoint,
+        "secret":  endpoint.Secret,
+    })
+}
+
+// AdminListWebhookDeliveriesHandler lists an endpoint's deliveries, filtered by status
+func (h *Handler) AdminListWebhookDeliveriesHandler(c *gin.Context) {
+    endpoint, err := h.WebhookService.Endpoint(c.Param("id"))
+    if err != nil {
+        h.webhookError(c, err)
+        return
+    }
+
+    limit, offset := parseLimitOffset(c)
+    deliveries, total, err := h.WebhookService.Deliveries(endpoint.UUID, c.Query("status"), limit, offset)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load webhook deliveries"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "total":      total,
+        "limit":      limit,
+        "offset":     offset,
+        "deliveries": deliveries,
+    })
+}
+
+// AdminGetWebhookDeliveryHandler returns a delivery with its payload and every attempt made
+func (h *Handler) AdminGetWebhookDeliveryHandler(c *gin.Context) {
+    delivery, err := h.WebhookService.Delivery(c.Param("id"))
+    if err != nil {
+        h.webhookError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"delivery": delivery})
+}
+
+// AdminRedeliverWebhookHandler sends a delivery again right away
+func (h *Handler) AdminRedeliverWebhookHandler(c *gin.Context) {
+    id := c.Param("id")
+
+    delivery, err := h.WebhookService.Redeliver(id)
+    if err != nil {
+        h.logAdminAction(c, "admin_redeliver_webhook", "Admin redelivered a webhook", "webhook_delivery", id, err)
+        h.webhookError(c, err)
+        return
+    }
+
+    h.logAdminAction(c, "admin_redeliver_webhook", "Admin redelivered "+delivery.EventType+" webhook", "webhook_delivery", id, nil)
+
+    c.JSON(http.StatusAccepted, gin.H{"delivery": delivery})
+}
+
+// webhookError responds with the status matching a webhook service error
+func (h *Handler) webhookError(c *gin.Context, err error) {
+    status := http.StatusInternalServerError
+    switch {
+    case errors.Is(err, services.ErrInvalidWebhook):
+        status = http.StatusBadRequest
+    case err.Error() == "webhook endpoint not found" || err.Error() == "webhook delivery not found":
+        status = http.StatusNotFound
+    case err.Error() == "webhook endpoint is disabled":
+        status = http.StatusConflict
+    }
+    c.JSON(status, gin.H{"error": err.Error()})
+}
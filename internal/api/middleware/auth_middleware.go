@@ -44,6 +44,8 @@ func AuthMiddleware(tokenService *auth.TokenService) gin.HandlerFunc {
         c.Set("address", claims.Address)
         c.Set("user_email", claims.Email)
         c.Set("wallet_address", claims.WalletAddress)
+        c.Set("role", claims.Role)
+        c.Set("permissions", claims.Permissions)
         
         c.Next()
     }
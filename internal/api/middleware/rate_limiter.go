@@ -0,0 +1,154 @@
+package middleware
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/gin-gonic/gin"
+)
+
+// RateLimiter is an in-process token bucket limiter keyed by arbitrary strings
+type RateLimiter struct {
+    buckets map[string]*tokenBucket
+    rate    float64 // tokens added per second
+    burst   float64 // bucket capacity
+    mu      sync.Mutex
+}
+
+type tokenBucket struct {
+    tokens   float64
+    lastSeen time.Time
+}
+
+// NewRateLimiter creates a limiter allowing requestsPerMinute sustained with the given burst
+func NewRateLimiter(requestsPerMinute int, burst int) *RateLimiter {
+    if burst <= 0 {
+        burst = requestsPerMinute
+    }
+
+    rl := &RateLimiter{
+        buckets: make(map[string]*tokenBucket),
+        rate:    float64(requestsPerMinute) / 60.0,
+        burst:   float64(burst),
+    }
+
+    // Start a goroutine to drop idle buckets
+    go rl.cleanupRoutine()
+
+    return rl
+}
+
+// Allow consumes a token for the key and reports whether the request may proceed.
+// When denied it also returns how long until a token is available.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    now := time.Now()
+    b, exists := rl.buckets[key]
+    if !exists {
+        b = &tokenBucket{tokens: rl.burst, lastSeen: now}
+        rl.buckets[key] = b
+    }
+
+    // Refill based on elapsed time
+    elapsed := now.Sub(b.lastSeen).Seconds()
+    b.tokens = math.Min(rl.burst, b.tokens+elapsed*rl.rate)
+    b.lastSeen = now
+
+    if b.tokens >= 1 {
+        b.tokens--
+        return true, 0
+    }
+
+    wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+    return false, wait
+}
+
+// cleanupRoutine periodically removes buckets that have fully refilled
+func (rl *RateLimiter) cleanupRoutine() {
+    ticker := time.NewTicker(10 * time.Minute)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        rl.cleanup()
+    }
+}
+
+// cleanup removes idle buckets
+func (rl *RateLimiter) cleanup() {
+    rl.mu.Lock()
+    defer rl.mu.Unlock()
+
+    fullAfter := time.Duration(rl.burst / rl.rate * float64(time.Second))
+    for key, b := range rl.buckets {
+        if time.Since(b.lastSeen) > fullAfter {
+            delete(rl.buckets, key)
+        }
+    }
+}
+
+// RateLimitMiddleware limits requests per client IP and route and, when the JSON body
+// carries a username, per username and route as well
+func RateLimitMiddleware(limiter *RateLimiter) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        route := c.FullPath()
+        if route == "" {
+            route = c.Request.URL.Path
+        }
+
+        keys := []string{fmt.Sprintf("ip:%s:%s", c.ClientIP(), route)}
+        if username := peekUsername(c); username != "" {
+            keys = append(keys, fmt.Sprintf("user:%s:%s", strings.ToLower(username), route))
+        }
+
+        for _, key := range keys {
+            allowed, retryAfter := limiter.Allow(key)
+            if !allowed {
+                seconds := int(math.Ceil(retryAfter.Seconds()))
+                c.Header("Retry-After", fmt.Sprintf("%d", seconds))
+                c.JSON(http.StatusTooManyRequests, gin.H{
+                    "error":       "Too many requests, please try again later",
+                    "retry_after": seconds,
+                })
+                c.Abort()
+                return
+            }
+        }
+
+        c.Next()
+    }
+}
+
+// peekUsername reads the username from a JSON body without consuming it
+func peekUsername(c *gin.Context) string {
+    if c.Request.Body == nil || !strings.Contains(c.GetHeader("Content-Type"), "application/json") {
+        return ""
+    }
+
+    body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+    if err != nil {
+        return ""
+    }
+    c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+    var payload struct {
+        Username string `json:"username"`
+        Email    string `json:"email"`
+    }
+    if err := json.Unmarshal(body, &payload); err != nil {
+        return ""
+    }
+
+    if payload.Username != "" {
+        return payload.Username
+    }
+    return payload.Email
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+    "net/http"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/gin-gonic/gin"
+    "gorm.io/gorm"
+)
+
+// LoadRole replaces the role and permissions of the token with the user's current ones, so a
+// revoked role stops working before the token expires. Must be used after AuthMiddleware and
+// before RequireRole and RequirePermission.
+func LoadRole(db *gorm.DB) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var user models.User
+        if err := db.Select("uuid", "role", "permissions").Where("uuid = ?", c.GetString("user_id")).First(&user).Error; err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+            c.Abort()
+            return
+        }
+
+        c.Set("role", user.GetRole())
+        c.Set("permissions", user.PermissionList())
+        c.Next()
+    }
+}
+
+// RequireRole allows the request through only if the authenticated user has one of the given roles.
+// Must be used after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        role := c.GetString("role")
+        for _, r := range roles {
+            if role == r {
+                c.Next()
+                return
+            }
+        }
+
+        c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
+        c.Abort()
+    }
+}
+
+// RequirePermission allows the request through only if the authenticated user holds every given permission.
+// Must be used after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        granted := make(map[string]bool)
+        if perms, ok := c.Get("permissions"); ok {
+            if list, ok := perms.([]string); ok {
+                for _, p := range list {
+                    granted[p] = true
+                }
+            }
+        }
+
+        for _, p := range permissions {
+            if !granted[p] {
+                c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission: " + p})
+                c.Abort()
+                return
+            }
+        }
+
+        c.Next()
+    }
+}
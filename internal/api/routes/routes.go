@@ -5,32 +5,63 @@ import (
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/api/handlers"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/api/middleware"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRoutes(router *gin.Engine, handler *handlers.Handler, authMiddleware gin.HandlerFunc, secretKey string, activityLogger *services.ActivityLoggerService) {
+    // Rate limiters for brute-force sensitive and upstream-heavy endpoints
+    authLimit := middleware.RateLimitMiddleware(middleware.NewRateLimiter(handler.Config.AuthRateLimit, handler.Config.AuthRateLimit))
+    quoteLimit := middleware.RateLimitMiddleware(middleware.NewRateLimiter(handler.Config.QuoteRateLimit, handler.Config.QuoteRateLimit))
+
     // API v1 group
     v1 := router.Group("/api/v1")
     {
         // Token quote endpoints
-        v1.GET("/quote/:token", handler.GetCifoQuoteHandler)
+        v1.GET("/quote/:token", quoteLimit, handler.GetCifoQuoteHandler)
 
         // Token conversion endpoints
-        v1.GET("/convert/token-to-eth", handler.CifoToEthHandler)
-        v1.GET("/convert/eth-to-token", handler.EthToCifoHandler)
+        v1.GET("/convert/token-to-eth", quoteLimit, handler.CifoToEthHandler)
+        v1.GET("/convert/eth-to-token", quoteLimit, handler.EthToCifoHandler)
 
         // On-ramp endpoint
         v1.POST("/onramp/session", handler.CreateOnRampSessionHandler)
 
         // Midtrans payment endpoints
-        v1.POST("/payment/midtrans", handler.CreateMidtransPaymentHandler)
+        v1.POST("/payment/midtrans", authMiddleware, handler.CreateMidtransPaymentHandler)
         v1.POST("/payment/midtrans/webhook", handler.ProcessMidtransWebhookHandler)
 
         v1.POST("/ethereum/account", handler.CreateAccountHandler)
         v1.POST("/ethereum/import", handler.ImportAccountHandler)
         v1.GET("/ethereum/balance/:address", handler.GetAccountBalanceHandler)
 
+        // Tokens shown in wallet portfolios
+        v1.GET("/tokens", handler.ListTokensHandler)
+
+        // Fee presets and operation fee quotes
+        v1.GET("/fees", quoteLimit, handler.GetFeesHandler)
+
+        // Sale round progress and the caller's remaining allocation
+        v1.GET("/sale/rounds", handler.GetSaleProgressHandler)
+        v1.GET("/sale/allocation", authMiddleware, handler.GetSaleAllocationHandler)
+        v1.GET("/sale/allowlist/proof", authMiddleware, handler.GetAllowlistProofHandler)
+
+        // Vesting schedules of purchases in vesting rounds and their claims
+        v1.GET("/vesting/schedules", authMiddleware, handler.GetVestingSchedulesHandler)
+        v1.POST("/vesting/schedules/:id/claim", authMiddleware, handler.ClaimVestingHandler)
+        v1.GET("/vesting/claims", authMiddleware, handler.GetVestingClaimsHandler)
+
+        // Referral code, commission balance and payouts
+        v1.GET("/referrals", authMiddleware, handler.GetReferralSummaryHandler)
+        v1.GET("/referrals/commissions", authMiddleware, handler.GetReferralCommissionsHandler)
+        v1.GET("/referrals/payouts", authMiddleware, handler.GetReferralPayoutsHandler)
+
+        // KYC verification and purchase limits
+        v1.POST("/kyc/applicants", authMiddleware, handler.StartKYCHandler)
+        v1.GET("/kyc/status", authMiddleware, handler.GetKYCStatusHandler)
+        v1.POST("/kyc/webhook", handler.KYCWebhookHandler)
+
         
 
         transactionGroup := v1.Group("/transactions")
@@ -40,11 +71,25 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler, authMiddleware g
         
             // Get details of a specific transaction by payment_id or UUID
             transactionGroup.GET("/:id", handler.GetTransactionStatusHandler)
+
+            // Download the invoice or receipt PDF of the authenticated user's purchase
+            transactionGroup.GET("/:id/invoice", authMiddleware, handler.GetTransactionInvoiceHandler)
+            transactionGroup.GET("/:id/receipt", authMiddleware, handler.GetTransactionReceiptHandler)
         
             // Get a list of transactions for the authenticated user (with pagination)
             transactionGroup.GET("", authMiddleware, handler.GetUserTransactionsHandler)
         }
 
+        // Transaction history exports for tax reporting
+        exportGroup := v1.Group("/exports")
+        {
+            exportGroup.Use(authMiddleware)
+            exportGroup.GET("/transactions", handler.ExportTransactionsHandler)
+            exportGroup.GET("", handler.ListExportsHandler)
+            exportGroup.GET("/:id", handler.GetExportHandler)
+            exportGroup.GET("/:id/download", handler.DownloadExportHandler)
+        }
+
         transakGroup := v1.Group("/transak")
         {
             transakGroup.Use(authMiddleware)
@@ -60,6 +105,10 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler, authMiddleware g
         v1.POST("/payment/midtrans-to-transak", authMiddleware, handler.CreateMidtransToTransakHandler)
         v1.POST("/payment/midtrans-to-transak/webhook", handler.ProcessMidtransTransakWebhookHandler)
         
+        // Crypto payments to per-order deposit addresses
+        v1.POST("/payment/crypto", authMiddleware, handler.CreateCryptoPaymentHandler)
+        v1.GET("/payment/crypto/:id", authMiddleware, handler.GetCryptoPaymentHandler)
+
         sendGroup := v1.Group("/send")
         {
             sendGroup.Use(authMiddleware)
@@ -80,8 +129,9 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler, authMiddleware g
         {
             // Existing endpoints
             authGroup.Use(middleware.ActivityLoggingMiddleware(activityLogger))
-            authGroup.POST("/login", handler.LoginHandler)
-            authGroup.POST("/login/2fa", handler.LoginWith2FAHandler)
+            authGroup.POST("/login", authLimit, handler.LoginHandler)
+            authGroup.POST("/login/2fa", authLimit, handler.LoginWith2FAHandler)
+            authGroup.POST("/unlock", authLimit, handler.UnlockAccountHandler)
 
             authGroup.POST("/register", handler.RegisterUserHandler)
             
@@ -90,14 +140,14 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler, authMiddleware g
             authGroup.POST("/logout", handler.LogoutHandler)
 
             // Recovery endpoints
-            authGroup.POST("/recovery/request", handler.RequestWalletRecoveryHandler)
-            authGroup.POST("/recovery/verify", handler.VerifyWalletRecoveryHandler)
+            authGroup.POST("/recovery/request", authLimit, handler.RequestWalletRecoveryHandler)
+            authGroup.POST("/recovery/verify", authLimit, handler.VerifyWalletRecoveryHandler)
 
             // 2FA endpoints
             authGroup.POST("/2fa/setup", handler.Setup2FAHandler)
             authGroup.POST("/2fa/verify", handler.Verify2FAHandler)
-            authGroup.POST("/2fa/recover", handler.Request2FARecovery)  // Add this line
-            authGroup.POST("/2fa/verify-recovery", handler.Verify2FARecoveryHandler)  // Add this line
+            authGroup.POST("/2fa/recover", authLimit, handler.Request2FARecovery)  // Add this line
+            authGroup.POST("/2fa/verify-recovery", authLimit, handler.Verify2FARecoveryHandler)  // Add this line
 
             // Protected routes (require authentication)
             protected := authGroup.Group("/")
@@ -111,22 +161,117 @@ func SetupRoutes(router *gin.Engine, handler *handlers.Handler, authMiddleware g
         {
             walletGroup.Use(authMiddleware)
                 walletGroup.GET("/balance", handler.GetUserWalletBalanceHandler)
+                walletGroup.GET("/portfolio", quoteLimit, handler.GetPortfolioHandler)
+                walletGroup.PUT("/currency", handler.UpdatePreferredCurrencyHandler)
+                walletGroup.GET("/accounts", handler.ListWalletAccountsHandler)
+                walletGroup.POST("/accounts", handler.DeriveWalletAccountHandler)
+                walletGroup.PUT("/accounts/:account", handler.UpdateWalletAccountHandler)
+                walletGroup.PUT("/accounts/:account/default", handler.SetDefaultWalletAccountHandler)
                 walletGroup.POST("/create", handler.CreateWalletHandler)
                 walletGroup.POST("/import", handler.ImportWalletHandler)
+                walletGroup.POST("/import/discover", quoteLimit, handler.DiscoverWalletAccountsHandler)
+                walletGroup.POST("/import/attach", handler.AttachWalletAccountsHandler)
                 walletGroup.POST("/swap", handler.SwapTokensHandler)
+                walletGroup.POST("/send", handler.SendFundsHandler)
+                walletGroup.GET("/allowances", quoteLimit, handler.ListAllowancesHandler)
+                walletGroup.POST("/allowances/revoke", handler.RevokeAllowancesHandler)
+                walletGroup.POST("/sign/preview", handler.PreviewSignatureHandler)
+                walletGroup.POST("/sign", handler.SignMessageHandler)
+                walletGroup.POST("/sign/permit", handler.SignPermitHandler)
+                walletGroup.GET("/signatures", handler.ListSignaturesHandler)
                 walletGroup.GET("/transactions", handler.GetWalletTransactionsHandler)
                 // Add new wallet backup and recovery routes
                 walletGroup.POST("/enable-backup", handler.EnableWalletBackupHandler)
                 walletGroup.POST("/recover", handler.RecoverWalletHandler)
+                walletGroup.POST("/backup/shares", handler.CreateShareBackupHandler)
+                walletGroup.POST("/backup/shares/recover", handler.RecoverFromSharesHandler)
+
+                // Non-custodial mode: the server builds, the user's wallet signs
+                walletGroup.PUT("/custody-mode", handler.UpdateCustodyModeHandler)
+                walletGroup.GET("/link/challenge", handler.GetWalletLinkChallengeHandler)
+                walletGroup.POST("/link", handler.LinkWalletHandler)
+                walletGroup.POST("/tx/build/transfer", handler.BuildTransferTxHandler)
+                walletGroup.POST("/tx/build/approve", handler.BuildApproveTxHandler)
+                walletGroup.POST("/tx/build/swap", handler.BuildSwapTxHandler)
+                walletGroup.POST("/tx/broadcast", handler.BroadcastSignedTxHandler)
+                walletGroup.GET("/tx/:hash", handler.GetWalletTxStatusHandler)
+        }
+
+        // Profile settings of the signed in user
+        userGroup := v1.Group("/user")
+        {
+            userGroup.Use(authMiddleware)
+            userGroup.PUT("/language", handler.UpdateLanguageHandler)
+        }
+
+        // Admin endpoints (authenticated, role and permission checked)
+        adminGroup := v1.Group("/admin")
+        {
+            adminGroup.Use(authMiddleware)
+            adminGroup.Use(middleware.LoadRole(handler.DB))
+            adminGroup.Use(middleware.RequireRole(models.RoleAdmin, models.RoleSupport))
+
+            adminGroup.GET("/users", middleware.RequirePermission(models.PermissionViewUsers), handler.AdminSearchUsersHandler)
+            adminGroup.GET("/users/:id", middleware.RequirePermission(models.PermissionViewUsers), handler.AdminGetUserHandler)
+            adminGroup.PUT("/users/:id/role", middleware.RequirePermission(models.PermissionManageUsers), handler.AdminUpdateUserRoleHandler)
+            adminGroup.PUT("/users/:id/kyc-level", middleware.RequirePermission(models.PermissionManageUsers), handler.AdminSetKYCLevelHandler)
+
+            adminGroup.GET("/transactions", middleware.RequirePermission(models.PermissionViewTransactions), handler.AdminSearchTransactionsHandler)
+            adminGroup.POST("/transactions/:id/refund", middleware.RequirePermission(models.PermissionProcessRefund), handler.AdminRefundTransactionHandler)
+            adminGroup.GET("/crypto-payments", middleware.RequirePermission(models.PermissionViewTransactions), handler.AdminListCryptoPaymentsHandler)
+            adminGroup.POST("/crypto-payments/:id/resolve", middleware.RequirePermission(models.PermissionProcessRefund), handler.AdminResolveCryptoPaymentHandler)
+
+            // Payment gateway contract operations
+            adminGroup.POST("/contract/token-price", middleware.RequirePermission(models.PermissionManageTokenPrice), handler.AdminUpdateTokenPriceHandler)
+            adminGroup.POST("/contract/gas-deposit", middleware.RequirePermission(models.PermissionManageGasDeposit), handler.AdminUpdateGasDepositHandler)
+            adminGroup.POST("/contract/gateway-signer", middleware.RequirePermission(models.PermissionManageSigners), handler.AdminUpdateGatewaySignerHandler)
+            adminGroup.POST("/contract/withdraw-fees", middleware.RequirePermission(models.PermissionWithdrawFees), handler.AdminWithdrawFeesHandler)
+
+            // Token registry
+            adminGroup.GET("/tokens", middleware.RequirePermission(models.PermissionManageTokens), handler.AdminListTokensHandler)
+            adminGroup.POST("/tokens", middleware.RequirePermission(models.PermissionManageTokens), handler.AdminRegisterTokenHandler)
+            adminGroup.PUT("/tokens/:id", middleware.RequirePermission(models.PermissionManageTokens), handler.AdminUpdateTokenHandler)
+
+            // Sale rounds
+            adminGroup.GET("/sale-rounds", middleware.RequirePermission(models.PermissionManageSale), handler.AdminListSaleRoundsHandler)
+            adminGroup.POST("/sale-rounds", middleware.RequirePermission(models.PermissionManageSale), handler.AdminCreateSaleRoundHandler)
+            adminGroup.PUT("/sale-rounds/:id", middleware.RequirePermission(models.PermissionManageSale), handler.AdminUpdateSaleRoundHandler)
+            adminGroup.GET("/sale-rounds/:id/allowlist", middleware.RequirePermission(models.PermissionManageSale), handler.AdminListAllowlistHandler)
+            adminGroup.PUT("/sale-rounds/:id/allowlist", middleware.RequirePermission(models.PermissionManageSale), handler.AdminUploadAllowlistHandler)
+            adminGroup.DELETE("/sale-rounds/:id/allowlist", middleware.RequirePermission(models.PermissionManageSale), handler.AdminClearAllowlistHandler)
+            adminGroup.POST("/sale-rounds/:id/allowlist/publish", middleware.RequirePermission(models.PermissionManageSale), handler.AdminPublishAllowlistRootHandler)
+
+            // Promo codes
+            adminGroup.GET("/promo-codes", middleware.RequirePermission(models.PermissionManageSale), handler.AdminListPromoCodesHandler)
+            adminGroup.POST("/promo-codes", middleware.RequirePermission(models.PermissionManageSale), handler.AdminCreatePromoCodeHandler)
+            adminGroup.PUT("/promo-codes/:id", middleware.RequirePermission(models.PermissionManageSale), handler.AdminUpdatePromoCodeHandler)
+
+            // Referral commissions and payouts
+            adminGroup.GET("/referrals/commissions", middleware.RequirePermission(models.PermissionViewTransactions), handler.AdminListReferralCommissionsHandler)
+            adminGroup.GET("/referrals/payouts", middleware.RequirePermission(models.PermissionViewTransactions), handler.AdminListReferralPayoutsHandler)
+            adminGroup.POST("/referrals/payouts", middleware.RequirePermission(models.PermissionPayReferrals), handler.AdminPayReferralsHandler)
+
+            // Email outbox
+            adminGroup.GET("/emails", middleware.RequirePermission(models.PermissionViewUsers), handler.AdminListEmailsHandler)
+            adminGroup.POST("/emails/:id/retry", middleware.RequirePermission(models.PermissionManageUsers), handler.AdminRetryEmailHandler)
+
+            // Partner webhooks
+            adminGroup.GET("/webhooks", middleware.RequirePermission(models.PermissionManageWebhooks), handler.AdminListWebhooksHandler)
+            adminGroup.POST("/webhooks", middleware.RequirePermission(models.PermissionManageWebhooks), handler.AdminCreateWebhookHandler)
+            adminGroup.PUT("/webhooks/:id", middleware.RequirePermission(models.PermissionManageWebhooks), handler.AdminUpdateWebhookHandler)
+            adminGroup.POST("/webhooks/:id/rotate-secret", middleware.RequirePermission(models.PermissionManageWebhooks), handler.AdminRotateWebhookSecretHandler)
+            adminGroup.GET("/webhooks/:id/deliveries", middleware.RequirePermission(models.PermissionManageWebhooks), handler.AdminListWebhookDeliveriesHandler)
+            adminGroup.GET("/webhook-deliveries/:id", middleware.RequirePermission(models.PermissionManageWebhooks), handler.AdminGetWebhookDeliveryHandler)
+            adminGroup.POST("/webhook-deliveries/:id/redeliver", middleware.RequirePermission(models.PermissionManageWebhooks), handler.AdminRedeliverWebhookHandler)
         }
 
         // CIFO token specific endpoints for convenience
         cifoGroup := v1.Group("/cifo")
         {
-            cifoGroup.GET("/quote", handler.GetCifoQuoteHandler)
-            cifoGroup.GET("/convert-to-eth", handler.CifoToEthHandler)
-            cifoGroup.GET("/convert-from-eth", handler.EthToCifoHandler)
-            cifoGroup.GET("/convert-from-fiat", handler.FiatToTokenHandler)
+            cifoGroup.GET("/quote", quoteLimit, handler.GetCifoQuoteHandler)
+            cifoGroup.GET("/convert-to-eth", quoteLimit, handler.CifoToEthHandler)
+            cifoGroup.GET("/convert-from-eth", quoteLimit, handler.EthToCifoHandler)
+            cifoGroup.GET("/convert-from-fiat", quoteLimit, handler.FiatToTokenHandler)
 
             // Health check endpoint
             cifoGroup.GET("/health", func(c *gin.Context) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/api/auth"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/api/handlers"
@@ -12,8 +13,12 @@ import (
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/database"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/services"
 	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/ethereum"
+	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/kyc"
+	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/mailer"
+	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/signer"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -59,20 +64,57 @@ func NewServer(cfg *config.Config) (*Server, error) {
         return nil, fmt.Errorf("no contract code found at address %s - verify you're connected to the correct network", cfg.PaymentGatewayAddress.Hex())
     }
 
+    // Initialize the hot wallet signer (local key, keystore file or remote signer)
+    hotWalletSigner, err := signer.NewFromConfig(context.Background(), signer.Config{
+        Type:             cfg.Signer.Type,
+        KeystorePath:     cfg.Signer.KeystorePath,
+        KeystorePassword: cfg.Signer.KeystorePassword,
+        RemoteURL:        cfg.Signer.RemoteURL,
+        Address:          cfg.Signer.Address,
+    }, cfg.PrivateKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize %s signer: %v", cfg.Signer.Type, err)
+    }
+    log.Printf("Using %s signer for hot wallet %s", cfg.Signer.Type, hotWalletSigner.Address().Hex())
+
+    // Fee caps the hot wallet refuses to exceed during gas spikes
+    feeCaps, err := blockchain.NewFeeCaps(cfg.HotWalletMaxFeeGwei, cfg.HotWalletMaxPriorityFeeGwei)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse hot wallet fee caps: %v", err)
+    }
+    if feeCaps.MaxFeePerGas != nil {
+        log.Printf("Hot wallet max fee capped at %s gwei", blockchain.FormatGwei(feeCaps.MaxFeePerGas))
+    }
+    if feeCaps.MaxPriorityFeePerGas != nil {
+        log.Printf("Hot wallet priority fee capped at %s gwei", blockchain.FormatGwei(feeCaps.MaxPriorityFeePerGas))
+    }
+
+    // Uniswap swaps only sign with their own WALLET_PRIVATE_KEY; without it swaps are disabled
+    // rather than spending from the hot wallet
+    var swapSigner signer.Signer
+    if cfg.WalletPrivateKey != "" {
+        swapSigner, err = signer.NewLocalSigner(cfg.WalletPrivateKey)
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize swap signer: %v", err)
+        }
+    }
+
     // Initialize Uniswap client
-    uniswapClient := ethereum.NewUniswapClient(ethClient.RPCClient, cfg)
+    uniswapClient := ethereum.NewUniswapClient(ethClient.RPCClient, cfg, swapSigner)
+    uniswapClient.SetFeeCaps(feeCaps)
 
     // Initialize payment gateway client
     // Pass the Ethereum client directly - your constructor should accept a client directly
 	paymentGateway, err := blockchain.NewPaymentGatewayClient(
         cfg.EthereumRPC,
         cfg.PaymentGatewayAddress.Hex(), 
-        cfg.PrivateKey,
+        hotWalletSigner,
     )
     
     if err != nil {
         return nil, fmt.Errorf("failed to initialize payment gateway client: %v", err)
     }
+    paymentGateway.SetFeeCaps(feeCaps)
 
     mainDB, err := database.Connect(cfg)
     if err != nil {
@@ -84,7 +126,12 @@ func NewServer(cfg *config.Config) (*Server, error) {
         log.Fatalf("Failed to connect to wallet database: %v", err)
     }
 
-    encryptionService, err := services.NewEncryptionService(cfg.WalletDB.EncryptKey)
+    keyProvider, err := services.NewKeyProvider(cfg)
+    if err != nil {
+        log.Fatalf("Failed to initialize key provider: %v", err)
+    }
+
+    encryptionService, err := services.NewEncryptionService(keyProvider, cfg.WalletDB.EncryptKey)
     if err != nil {
         log.Fatalf("Failed to initialize encryption service: %v", err)
     }
@@ -105,19 +152,20 @@ func NewServer(cfg *config.Config) (*Server, error) {
     // Initialize TOTP service
     totpService := auth.NewTOTPService("Web3Tokensale")
     
-    // Initialize recovery service
-    recoveryService := services.NewRecoveryService(
-        db,
-        cfg.SendGridAPIKey,
-        cfg.AppURL,
-        cfg.FromEmail,
-        cfg.FromName,
-    )
-
     if err != nil {
         return nil, fmt.Errorf("failed to initialize blockchain service: %v", err)
     }
 
+    // Initialize email outbox and recovery service
+    emailMailer, err := mailer.NewFromConfig(cfg.Email, cfg.SendGridAPIKey, mailer.Address{Name: cfg.FromName, Email: cfg.FromEmail})
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize mailer: %v", err)
+    }
+    emailService := services.NewEmailService(db, emailMailer, cfg.Email)
+    go emailService.Run(cfg.Email.PollInterval)
+
+    recoveryService := services.NewRecoveryService(db, emailService, cfg.AppURL)
+
     walletStorageService := services.NewWalletStorageService(
         walletDB,
         mainDB,
@@ -138,12 +186,173 @@ func NewServer(cfg *config.Config) (*Server, error) {
         common.HexToAddress(cfg.WrappedEthAddress),
         cfg.TokenAddress, // Now passing the address directly
     )
+    // Initialize admin service and promote configured operators
+    adminService := services.NewAdminService(db)
+    adminService.BootstrapAdmins(cfg.AdminUsernames)
+
+    // Initialize lockout service for brute-force protection
+    lockoutService := services.NewLockoutService(db, recoveryService, cfg.MaxLoginAttempts, cfg.LockoutDuration, cfg.UnlockTokenTTL)
+
+    // Initialize transaction builder for non-custodial users
+    txBuilderService, err := services.NewTxBuilderService(
+        db,
+        ethClient.Client,
+        common.HexToAddress(cfg.UniswapRouterAddress),
+        common.HexToAddress(cfg.WrappedEthAddress),
+        cfg.TokenAddress,
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize transaction builder: %v", err)
+    }
+
+    // Track wallet transactions from pending to confirmed or failed
+    go txBuilderService.TrackPending(cfg.WalletTxPollInterval)
+
+    // Watch managed wallets for incoming ETH and token deposits
+    if cfg.DepositWatcherEnabled {
+        depositWatcher := services.NewDepositWatcherService(
+            db,
+            ethClient.Client,
+            recoveryService,
+            uint64(cfg.DepositConfirmations),
+            uint64(cfg.DepositMaxBlocks),
+            uint64(cfg.DepositStartBlock),
+            cfg.TokenAddress,
+            cfg.StablecoinAddress,
+            common.HexToAddress(cfg.WrappedEthAddress),
+        )
+        go depositWatcher.Run(cfg.DepositPollInterval)
+    }
+
+    // Initialize custodial transfers signed with stored credentials
+    walletTransferService := services.NewWalletTransferService(walletStorageService, txBuilderService)
+
+    // Initialize wallet discovery for mnemonic imports
+    walletDiscoveryService := services.NewWalletDiscoveryService(ethClient.Client, cfg.TokenAddress, cfg.StablecoinAddress)
+
+    // Initialize the token registry with the configured tokens
+    tokenRegistryService := services.NewTokenRegistryService(db, ethClient.Client)
+    seedCtx, cancelSeed := context.WithTimeout(context.Background(), 30*time.Second)
+    tokenRegistryService.SeedToken(seedCtx, cfg.TokenAddress, models.TokenPriceSourceUniswap, "")
+    tokenRegistryService.SeedToken(seedCtx, cfg.StablecoinAddress, models.TokenPriceSourceFixed, "1")
+    tokenRegistryService.SeedToken(seedCtx, common.HexToAddress(cfg.WrappedEthAddress), models.TokenPriceSourceUniswap, "")
+    cancelSeed()
+
+    // Initialize portfolio balances through Multicall3
+    portfolioService, err := services.NewPortfolioService(db, ethClient.Client, priceService, tokenRegistryService, cfg.Multicall3Address)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize portfolio service: %v", err)
+    }
+
+    // Initialize allowance listing and revocation for the router and gateway spenders
+    allowanceService := services.NewAllowanceService(
+        tokenRegistryService,
+        walletTransferService,
+        map[common.Address]string{
+            common.HexToAddress(cfg.UniswapRouterAddress): "Uniswap Router",
+            cfg.PaymentGatewayAddress:                     "Payment Gateway",
+        },
+        uint64(cfg.AllowanceLookbackBlocks),
+    )
+
+    // Initialize message signing with permits for the gateway token
+    messageSigningService := services.NewMessageSigningService(db, walletTransferService, tokenRegistryService, cfg.TokenAddress)
+
+    // Initialize fee presets and operation quotes
+    feeService := services.NewFeeService(ethClient.Client, priceService, feeCaps)
+
+    // Initialize sale rounds enforced on purchases; vesting purchases are held by the hot wallet
+    saleRoundService := services.NewSaleRoundService(db, cfg.SaleReservationTTL, hotWalletSigner.Address().Hex())
+
+    // Initialize allowlists of private sale rounds
+    allowlistService := services.NewAllowlistService(db, saleRoundService, blockchainService.PaymentGateway)
+
+    // Initialize vesting schedules, claimed from the hot wallet
+    tokenClient, err := blockchain.NewTokenClient(cfg.EthereumRPC, cfg.TokenAddress.Hex(), hotWalletSigner)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize token client: %v", err)
+    }
+    tokenClient.SetFeeCaps(feeCaps)
+    vestingService := services.NewVestingService(db, tokenClient)
+    go vestingService.Run(cfg.TransferPollInterval)
+
+    // Initialize promo codes; swap purchase bonuses are sent from the hot wallet
+    promoService := services.NewPromoService(db, saleRoundService, tokenClient)
+    go promoService.Run(cfg.TransferPollInterval)
+
+    // Accept crypto payments to per-order deposit addresses when a deposit seed is configured
+    var cryptoPaymentService *services.CryptoPaymentService
+    if cfg.CryptoPaymentMnemonic != "" {
+        treasury := hotWalletSigner.Address()
+        if cfg.TreasuryAddress != "" {
+            treasury = common.HexToAddress(cfg.TreasuryAddress)
+        }
+        cryptoPaymentService, err = services.NewCryptoPaymentService(
+            db,
+            ethClient.Client,
+            blockchainService,
+            tokenRegistryService,
+            saleRoundService,
+            hotWalletSigner,
+            feeCaps,
+            cfg.CryptoPaymentMnemonic,
+            treasury,
+            cfg.StablecoinAddress,
+            cfg.CryptoPaymentTTL,
+            uint64(cfg.CryptoPaymentConfirmations),
+            int64(cfg.CryptoPaymentUnderpayTolerance),
+            cfg.CryptoPaymentProrateUnderpaid,
+        )
+        if err != nil {
+            return nil, fmt.Errorf("failed to initialize crypto payments: %v", err)
+        }
+        log.Printf("Crypto payments enabled, sweeping to %s", treasury.Hex())
+        go cryptoPaymentService.Run(cfg.CryptoPaymentPollInterval)
+    }
+
+    // Initialize KYC tiers with the configured verification provider
+    kycProvider, err := kyc.NewFromConfig(cfg.KYC, cfg.AppURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize KYC provider: %v", err)
+    }
+    kycService, err := services.NewKYCService(db, kycProvider, cfg.KYC.LimitsUSD)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize KYC service: %v", err)
+    }
+
+    // Initialize referral commissions, paid out from the hot wallet
+    referralService, err := services.NewReferralService(db, tokenClient, cfg.Referral, cfg.AppURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize referral service: %v", err)
+    }
+    go referralService.Run(cfg.Referral.PollInterval)
+
+    // Initialize purchase invoices and receipts, emailed once a purchase completes
+    invoiceService := services.NewInvoiceService(db, emailService, cfg.Invoice)
+    go invoiceService.Run(cfg.Invoice.PollInterval)
+
+    purchaseEmailService := services.NewPurchaseEmailService(db, emailService, cfg.Email)
+    go purchaseEmailService.Run(cfg.Invoice.PollInterval)
+
+    webhookService := services.NewWebhookService(db, cfg.Webhook)
+    go webhookService.Run(cfg.Webhook.PollInterval)
+
+    // Initialize transaction history exports, which also value new wallet transactions
+    taxExportService := services.NewTaxExportService(db, priceService, ethClient.Client, cfg.Export)
+    go taxExportService.Run(cfg.Export.PollInterval)
+
     // Initialize handlers
-    handler := handlers.NewHandler(db, priceService, blockchainService, cfg, tokenService, totpService, recoveryService, walletService, transakService, activityLogger,walletStorageService,encryptionService,swapService)
+    handler := handlers.NewHandler(db, priceService, blockchainService, cfg, tokenService, totpService, recoveryService, walletService, transakService, activityLogger,walletStorageService,encryptionService,swapService,adminService,lockoutService,txBuilderService,walletDiscoveryService,walletTransferService,tokenRegistryService,portfolioService,allowanceService,messageSigningService,feeService,cryptoPaymentService,saleRoundService,kycService,allowlistService,vestingService,referralService,promoService,invoiceService,taxExportService,emailService,webhookService)
 
     // Initialize router
     router := gin.Default()
 
+    // Only take the client IP from X-Forwarded-For when the request came through a known proxy.
+    // Rate limits, lockouts and login alerts are keyed on it.
+    if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+        return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+    }
+
     authMiddleware := middleware.AuthMiddleware(tokenService)
 
     // Setup routes
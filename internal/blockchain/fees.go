@@ -0,0 +1,123 @@
+package blockchain
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/big"
+    "strings"
+
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/ethclient"
+    "github.com/ethereum/go-ethereum/params"
+)
+
+// ErrFeeCapExceeded is returned when the network fee is above the configured cap
+var ErrFeeCapExceeded = errors.New("network fee exceeds the configured cap")
+
+// FeeCaps limits the fees the hot wallet pays per gas. A nil cap is not enforced.
+type FeeCaps struct {
+    MaxFeePerGas         *big.Int // Wei, also caps the gas price on legacy chains
+    MaxPriorityFeePerGas *big.Int // Wei
+}
+
+// NewFeeCaps parses fee caps given in gwei. Empty or zero values disable a cap.
+func NewFeeCaps(maxFeeGwei, maxPriorityFeeGwei string) (FeeCaps, error) {
+    maxFee, err := ParseGwei(maxFeeGwei)
+    if err != nil {
+        return FeeCaps{}, fmt.Errorf("invalid max fee: %w", err)
+    }
+    maxPriorityFee, err := ParseGwei(maxPriorityFeeGwei)
+    if err != nil {
+        return FeeCaps{}, fmt.Errorf("invalid max priority fee: %w", err)
+    }
+    if maxFee != nil && maxPriorityFee != nil && maxPriorityFee.Cmp(maxFee) > 0 {
+        return FeeCaps{}, fmt.Errorf("max priority fee is above the max fee")
+    }
+
+    return FeeCaps{MaxFeePerGas: maxFee, MaxPriorityFeePerGas: maxPriorityFee}, nil
+}
+
+// ParseGwei converts a decimal gwei amount to wei. Empty or zero values return nil.
+func ParseGwei(value string) (*big.Int, error) {
+    value = strings.TrimSpace(value)
+    if value == "" {
+        return nil, nil
+    }
+
+    gwei, ok := new(big.Float).SetPrec(256).SetString(value)
+    if !ok || gwei.Sign() < 0 {
+        return nil, fmt.Errorf("%q is not a gwei amount", value)
+    }
+
+    wei, _ := new(big.Float).Mul(gwei, big.NewFloat(params.GWei)).Int(nil)
+    if wei.Sign() == 0 {
+        return nil, nil
+    }
+
+    return wei, nil
+}
+
+// Enabled reports whether any cap is set
+func (f FeeCaps) Enabled() bool {
+    return f.MaxFeePerGas != nil || f.MaxPriorityFeePerGas != nil
+}
+
+// Apply sets EIP-1559 fees on the transactor, or a gas price on chains without a base fee.
+// The priority fee is lowered to its cap, but when the base fee alone leaves no room under
+// the max fee cap the transaction is refused rather than sent at spike prices.
+func (f FeeCaps) Apply(ctx context.Context, client *ethclient.Client, auth *bind.TransactOpts) error {
+    header, err := client.HeaderByNumber(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("failed to get latest block: %v", err)
+    }
+
+    if header.BaseFee == nil {
+        gasPrice, err := client.SuggestGasPrice(ctx)
+        if err != nil {
+            return fmt.Errorf("failed to suggest gas price: %v", err)
+        }
+        if f.MaxFeePerGas != nil && gasPrice.Cmp(f.MaxFeePerGas) > 0 {
+            return fmt.Errorf("%w: gas price %s gwei, cap %s gwei", ErrFeeCapExceeded, FormatGwei(gasPrice), FormatGwei(f.MaxFeePerGas))
+        }
+        auth.GasPrice = gasPrice
+        return nil
+    }
+
+    tip, err := client.SuggestGasTipCap(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to suggest priority fee: %v", err)
+    }
+    if f.MaxPriorityFeePerGas != nil && tip.Cmp(f.MaxPriorityFeePerGas) > 0 {
+        tip = new(big.Int).Set(f.MaxPriorityFeePerGas)
+    }
+
+    // Twice the base fee keeps the transaction includable through six full blocks
+    feeCap := new(big.Int).Add(new(big.Int).Mul(header.BaseFee, big.NewInt(2)), tip)
+    if f.MaxFeePerGas != nil {
+        if new(big.Int).Add(header.BaseFee, tip).Cmp(f.MaxFeePerGas) > 0 {
+            return fmt.Errorf("%w: base fee %s gwei, cap %s gwei", ErrFeeCapExceeded, FormatGwei(header.BaseFee), FormatGwei(f.MaxFeePerGas))
+        }
+        if feeCap.Cmp(f.MaxFeePerGas) > 0 {
+            feeCap = new(big.Int).Set(f.MaxFeePerGas)
+        }
+    }
+
+    auth.GasPrice = nil
+    auth.GasTipCap = tip
+    auth.GasFeeCap = feeCap
+    return nil
+}
+
+// FormatGwei formats a wei amount per gas in gwei
+func FormatGwei(wei *big.Int) string {
+    if wei == nil {
+        return "0"
+    }
+    gwei := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(params.GWei))
+    text := gwei.Text('f', 9)
+    if strings.Contains(text, ".") {
+        text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+    }
+    return text
+}
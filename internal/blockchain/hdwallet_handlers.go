@@ -67,10 +67,61 @@ func NewHDWalletFromMnemonic(mnemonic string) (*HDWallet, error) {
     }, nil
 }
 
+// DefaultDerivationPath is the standard Ethereum BIP-44 path template
+const DefaultDerivationPath = "m/44'/60'/0'/0/%d"
+
+// LedgerLiveDerivationPath is the path template Ledger Live uses, one hardened account per index
+const LedgerLiveDerivationPath = "m/44'/60'/%d'/0/0"
+
+// Derivation path layouts
+const (
+    PathLayoutBIP44      = "bip44"       // MetaMask, Trezor and most software wallets
+    PathLayoutLedgerLive = "ledger_live" // Ledger Live
+)
+
+// AccountPath returns the standard Ethereum derivation path for an account index
+func AccountPath(index uint32) string {
+    return fmt.Sprintf(DefaultDerivationPath, index)
+}
+
+// LayoutPath returns the derivation path of an account index in a layout
+func LayoutPath(layout string, index uint32) (string, error) {
+    switch layout {
+    case PathLayoutBIP44:
+        return AccountPath(index), nil
+    case PathLayoutLedgerLive:
+        return fmt.Sprintf(LedgerLiveDerivationPath, index), nil
+    default:
+        return "", fmt.Errorf("unsupported derivation layout: %s", layout)
+    }
+}
+
+// ParseAccountPath returns the layout and account index of a supported
+// derivation path. m/44'/60'/0'/0/0 is reported as BIP-44.
+func ParseAccountPath(path string) (string, uint32, error) {
+    parsed, err := accounts.ParseDerivationPath(path)
+    if err != nil {
+        return "", 0, fmt.Errorf("invalid derivation path: %v", err)
+    }
+
+    const hardened = 0x80000000
+    if len(parsed) != 5 || parsed[0] != hardened+44 || parsed[1] != hardened+60 || parsed[3] != 0 {
+        return "", 0, fmt.Errorf("unsupported derivation path: %s", path)
+    }
+
+    switch {
+    case parsed[2] == hardened && parsed[4] < hardened:
+        return PathLayoutBIP44, parsed[4], nil
+    case parsed[2] > hardened && parsed[4] == 0:
+        return PathLayoutLedgerLive, parsed[2] - hardened, nil
+    default:
+        return "", 0, fmt.Errorf("unsupported derivation path: %s", path)
+    }
+}
+
 // DeriveAccount derives a new account from the wallet using the standard Ethereum derivation path
 func (w *HDWallet) DeriveAccount(index uint32) (*Account, error) {
-    path := fmt.Sprintf("m/44'/60'/0'/0/%d", index)
-    return w.DeriveAccountFromPath(path)
+    return w.DeriveAccountFromPath(AccountPath(index))
 }
 
 // DeriveAccountFromPath derives a new account using a custom path
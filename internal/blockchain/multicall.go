@@ -0,0 +1,148 @@
+package blockchain
+
+import (
+    "context"
+    "fmt"
+    "math/big"
+    "strings"
+
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/ethclient"
+)
+
+// DefaultMulticall3Address is the Multicall3 deployment shared by most EVM chains
+const DefaultMulticall3Address = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+// multicallBatchSize is the number of calls sent in one aggregate3 request
+const multicallBatchSize = 500
+
+// Multicall3Call is a single call in an aggregate3 batch
+type Multicall3Call struct {
+    Target       common.Address
+    AllowFailure bool
+    CallData     []byte
+}
+
+// Multicall3Result is the outcome of a single call in an aggregate3 batch
+type Multicall3Result struct {
+    Success    bool
+    ReturnData []byte
+}
+
+// Multicall3 batches read-only contract calls into a single eth_call
+type Multicall3 struct {
+    client  *ethclient.Client
+    address common.Address
+    abi     abi.ABI
+}
+
+// NewMulticall3 creates a new Multicall3 contract instance
+func NewMulticall3(address common.Address, client *ethclient.Client) (*Multicall3, error) {
+    parsedABI, err := abi.JSON(strings.NewReader(Multicall3ABI))
+    if err != nil {
+        return nil, err
+    }
+
+    return &Multicall3{
+        client:  client,
+        address: address,
+        abi:     parsedABI,
+    }, nil
+}
+
+// Address returns the Multicall3 contract address
+func (m *Multicall3) Address() common.Address {
+    return m.address
+}
+
+// Aggregate3 runs the calls in batches and returns one result per call, in order
+func (m *Multicall3) Aggregate3(ctx context.Context, calls []Multicall3Call) ([]Multicall3Result, error) {
+    results := make([]Multicall3Result, 0, len(calls))
+
+    for start := 0; start < len(calls); start += multicallBatchSize {
+        end := start + multicallBatchSize
+        if end > len(calls) {
+            end = len(calls)
+        }
+
+        data, err := m.abi.Pack("aggregate3", calls[start:end])
+        if err != nil {
+            return nil, fmt.Errorf("failed to pack multicall: %w", err)
+        }
+
+        output, err := m.client.CallContract(ctx, ethereum.CallMsg{To: &m.address, Data: data}, nil)
+        if err != nil {
+            return nil, fmt.Errorf("multicall failed: %w", err)
+        }
+        if len(output) == 0 {
+            return nil, fmt.Errorf("no Multicall3 contract at %s", m.address.Hex())
+        }
+
+        unpacked, err := m.abi.Unpack("aggregate3", output)
+        if err != nil {
+            return nil, fmt.Errorf("failed to unpack multicall: %w", err)
+        }
+
+        batch := *abi.ConvertType(unpacked[0], new([]Multicall3Result)).(*[]Multicall3Result)
+        if len(batch) != end-start {
+            return nil, fmt.Errorf("multicall returned %d results for %d calls", len(batch), end-start)
+        }
+        results = append(results, batch...)
+    }
+
+    return results, nil
+}
+
+// PackGetEthBalance encodes a getEthBalance call, run against the Multicall3 contract itself
+func (m *Multicall3) PackGetEthBalance(account common.Address) ([]byte, error) {
+    return m.abi.Pack("getEthBalance", account)
+}
+
+// UnpackUint256 decodes a single uint256 return value
+func UnpackUint256(data []byte) (*big.Int, error) {
+    if len(data) != 32 {
+        return nil, fmt.Errorf("unexpected return data length %d", len(data))
+    }
+    return new(big.Int).SetBytes(data), nil
+}
+
+// Multicall3ABI is the subset of the Multicall3 ABI used for batched reads
+const Multicall3ABI = `[
+    {
+        "inputs": [
+            {
+                "components": [
+                    {"internalType": "address", "name": "target", "type": "address"},
+                    {"internalType": "bool", "name": "allowFailure", "type": "bool"},
+                    {"internalType": "bytes", "name": "callData", "type": "bytes"}
+                ],
+                "internalType": "struct Multicall3.Call3[]",
+                "name": "calls",
+                "type": "tuple[]"
+            }
+        ],
+        "name": "aggregate3",
+        "outputs": [
+            {
+                "components": [
+                    {"internalType": "bool", "name": "success", "type": "bool"},
+                    {"internalType": "bytes", "name": "returnData", "type": "bytes"}
+                ],
+                "internalType": "struct Multicall3.Result[]",
+                "name": "returnData",
+                "type": "tuple[]"
+            }
+        ],
+        "stateMutability": "payable",
+        "type": "function"
+    },
+    {
+        "inputs": [{"internalType": "address", "name": "addr", "type": "address"}],
+        "name": "getEthBalance",
+        "outputs": [{"internalType": "uint256", "name": "balance", "type": "uint256"}],
+        "stateMutability": "view",
+        "type": "function"
+    }
+]`
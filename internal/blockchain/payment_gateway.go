@@ -3,11 +3,12 @@ package blockchain
 import (
 	"bytes"
 	"context"
-	"crypto/ecdsa"
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 
@@ -18,6 +19,7 @@ import (
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/bindings/generated/fiattotokenpaymentgateway"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/bindings/generated/testtoken"
+	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/signer"
 )
 
 // PaymentStatus represents payment status in the contract
@@ -35,9 +37,10 @@ type PaymentGatewayClient struct {
     client         *ethclient.Client
     contractAddr   common.Address
     contract       *fiattotokenpaymentgateway.FiatToTokenPaymentGateway
-    privateKey     *ecdsa.PrivateKey
+    signer         signer.Signer
     tokenAddr      common.Address
     tokenContract  *testtoken.TestToken
+    feeCaps        FeeCaps
 }
 
 type PaymentDetails struct {
@@ -54,9 +57,9 @@ type PaymentDetails struct {
 // NewPaymentGatewayClient creates a new client to interact with the payment gateway contract
 
 func (c *PaymentGatewayClient) IsInitialized() bool {
-    return c != nil && c.client != nil && c.privateKey != nil && c.contract != nil
+    return c != nil && c.client != nil && c.signer != nil && c.contract != nil
 }
-func NewPaymentGatewayClient(rpcURL string, contractAddress string, privateKeyHex string) (*PaymentGatewayClient, error) {
+func NewPaymentGatewayClient(rpcURL string, contractAddress string, txSigner signer.Signer) (*PaymentGatewayClient, error) {
     // Connect to Ethereum node
     client, err := ethclient.Dial(rpcURL)
     if err != nil {
@@ -72,12 +75,6 @@ func NewPaymentGatewayClient(rpcURL string, contractAddress string, privateKeyHe
         return nil, fmt.Errorf("failed to instantiate payment gateway contract: %v", err)
     }
 
-    // Parse private key
-    privateKey, err := crypto.HexToECDSA(privateKeyHex)
-    if err != nil {
-        return nil, fmt.Errorf("failed to parse private key: %v", err)
-    }
-
     // Get token address from contract
     tokenAddr, err := contract.Token(&bind.CallOpts{})
     if err != nil {
@@ -94,7 +91,7 @@ func NewPaymentGatewayClient(rpcURL string, contractAddress string, privateKeyHe
         client:        client,
         contractAddr:  contractAddr,
         contract:      contract,
-        privateKey:    privateKey,
+        signer:        txSigner,
         tokenAddr:     tokenAddr,
         tokenContract: tokenContract,
     }, nil
@@ -103,7 +100,7 @@ func NewPaymentGatewayClient(rpcURL string, contractAddress string, privateKeyHe
 // CreatePayment initializes a payment in the contract
 func (c *PaymentGatewayClient) CreatePayment(ctx context.Context, paymentId string, tokenAmount *big.Int, fiatAmount *big.Int, gateway string, destinationWallet common.Address,gasDeposit *big.Int) (string, error) {
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return "",err
     }
@@ -113,6 +110,7 @@ func (c *PaymentGatewayClient) CreatePayment(ctx context.Context, paymentId stri
 
     // Create payment
     tx, err := c.contract.CreatePayment(auth, paymentId, tokenAmount, fiatAmount, gateway,destinationWallet)
+    unlock()
     if err != nil {
         return "",fmt.Errorf("failed to create payment: %v", err)
     }
@@ -142,7 +140,7 @@ func (c *PaymentGatewayClient) ProcessPaymentCallback(ctx context.Context, payme
     // If no signature provided, create one
     if signature == nil {
         var err error
-        signature, err = c.createPaymentSignature(paymentId, status)
+        signature, err = c.createPaymentSignature(ctx, paymentId, status)
         if err != nil {
             return "", fmt.Errorf("failed to create signature: %v", err)
         }
@@ -150,10 +148,11 @@ func (c *PaymentGatewayClient) ProcessPaymentCallback(ctx context.Context, payme
     }
 
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return "", fmt.Errorf("failed to create transactor: %v", err)
     }
+    defer unlock()
 
     
     // Get payment details first to make sure it exists
@@ -168,7 +167,7 @@ func (c *PaymentGatewayClient) ProcessPaymentCallback(ctx context.Context, payme
 
     // If no signature is provided, create one
     if signature == nil {
-        signature, err = c.createPaymentSignature(paymentId, status)
+        signature, err = c.createPaymentSignature(ctx, paymentId, status)
         if err != nil {
             return "", fmt.Errorf("failed to create signature: %v", err)
         }
@@ -176,11 +175,11 @@ func (c *PaymentGatewayClient) ProcessPaymentCallback(ctx context.Context, payme
 
     // Process payment with signature
     tx, err := c.contract.ProcessPaymentCallback(auth, paymentId, status, signature)
-    fmt.Printf("Processing payment callback: tx=%s", tx.Hash().Hex())
-    
+    unlock()
     if err != nil {
         return "", fmt.Errorf("failed to process payment callback: %v", err)
     }
+    fmt.Printf("Processing payment callback: tx=%s", tx.Hash().Hex())
 
     // Wait for the transaction to be mined
     receipt, err := bind.WaitMined(ctx, c.client, tx)
@@ -198,13 +197,14 @@ func (c *PaymentGatewayClient) ProcessPaymentCallback(ctx context.Context, payme
 // ProcessRefund processes a refund for a payment
 func (c *PaymentGatewayClient) ProcessRefund(ctx context.Context, paymentId string) error {
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Process refund
     tx, err := c.contract.ProcessRefund(auth, paymentId)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to process refund: %v", err)
     }
@@ -263,13 +263,14 @@ func (c *PaymentGatewayClient) CalculateTokenAmount(ctx context.Context, fiatAmo
 // WithdrawProcessingFees withdraws accumulated processing fees to owner
 func (c *PaymentGatewayClient) WithdrawProcessingFees(ctx context.Context) error {
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Withdraw fees
     tx, err := c.contract.WithdrawProcessingFees(auth)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to withdraw fees: %v", err)
     }
@@ -290,13 +291,14 @@ func (c *PaymentGatewayClient) WithdrawProcessingFees(ctx context.Context) error
 // UpdateGasDepositRequirement updates the required gas deposit
 func (c *PaymentGatewayClient) UpdateGasDepositRequirement(ctx context.Context, amount *big.Int) error {
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Update gas deposit requirement
     tx, err := c.contract.UpdateGasDepositRequirement(auth, amount)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to update gas deposit requirement: %v", err)
     }
@@ -317,13 +319,14 @@ func (c *PaymentGatewayClient) UpdateGasDepositRequirement(ctx context.Context,
 // UpdateTokenPrice updates the token price
 func (c *PaymentGatewayClient) UpdateTokenPrice(ctx context.Context, pricePerToken *big.Int) error {
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Update token price
     tx, err := c.contract.UpdateTokenPrice(auth, pricePerToken)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to update token price: %v", err)
     }
@@ -344,13 +347,14 @@ func (c *PaymentGatewayClient) UpdateTokenPrice(ctx context.Context, pricePerTok
 // UpdateGatewaySigner updates a gateway signer address
 func (c *PaymentGatewayClient) UpdateGatewaySigner(ctx context.Context, gateway string, signer common.Address) error {
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Update gateway signer
     tx, err := c.contract.UpdateGatewaySigner(auth, gateway, signer)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to update gateway signer: %v", err)
     }
@@ -368,16 +372,55 @@ func (c *PaymentGatewayClient) UpdateGatewaySigner(ctx context.Context, gateway
     return nil
 }
 
+// AllowlistRootABI is the allowlist extension of the payment gateway. The deployed gateway does not
+// have it yet; once it does, createPayment can check buyers against the root on-chain.
+const AllowlistRootABI = `[{"inputs":[{"internalType":"bytes32","name":"root","type":"bytes32"}],"name":"updateAllowlistRoot","outputs":[],"stateMutability":"nonpayable","type":"function"}]`
+
+// UpdateAllowlistRoot publishes the Merkle root of the sale allowlist to the gateway
+func (c *PaymentGatewayClient) UpdateAllowlistRoot(ctx context.Context, root common.Hash) (string, error) {
+    parsedABI, err := abi.JSON(strings.NewReader(AllowlistRootABI))
+    if err != nil {
+        return "", err
+    }
+
+    // Create a keyed transactor
+    auth, unlock, err := c.createTransactor(ctx)
+    if err != nil {
+        return "", err
+    }
+
+    // Update allowlist root
+    contract := bind.NewBoundContract(c.contractAddr, parsedABI, c.client, c.client, c.client)
+    tx, err := contract.Transact(auth, "updateAllowlistRoot", [32]byte(root))
+    unlock()
+    if err != nil {
+        return "", fmt.Errorf("failed to update allowlist root: %v", err)
+    }
+
+    // Wait for the transaction to be mined
+    receipt, err := bind.WaitMined(ctx, c.client, tx)
+    if err != nil {
+        return "", fmt.Errorf("transaction failed: %v", err)
+    }
+
+    if receipt.Status == 0 {
+        return "", fmt.Errorf("transaction reverted")
+    }
+
+    return receipt.TxHash.Hex(), nil
+}
+
 // MockPaymentCallback simulates a payment callback for testing
 func (c *PaymentGatewayClient) MockPaymentCallback(ctx context.Context, paymentId string, status uint8) error {
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Mock payment callback
     tx, err := c.contract.MockPaymentCallback(auth, paymentId, status)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to mock payment callback: %v", err)
     }
@@ -395,52 +438,58 @@ func (c *PaymentGatewayClient) MockPaymentCallback(ctx context.Context, paymentI
     return nil
 }
 
-// Helper function to create a transactor
-func (c *PaymentGatewayClient) createTransactor(ctx context.Context) (*bind.TransactOpts, error) {
+// Helper function to create a transactor. It holds the signer's sender lock until the returned
+// unlock is called, which must be right after the transaction is broadcast.
+func (c *PaymentGatewayClient) createTransactor(ctx context.Context) (*bind.TransactOpts, func(), error) {
     
 
     if c == nil {
-        return nil, fmt.Errorf("payment gateway client is nil")
+        return nil, nil, fmt.Errorf("payment gateway client is nil")
     }
 
     if c.client == nil {
-        return nil, fmt.Errorf("ethereum client is nil, client not properly initialized")
+        return nil, nil, fmt.Errorf("ethereum client is nil, client not properly initialized")
     }
 
-    if c.privateKey == nil {
-        return nil, fmt.Errorf("private key is nil, check key initialization")
-    }
-    // Get the current nonce
-    nonce, err := c.client.PendingNonceAt(ctx, crypto.PubkeyToAddress(c.privateKey.PublicKey))
-    if err != nil {
-        return nil, fmt.Errorf("failed to get nonce: %v", err)
+    if c.signer == nil {
+        return nil, nil, fmt.Errorf("signer is nil, check signer initialization")
     }
+    unlock := LockSender(c.signer.Address())
 
-    // Get gas price
-    gasPrice, err := c.client.SuggestGasPrice(ctx)
+    // Get the current nonce
+    nonce, err := c.client.PendingNonceAt(ctx, c.signer.Address())
     if err != nil {
-        return nil, fmt.Errorf("failed to suggest gas price: %v", err)
+        unlock()
+        return nil, nil, fmt.Errorf("failed to get nonce: %v", err)
     }
 
     // Get chain ID
     chainID, err := c.client.NetworkID(ctx)
     if err != nil {
-        return nil, fmt.Errorf("failed to get chain ID: %v", err)
+        unlock()
+        return nil, nil, fmt.Errorf("failed to get chain ID: %v", err)
     }
 
-    // Create auth
-    auth, err := bind.NewKeyedTransactorWithChainID(c.privateKey, chainID)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create transactor: %v", err)
-    }
+    // Create auth backed by the signer
+    auth := signer.NewTransactOpts(ctx, c.signer, chainID)
 
     auth.Nonce = big.NewInt(int64(nonce))
     auth.Value = big.NewInt(0)
     auth.GasLimit = uint64(3000000)
-    auth.GasPrice = gasPrice
     auth.Context = ctx
 
-    return auth, nil
+    // Set fees within the hot wallet caps
+    if err := c.feeCaps.Apply(ctx, c.client, auth); err != nil {
+        unlock()
+        return nil, nil, err
+    }
+
+    return auth, unlock, nil
+}
+
+// SetFeeCaps limits the fees of transactions sent by the hot wallet
+func (c *PaymentGatewayClient) SetFeeCaps(caps FeeCaps) {
+    c.feeCaps = caps
 }
 
 // GetOwner returns the contract owner
@@ -489,7 +538,7 @@ func (c *PaymentGatewayClient) CheckPaymentExists(ctx context.Context, paymentId
     return exists, nil
 }
 
-func (c *PaymentGatewayClient) createPaymentSignature(paymentId string, status uint8) ([]byte, error) {
+func (c *PaymentGatewayClient) createPaymentSignature(ctx context.Context, paymentId string, status uint8) ([]byte, error) {
     // Encode like abi.encodePacked(paymentId, status)
     var buf bytes.Buffer
     buf.WriteString(paymentId)
@@ -499,12 +548,8 @@ func (c *PaymentGatewayClient) createPaymentSignature(paymentId string, status u
     packed := buf.Bytes()
     hash := crypto.Keccak256Hash(packed)
 
-    // Apply Ethereum signed message prefix
-    prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n32")
-    prefixedHash := crypto.Keccak256Hash(append([]byte(prefix), hash.Bytes()...))
-
-    // Sign
-    signature, err := crypto.Sign(prefixedHash.Bytes(), c.privateKey)
+    // Sign with the Ethereum signed message prefix
+    signature, err := c.signer.SignPersonalMessage(ctx, hash.Bytes())
     if err != nil {
         return nil, err
     }
@@ -0,0 +1,97 @@
+package blockchain
+
+import (
+    "math/big"
+    "strings"
+
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ERC20Permit represents the EIP-2612 extension of an ERC20 token
+type ERC20Permit struct {
+    address  common.Address
+    contract *bind.BoundContract
+}
+
+// NewERC20Permit creates a new EIP-2612 token contract instance
+func NewERC20Permit(address common.Address, client *ethclient.Client) (*ERC20Permit, error) {
+    parsedABI, err := abi.JSON(strings.NewReader(ERC20PermitABI))
+    if err != nil {
+        return nil, err
+    }
+
+    return &ERC20Permit{
+        address:  address,
+        contract: bind.NewBoundContract(address, parsedABI, client, client, client),
+    }, nil
+}
+
+// Nonces gets the next permit nonce of the owner
+func (e *ERC20Permit) Nonces(opts *bind.CallOpts, owner common.Address) (*big.Int, error) {
+    var out []interface{}
+    if err := e.contract.Call(opts, &out, "nonces", owner); err != nil {
+        return nil, err
+    }
+
+    if len(out) == 0 {
+        return big.NewInt(0), nil
+    }
+
+    return out[0].(*big.Int), nil
+}
+
+// DomainSeparator gets the EIP-712 domain separator the token verifies permits against
+func (e *ERC20Permit) DomainSeparator(opts *bind.CallOpts) (common.Hash, error) {
+    var out []interface{}
+    if err := e.contract.Call(opts, &out, "DOMAIN_SEPARATOR"); err != nil {
+        return common.Hash{}, err
+    }
+
+    if len(out) == 0 {
+        return common.Hash{}, nil
+    }
+
+    return common.Hash(out[0].([32]byte)), nil
+}
+
+// Version gets the EIP-712 domain version, which not every permit token exposes
+func (e *ERC20Permit) Version(opts *bind.CallOpts) (string, error) {
+    var out []interface{}
+    if err := e.contract.Call(opts, &out, "version"); err != nil {
+        return "", err
+    }
+
+    if len(out) == 0 {
+        return "", nil
+    }
+
+    return out[0].(string), nil
+}
+
+// ERC20PermitABI is the read-only part of the EIP-2612 ABI
+const ERC20PermitABI = `[
+    {
+        "inputs": [{"internalType": "address", "name": "owner", "type": "address"}],
+        "name": "nonces",
+        "outputs": [{"internalType": "uint256", "name": "", "type": "uint256"}],
+        "stateMutability": "view",
+        "type": "function"
+    },
+    {
+        "inputs": [],
+        "name": "DOMAIN_SEPARATOR",
+        "outputs": [{"internalType": "bytes32", "name": "", "type": "bytes32"}],
+        "stateMutability": "view",
+        "type": "function"
+    },
+    {
+        "inputs": [],
+        "name": "version",
+        "outputs": [{"internalType": "string", "name": "", "type": "string"}],
+        "stateMutability": "view",
+        "type": "function"
+    }
+]`
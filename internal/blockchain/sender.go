@@ -0,0 +1,23 @@
+package blockchain
+
+import (
+    "sync"
+
+    "github.com/ethereum/go-ethereum/common"
+)
+
+// senders holds a lock per sending account, shared by every client in the process
+var senders sync.Map // common.Address -> *sync.Mutex
+
+// LockSender serializes the transactions of one account, from reading its pending nonce until the
+// signed transaction is broadcast, so workers sending from the same wallet cannot reuse a nonce.
+// It returns the unlock function, which may be called more than once.
+func LockSender(account common.Address) func() {
+    mu, _ := senders.LoadOrStore(account, &sync.Mutex{})
+    mu.(*sync.Mutex).Lock()
+
+    var once sync.Once
+    return func() {
+        once.Do(mu.(*sync.Mutex).Unlock)
+    }
+}
@@ -2,27 +2,48 @@ package blockchain
 
 import (
 	"context"
-	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"math/big"
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/bindings/generated/testtoken"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/signer"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+// Transfer outcomes that are known for sure. Any other transfer error means the transaction
+// may have been broadcast and its outcome has to be looked up with TransactionStatus.
+var (
+    ErrTxNotSent  = errors.New("transaction was not sent")
+    ErrTxReverted = errors.New("transaction reverted")
+)
+
+// TxStatus is what the node knows about a sent transaction
+type TxStatus int
+
+const (
+    TxStatusUnknown   TxStatus = iota // Not seen by the node, possibly dropped
+    TxStatusPending                   // Waiting to be mined
+    TxStatusSucceeded
+    TxStatusReverted
+)
+
 // TokenClient provides interaction with the TestToken contract
 type TokenClient struct {
     client       *ethclient.Client
     contractAddr common.Address
     contract     *testtoken.TestToken
-    privateKey   *ecdsa.PrivateKey
+    signer       signer.Signer
+    feeCaps      FeeCaps
 }
 
-// NewTokenClient creates a new client to interact with the TestToken contract
-func NewTokenClient(rpcURL string, contractAddress string, privateKeyHex string) (*TokenClient, error) {
+// NewTokenClient creates a new client to interact with the TestToken contract.
+// txSigner may be nil for a read-only client.
+func NewTokenClient(rpcURL string, contractAddress string, txSigner signer.Signer) (*TokenClient, error) {
     // Connect to Ethereum node
     client, err := ethclient.Dial(rpcURL)
     if err != nil {
@@ -38,20 +59,11 @@ func NewTokenClient(rpcURL string, contractAddress string, privateKeyHex string)
         return nil, fmt.Errorf("failed to instantiate token contract: %v", err)
     }
 
-    // Parse private key if provided
-    var privateKey *ecdsa.PrivateKey
-    if privateKeyHex != "" {
-        privateKey, err = crypto.HexToECDSA(privateKeyHex)
-        if err != nil {
-            return nil, fmt.Errorf("failed to parse private key: %v", err)
-        }
-    }
-
     return &TokenClient{
         client:       client,
         contractAddr: contractAddr,
         contract:     contract,
-        privateKey:   privateKey,
+        signer:       txSigner,
     }, nil
 }
 
@@ -85,51 +97,110 @@ func (c *TokenClient) GetAllowance(ctx context.Context, owner, spender common.Ad
     return c.contract.Allowance(&bind.CallOpts{Context: ctx}, owner, spender)
 }
 
-// Transfer transfers tokens to the given address
-func (c *TokenClient) Transfer(ctx context.Context, to common.Address, amount *big.Int) error {
-    if c.privateKey == nil {
-        return fmt.Errorf("private key not provided")
+// Transfer transfers tokens from the signer to the given address and returns the transaction hash.
+// Errors wrap ErrTxNotSent when nothing was broadcast and ErrTxReverted when the transfer reverted.
+func (c *TokenClient) Transfer(ctx context.Context, to common.Address, amount *big.Int) (string, error) {
+    tx, err := c.SendTransfer(ctx, to, amount, nil)
+    if err != nil {
+        if tx != nil {
+            return tx.Hash().Hex(), err
+        }
+        return "", err
     }
+    return tx.Hash().Hex(), c.WaitTransfer(ctx, tx)
+}
 
-    // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+// SendTransfer signs a transfer from the signer to the given address and broadcasts it without
+// waiting for it to be mined. When record is set it gets the hash before the broadcast, and an
+// error from it cancels the transfer. Errors wrap ErrTxNotSent when nothing was broadcast.
+func (c *TokenClient) SendTransfer(ctx context.Context, to common.Address, amount *big.Int, record func(txHash string) error) (*types.Transaction, error) {
+    if c.signer == nil {
+        return nil, fmt.Errorf("%w: signer not provided", ErrTxNotSent)
+    }
+
+    // Create a keyed transactor that only signs
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
-        return err
+        return nil, fmt.Errorf("%w: %v", ErrTxNotSent, err)
     }
+    defer unlock()
+    auth.NoSend = true
 
-    // Transfer tokens
     tx, err := c.contract.Transfer(auth, to, amount)
     if err != nil {
-        return fmt.Errorf("failed to transfer tokens: %v", err)
+        return nil, fmt.Errorf("%w: failed to transfer tokens: %v", ErrTxNotSent, err)
     }
 
-    // Wait for the transaction to be mined
+    if record != nil {
+        if err := record(tx.Hash().Hex()); err != nil {
+            return tx, fmt.Errorf("%w: %w", ErrTxNotSent, err)
+        }
+    }
+
+    if err := c.client.SendTransaction(ctx, tx); err != nil {
+        // A broadcast cut short may still have reached the node
+        if ctx.Err() != nil {
+            return tx, fmt.Errorf("broadcast interrupted: %v", err)
+        }
+        return tx, fmt.Errorf("%w: failed to broadcast transfer: %v", ErrTxNotSent, err)
+    }
+
+    return tx, nil
+}
+
+// WaitTransfer waits for a sent transfer to be mined
+func (c *TokenClient) WaitTransfer(ctx context.Context, tx *types.Transaction) error {
     receipt, err := bind.WaitMined(ctx, c.client, tx)
     if err != nil {
         return fmt.Errorf("transaction failed: %v", err)
     }
 
-    if receipt.Status == 0 {
-        return fmt.Errorf("transaction reverted")
+    if receipt.Status == types.ReceiptStatusFailed {
+        return ErrTxReverted
     }
 
     return nil
 }
 
+// TransactionStatus looks up a transaction sent by the client
+func (c *TokenClient) TransactionStatus(ctx context.Context, txHash string) (TxStatus, error) {
+    hash := common.HexToHash(txHash)
+
+    receipt, err := c.client.TransactionReceipt(ctx, hash)
+    if err == nil {
+        if receipt.Status == types.ReceiptStatusFailed {
+            return TxStatusReverted, nil
+        }
+        return TxStatusSucceeded, nil
+    }
+    if !errors.Is(err, ethereum.NotFound) {
+        return TxStatusUnknown, fmt.Errorf("failed to get receipt: %v", err)
+    }
+
+    if _, _, err := c.client.TransactionByHash(ctx, hash); err != nil {
+        if errors.Is(err, ethereum.NotFound) {
+            return TxStatusUnknown, nil
+        }
+        return TxStatusUnknown, fmt.Errorf("failed to get transaction: %v", err)
+    }
+    return TxStatusPending, nil
+}
+
 // Approve approves the spender to spend the given amount of tokens
 func (c *TokenClient) Approve(ctx context.Context, spender common.Address, amount *big.Int) error {
-    if c.privateKey == nil {
-        return fmt.Errorf("private key not provided")
+    if c.signer == nil {
+        return fmt.Errorf("signer not provided")
     }
 
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Approve tokens
     tx, err := c.contract.Approve(auth, spender, amount)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to approve tokens: %v", err)
     }
@@ -149,18 +220,19 @@ func (c *TokenClient) Approve(ctx context.Context, spender common.Address, amoun
 
 // TransferFrom transfers tokens from one address to another
 func (c *TokenClient) TransferFrom(ctx context.Context, from, to common.Address, amount *big.Int) error {
-    if c.privateKey == nil {
-        return fmt.Errorf("private key not provided")
+    if c.signer == nil {
+        return fmt.Errorf("signer not provided")
     }
 
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Transfer tokens
     tx, err := c.contract.TransferFrom(auth, from, to, amount)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to transfer tokens: %v", err)
     }
@@ -181,18 +253,19 @@ func (c *TokenClient) TransferFrom(ctx context.Context, from, to common.Address,
 // Mint mints new tokens and assigns them to the given address
 // Only the contract owner can call this function
 func (c *TokenClient) Mint(ctx context.Context, to common.Address, amount *big.Int) error {
-    if c.privateKey == nil {
-        return fmt.Errorf("private key not provided")
+    if c.signer == nil {
+        return fmt.Errorf("signer not provided")
     }
 
     // Create a keyed transactor
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return err
     }
 
     // Mint tokens
     tx, err := c.contract.Mint(auth, to, amount)
+    unlock()
     if err != nil {
         return fmt.Errorf("failed to mint tokens: %v", err)
     }
@@ -210,42 +283,48 @@ func (c *TokenClient) Mint(ctx context.Context, to common.Address, amount *big.I
     return nil
 }
 
+// SetFeeCaps limits the fees of transactions sent by the hot wallet
+func (c *TokenClient) SetFeeCaps(caps FeeCaps) {
+    c.feeCaps = caps
+}
+
 // GetOwner returns the contract owner
 func (c *TokenClient) GetOwner(ctx context.Context) (common.Address, error) {
     return c.contract.Owner(&bind.CallOpts{Context: ctx})
 }
 
-// Helper function to create a transactor
-func (c *TokenClient) createTransactor(ctx context.Context) (*bind.TransactOpts, error) {
-    // Get the current nonce
-    nonce, err := c.client.PendingNonceAt(ctx, crypto.PubkeyToAddress(c.privateKey.PublicKey))
-    if err != nil {
-        return nil, fmt.Errorf("failed to get nonce: %v", err)
-    }
+// Helper function to create a transactor. It holds the signer's sender lock until the returned
+// unlock is called, which must be right after the transaction is broadcast.
+func (c *TokenClient) createTransactor(ctx context.Context) (*bind.TransactOpts, func(), error) {
+    unlock := LockSender(c.signer.Address())
 
-    // Get gas price
-    gasPrice, err := c.client.SuggestGasPrice(ctx)
+    // Get the current nonce
+    nonce, err := c.client.PendingNonceAt(ctx, c.signer.Address())
     if err != nil {
-        return nil, fmt.Errorf("failed to suggest gas price: %v", err)
+        unlock()
+        return nil, nil, fmt.Errorf("failed to get nonce: %v", err)
     }
 
     // Get chain ID
     chainID, err := c.client.NetworkID(ctx)
     if err != nil {
-        return nil, fmt.Errorf("failed to get chain ID: %v", err)
+        unlock()
+        return nil, nil, fmt.Errorf("failed to get chain ID: %v", err)
     }
 
-    // Create auth
-    auth, err := bind.NewKeyedTransactorWithChainID(c.privateKey, chainID)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create transactor: %v", err)
-    }
+    // Create auth backed by the signer
+    auth := signer.NewTransactOpts(ctx, c.signer, chainID)
 
     auth.Nonce = big.NewInt(int64(nonce))
     auth.Value = big.NewInt(0)
     auth.GasLimit = uint64(300000)
-    auth.GasPrice = gasPrice
     auth.Context = ctx
 
-    return auth, nil
+    // Set fees within the hot wallet caps
+    if err := c.feeCaps.Apply(ctx, c.client, auth); err != nil {
+        unlock()
+        return nil, nil, err
+    }
+
+    return auth, unlock, nil
 }
\ No newline at end of file
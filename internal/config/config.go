@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -19,19 +21,86 @@ type Config struct {
     TokenAddress          common.Address           // CIFO token address
     WethAddress           common.Address           // WETH address
     PaymentGatewayAddress common.Address           // Payment gateway contract address
+    Multicall3Address     common.Address           // Multicall3 contract used for batched balance reads
     PrivateKey            string    
     WalletPrivateKey    string                   
 
+    // Hot wallet signer used for contract transactions
+    Signer SignerConfig
+
+    // Fee caps for hot wallet transactions in gwei, empty = no cap
+    HotWalletMaxFeeGwei         string
+    HotWalletMaxPriorityFeeGwei string
+
+    // How often pending wallet transactions are checked for receipts
+    WalletTxPollInterval time.Duration
+
+    // How often pending hot wallet transfers of booked tokens (vesting claims, promo bonuses) are checked for receipts
+    TransferPollInterval time.Duration
+
+    // Incoming deposit watcher
+    DepositWatcherEnabled bool
+    DepositConfirmations  int           // Blocks on top of a deposit before it is confirmed
+    DepositPollInterval   time.Duration // How often new blocks are scanned
+    DepositMaxBlocks      int           // Blocks scanned per pass at most
+    DepositStartBlock     int           // First block on a fresh database, 0 = near the head
+
+    // Blocks searched for a wallet's Approval logs, 0 = from genesis
+    AllowanceLookbackBlocks int
+
+    // Crypto payments to per-order deposit addresses
+    CryptoPaymentMnemonic          string        // Seed of the deposit addresses, empty disables crypto payments
+    CryptoPaymentTTL               time.Duration // How long an order accepts payment
+    CryptoPaymentConfirmations     int
+    CryptoPaymentPollInterval      time.Duration
+    CryptoPaymentUnderpayTolerance int    // Shortfall still accepted as paid in full, in basis points
+    CryptoPaymentProrateUnderpaid  bool   // Deliver expired underpaid orders pro rata instead of holding them
+    TreasuryAddress                string // Receives swept payments, empty = the hot wallet
+
+    // How long an unpaid order holds its sale round allocation
+    SaleReservationTTL time.Duration
+
+    // Identity verification and the purchase limits of each KYC level
+    KYC KYCConfig
+
+    // Referral commissions and their payouts
+    Referral ReferralConfig
+
+    // Purchase invoices and receipts
+    Invoice InvoiceConfig
+
+    // Transaction history exports for tax reporting
+    Export ExportConfig
+
+    // Signed webhooks sent to partner endpoints
+    Webhook WebhookConfig
+
     // jwt configuration
     JWTSecret     string
     JWTExpiration time.Duration
 
+    // Usernames promoted to admin on startup
+    AdminUsernames []string
+
+    // Brute-force protection
+    MaxLoginAttempts     int           // Failed attempts before an account is locked
+    LockoutDuration      time.Duration // First lockout duration, doubled on each repeat
+    AuthRateLimit        int           // Auth requests per minute per IP/username and route
+    QuoteRateLimit       int           // Quote requests per minute per IP and route
+    UnlockTokenTTL       time.Duration // How long an emailed unlock link stays valid
+
+    // Proxies whose X-Forwarded-For header is trusted for the client IP, none by default
+    TrustedProxies []string
+
     // Email/Recovery configuration
     SendGridAPIKey string
     AppURL         string
     FromEmail      string
     FromName       string
 
+    // Email delivery through the outbox
+    Email EmailConfig
+
     TransakAPIKey    string
     TransakSecretKey string
     TransakBaseURL  string
@@ -51,6 +120,72 @@ type Config struct {
     WrappedEthAddress    string
 }
 
+// SignerConfig selects how the hot wallet signs transactions
+type SignerConfig struct {
+    Type             string // local, keystore or remote
+    KeystorePath     string // Encrypted keystore file for the keystore signer
+    KeystorePassword string
+    RemoteURL        string // Web3Signer / eth_signTransaction JSON-RPC endpoint
+    Address          string // Account to use on the remote signer, defaults to the first one
+}
+
+// KYCConfig selects the identity verification provider and the purchase limits per level
+type KYCConfig struct {
+    Provider      string   // fake (local stand-in)
+    WebhookSecret string   // Verifies status webhooks from the provider
+    LimitsUSD     []string // level=daily/monthly/lifetime in USD, 0 = no limit
+}
+
+// ReferralConfig sets the commission tiers and caps of the referral program, amounts are in tokens
+type ReferralConfig struct {
+    TiersBps        []string      // referred buyers=commission in basis points, the highest reached tier applies
+    MaxPerPurchase  int           // Commission cap per purchase, 0 = no cap
+    MaxPerReferrer  int           // Lifetime commission cap per referrer, 0 = no cap
+    MinPayout       int           // Smallest balance paid out
+    PayoutBatchSize int           // Referrers paid per batch
+    PollInterval    time.Duration // How often completed purchases are credited
+    PayoutInterval  time.Duration // How often balances are paid out, 0 = only when an admin asks
+}
+
+// InvoiceConfig sets what purchase invoices and receipts show and when receipts are emailed
+type InvoiceConfig struct {
+    IssuerName    string        // Seller printed on every document
+    IssuerAddress string
+    ExplorerURL   string        // Block explorer the transaction hashes link to
+    PollInterval  time.Duration // How often completed purchases are checked for unsent receipts
+    EmailLookback time.Duration // Purchases completed longer ago than this are not emailed
+}
+
+// ExportConfig sets when transaction history exports run as background jobs and how long their files are kept
+type ExportConfig struct {
+    SyncLimit    int           // Records exported in the request at most, larger exports become jobs
+    MaxPending   int           // Queued and running jobs per user at most
+    PollInterval time.Duration // How often jobs are run and new wallet transactions valued
+    Retention    time.Duration // How long a finished export can be downloaded
+}
+
+// WebhookConfig tunes how purchase events are found and delivered to partner endpoints
+type WebhookConfig struct {
+    PollInterval time.Duration // How often purchases are checked for events and due deliveries sent
+    MaxAttempts  int           // Delivery attempts before a delivery is marked failed
+    Timeout      time.Duration // How long an endpoint has to respond
+    Lookback     time.Duration // Purchases that changed state longer ago than this raise no events
+}
+
+// EmailConfig selects how email is delivered and how the outbox retries failures
+type EmailConfig struct {
+    Driver           string // sendgrid, smtp or file, empty = sendgrid with an API key and file otherwise
+    SMTPHost         string
+    SMTPPort         int
+    SMTPUsername     string
+    SMTPPassword     string
+    FileDir          string        // Where the file driver writes .eml files
+    DefaultLanguage  string        // en or id, for recipients without an account
+    MaxAttempts      int           // Delivery attempts before an email is marked failed
+    PollInterval     time.Duration // How often the outbox is checked for due emails
+    PurchaseLookback time.Duration // Purchases that failed or were refunded longer ago than this are not emailed
+}
+
 type WalletDBConfig struct {
     Host        string
     User        string
@@ -58,7 +193,13 @@ type WalletDBConfig struct {
     DBName      string
     Port        string
     DBSSLMode  string
-    EncryptKey  string
+    EncryptKey  string // Legacy static key, still needed to read rows with key version 0
+
+    // Envelope encryption key hierarchy
+    KMSProvider      string // "static" (env keys) or "file" (local KMS stand-in)
+    KMSKeyDir        string // Directory holding vN.key files for the file provider
+    MasterKeys       string // "version:hexkey" pairs for the static provider
+    MasterKeyVersion int    // Version used for new data keys, 0 = highest available
 }
 
 func LoadConfig() (*Config, error) {
@@ -79,6 +220,7 @@ func LoadConfig() (*Config, error) {
     defaultCifo := "0x5FbDB2315678afecb367f032d93F642f64180aa3"        // TestToken
     defaultWeth := "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"        // WETH on Ethereum mainnet
     defaultPaymentGateway := "0xe7f1725E7734CE288F8367e1Bb143E90bb3F0512" // Replace with your actual contract address
+    defaultMulticall3 := "0xcA11bde05977b3631167028862bE2a173976CA11"     // Multicall3, same address on most chains
 
     config := &Config{
         Port:                  getEnv("PORT", "8080"),
@@ -89,16 +231,111 @@ func LoadConfig() (*Config, error) {
         TokenAddress:          common.HexToAddress(getEnv("TOKEN_ADDRESS", defaultCifo)),
         WethAddress:           common.HexToAddress(getEnv("WETH_ADDRESS", defaultWeth)),
         PaymentGatewayAddress: common.HexToAddress(getEnv("PAYMENT_GATEWAY_ADDRESS", defaultPaymentGateway)),
-        PrivateKey:            getEnv("PRIVATE_KEY", "1e88f382bfed1d0597d717d10063c1ea7149d106b36078edbe5913b5d8f0327e"), // Never include default private keys in code
+        Multicall3Address:     common.HexToAddress(getEnv("MULTICALL3_ADDRESS", defaultMulticall3)),
+        PrivateKey:            getEnv("PRIVATE_KEY", ""), // Only used by the local signer
+        WalletPrivateKey:      getEnv("WALLET_PRIVATE_KEY", ""),
+
+        Signer: SignerConfig{
+            Type:             getEnv("SIGNER_TYPE", "local"),
+            KeystorePath:     getEnv("SIGNER_KEYSTORE_PATH", ""),
+            KeystorePassword: getEnv("SIGNER_KEYSTORE_PASSWORD", ""),
+            RemoteURL:        getEnv("SIGNER_REMOTE_URL", ""),
+            Address:          getEnv("SIGNER_ADDRESS", ""),
+        },
+
+        HotWalletMaxFeeGwei:         getEnv("HOT_WALLET_MAX_FEE_GWEI", ""),
+        HotWalletMaxPriorityFeeGwei: getEnv("HOT_WALLET_MAX_PRIORITY_FEE_GWEI", ""),
+
+        WalletTxPollInterval: time.Duration(getEnvAsInt("WALLET_TX_POLL_SECONDS", 15)) * time.Second,
+
+        TransferPollInterval: time.Duration(getEnvAsInt("TRANSFER_POLL_SECONDS", 60)) * time.Second,
+
+        DepositWatcherEnabled: getEnv("DEPOSIT_WATCHER_ENABLED", "true") == "true",
+        DepositConfirmations:  getEnvAsInt("DEPOSIT_CONFIRMATIONS", 12),
+        DepositPollInterval:   time.Duration(getEnvAsInt("DEPOSIT_POLL_SECONDS", 15)) * time.Second,
+        DepositMaxBlocks:      getEnvAsInt("DEPOSIT_MAX_BLOCKS", 50),
+        DepositStartBlock:     getEnvAsInt("DEPOSIT_START_BLOCK", 0),
+
+        AllowanceLookbackBlocks: getEnvAsInt("ALLOWANCE_LOOKBACK_BLOCKS", 500000),
+
+        CryptoPaymentMnemonic:          getEnv("CRYPTO_PAYMENT_MNEMONIC", ""),
+        CryptoPaymentTTL:               time.Duration(getEnvAsInt("CRYPTO_PAYMENT_TTL_MINUTES", 30)) * time.Minute,
+        CryptoPaymentConfirmations:     getEnvAsInt("CRYPTO_PAYMENT_CONFIRMATIONS", 12),
+        CryptoPaymentPollInterval:      time.Duration(getEnvAsInt("CRYPTO_PAYMENT_POLL_SECONDS", 15)) * time.Second,
+        CryptoPaymentUnderpayTolerance: getEnvAsInt("CRYPTO_PAYMENT_UNDERPAY_TOLERANCE_BPS", 50),
+        CryptoPaymentProrateUnderpaid:  getEnv("CRYPTO_PAYMENT_PRORATE_UNDERPAID", "false") == "true",
+        TreasuryAddress:                getEnv("TREASURY_ADDRESS", ""),
+
+        SaleReservationTTL: time.Duration(getEnvAsInt("SALE_RESERVATION_MINUTES", 60)) * time.Minute,
+
+        KYC: KYCConfig{
+            Provider:      getEnv("KYC_PROVIDER", "fake"),
+            WebhookSecret: getEnv("KYC_WEBHOOK_SECRET", ""),
+            LimitsUSD:     getEnvAsSlice("KYC_LIMITS_USD", []string{"0=100/500/1000", "1=2000/10000/25000", "2=0/0/0"}),
+        },
+
+        Referral: ReferralConfig{
+            TiersBps:        getEnvAsSlice("REFERRAL_TIERS_BPS", []string{"0=500", "10=750", "50=1000"}),
+            MaxPerPurchase:  getEnvAsInt("REFERRAL_MAX_PER_PURCHASE", 0),
+            MaxPerReferrer:  getEnvAsInt("REFERRAL_MAX_PER_REFERRER", 0),
+            MinPayout:       getEnvAsInt("REFERRAL_MIN_PAYOUT", 10),
+            PayoutBatchSize: getEnvAsInt("REFERRAL_PAYOUT_BATCH_SIZE", 50),
+            PollInterval:    time.Duration(getEnvAsInt("REFERRAL_POLL_SECONDS", 60)) * time.Second,
+            PayoutInterval:  time.Duration(getEnvAsInt("REFERRAL_PAYOUT_HOURS", 0)) * time.Hour,
+        },
+
+        Invoice: InvoiceConfig{
+            IssuerName:    getEnv("INVOICE_ISSUER_NAME", "Web3 Tokensale"),
+            IssuerAddress: getEnv("INVOICE_ISSUER_ADDRESS", ""),
+            ExplorerURL:   getEnv("EXPLORER_URL", "https://etherscan.io"),
+            PollInterval:  time.Duration(getEnvAsInt("INVOICE_POLL_SECONDS", 60)) * time.Second,
+            EmailLookback: time.Duration(getEnvAsInt("INVOICE_EMAIL_LOOKBACK_HOURS", 72)) * time.Hour,
+        },
+
+        Export: ExportConfig{
+            SyncLimit:    getEnvAsInt("EXPORT_SYNC_LIMIT", 1000),
+            MaxPending:   getEnvAsInt("EXPORT_MAX_PENDING", 3),
+            PollInterval: time.Duration(getEnvAsInt("EXPORT_POLL_SECONDS", 30)) * time.Second,
+            Retention:    time.Duration(getEnvAsInt("EXPORT_RETENTION_DAYS", 7)) * 24 * time.Hour,
+        },
+
+        Webhook: WebhookConfig{
+            PollInterval: time.Duration(getEnvAsInt("WEBHOOK_POLL_SECONDS", 10)) * time.Second,
+            MaxAttempts:  getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 10),
+            Timeout:      time.Duration(getEnvAsInt("WEBHOOK_TIMEOUT_SECONDS", 10)) * time.Second,
+            Lookback:     time.Duration(getEnvAsInt("WEBHOOK_EVENT_LOOKBACK_HOURS", 72)) * time.Hour,
+        },
 
         JWTSecret:    getEnv("JWT_SECRET", "your_jwt_secret"),
         JWTExpiration: time.Duration(getEnvAsInt("JWT_EXPIRATION_HOURS", 24)) * time.Hour,
 
+        AdminUsernames: getEnvAsSlice("ADMIN_USERNAMES", nil),
+
+        MaxLoginAttempts: getEnvAsInt("MAX_LOGIN_ATTEMPTS", 5),
+        LockoutDuration:  time.Duration(getEnvAsInt("LOCKOUT_DURATION_MINUTES", 15)) * time.Minute,
+        AuthRateLimit:    getEnvAsInt("AUTH_RATE_LIMIT_PER_MINUTE", 10),
+        QuoteRateLimit:   getEnvAsInt("QUOTE_RATE_LIMIT_PER_MINUTE", 60),
+        UnlockTokenTTL:   time.Duration(getEnvAsInt("UNLOCK_TOKEN_TTL_MINUTES", 60)) * time.Minute,
+        TrustedProxies:   getEnvAsSlice("TRUSTED_PROXIES", nil),
+
         SendGridAPIKey: getEnv("SENDGRID_API_KEY", ""),
         AppURL:         getEnv("APP_URL", "http://localhost:3000"),
         FromEmail:      getEnv("FROM_EMAIL", "no-reply@example.com"),
         FromName:       getEnv("FROM_NAME", "Web3 Tokensale"),
 
+        Email: EmailConfig{
+            Driver:           getEnv("EMAIL_DRIVER", ""),
+            SMTPHost:         getEnv("SMTP_HOST", ""),
+            SMTPPort:         getEnvAsInt("SMTP_PORT", 587),
+            SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+            SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+            FileDir:          getEnv("EMAIL_FILE_DIR", "mail"),
+            DefaultLanguage:  getEnv("EMAIL_DEFAULT_LANGUAGE", "en"),
+            MaxAttempts:      getEnvAsInt("EMAIL_MAX_ATTEMPTS", 8),
+            PollInterval:     time.Duration(getEnvAsInt("EMAIL_POLL_SECONDS", 10)) * time.Second,
+            PurchaseLookback: time.Duration(getEnvAsInt("EMAIL_PURCHASE_LOOKBACK_HOURS", 72)) * time.Hour,
+        },
+
         
         TransakAPIKey:    getEnv("TRANSAK_API_KEY", ""),
         TransakSecretKey: getEnv("TRANSAK_SECRET_KEY", ""),
@@ -121,6 +358,11 @@ func LoadConfig() (*Config, error) {
             DBName:     getEnv("WALLET_DB_NAME", "wallet_credentials"),
             DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
             EncryptKey: getEnv("WALLET_DB_ENCRYPT_KEY", ""),
+
+            KMSProvider:      getEnv("WALLET_KMS_PROVIDER", "static"),
+            KMSKeyDir:        getEnv("WALLET_KMS_KEY_DIR", "./keys"),
+            MasterKeys:       getEnv("WALLET_DB_MASTER_KEYS", ""),
+            MasterKeyVersion: getEnvAsInt("WALLET_DB_MASTER_KEY_VERSION", 0),
         },
     }
 
@@ -129,9 +371,39 @@ func LoadConfig() (*Config, error) {
         log.Println("Warning: WALLET_DB_ENCRYPT_KEY should be 64 hex characters (32 bytes)")
     }
 
+    if err := config.validatePollIntervals(); err != nil {
+        return nil, err
+    }
+
     return config, nil
 }
 
+// validatePollIntervals rejects worker intervals that would panic time.NewTicker
+func (c *Config) validatePollIntervals() error {
+    intervals := []struct {
+        env      string
+        interval time.Duration
+    }{
+        {"WALLET_TX_POLL_SECONDS", c.WalletTxPollInterval},
+        {"TRANSFER_POLL_SECONDS", c.TransferPollInterval},
+        {"DEPOSIT_POLL_SECONDS", c.DepositPollInterval},
+        {"CRYPTO_PAYMENT_POLL_SECONDS", c.CryptoPaymentPollInterval},
+        {"REFERRAL_POLL_SECONDS", c.Referral.PollInterval},
+        {"INVOICE_POLL_SECONDS", c.Invoice.PollInterval},
+        {"EXPORT_POLL_SECONDS", c.Export.PollInterval},
+        {"WEBHOOK_POLL_SECONDS", c.Webhook.PollInterval},
+        {"EMAIL_POLL_SECONDS", c.Email.PollInterval},
+    }
+
+    for _, i := range intervals {
+        if i.interval <= 0 {
+            return fmt.Errorf("%s must be positive", i.env)
+        }
+    }
+
+    return nil
+}
+
 func getEnvAsInt(key string, defaultVal int) int {
     valueStr := getEnv(key, "")
     if valueStr == "" {
@@ -146,6 +418,22 @@ func getEnvAsInt(key string, defaultVal int) int {
     return value
 }
 
+func getEnvAsSlice(key string, defaultVal []string) []string {
+    valueStr := getEnv(key, "")
+    if valueStr == "" {
+        return defaultVal
+    }
+
+    var values []string
+    for _, v := range strings.Split(valueStr, ",") {
+        if v = strings.TrimSpace(v); v != "" {
+            values = append(values, v)
+        }
+    }
+
+    return values
+}
+
 func getEnv(key, defaultValue string) string {
     if value, exists := os.LookupEnv(key); exists {
         return value
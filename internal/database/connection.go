@@ -56,12 +56,81 @@ func Connect(cfg *config.Config) (*gorm.DB, error) {
 
 // autoMigrate automatically migrates the database schema
 func autoMigrate(db *gorm.DB) error {
-    return db.AutoMigrate(
+    if err := dedupeDeposits(db); err != nil {
+        return err
+    }
+
+    if err := db.AutoMigrate(
         &models.User{},
         &models.Recovery{},
         &models.Transaction{},
         &models.Wallet{},
+        &models.WalletTransaction{},
+        &models.ChainCursor{},
+        &models.Token{},
+        &models.MessageSignature{},
+        &models.CryptoPayment{},
+        &models.SaleRound{},
+        &models.AllowlistEntry{},
+        &models.VestingSchedule{},
+        &models.VestingClaim{},
+        &models.ReferralCommission{},
+        &models.ReferralPayout{},
+        &models.PromoCode{},
+        &models.PromoRedemption{},
+        &models.Invoice{},
+        &models.InvoiceSequence{},
+        &models.TaxExport{},
+        &models.ExchangeRate{},
+        &models.EmailOutbox{},
+        &models.WebhookEndpoint{},
+        &models.WebhookEvent{},
+        &models.WebhookDelivery{},
+        &models.WebhookAttempt{},
+        &models.KYCCheck{},
         &models.ActivityLog{},
         // Add other models here as needed
-    )
+    ); err != nil {
+        return err
+    }
+
+    return backfillDefaultWallets(db)
+}
+
+// dedupeDeposits removes duplicate deposit rows recorded before deposits had a unique
+// index, keeping the oldest, so the index can be created
+func dedupeDeposits(db *gorm.DB) error {
+    migrator := db.Migrator()
+    if !migrator.HasTable(&models.WalletTransaction{}) || migrator.HasIndex(&models.WalletTransaction{}, "idx_wallet_tx_deposit") {
+        return nil
+    }
+
+    if err := db.Exec(`DELETE FROM wallet_transactions a USING wallet_transactions b
+        WHERE a.direction = 'incoming' AND b.direction = 'incoming'
+        AND a.tx_hash = b.tx_hash AND a.log_index = b.log_index
+        AND a.wallet_address = b.wallet_address AND COALESCE(a.token_address, '') = COALESCE(b.token_address, '')
+        AND (a.created_at, a.uuid) > (b.created_at, b.uuid)`).Error; err != nil {
+        return fmt.Errorf("failed to remove duplicate deposits: %w", err)
+    }
+
+    return nil
+}
+
+// backfillDefaultWallets marks a default account for users whose wallets predate
+// is_default: the wallet matching users.wallet_address, otherwise the oldest one
+func backfillDefaultWallets(db *gorm.DB) error {
+    if err := db.Exec(`UPDATE wallets SET is_default = true FROM users
+        WHERE wallets.user_id = users.uuid AND LOWER(wallets.wallet_address) = LOWER(users.wallet_address)
+        AND NOT EXISTS (SELECT 1 FROM wallets d WHERE d.user_id = wallets.user_id AND d.is_default)`).Error; err != nil {
+        return fmt.Errorf("failed to backfill default wallets: %w", err)
+    }
+
+    if err := db.Exec(`UPDATE wallets SET is_default = true WHERE uuid IN (
+        SELECT DISTINCT ON (user_id) uuid FROM wallets w
+        WHERE NOT EXISTS (SELECT 1 FROM wallets d WHERE d.user_id = w.user_id AND d.is_default)
+        ORDER BY user_id, created_at ASC)`).Error; err != nil {
+        return fmt.Errorf("failed to backfill default wallets: %w", err)
+    }
+
+    return nil
 }
\ No newline at end of file
@@ -52,5 +52,6 @@ func autoMigrateWalletDB(db *gorm.DB) error {
         &models.EncryptedWallet{},
         &models.WalletMnemonic{},
         &models.WalletBackup{},
+        &models.WalletShare{},
     )
 }
\ No newline at end of file
@@ -0,0 +1,26 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Allowlist account kinds
+const (
+    AllowlistKindAddress = "address"
+    AllowlistKindEmail   = "email" // Only matched for users who passed KYC
+)
+
+// AllowlistEntry is a buyer allowed into a private sale round with their allocation and Merkle proof
+type AllowlistEntry struct {
+    UUID          uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    SaleRoundID   uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_allowlist_round_account" json:"sale_round_id"`
+    Kind          string    `gorm:"not null" json:"kind"`                                            // address or email
+    Account       string    `gorm:"not null;uniqueIndex:idx_allowlist_round_account" json:"account"` // Lowercase address or email
+    Allocation    float64   `gorm:"not null" json:"allocation"`                                      // Tokens the account may buy in the round
+    AllocationWei string    `gorm:"not null" json:"allocation_wei"`                                  // Allocation in the leaf, 18 decimals
+    Leaf          string    `gorm:"not null" json:"leaf"`
+    Proof         string    `gorm:"type:text;not null" json:"-"` // JSON array of hex hashes
+    CreatedAt     time.Time `json:"created_at"`
+}
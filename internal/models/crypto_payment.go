@@ -0,0 +1,69 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Crypto payment statuses
+const (
+    CryptoPaymentStatusAwaiting   = "awaiting_payment" // Nothing received yet
+    CryptoPaymentStatusConfirming = "confirming"       // Funds seen, waiting for confirmations
+    CryptoPaymentStatusPaid       = "paid"             // Accepted, tokens being delivered, retried until delivered
+    CryptoPaymentStatusCompleted  = "completed"        // Tokens delivered
+    CryptoPaymentStatusUnderpaid  = "underpaid"        // Expired short of the amount, held for review
+    CryptoPaymentStatusLate       = "late"             // Funds arrived after expiry, held for review
+    CryptoPaymentStatusExpired    = "expired"          // Expired with nothing received
+    CryptoPaymentStatusFailed     = "failed"           // Token delivery failed after every retry
+    CryptoPaymentStatusRefunded   = "refunded"         // Funds returned to the payer, no tokens delivered
+)
+
+// Crypto payment sweep statuses
+const (
+    SweepStatusPending  = "pending"  // Funds still on the deposit address
+    SweepStatusFunding  = "funding"  // Gas sent to the deposit address for a token sweep
+    SweepStatusSweeping = "sweeping" // Sweep transaction broadcast
+    SweepStatusSwept    = "swept"    // Funds moved to the treasury
+    SweepStatusDust     = "dust"     // ETH balance below the sweep fee, swept once it covers the fee
+)
+
+// Crypto payment resolutions an admin applies to held, failed or overpaid payments
+const (
+    CryptoPaymentResolveDeliver = "deliver" // Deliver the tokens, pro rata when short
+    CryptoPaymentResolveRefund  = "refund"  // Record a refund sent to the payer
+)
+
+// CryptoPayment is a purchase paid in ETH or a stablecoin to a deposit address derived for the order
+type CryptoPayment struct {
+    UUID             uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
+    TransactionID    uuid.UUID  `gorm:"type:uuid;uniqueIndex;not null" json:"transaction_id"`
+    UserID           uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+    Asset            string     `gorm:"not null" json:"asset"`   // ETH or the stablecoin symbol
+    AssetAddress     string     `json:"asset_address,omitempty"` // Empty for ETH
+    Decimals         uint8      `gorm:"not null" json:"decimals"`
+    DepositAddress   string     `gorm:"uniqueIndex;not null" json:"deposit_address"`
+    DerivationIndex  uint32     `gorm:"uniqueIndex;not null" json:"-"`
+    AmountDue        string     `gorm:"not null" json:"amount_due"`                // Smallest unit
+    AmountReceived   string     `gorm:"not null;default:0" json:"amount_received"` // Smallest unit, confirmed
+    ExcessAmount     string     `gorm:"not null;default:0" json:"excess_amount"`   // Overpayment to refund
+    PaymentURI       string     `gorm:"not null" json:"payment_uri"`               // EIP-681, also the QR payload
+    Status           string     `gorm:"not null;index" json:"status"`
+    ExpiresAt        time.Time  `gorm:"index" json:"expires_at"`
+    PaidAt           *time.Time `json:"paid_at,omitempty"`
+    DeliveryAttempts int        `gorm:"not null;default:0" json:"delivery_attempts"`
+    RefundTxHash     string     `json:"refund_tx_hash,omitempty"` // Refund of the payment, or of the excess of a completed one
+    ResolvedAt       *time.Time `json:"resolved_at,omitempty"`
+    ResolutionNote   string     `gorm:"type:text" json:"resolution_note,omitempty"`
+    SweepStatus      string     `gorm:"not null;default:pending;index" json:"sweep_status"`
+    GasTxHash        string     `json:"gas_tx_hash,omitempty"` // Hot wallet gas top-up for token sweeps
+    SweepTxHash      string     `json:"sweep_tx_hash,omitempty"`
+    SweptAt          *time.Time `json:"swept_at,omitempty"`
+    CreatedAt        time.Time  `json:"created_at"`
+    UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// IsOpen reports whether the payment is still watched for incoming funds
+func (p *CryptoPayment) IsOpen() bool {
+    return p.Status == CryptoPaymentStatusAwaiting || p.Status == CryptoPaymentStatusConfirming
+}
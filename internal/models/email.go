@@ -0,0 +1,43 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Email outbox statuses
+const (
+    EmailStatusPending = "pending" // Waiting for its next attempt
+    EmailStatusSent    = "sent"
+    EmailStatusFailed  = "failed" // Out of attempts
+)
+
+// Supported email languages
+const (
+    LanguageEnglish    = "en"
+    LanguageIndonesian = "id"
+)
+
+// EmailOutbox is a rendered email waiting to be delivered or kept as a delivery record.
+// Bodies of emails carrying secrets are cleared once sent.
+type EmailOutbox struct {
+    UUID          uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
+    UserID        *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+    Template      string     `gorm:"not null;index" json:"template"`
+    Language      string     `gorm:"not null" json:"language"`
+    ToEmail       string     `gorm:"not null;index" json:"to_email"`
+    ToName        string     `json:"to_name"`
+    Subject       string     `gorm:"not null" json:"subject"`
+    TextBody      string     `gorm:"type:text" json:"-"`
+    HTMLBody      string     `gorm:"type:text" json:"-"`
+    Attachments   []byte     `gorm:"type:bytea" json:"-"` // JSON list of mailer attachments
+    Sensitive     bool       `gorm:"not null;default:false" json:"sensitive"`
+    Status        string     `gorm:"not null;index" json:"status"`
+    Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+    NextAttemptAt time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+    LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+    SentAt        *time.Time `json:"sent_at,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+    UpdatedAt     time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Invoice kinds
+const (
+    InvoiceKindInvoice = "invoice" // Issued for every purchase
+    InvoiceKindReceipt = "receipt" // Issued once the purchase has completed
+)
+
+// Invoice is a numbered invoice or receipt of a purchase. The PDF is rendered whenever it is
+// downloaded, from the figures fixed when the document was issued and the purchase's current
+// status and transaction hashes.
+type Invoice struct {
+    UUID          uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
+    Number        string     `gorm:"uniqueIndex;not null" json:"number"` // INV-2025-000001 or RCT-2025-000001
+    Kind          string     `gorm:"not null;uniqueIndex:idx_invoice_transaction_kind" json:"kind"`
+    TransactionID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_invoice_transaction_kind" json:"transaction_id"`
+    UserID        uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+    IssuedAt      time.Time  `gorm:"not null" json:"issued_at"`
+    Figures       string     `gorm:"type:text" json:"-"` // JSON of the amounts, rates and wallet the document states
+    EmailedAt     *time.Time `json:"emailed_at,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+}
+
+// InvoiceSequence holds the last number used per kind and year, numbers restart every year
+type InvoiceSequence struct {
+    Kind string `gorm:"primaryKey"`
+    Year int    `gorm:"primaryKey;autoIncrement:false"`
+    Last int    `gorm:"not null"`
+}
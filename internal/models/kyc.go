@@ -0,0 +1,30 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// KYC verification statuses
+const (
+    KYCStatusNone     = "none"    // Never applied
+    KYCStatusPending  = "pending" // Waiting for documents or the provider's review
+    KYCStatusApproved = "approved"
+    KYCStatusRejected = "rejected"
+)
+
+// KYCCheck is one verification of a user for a KYC level at the provider
+type KYCCheck struct {
+    UUID        uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
+    UserID      uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+    Provider    string     `gorm:"not null" json:"provider"`
+    ApplicantID string     `gorm:"uniqueIndex;not null" json:"applicant_id"`
+    Level       int        `gorm:"not null" json:"level"` // Level applied for
+    Status      string     `gorm:"not null;index" json:"status"`
+    Reason      string     `json:"reason,omitempty"`   // Rejection reason from the provider
+    Documents   string     `gorm:"type:text" json:"-"` // Document results as JSON
+    ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+    CreatedAt   time.Time  `json:"created_at"`
+    UpdatedAt   time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Promo code types
+const (
+    PromoTypePercentBonus       = "percent_bonus"        // Value percent extra tokens
+    PromoTypeFixedDiscount      = "fixed_discount"       // Value off the fiat amount, in Currency
+    PromoTypeFirstPurchaseBonus = "first_purchase_bonus" // Value percent extra tokens on the user's first purchase
+)
+
+// PromoCode is a discount or token bonus buyers enter at checkout
+type PromoCode struct {
+    UUID           uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
+    Code           string     `gorm:"uniqueIndex;not null" json:"code"` // Stored uppercase
+    Type           string     `gorm:"not null" json:"type"`
+    Value          float64    `gorm:"not null" json:"value"`
+    Currency       string     `json:"currency,omitempty"`                             // IDR or USD, fixed discounts only
+    StartsAt       *time.Time `json:"starts_at,omitempty"`                            // Nil = valid right away
+    EndsAt         *time.Time `json:"ends_at,omitempty"`                              // Nil = never expires
+    MaxRedemptions int        `gorm:"not null;default:0" json:"max_redemptions"`      // Across all users, 0 = unlimited
+    MaxPerUser     int        `gorm:"not null" json:"max_per_user"`                   // 0 = unlimited
+    SaleRoundID    *uuid.UUID `gorm:"type:uuid;index" json:"sale_round_id,omitempty"` // Only valid in this round when set
+    Enabled        bool       `gorm:"not null" json:"enabled"`
+    CreatedAt      time.Time  `json:"created_at"`
+    UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// IsBonus reports whether the code adds tokens rather than lowering the price
+func (p *PromoCode) IsBonus() bool {
+    return p.Type == PromoTypePercentBonus || p.Type == PromoTypeFirstPurchaseBonus
+}
+
+// PromoRedemption records a code used on a purchase. It only counts towards the limits while its
+// transaction is paid or still reserved.
+type PromoRedemption struct {
+    UUID          uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    PromoCodeID   uuid.UUID `gorm:"type:uuid;index;not null" json:"promo_code_id"`
+    UserID        uuid.UUID `gorm:"type:uuid;index;not null" json:"user_id"`
+    TransactionID uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"transaction_id"`
+    DiscountFiat  float64   `gorm:"not null;default:0" json:"discount_fiat"`
+    BonusTokens   float64   `gorm:"not null;default:0" json:"bonus_tokens"`
+    CreatedAt     time.Time `json:"created_at"`
+}
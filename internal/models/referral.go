@@ -0,0 +1,62 @@
+package models
+
+import (
+    "math/big"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Referral commission statuses
+const (
+    ReferralCommissionStatusAccrued  = "accrued"  // In the referrer's balance
+    ReferralCommissionStatusPaid     = "paid"     // Part of a payout
+    ReferralCommissionStatusRejected = "rejected" // Failed an anti-abuse check, see Reason
+)
+
+// Referral payout statuses
+const (
+    ReferralPayoutStatusPending   = "pending"
+    ReferralPayoutStatusCompleted = "completed"
+    ReferralPayoutStatusFailed    = "failed"
+)
+
+// ReferralCommission is what a referrer earns on one completed purchase of a referred user, in tokens
+type ReferralCommission struct {
+    UUID          uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
+    ReferrerID    uuid.UUID  `gorm:"type:uuid;index;not null" json:"referrer_id"`
+    RefereeID     uuid.UUID  `gorm:"type:uuid;index;not null" json:"referee_id"`
+    TransactionID uuid.UUID  `gorm:"type:uuid;uniqueIndex;not null" json:"transaction_id"`
+    TokenAmount   float64    `gorm:"not null" json:"token_amount"` // Tokens bought
+    RateBps       int        `gorm:"not null" json:"rate_bps"`     // Rate of the referrer's tier
+    Amount        float64    `gorm:"not null" json:"amount"`       // After the caps
+    Status        string     `gorm:"not null;index" json:"status"`
+    Reason        string     `json:"reason,omitempty"`
+    PayoutID      *uuid.UUID `gorm:"type:uuid;index" json:"payout_id,omitempty"`
+    CreatedAt     time.Time  `json:"created_at"`
+    UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// ReferralPayout sends a referrer's accrued commissions from the hot wallet in one transfer
+type ReferralPayout struct {
+    UUID          uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    ReferrerID    uuid.UUID `gorm:"type:uuid;index;not null" json:"referrer_id"`
+    WalletAddress string    `gorm:"not null" json:"wallet_address"`
+    Amount        float64   `gorm:"not null" json:"amount"`
+    Commissions   int       `gorm:"not null" json:"commissions"`
+    Status        string    `gorm:"not null;index" json:"status"`
+    TxHash        string    `json:"tx_hash,omitempty"`
+    ErrorMessage  string    `json:"error_message,omitempty"`
+    CreatedAt     time.Time `json:"created_at"`
+    UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// AmountInWei converts the payout amount to wei (with 18 decimals)
+func (p *ReferralPayout) AmountInWei() *big.Int {
+    amount := new(big.Float).Mul(
+        big.NewFloat(p.Amount),
+        new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)),
+    )
+    amountInt, _ := amount.Int(nil)
+    return amountInt
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+    "sort"
+    "strings"
+)
+
+// Role constants
+const (
+    RoleUser    = "user"
+    RoleSupport = "support"
+    RoleAdmin   = "admin"
+)
+
+// Permission constants
+const (
+    PermissionViewUsers        = "users:read"
+    PermissionManageUsers      = "users:write"
+    PermissionViewTransactions = "transactions:read"
+    PermissionProcessRefund    = "transactions:refund"
+    PermissionManageTokenPrice = "contract:token_price"
+    PermissionManageGasDeposit = "contract:gas_deposit"
+    PermissionManageSigners    = "contract:signers"
+    PermissionWithdrawFees     = "contract:withdraw_fees"
+    PermissionManageTokens     = "tokens:write"
+    PermissionManageSale       = "sale:write"
+    PermissionPayReferrals     = "referrals:payout"
+    PermissionManageWebhooks   = "webhooks:write"
+)
+
+// AllPermissions lists every permission that can be granted
+var AllPermissions = []string{
+    PermissionViewUsers,
+    PermissionManageUsers,
+    PermissionViewTransactions,
+    PermissionProcessRefund,
+    PermissionManageTokenPrice,
+    PermissionManageGasDeposit,
+    PermissionManageSigners,
+    PermissionWithdrawFees,
+    PermissionManageTokens,
+    PermissionManageSale,
+    PermissionPayReferrals,
+    PermissionManageWebhooks,
+}
+
+// RolePermissions maps each role to the permissions it grants
+var RolePermissions = map[string][]string{
+    RoleUser: {},
+    RoleSupport: {
+        PermissionViewUsers,
+        PermissionViewTransactions,
+    },
+    RoleAdmin: {
+        PermissionViewUsers,
+        PermissionManageUsers,
+        PermissionViewTransactions,
+        PermissionProcessRefund,
+        PermissionManageTokenPrice,
+        PermissionManageGasDeposit,
+        PermissionManageSigners,
+        PermissionWithdrawFees,
+        PermissionManageTokens,
+        PermissionManageSale,
+        PermissionPayReferrals,
+        PermissionManageWebhooks,
+    },
+}
+
+// IsValidRole reports whether the role is known
+func IsValidRole(role string) bool {
+    _, ok := RolePermissions[role]
+    return ok
+}
+
+// IsValidPermission reports whether the permission is known
+func IsValidPermission(permission string) bool {
+    for _, p := range AllPermissions {
+        if p == permission {
+            return true
+        }
+    }
+    return false
+}
+
+// GetRole returns the user's role, falling back to the default user role
+func (u *User) GetRole() string {
+    if u.Role == "" {
+        return RoleUser
+    }
+    return u.Role
+}
+
+// PermissionList returns the effective permissions of the user (role grants plus extra grants)
+func (u *User) PermissionList() []string {
+    set := make(map[string]bool)
+    for _, p := range RolePermissions[u.GetRole()] {
+        set[p] = true
+    }
+    for _, p := range strings.Split(u.Permissions, ",") {
+        if p = strings.TrimSpace(p); p != "" {
+            set[p] = true
+        }
+    }
+
+    perms := make([]string, 0, len(set))
+    for p := range set {
+        perms = append(perms, p)
+    }
+    sort.Strings(perms)
+    return perms
+}
+
+// HasPermission checks whether the user holds the given permission
+func (u *User) HasPermission(permission string) bool {
+    for _, p := range u.PermissionList() {
+        if p == permission {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// SaleRound is a stage of the token sale (presale, public, ...) with its own window, price and caps.
+// Amounts are in tokens.
+type SaleRound struct {
+    UUID        uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    Name        string    `gorm:"uniqueIndex;not null" json:"name"`
+    StartsAt    time.Time `gorm:"index;not null" json:"starts_at"`
+    EndsAt      time.Time `gorm:"index;not null" json:"ends_at"`
+    PriceUSD    float64   `gorm:"not null" json:"price_usd"`              // Price of one token
+    HardCap     float64   `gorm:"not null" json:"hard_cap"`               // Tokens for sale in the round
+    SoftCap     float64   `gorm:"not null;default:0" json:"soft_cap"`     // Tokens that must sell for the round to succeed
+    MinPurchase float64   `gorm:"not null;default:0" json:"min_purchase"` // Per purchase, 0 = no minimum
+    MaxPerUser  float64   `gorm:"not null;default:0" json:"max_per_user"` // Per user across the round, 0 = no maximum
+    Enabled     bool      `gorm:"not null;default:true" json:"enabled"`
+    CreatedAt   time.Time `json:"created_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+
+    // Merkle root of the round's allowlist; when set only listed buyers may purchase, up to their allocation
+    AllowlistRoot   string `json:"allowlist_root,omitempty"`
+    AllowlistRootTx string `json:"allowlist_root_tx,omitempty"` // Transaction that published the root to the payment gateway
+
+    // Vesting of the round's purchases: nothing before the cliff, then linear until VestingDays after the purchase
+    VestingCliffDays int `gorm:"not null;default:0" json:"vesting_cliff_days"`
+    VestingDays      int `gorm:"not null;default:0" json:"vesting_days"` // 0 = tokens are delivered to the buyer right away
+}
+
+// IsPrivate reports whether the round only sells to its allowlist
+func (r *SaleRound) IsPrivate() bool {
+    return r.AllowlistRoot != ""
+}
+
+// Vests reports whether the round's purchases are released through vesting schedules
+func (r *SaleRound) Vests() bool {
+    return r.VestingDays > 0
+}
+
+// IsActive reports whether the round accepts purchases at the given time
+func (r *SaleRound) IsActive(now time.Time) bool {
+    return r.Enabled && !now.Before(r.StartsAt) && now.Before(r.EndsAt)
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Message signing methods
+const (
+    SignMethodPersonal  = "personal_sign"
+    SignMethodTypedData = "eth_signTypedData_v4"
+)
+
+// MessageSignature is the audit record of a message signed with a custodial key
+type MessageSignature struct {
+    UUID              uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    UserID            uuid.UUID `gorm:"index;not null" json:"user_id"`
+    WalletAddress     string    `gorm:"index;not null" json:"wallet_address"`
+    Method            string    `gorm:"not null" json:"method"` // personal_sign or eth_signTypedData_v4
+    PrimaryType       string    `json:"primary_type,omitempty"`
+    DomainName        string    `json:"domain_name,omitempty"`
+    VerifyingContract string    `json:"verifying_contract,omitempty"`
+    ChainID           string    `json:"chain_id,omitempty"`
+    Digest            string    `gorm:"index;not null" json:"digest"` // Hash that was signed
+    Summary           string    `gorm:"type:text" json:"summary"`     // Human-readable preview shown before signing
+    Payload           string    `gorm:"type:text" json:"payload"`     // Message or typed data JSON
+    Signature         string    `gorm:"not null" json:"signature"`
+    IPAddress         string    `json:"ip_address"`
+    UserAgent         string    `json:"user_agent"`
+    CreatedAt         time.Time `json:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Tax export statuses
+const (
+    TaxExportStatusPending    = "pending"
+    TaxExportStatusProcessing = "processing"
+    TaxExportStatusCompleted  = "completed"
+    TaxExportStatusFailed     = "failed"
+)
+
+// TaxExport is an asynchronous export of a user's transaction history. The file is kept until
+// ExpiresAt and then dropped.
+type TaxExport struct {
+    UUID         uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
+    UserID       uuid.UUID  `gorm:"type:uuid;index;not null" json:"user_id"`
+    Format       string     `gorm:"not null" json:"format"`   // csv or json
+    Currency     string     `gorm:"not null" json:"currency"` // IDR or USD
+    PeriodStart  time.Time  `gorm:"not null" json:"from"`
+    PeriodEnd    time.Time  `gorm:"not null" json:"to"` // Exclusive
+    Status       string     `gorm:"not null;index" json:"status"`
+    Records      int        `gorm:"not null;default:0" json:"records"`
+    Content      []byte     `gorm:"type:bytea" json:"-"`
+    ErrorMessage string     `json:"error_message,omitempty"`
+    CompletedAt  *time.Time `json:"completed_at,omitempty"`
+    ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+    CreatedAt    time.Time  `json:"created_at"`
+    UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// ExchangeRate is the daily rate of a currency against USD, recorded so that past trades are
+// valued at the rate of their day
+type ExchangeRate struct {
+    Date     string  `gorm:"primaryKey;size:10"` // YYYY-MM-DD, UTC
+    Currency string  `gorm:"primaryKey;size:3"`
+    PerUSD   float64 `gorm:"not null"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Token price sources
+const (
+    TokenPriceSourceUniswap   = "uniswap"   // Priced in ETH through the Uniswap pool
+    TokenPriceSourceCoinGecko = "coingecko" // PriceSourceID is the CoinGecko coin id
+    TokenPriceSourceFixed     = "fixed"     // PriceSourceID is a fixed USD price, e.g. "1" for stablecoins
+    TokenPriceSourceNone      = "none"      // Balance only, never valued
+)
+
+// Token is an ERC-20 token shown in wallet portfolios
+type Token struct {
+    UUID          uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    Address       string    `gorm:"uniqueIndex;not null" json:"address"`
+    Symbol        string    `gorm:"not null" json:"symbol"`
+    Name          string    `json:"name"`
+    Decimals      uint8     `gorm:"not null;default:18" json:"decimals"`
+    LogoURL       string    `json:"logo_url"`
+    PriceSource   string    `gorm:"not null;default:none" json:"price_source"`
+    PriceSourceID string    `json:"price_source_id,omitempty"`
+    Enabled       bool      `gorm:"not null;default:true" json:"enabled"`
+    CreatedAt     time.Time `json:"created_at"`
+    UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// IsValidTokenPriceSource reports whether the price source is known
+func IsValidTokenPriceSource(source string) bool {
+    switch source {
+    case TokenPriceSourceUniswap, TokenPriceSourceCoinGecko, TokenPriceSourceFixed, TokenPriceSourceNone:
+        return true
+    }
+    return false
+}
@@ -14,9 +14,16 @@ const (
     TransactionStatusFailed    = "failed"
     TransactionStatusRefunded  = "refunded"
     TransactionStatusProcessing = "processing"
+    TransactionStatusRefunding = "refunding" // Refund sent to the gateway, not confirmed yet
     
 )
 
+// Promo bonus statuses of swap purchases, whose bonus is sent from the hot wallet
+const (
+    BonusStatusPending   = "pending" // Owed, sent in BonusTxHash or retried when empty
+    BonusStatusCompleted = "completed"
+)
+
 // Transaction represents a token purchase transaction
 type Transaction struct {
     UUID               uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
@@ -51,6 +58,31 @@ type Transaction struct {
 
     BlockchainRegistered bool  `gorm:"default:false"` // Set to true when created in blockchain
     BlockchainCompleted  bool  `gorm:"default:false"`
+
+    // Sale round the purchase counts towards, nil when no rounds are configured
+    SaleRoundID *uuid.UUID `gorm:"type:uuid;index" json:"sale_round_id,omitempty"`
+
+    // Buyer of a vesting purchase; the tokens go to the vesting treasury in WalletAddress and are claimed from there
+    VestingWallet string `json:"vesting_wallet,omitempty"`
+
+    // IDR per USD when the purchase was made, 0 for purchases made before it was recorded
+    FXRate float64 `json:"fx_rate,omitempty"`
+
+    // Promo code of the purchase; FiatAmount is after the discount and TokenAmount includes the bonus
+    PromoCodeID  *uuid.UUID `gorm:"type:uuid;index" json:"promo_code_id,omitempty"`
+    PromoCode    string     `json:"promo_code,omitempty"`
+    DiscountFiat float64    `gorm:"not null;default:0" json:"discount_fiat,omitempty"`
+    BonusTokens  float64    `gorm:"not null;default:0" json:"bonus_tokens,omitempty"`
+    BonusTxHash  string     `json:"bonus_tx_hash,omitempty"` // Bonus sent from the hot wallet after a swap purchase
+    BonusStatus  string     `gorm:"index" json:"bonus_status,omitempty"`
+    BonusSentAt  *time.Time `json:"-"` // When BonusTxHash was signed
+    BonusError   string     `json:"bonus_error,omitempty"`
+
+    // Partner the buyer came from; only its webhook endpoints are sent the purchase's events
+    PartnerCode string `gorm:"index" json:"partner_code,omitempty"`
+
+    // Last failed or refunded status the buyer was emailed about
+    NotifiedStatus string `json:"-"`
 }
 
 // TokenAmountInWei converts token amount to wei (with 18 decimals)
@@ -64,6 +96,16 @@ func (t *Transaction) TokenAmountInWei() *big.Int {
     return tokenAmountInt
 }
 
+// BonusInWei converts the bonus tokens of a transaction to wei (with 18 decimals)
+func (t *Transaction) BonusInWei() *big.Int {
+    amount := new(big.Float).Mul(
+        big.NewFloat(t.BonusTokens),
+        new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)),
+    )
+    amountInt, _ := amount.Int(nil)
+    return amountInt
+}
+
 // FiatAmountInSmallestUnit converts fiat amount to smallest unit (with 2 decimals)
 func (t *Transaction) FiatAmountInSmallestUnit() *big.Int {
     // Convert fiat amount (e.g. 100.50) to smallest unit (e.g. 10050)
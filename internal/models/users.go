@@ -23,11 +23,42 @@ type User struct {
     RecoveryCode     string     `json:"-" gorm:"column:recovery_code"`
     RecoveryExpires  *time.Time `json:"-" gorm:"column:recovery_expires"`
     LastActivity     time.Time  `json:"last_activity" gorm:"column:last_activity"`
+
+    Role             string     `gorm:"column:role;not null;default:user;index" json:"role"`
+    Permissions      string     `gorm:"column:permissions" json:"-"` // Extra comma-separated grants on top of the role
+
+    FailedLoginAttempts  int        `gorm:"column:failed_login_attempts;not null;default:0" json:"-"`
+    LockoutCount         int        `gorm:"column:lockout_count;not null;default:0" json:"-"` // Consecutive lockouts, drives the lock duration
+    LockedUntil          *time.Time `gorm:"column:locked_until" json:"locked_until,omitempty"`
+    UnlockToken          string     `gorm:"column:unlock_token;index" json:"-"` // SHA-256 of the emailed unlock token
+    UnlockTokenExpiresAt *time.Time `gorm:"column:unlock_token_expires_at" json:"-"`
+
+    CustodyMode         string     `gorm:"column:custody_mode;not null;default:custodial" json:"custody_mode"` // custodial or non_custodial
+    PreferredCurrency   string     `gorm:"column:preferred_currency;not null;default:USD" json:"preferred_currency"` // Fiat currency portfolios are valued in
+    Language            string     `gorm:"column:language;not null;default:en" json:"language"`                     // Language of emails, en or id
+
+    KYCLevel            int        `gorm:"column:kyc_level;not null;default:0" json:"kyc_level"`      // Verified level, sets the purchase limits
+    KYCStatus           string     `gorm:"column:kyc_status;not null;default:none" json:"kyc_status"` // Status of the latest verification
+
+    ReferralCode        string     `gorm:"column:referral_code;uniqueIndex;default:null" json:"referral_code,omitempty"` // Code others sign up with
+    ReferredBy          *uuid.UUID `gorm:"column:referred_by;type:uuid;index" json:"referred_by,omitempty"`              // Referrer credited with this user's purchases
+    SignupIP            string     `gorm:"column:signup_ip" json:"-"`
     
     CreatedAt     time.Time `json:"created_at"`
     UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// Custody modes
+const (
+    CustodyModeCustodial    = "custodial"     // Server may store and use the user's keys
+    CustodyModeNonCustodial = "non_custodial" // Server only builds unsigned transactions
+)
+
+// IsNonCustodial reports whether the server must never handle the user's keys
+func (u *User) IsNonCustodial() bool {
+    return u.CustodyMode == CustodyModeNonCustodial
+}
+
 type Recovery struct {
     UUID         uuid.UUID  `gorm:"primary_key;type:uuid"`
     UserID       uuid.UUID  `gorm:"index;not null"`
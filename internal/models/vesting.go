@@ -0,0 +1,72 @@
+package models
+
+import (
+    "math/big"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Vesting claim statuses
+const (
+    VestingClaimStatusPending   = "pending"
+    VestingClaimStatusCompleted = "completed"
+    VestingClaimStatusFailed    = "failed"
+)
+
+// VestingSchedule releases the tokens of one purchase: nothing before the cliff, then linearly until EndsAt.
+// Amounts are in tokens.
+type VestingSchedule struct {
+    UUID          uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    UserID        uuid.UUID `gorm:"type:uuid;index;not null" json:"user_id"`
+    TransactionID uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"transaction_id"`
+    SaleRoundID   uuid.UUID `gorm:"type:uuid;index;not null" json:"sale_round_id"`
+    Beneficiary   string    `gorm:"not null" json:"beneficiary"` // Wallet the claims are sent to
+    TotalAmount   float64   `gorm:"not null" json:"total_amount"`
+    ClaimedAmount float64   `gorm:"not null;default:0" json:"claimed_amount"` // Includes claims still being sent
+    StartsAt      time.Time `gorm:"not null" json:"starts_at"`
+    CliffEndsAt   time.Time `gorm:"not null" json:"cliff_ends_at"`
+    EndsAt        time.Time `gorm:"not null" json:"ends_at"`
+    CreatedAt     time.Time `json:"created_at"`
+    UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// VestedAmount returns the tokens vested at the given time
+func (s *VestingSchedule) VestedAmount(now time.Time) float64 {
+    switch {
+    case now.Before(s.CliffEndsAt):
+        return 0
+    case !now.Before(s.EndsAt):
+        return s.TotalAmount
+    }
+    return s.TotalAmount * float64(now.Sub(s.StartsAt)) / float64(s.EndsAt.Sub(s.StartsAt))
+}
+
+// ClaimableAmount returns the vested tokens not claimed yet
+func (s *VestingSchedule) ClaimableAmount(now time.Time) float64 {
+    return max(s.VestedAmount(now)-s.ClaimedAmount, 0)
+}
+
+// VestingClaim is a release of vested tokens from the treasury to the beneficiary
+type VestingClaim struct {
+    UUID         uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    ScheduleID   uuid.UUID `gorm:"type:uuid;index;not null" json:"schedule_id"`
+    UserID       uuid.UUID `gorm:"type:uuid;index;not null" json:"user_id"`
+    Beneficiary  string    `gorm:"not null" json:"beneficiary"`
+    Amount       float64   `gorm:"not null" json:"amount"`
+    Status       string    `gorm:"not null;index" json:"status"`
+    TxHash       string    `json:"tx_hash,omitempty"`
+    ErrorMessage string    `json:"error_message,omitempty"`
+    CreatedAt    time.Time `json:"created_at"`
+    UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// AmountInWei converts the claimed amount to wei (with 18 decimals)
+func (c *VestingClaim) AmountInWei() *big.Int {
+    amount := new(big.Float).Mul(
+        big.NewFloat(c.Amount),
+        new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)),
+    )
+    amountInt, _ := amount.Int(nil)
+    return amountInt
+}
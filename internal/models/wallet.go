@@ -8,37 +8,77 @@ import (
 
 // Wallet represents a user's blockchain wallet
 type Wallet struct {
-    UUID          uuid.UUID `gorm:"primary_key;type:uuid"`
-    UserID        uuid.UUID `gorm:"index;not null"`
-    WalletAddress string    `gorm:"not null"`
-    CreatedAt     time.Time
-    UpdatedAt     time.Time
+    UUID           uuid.UUID `gorm:"primary_key;type:uuid"`
+    UserID         uuid.UUID `gorm:"index;not null"`
+    WalletAddress  string    `gorm:"not null"`
+    Label          string    `gorm:"column:label"`
+    DerivationPath string    `gorm:"column:derivation_path"` // Empty for linked external wallets
+    AccountIndex   uint32    `gorm:"column:account_index;not null;default:0"`
+    IsDefault      bool      `gorm:"column:is_default;not null;default:false"` // Mirrors users.wallet_address
+    CreatedAt      time.Time
+    UpdatedAt      time.Time
 
     // Relationships
     User User `gorm:"foreignKey:UserID"`
 }
 
-// WalletTransaction represents a transaction initiated by the user
+// Wallet transaction statuses
+const (
+    WalletTxStatusPending   = "pending"
+    WalletTxStatusConfirmed = "confirmed"
+    WalletTxStatusFailed    = "failed"
+)
+
+// Wallet transaction directions
+const (
+    WalletTxDirectionOutgoing = "outgoing"
+    WalletTxDirectionIncoming = "incoming"
+)
+
+// WalletTransaction represents a transaction initiated by the user or a deposit to one of their wallets
 type WalletTransaction struct {
     UUID          uuid.UUID `gorm:"primary_key;type:uuid"`
     UserID        uuid.UUID `gorm:"index;not null"`
-    WalletAddress string    `gorm:"not null"`
-    TxHash        string    `gorm:"index"`
-    TxType        string    `gorm:"not null"` // swap, transfer, etc.
+    WalletAddress string    `gorm:"not null;uniqueIndex:idx_wallet_tx_deposit"`
+    TxHash        string    `gorm:"index;uniqueIndex:idx_wallet_tx_deposit,where:direction = 'incoming'"` // A deposit is recorded once
+    TxType        string    `gorm:"not null"` // swap, transfer, deposit, etc.
     Amount        string    `gorm:"not null"`
     TokenSymbol   string    `gorm:"not null"`
+    TokenAddress  string    `gorm:"uniqueIndex:idx_wallet_tx_deposit"` // Empty for ETH
     ToAddress     string    `gorm:"index"`
+    FromAddress   string    `gorm:"index"`
+    Direction     string    `gorm:"not null;default:outgoing;index"` // outgoing or incoming
     Status        string    `gorm:"not null"` // pending, confirmed, failed
+    BlockNumber   uint64    `gorm:"index"`
+    BlockHash     string
+    LogIndex      uint      `gorm:"not null;default:0;uniqueIndex:idx_wallet_tx_deposit"` // Transfer log index of token deposits
+    FeeWei        string    // Gas paid for outgoing transactions, set once mined
+
+    // USD prices of the token and ETH at trade time for tax exports, 0 = no price source
+    PriceUSD    float64    `gorm:"not null;default:0"`
+    EthPriceUSD float64    `gorm:"not null;default:0"`
+    ValuedAt    *time.Time `gorm:"index"`
+    PricedAt    *time.Time // Trade time the prices are from, nil on rows valued at the price of the day they were valued
+
     CreatedAt     time.Time
     UpdatedAt     time.Time
 }
 
+// ChainCursor remembers the last block a chain watcher processed
+type ChainCursor struct {
+    Name        string `gorm:"primary_key"`
+    BlockNumber uint64 `gorm:"not null"`
+    UpdatedAt   time.Time
+}
+
 type EncryptedWallet struct {
     UUID           uuid.UUID `gorm:"primary_key;type:uuid"`
     UserUUID       uuid.UUID `gorm:"index;not null"` // Reference to user in main DB
     WalletAddress  string    `gorm:"uniqueIndex;not null"`
     EncPrivateKey  []byte    `gorm:"type:bytea"` // Encrypted private key
     EncKeystoreJSON []byte   `gorm:"type:bytea"` // Encrypted keystore JSON
+    EncDataKey     []byte    `gorm:"type:bytea"` // Per-record data key wrapped by the master key
+    KeyVersion     int       `gorm:"not null;default:0;index"` // Master key version, 0 = legacy static key
     CreatedAt      time.Time
     UpdatedAt      time.Time
 }
@@ -50,6 +90,9 @@ type WalletMnemonic struct {
     WalletAddress  string    `gorm:"uniqueIndex;not null"`
     EncMnemonic    []byte    `gorm:"type:bytea"` // Encrypted mnemonic phrase
     PathIndex      uint32    `gorm:"not null"`   // HD path index used
+    DerivationPath string    `gorm:"column:derivation_path"` // Full path, empty for rows stored before paths were recorded
+    EncDataKey     []byte    `gorm:"type:bytea"` // Per-record data key wrapped by the master key
+    KeyVersion     int       `gorm:"not null;default:0;index"` // Master key version, 0 = legacy static key
     CreatedAt      time.Time
     UpdatedAt      time.Time
 }
@@ -61,5 +104,33 @@ type WalletBackup struct {
     WalletAddress  string    `gorm:"index;not null"`
     BackupType     string    `gorm:"not null"` // mnemonic, private_key, keystore
     BackupData     []byte    `gorm:"type:bytea"`
+    EncDataKey     []byte    `gorm:"type:bytea"` // Per-record data key wrapped by the master key
+    KeyVersion     int       `gorm:"not null;default:0;index"` // Master key version, 0 = legacy static key
+    CreatedAt      time.Time
+}
+
+// WalletShare records one Shamir share of a wallet mnemonic. Only the server
+// vault share is stored; other holders get their share once and the row keeps
+// a hash so submitted shares can be matched to their set.
+type WalletShare struct {
+    UUID           uuid.UUID `gorm:"primary_key;type:uuid"`
+    SetID          uuid.UUID `gorm:"type:uuid;index;not null"` // Shares created together
+    UserUUID       uuid.UUID `gorm:"index;not null"`
+    WalletAddress  string    `gorm:"index;not null"`
+    Threshold      int       `gorm:"not null"` // Shares needed to rebuild the mnemonic
+    TotalShares    int       `gorm:"not null"`
+    ShareIndex     int       `gorm:"not null"`
+    Holder         string    `gorm:"not null"` // user, server or email
+    ShareHash      string    `gorm:"uniqueIndex;not null"` // SHA-256 of the share
+    EncShare       []byte    `gorm:"type:bytea"` // Server vault share only
+    EncDataKey     []byte    `gorm:"type:bytea"`
+    KeyVersion     int       `gorm:"not null;default:0;index"`
     CreatedAt      time.Time
-}
\ No newline at end of file
+}
+
+// Wallet share holders
+const (
+    ShareHolderUser   = "user"
+    ShareHolderServer = "server"
+    ShareHolderEmail  = "email"
+)
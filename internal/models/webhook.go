@@ -0,0 +1,89 @@
+package models
+
+import (
+    "strings"
+    "time"
+
+    "github.com/google/uuid"
+)
+
+// Webhook event types
+const (
+    WebhookEventTransactionPaid      = "transaction.paid"      // Payment received, tokens not delivered yet
+    WebhookEventTransactionCompleted = "transaction.completed" // Tokens delivered
+    WebhookEventTransactionRefunded  = "transaction.refunded"
+)
+
+// WebhookEventTypes lists every event type an endpoint can subscribe to
+var WebhookEventTypes = []string{
+    WebhookEventTransactionPaid,
+    WebhookEventTransactionCompleted,
+    WebhookEventTransactionRefunded,
+}
+
+// Webhook delivery statuses
+const (
+    WebhookDeliveryPending   = "pending" // Waiting for its next attempt
+    WebhookDeliveryDelivered = "delivered"
+    WebhookDeliveryFailed    = "failed" // Out of attempts
+)
+
+// WebhookEndpoint is a partner URL that receives signed events of the purchases attributed to the partner
+type WebhookEndpoint struct {
+    UUID        uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    PartnerCode string    `gorm:"index;not null;default:''" json:"partner_code"` // Purchases made with this code are sent here
+    Name        string    `gorm:"not null" json:"name"`
+    URL         string    `gorm:"not null" json:"url"`
+    Secret      string    `gorm:"not null" json:"-"`      // HMAC key, shown once when created or rotated
+    Events      string    `gorm:"not null" json:"events"` // Comma separated event types
+    Active      bool      `gorm:"not null;default:true" json:"active"`
+    CreatedAt   time.Time `json:"created_at"`
+    UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Subscribes reports whether the endpoint receives the event type
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+    for _, event := range strings.Split(e.Events, ",") {
+        if strings.TrimSpace(event) == eventType {
+            return true
+        }
+    }
+    return false
+}
+
+// WebhookEvent is a state change of a purchase, raised once per type and transaction. The
+// payload is fixed when the event is raised so every delivery sends the same body.
+type WebhookEvent struct {
+    UUID          uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    Type          string    `gorm:"not null;uniqueIndex:idx_webhook_event_transaction_type" json:"type"`
+    TransactionID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_event_transaction_type" json:"transaction_id"`
+    Payload       string    `gorm:"type:text;not null" json:"-"`
+    CreatedAt     time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an event queued for one endpoint
+type WebhookDelivery struct {
+    UUID           uuid.UUID  `gorm:"primary_key;type:uuid" json:"uuid"`
+    EndpointID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_endpoint_event" json:"endpoint_id"`
+    EventID        uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_webhook_delivery_endpoint_event" json:"event_id"`
+    EventType      string     `gorm:"not null" json:"event_type"`
+    Status         string     `gorm:"not null;index" json:"status"`
+    Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+    NextAttemptAt  time.Time  `gorm:"not null;index" json:"next_attempt_at"`
+    LastStatusCode int        `json:"last_status_code,omitempty"`
+    LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+    DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+    UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// WebhookAttempt logs one request made for a delivery
+type WebhookAttempt struct {
+    UUID         uuid.UUID `gorm:"primary_key;type:uuid" json:"uuid"`
+    DeliveryID   uuid.UUID `gorm:"type:uuid;not null;index" json:"delivery_id"`
+    StatusCode   int       `json:"status_code,omitempty"`
+    Error        string    `gorm:"type:text" json:"error,omitempty"`
+    ResponseBody string    `gorm:"type:text" json:"response_body,omitempty"` // First KB of the response
+    DurationMs   int64     `json:"duration_ms"`
+    CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "gorm.io/gorm"
+)
+
+// AdminService provides back-office lookups and role management
+type AdminService struct {
+    DB *gorm.DB
+}
+
+// UserSearchFilter holds the filters for admin user lookups
+type UserSearchFilter struct {
+    Query  string // Matches username, email or wallet address
+    Role   string
+    Limit  int
+    Offset int
+}
+
+// TransactionSearchFilter holds the filters for admin transaction search
+type TransactionSearchFilter struct {
+    Query         string // Matches payment ID, tx hash or payment reference
+    UserID        string
+    WalletAddress string
+    Status        string
+    PaymentMethod string
+    From          *time.Time
+    To            *time.Time
+    Limit         int
+    Offset        int
+}
+
+// NewAdminService creates a new admin service
+func NewAdminService(db *gorm.DB) *AdminService {
+    return &AdminService{
+        DB: db,
+    }
+}
+
+// SearchUsers returns users matching the filter along with the total count
+func (s *AdminService) SearchUsers(filter UserSearchFilter) ([]models.User, int64, error) {
+    query := s.DB.Model(&models.User{})
+
+    if filter.Query != "" {
+        like := "%" + strings.ToLower(filter.Query) + "%"
+        query = query.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ? OR LOWER(wallet_address) LIKE ?", like, like, like)
+    }
+
+    if filter.Role != "" {
+        query = query.Where("role = ?", filter.Role)
+    }
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count users: %w", err)
+    }
+
+    var users []models.User
+    if err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&users).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to fetch users: %w", err)
+    }
+
+    return users, total, nil
+}
+
+// GetUser returns a single user by UUID, username or email
+func (s *AdminService) GetUser(identifier string) (*models.User, error) {
+    var user models.User
+    if err := s.DB.Where("uuid::text = ? OR username = ? OR email = ?", identifier, identifier, identifier).
+        First(&user).Error; err != nil {
+        return nil, fmt.Errorf("user not found: %w", err)
+    }
+    return &user, nil
+}
+
+// SetUserRole changes a user's role and extra permission grants
+func (s *AdminService) SetUserRole(user *models.User, role string, permissions []string) error {
+    if !models.IsValidRole(role) {
+        return fmt.Errorf("unknown role: %s", role)
+    }
+
+    granted := make([]string, 0, len(permissions))
+    for _, permission := range permissions {
+        permission = strings.TrimSpace(permission)
+        if !models.IsValidPermission(permission) {
+            return fmt.Errorf("unknown permission: %s", permission)
+        }
+        granted = append(granted, permission)
+    }
+
+    return s.DB.Model(user).Updates(map[string]interface{}{
+        "role":        role,
+        "permissions": strings.Join(granted, ","),
+        "updated_at":  time.Now(),
+    }).Error
+}
+
+// SearchTransactions returns purchase transactions matching the filter along with the total count
+func (s *AdminService) SearchTransactions(filter TransactionSearchFilter) ([]models.Transaction, int64, error) {
+    query := s.DB.Model(&models.Transaction{})
+
+    if filter.Query != "" {
+        query = query.Where("payment_id = ? OR blockchain_tx_hash = ? OR swap_tx_hash = ? OR payment_reference = ?",
+            filter.Query, filter.Query, filter.Query, filter.Query)
+    }
+    if filter.UserID != "" {
+        query = query.Where("user_id = ?", filter.UserID)
+    }
+    if filter.WalletAddress != "" {
+        query = query.Where("LOWER(wallet_address) = ?", strings.ToLower(filter.WalletAddress))
+    }
+    if filter.Status != "" {
+        query = query.Where("status = ?", filter.Status)
+    }
+    if filter.PaymentMethod != "" {
+        query = query.Where("payment_method = ?", filter.PaymentMethod)
+    }
+    if filter.From != nil {
+        query = query.Where("created_at >= ?", *filter.From)
+    }
+    if filter.To != nil {
+        query = query.Where("created_at <= ?", *filter.To)
+    }
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count transactions: %w", err)
+    }
+
+    var transactions []models.Transaction
+    if err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&transactions).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to fetch transactions: %w", err)
+    }
+
+    return transactions, total, nil
+}
+
+// BootstrapAdmins promotes the configured usernames to admin so the first operator can sign in
+func (s *AdminService) BootstrapAdmins(usernames []string) {
+    for _, username := range usernames {
+        username = strings.TrimSpace(username)
+        if username == "" {
+            continue
+        }
+
+        result := s.DB.Model(&models.User{}).
+            Where("username = ? AND role <> ?", username, models.RoleAdmin).
+            Updates(map[string]interface{}{
+                "role":       models.RoleAdmin,
+                "updated_at": time.Now(),
+            })
+        if result.Error != nil {
+            log.Printf("Warning: Failed to promote %s to admin: %v", username, result.Error)
+        } else if result.RowsAffected > 0 {
+            log.Printf("Promoted %s to admin", username)
+        }
+    }
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "math/big"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/google/uuid"
+)
+
+// approvalLogChunk is the block range of one eth_getLogs request for Approval events
+const approvalLogChunk = 50000
+
+// erc20ApprovalTopic is the topic of Approval(address indexed owner, address indexed spender, uint256 value)
+var erc20ApprovalTopic = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+
+// unlimitedAllowance is the threshold above which an allowance is shown as unlimited
+var unlimitedAllowance = new(big.Int).Lsh(big.NewInt(1), 255)
+
+// AllowanceService lists the ERC-20 allowances a wallet has granted and revokes them
+type AllowanceService struct {
+    TokenRegistry  *TokenRegistryService
+    Transfers      *WalletTransferService
+    KnownSpenders  map[common.Address]string // Spender address to display label
+    LookbackBlocks uint64                    // Blocks searched for Approval logs, 0 = from genesis
+}
+
+// TokenAllowance is an allowance granted by a wallet to a spender
+type TokenAllowance struct {
+    Token             string `json:"token"`
+    Symbol            string `json:"symbol"`
+    Decimals          uint8  `json:"decimals"`
+    Spender           string `json:"spender"`
+    SpenderLabel      string `json:"spender_label,omitempty"` // Set for known spenders
+    Allowance         string `json:"allowance"`               // Smallest unit
+    Formatted         string `json:"formatted"`
+    Unlimited         bool   `json:"unlimited"`
+    LastApprovalTx    string `json:"last_approval_tx,omitempty"`
+    LastApprovalBlock uint64 `json:"last_approval_block,omitempty"`
+}
+
+// AllowanceTarget selects one token and spender pair
+type AllowanceTarget struct {
+    Token   string `json:"token" binding:"required"`
+    Spender string `json:"spender" binding:"required"`
+}
+
+// RevokeResult is the outcome of revoking one allowance
+type RevokeResult struct {
+    Token       string                    `json:"token"`
+    Spender     string                    `json:"spender"`
+    Transaction *models.WalletTransaction `json:"transaction,omitempty"`
+    Error       string                    `json:"error,omitempty"`
+}
+
+// NewAllowanceService creates a new allowance service
+func NewAllowanceService(tokenRegistry *TokenRegistryService, transfers *WalletTransferService, knownSpenders map[common.Address]string, lookbackBlocks uint64) *AllowanceService {
+    return &AllowanceService{
+        TokenRegistry:  tokenRegistry,
+        Transfers:      transfers,
+        KnownSpenders:  knownSpenders,
+        LookbackBlocks: lookbackBlocks,
+    }
+}
+
+// ListAllowances returns the non-zero allowances of the owner. It checks every registered
+// token against the known spenders, plus every token and spender seen in the owner's Approval logs.
+func (s *AllowanceService) ListAllowances(ctx context.Context, owner common.Address) ([]TokenAllowance, error) {
+    type pair struct {
+        token   common.Address
+        spender common.Address
+    }
+
+    pairs := make(map[pair]*TokenAllowance)
+    var order []pair
+    add := func(token, spender common.Address) *TokenAllowance {
+        key := pair{token, spender}
+        if entry, ok := pairs[key]; ok {
+            return entry
+        }
+        entry := &TokenAllowance{Token: token.Hex(), Spender: spender.Hex(), SpenderLabel: s.KnownSpenders[spender]}
+        pairs[key] = entry
+        order = append(order, key)
+        return entry
+    }
+
+    tokens, err := s.TokenRegistry.ListTokens(false)
+    if err != nil {
+        return nil, err
+    }
+    registered := make(map[common.Address]models.Token, len(tokens))
+    for _, token := range tokens {
+        address := common.HexToAddress(token.Address)
+        registered[address] = token
+        for spender := range s.KnownSpenders {
+            add(address, spender)
+        }
+    }
+
+    logs, err := s.approvalLogs(ctx, owner)
+    if err != nil {
+        // Known spenders are still checked without the history
+        log.Printf("Allowances: failed to read Approval logs of %s: %v", owner.Hex(), err)
+    }
+    for _, entry := range logs {
+        spender := common.BytesToAddress(entry.Topics[2].Bytes())
+        allowance := add(entry.Address, spender)
+        allowance.LastApprovalTx = entry.TxHash.Hex()
+        allowance.LastApprovalBlock = entry.BlockNumber
+    }
+
+    client := s.Transfers.TxBuilder.EthClient
+    opts := &bind.CallOpts{Context: ctx}
+    contracts := make(map[common.Address]*blockchain.ERC20)
+
+    allowances := make([]TokenAllowance, 0, len(order))
+    for _, key := range order {
+        contract, ok := contracts[key.token]
+        if !ok {
+            contract, err = blockchain.NewERC20(key.token, client)
+            if err != nil {
+                return nil, fmt.Errorf("failed to create token contract: %w", err)
+            }
+            contracts[key.token] = contract
+        }
+
+        amount, err := contract.Allowance(opts, owner, key.spender)
+        if err != nil || amount.Sign() == 0 {
+            continue
+        }
+
+        entry := pairs[key]
+        if token, ok := registered[key.token]; ok {
+            entry.Symbol = token.Symbol
+            entry.Decimals = token.Decimals
+        } else {
+            entry.Symbol = key.token.Hex()
+            entry.Decimals = 18
+            if symbol, err := contract.Symbol(opts); err == nil {
+                entry.Symbol = symbol
+            }
+            if decimals, err := contract.Decimals(opts); err == nil {
+                entry.Decimals = decimals
+            }
+        }
+
+        entry.Allowance = amount.String()
+        entry.Unlimited = amount.Cmp(unlimitedAllowance) >= 0
+        if entry.Unlimited {
+            entry.Formatted = "unlimited"
+        } else {
+            entry.Formatted = formatUnits(amount, entry.Decimals)
+        }
+        allowances = append(allowances, *entry)
+    }
+
+    return allowances, nil
+}
+
+// Revoke sets the chosen allowances to zero, signing with the owner's stored key.
+// Each target is sent as its own approve transaction; pairs without an allowance are skipped.
+func (s *AllowanceService) Revoke(ctx context.Context, userID uuid.UUID, owner common.Address, targets []AllowanceTarget) []RevokeResult {
+    client := s.Transfers.TxBuilder.EthClient
+    results := make([]RevokeResult, 0, len(targets))
+
+    for _, target := range targets {
+        result := RevokeResult{Token: target.Token, Spender: target.Spender}
+        if !common.IsHexAddress(target.Token) || !common.IsHexAddress(target.Spender) {
+            result.Error = "token and spender must be addresses"
+            results = append(results, result)
+            continue
+        }
+        token := common.HexToAddress(target.Token)
+        spender := common.HexToAddress(target.Spender)
+        result.Token = token.Hex()
+        result.Spender = spender.Hex()
+
+        contract, err := blockchain.NewERC20(token, client)
+        if err != nil {
+            result.Error = err.Error()
+            results = append(results, result)
+            continue
+        }
+        current, err := contract.Allowance(&bind.CallOpts{Context: ctx}, owner, spender)
+        if err != nil {
+            result.Error = fmt.Sprintf("failed to read allowance: %v", err)
+            results = append(results, result)
+            continue
+        }
+        if current.Sign() == 0 {
+            result.Error = "no allowance to revoke"
+            results = append(results, result)
+            continue
+        }
+
+        walletTx, err := s.revoke(ctx, userID, owner, token, spender)
+        if err != nil {
+            result.Error = err.Error()
+        }
+        result.Transaction = walletTx
+        results = append(results, result)
+    }
+
+    return results
+}
+
+// revoke sets one allowance to zero, holding the owner's send lock from nonce to broadcast
+func (s *AllowanceService) revoke(ctx context.Context, userID uuid.UUID, owner, token, spender common.Address) (*models.WalletTransaction, error) {
+    unlock := s.Transfers.TxBuilder.LockSender(owner)
+    defer unlock()
+
+    tx, chainID, err := s.Transfers.TxBuilder.ApproveTx(ctx, owner, token.Hex(), spender, big.NewInt(0))
+    if err != nil {
+        return nil, err
+    }
+
+    return s.Transfers.SendBuiltTx(ctx, userID, owner, tx, chainID)
+}
+
+// approvalLogs returns the owner's ERC-20 Approval logs across all contracts, oldest first
+func (s *AllowanceService) approvalLogs(ctx context.Context, owner common.Address) ([]types.Log, error) {
+    client := s.Transfers.TxBuilder.EthClient
+
+    head, err := client.BlockNumber(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get latest block: %w", err)
+    }
+
+    from := uint64(0)
+    if s.LookbackBlocks > 0 && head > s.LookbackBlocks {
+        from = head - s.LookbackBlocks
+    }
+
+    var logs []types.Log
+    for start := from; start <= head; start += approvalLogChunk {
+        end := start + approvalLogChunk - 1
+        if end > head {
+            end = head
+        }
+
+        chunk, err := client.FilterLogs(ctx, ethereum.FilterQuery{
+            FromBlock: new(big.Int).SetUint64(start),
+            ToBlock:   new(big.Int).SetUint64(end),
+            Topics:    [][]common.Hash{{erc20ApprovalTopic}, {common.BytesToHash(owner.Bytes())}},
+        })
+        if err != nil {
+            return logs, err
+        }
+
+        for _, entry := range chunk {
+            // ERC-721 approvals index the token id as a fourth topic
+            if entry.Removed || len(entry.Topics) != 3 || len(entry.Data) != 32 {
+                continue
+            }
+            logs = append(logs, entry)
+        }
+    }
+
+    return logs, nil
+}
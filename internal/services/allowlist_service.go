@@ -0,0 +1,454 @@
+package services
+
+import (
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "math/big"
+    "slices"
+    "strconv"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/pkg/merkle"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+const (
+    allowlistDecimals      = 18 // Token decimals allocations are encoded with in the leaves
+    allowlistEmailKYCLevel = 1  // KYC level a user needs before their email entry counts
+)
+
+// errNotAllowlisted is returned when the user has no entry in a round's allowlist
+var errNotAllowlisted = errors.New("account is not on the allowlist")
+
+// AllowlistService manages the allowlists of private sale rounds. Each list is a Merkle tree
+// whose root is stored on the round, so purchases can be checked against it here and later on-chain.
+type AllowlistService struct {
+    DB         *gorm.DB
+    SaleRounds *SaleRoundService
+    Gateway    *blockchain.PaymentGatewayClient
+}
+
+// AllowlistUpload summarizes a newly uploaded allowlist
+type AllowlistUpload struct {
+    Round           *models.SaleRound `json:"round"`
+    Entries         int               `json:"entries"`
+    TotalAllocation float64           `json:"total_allocation"`
+}
+
+// AllowlistProof is what a buyer needs to prove their allocation against the round's root
+type AllowlistProof struct {
+    SaleRoundID   uuid.UUID `json:"sale_round_id"`
+    Round         string    `json:"round"`
+    Kind          string    `json:"kind"`
+    Account       string    `json:"account"`
+    AccountHash   string    `json:"account_hash"` // bytes32 account encoded in the leaf
+    Allocation    float64   `json:"allocation"`
+    AllocationWei string    `json:"allocation_wei"`
+    Purchased     float64   `json:"purchased"`
+    Leaf          string    `json:"leaf"`
+    Proof         []string  `json:"proof"`
+    Root          string    `json:"root"`
+}
+
+// NewAllowlistService creates a new allowlist service
+func NewAllowlistService(db *gorm.DB, saleRounds *SaleRoundService, gateway *blockchain.PaymentGatewayClient) *AllowlistService {
+    return &AllowlistService{
+        DB:         db,
+        SaleRounds: saleRounds,
+        Gateway:    gateway,
+    }
+}
+
+// Upload replaces a round's allowlist with CSV rows of account,allocation and stores the new root.
+// Accounts are wallet addresses or emails, allocations are in tokens.
+func (s *AllowlistService) Upload(roundID string, r io.Reader) (*AllowlistUpload, error) {
+    round, err := s.SaleRounds.GetRound(roundID)
+    if err != nil {
+        return nil, err
+    }
+
+    entries, err := parseAllowlistCSV(r)
+    if err != nil {
+        return nil, err
+    }
+
+    upload := &AllowlistUpload{Round: round, Entries: len(entries)}
+    leaves := make([]common.Hash, len(entries))
+    for i := range entries {
+        amount, _ := new(big.Int).SetString(entries[i].AllocationWei, 10)
+        leaves[i] = merkle.Leaf(allowlistAccountHash(entries[i].Kind, entries[i].Account), amount)
+        upload.TotalAllocation += entries[i].Allocation
+    }
+
+    tree := merkle.New(leaves)
+    now := time.Now()
+    for i := range entries {
+        proof, err := json.Marshal(hexHashes(tree.Proof(i)))
+        if err != nil {
+            return nil, fmt.Errorf("failed to encode proof: %w", err)
+        }
+        entries[i].UUID = uuid.New()
+        entries[i].SaleRoundID = round.UUID
+        entries[i].Leaf = leaves[i].Hex()
+        entries[i].Proof = string(proof)
+        entries[i].CreatedAt = now
+    }
+
+    round.AllowlistRoot = tree.Root().Hex()
+    round.AllowlistRootTx = ""
+    err = s.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("sale_round_id = ?", round.UUID).Delete(&models.AllowlistEntry{}).Error; err != nil {
+            return err
+        }
+        if err := tx.CreateInBatches(entries, 500).Error; err != nil {
+            return err
+        }
+        return tx.Model(round).Updates(map[string]interface{}{
+            "allowlist_root":    round.AllowlistRoot,
+            "allowlist_root_tx": round.AllowlistRootTx,
+        }).Error
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to save allowlist: %w", err)
+    }
+
+    return upload, nil
+}
+
+// Clear removes a round's allowlist, opening the round to every buyer
+func (s *AllowlistService) Clear(roundID string) (*models.SaleRound, error) {
+    round, err := s.SaleRounds.GetRound(roundID)
+    if err != nil {
+        return nil, err
+    }
+
+    round.AllowlistRoot = ""
+    round.AllowlistRootTx = ""
+    err = s.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("sale_round_id = ?", round.UUID).Delete(&models.AllowlistEntry{}).Error; err != nil {
+            return err
+        }
+        return tx.Model(round).Updates(map[string]interface{}{
+            "allowlist_root":    "",
+            "allowlist_root_tx": "",
+        }).Error
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to clear allowlist: %w", err)
+    }
+
+    return round, nil
+}
+
+// ListEntries returns a page of a round's allowlist and its total size
+func (s *AllowlistService) ListEntries(roundID string, limit, offset int) ([]models.AllowlistEntry, int64, error) {
+    round, err := s.SaleRounds.GetRound(roundID)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    query := s.DB.Model(&models.AllowlistEntry{}).Where("sale_round_id = ?", round.UUID)
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count allowlist entries: %w", err)
+    }
+
+    var entries []models.AllowlistEntry
+    if err := query.Order("account").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to list allowlist entries: %w", err)
+    }
+
+    return entries, total, nil
+}
+
+// Proof returns the user's allocation and Merkle proof in a round, the active round when roundID is empty
+func (s *AllowlistService) Proof(roundID string, user *models.User) (*AllowlistProof, error) {
+    var round *models.SaleRound
+    var err error
+    if roundID == "" {
+        round, err = s.SaleRounds.ActiveRound()
+        if err == nil && round == nil {
+            err = fmt.Errorf("sale round not found")
+        }
+    } else {
+        round, err = s.SaleRounds.GetRound(roundID)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if !round.IsPrivate() {
+        return nil, fmt.Errorf("%s has no allowlist", round.Name)
+    }
+
+    entry, err := findAllowlistEntry(s.DB, round, user)
+    if err != nil {
+        return nil, err
+    }
+
+    var proof []string
+    if err := json.Unmarshal([]byte(entry.Proof), &proof); err != nil {
+        return nil, fmt.Errorf("failed to decode proof: %w", err)
+    }
+
+    purchased, err := s.SaleRounds.sum(s.DB, round.UUID, &user.UUID, true)
+    if err != nil {
+        return nil, err
+    }
+
+    return &AllowlistProof{
+        SaleRoundID:   round.UUID,
+        Round:         round.Name,
+        Kind:          entry.Kind,
+        Account:       entry.Account,
+        AccountHash:   allowlistAccountHash(entry.Kind, entry.Account).Hex(),
+        Allocation:    entry.Allocation,
+        AllocationWei: entry.AllocationWei,
+        Purchased:     purchased,
+        Leaf:          entry.Leaf,
+        Proof:         proof,
+        Root:          round.AllowlistRoot,
+    }, nil
+}
+
+// PublishRoot sends a round's allowlist root to the payment gateway and records the transaction
+func (s *AllowlistService) PublishRoot(ctx context.Context, roundID string) (*models.SaleRound, error) {
+    if !s.Gateway.IsInitialized() {
+        return nil, fmt.Errorf("payment gateway is not configured")
+    }
+
+    round, err := s.SaleRounds.GetRound(roundID)
+    if err != nil {
+        return nil, err
+    }
+    if !round.IsPrivate() {
+        return nil, fmt.Errorf("%s has no allowlist", round.Name)
+    }
+
+    txHash, err := s.Gateway.UpdateAllowlistRoot(ctx, common.HexToHash(round.AllowlistRoot))
+    if err != nil {
+        return nil, err
+    }
+
+    round.AllowlistRootTx = txHash
+    if err := s.DB.Model(round).Update("allowlist_root_tx", txHash).Error; err != nil {
+        return nil, fmt.Errorf("failed to record root transaction %s: %w", txHash, err)
+    }
+
+    return round, nil
+}
+
+// checkAllowlist keeps a private round's purchases within the buyer's allocation, whose entry
+// must prove against the round's root
+func (s *SaleRoundService) checkAllowlist(db *gorm.DB, round *models.SaleRound, userID *uuid.UUID, tokenAmount float64) error {
+    if !round.IsPrivate() {
+        return nil
+    }
+    if userID == nil {
+        return fmt.Errorf("%w: %s is limited to its allowlist", ErrPurchaseRejected, round.Name)
+    }
+
+    var user models.User
+    if err := db.Select("uuid", "email", "wallet_address", "kyc_level").Where("uuid = ?", *userID).First(&user).Error; err != nil {
+        return fmt.Errorf("failed to load buyer: %w", err)
+    }
+
+    entry, err := findAllowlistEntry(db, round, &user)
+    if err != nil {
+        if errors.Is(err, errNotAllowlisted) {
+            return fmt.Errorf("%w: your account is not on the %s allowlist", ErrPurchaseRejected, round.Name)
+        }
+        return err
+    }
+    if !verifyAllowlistEntry(round, entry) {
+        return fmt.Errorf("%w: your allowlist entry does not match the %s root", ErrPurchaseRejected, round.Name)
+    }
+
+    purchased, err := s.sum(db, round.UUID, userID, true)
+    if err != nil {
+        return err
+    }
+    if purchased+tokenAmount > entry.Allocation {
+        return fmt.Errorf("%w: your %s allocation is %g tokens, %g left", ErrPurchaseRejected, round.Name, entry.Allocation, max(entry.Allocation-purchased, 0))
+    }
+
+    return nil
+}
+
+// findAllowlistEntry finds the user's entry by their default wallet, then their other wallets,
+// then their email. Emails are not verified at registration, so an email entry only counts once
+// the user has passed KYC.
+func findAllowlistEntry(db *gorm.DB, round *models.SaleRound, user *models.User) (*models.AllowlistEntry, error) {
+    var accounts []string
+    if user.WalletAddress != "" {
+        accounts = append(accounts, strings.ToLower(user.WalletAddress))
+    }
+
+    var wallets []models.Wallet
+    if err := db.Select("wallet_address").Where("user_id = ?", user.UUID).Order("created_at").Find(&wallets).Error; err != nil {
+        return nil, fmt.Errorf("failed to load wallets: %w", err)
+    }
+    for _, wallet := range wallets {
+        if address := strings.ToLower(wallet.WalletAddress); address != "" && !slices.Contains(accounts, address) {
+            accounts = append(accounts, address)
+        }
+    }
+
+    if user.Email != "" && user.KYCLevel >= allowlistEmailKYCLevel {
+        accounts = append(accounts, strings.ToLower(user.Email))
+    }
+    if len(accounts) == 0 {
+        return nil, errNotAllowlisted
+    }
+
+    var entries []models.AllowlistEntry
+    if err := db.Where("sale_round_id = ? AND account IN ?", round.UUID, accounts).Find(&entries).Error; err != nil {
+        return nil, fmt.Errorf("failed to look up allowlist: %w", err)
+    }
+
+    for _, account := range accounts {
+        for i := range entries {
+            if entries[i].Account == account {
+                return &entries[i], nil
+            }
+        }
+    }
+    return nil, errNotAllowlisted
+}
+
+// verifyAllowlistEntry checks the entry's leaf and proof against the round's root
+func verifyAllowlistEntry(round *models.SaleRound, entry *models.AllowlistEntry) bool {
+    amount, ok := new(big.Int).SetString(entry.AllocationWei, 10)
+    if !ok {
+        return false
+    }
+
+    var proofHex []string
+    if err := json.Unmarshal([]byte(entry.Proof), &proofHex); err != nil {
+        return false
+    }
+    proof := make([]common.Hash, len(proofHex))
+    for i, h := range proofHex {
+        proof[i] = common.HexToHash(h)
+    }
+
+    leaf := merkle.Leaf(allowlistAccountHash(entry.Kind, entry.Account), amount)
+    return merkle.Verify(proof, common.HexToHash(round.AllowlistRoot), leaf)
+}
+
+// allowlistAccountHash is the bytes32 account in a leaf: the left-padded address, or the keccak256 of the email
+func allowlistAccountHash(kind, account string) common.Hash {
+    if kind == models.AllowlistKindAddress {
+        return common.BytesToHash(common.HexToAddress(account).Bytes())
+    }
+    return crypto.Keccak256Hash([]byte(account))
+}
+
+// parseAllowlistCSV reads account,allocation rows; a header row is skipped
+func parseAllowlistCSV(r io.Reader) ([]models.AllowlistEntry, error) {
+    reader := csv.NewReader(r)
+    reader.FieldsPerRecord = -1
+    reader.TrimLeadingSpace = true
+
+    var entries []models.AllowlistEntry
+    seen := make(map[string]int)
+    for line := 1; ; line++ {
+        record, err := reader.Read()
+        if errors.Is(err, io.EOF) {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("invalid CSV: %w", err)
+        }
+        if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+            continue
+        }
+        if len(record) < 2 {
+            return nil, fmt.Errorf("line %d: expected account,allocation", line)
+        }
+
+        account := strings.ToLower(strings.TrimSpace(record[0]))
+        value := strings.TrimSpace(record[1])
+
+        allocation, err := strconv.ParseFloat(value, 64)
+        if err != nil {
+            if line == 1 {
+                continue // header
+            }
+            return nil, fmt.Errorf("line %d: invalid allocation %q", line, value)
+        }
+        allocationWei, err := parseTokenUnits(value, allowlistDecimals)
+        if err != nil || allocationWei.Sign() <= 0 {
+            return nil, fmt.Errorf("line %d: allocation must be a positive number of tokens", line)
+        }
+
+        kind := models.AllowlistKindEmail
+        switch {
+        case common.IsHexAddress(account):
+            kind = models.AllowlistKindAddress
+            account = strings.ToLower(common.HexToAddress(account).Hex())
+        case !strings.Contains(account, "@"):
+            return nil, fmt.Errorf("line %d: %q is neither a wallet address nor an email", line, record[0])
+        }
+
+        if previous, ok := seen[account]; ok {
+            return nil, fmt.Errorf("line %d: %s is already listed on line %d", line, account, previous)
+        }
+        seen[account] = line
+
+        entries = append(entries, models.AllowlistEntry{
+            Kind:          kind,
+            Account:       account,
+            Allocation:    allocation,
+            AllocationWei: allocationWei.String(),
+        })
+    }
+
+    if len(entries) == 0 {
+        return nil, fmt.Errorf("the allowlist is empty")
+    }
+    return entries, nil
+}
+
+// parseTokenUnits converts a decimal token amount to its smallest unit without rounding
+func parseTokenUnits(value string, decimals int) (*big.Int, error) {
+    whole, frac, _ := strings.Cut(value, ".")
+    if whole == "" {
+        whole = "0"
+    }
+    if len(frac) > decimals {
+        return nil, fmt.Errorf("%s has more than %d decimals", value, decimals)
+    }
+    digits := whole + frac + strings.Repeat("0", decimals-len(frac))
+    for _, r := range digits {
+        if r < '0' || r > '9' {
+            return nil, fmt.Errorf("invalid amount %s", value)
+        }
+    }
+
+    amount, ok := new(big.Int).SetString(digits, 10)
+    if !ok {
+        return nil, fmt.Errorf("invalid amount %s", value)
+    }
+    return amount, nil
+}
+
+// hexHashes encodes hashes as hex strings
+func hexHashes(hashes []common.Hash) []string {
+    encoded := make([]string, len(hashes))
+    for i, h := range hashes {
+        encoded[i] = h.Hex()
+    }
+    return encoded
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+    "strings"
+    "testing"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+)
+
+func TestParseAllowlistCSVAcceptsAddressesAndEmails(t *testing.T) {
+    csv := "account,allocation\n0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B,100\nBuyer@Example.com,25.5\n"
+    entries, err := parseAllowlistCSV(strings.NewReader(csv))
+    if err != nil {
+        t.Fatalf("parseAllowlistCSV: %v", err)
+    }
+    if len(entries) != 2 {
+        t.Fatalf("expected 2 entries, got %d", len(entries))
+    }
+
+    if entries[0].Kind != models.AllowlistKindAddress || entries[0].Account != "0xab5801a7d398351b8be11c439e05c5b3259aec9b" {
+        t.Fatalf("unexpected address entry %s %s", entries[0].Kind, entries[0].Account)
+    }
+    if entries[1].Kind != models.AllowlistKindEmail || entries[1].Account != "buyer@example.com" {
+        t.Fatalf("unexpected email entry %s %s", entries[1].Kind, entries[1].Account)
+    }
+
+    if _, err := parseAllowlistCSV(strings.NewReader("not-an-account,10\n")); err == nil {
+        t.Fatal("expected an account that is neither an address nor an email to be rejected")
+    }
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -135,6 +137,48 @@ func (s *BlockchainService) ProcessPayment(ctx context.Context, paymentID string
     return nil
 }
 
+// DeliverTokens registers a paid transaction with the payment gateway when it is not there yet
+// and completes it, which releases the tokens to the transaction's wallet. It returns the
+// callback transaction hash.
+func (s *BlockchainService) DeliverTokens(ctx context.Context, transaction *models.Transaction) (string, error) {
+    if s.PaymentGateway == nil {
+        return "", fmt.Errorf("payment gateway client is not initialized")
+    }
+
+    paymentID := transaction.PaymentID
+    exists, err := s.PaymentGateway.CheckPaymentExists(ctx, paymentID)
+    if err != nil {
+        log.Printf("Warning: Error checking payment existence: %v", err)
+    }
+
+    if !exists {
+        gasDeposit, err := s.PaymentGateway.GetRequiredGasDeposit(ctx)
+        if err != nil {
+            return "", fmt.Errorf("failed to get required gas deposit: %v", err)
+        }
+
+        _, err = s.PaymentGateway.CreatePayment(
+            ctx,
+            paymentID,
+            transaction.TokenAmountInWei(),
+            transaction.FiatAmountInSmallestUnit(),
+            strings.ToLower(transaction.PaymentMethod),
+            common.HexToAddress(transaction.WalletAddress),
+            gasDeposit,
+        )
+        if err != nil {
+            return "", fmt.Errorf("failed to create payment: %v", err)
+        }
+    }
+
+    txHash, err := s.PaymentGateway.ProcessPaymentCallback(ctx, paymentID, uint8(blockchain.PaymentStatusCompleted), nil)
+    if err != nil {
+        return "", fmt.Errorf("failed to process payment callback: %v", err)
+    }
+
+    return txHash, nil
+}
+
 // GetPaymentStatus retrieves the status of a payment
 func (s *BlockchainService) GetPaymentStatus(ctx context.Context, paymentID string) (blockchain.PaymentStatus, error) {
     return s.PaymentGateway.GetPaymentStatus(ctx, paymentID)
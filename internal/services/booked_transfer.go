@@ -0,0 +1,89 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "math/big"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "github.com/ethereum/go-ethereum/common"
+)
+
+// Booked transfers send tokens from the hot wallet that were booked in the database first, such as
+// vesting claims and referral payouts. The booking is only released when nothing was sent; a transfer
+// whose outcome is unknown stays pending until its receipt is checked.
+const (
+    bookedTransferTimeout   = 5 * time.Minute // How long a transfer may take before it is left to the reconciler
+    bookedTransferDropAfter = time.Hour       // How long a transfer the node does not know may take to show up
+)
+
+// transferOutcome is what is known about a booked transfer
+type transferOutcome int
+
+const (
+    transferPending   transferOutcome = iota // Possibly sent, not confirmed yet
+    transferCompleted                        // Mined
+    transferFailed                           // Nothing left the wallet, the booking can be released
+)
+
+// sendBookedTransfer sends booked tokens detached from the caller's context, so a client that
+// disconnects cannot interrupt it. record saves the hash before the transfer is broadcast.
+func sendBookedTransfer(client *blockchain.TokenClient, to common.Address, amount *big.Int, record func(txHash string) error) (string, transferOutcome, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), bookedTransferTimeout)
+    defer cancel()
+
+    var txHash string
+    tx, err := client.SendTransfer(ctx, to, amount, func(hash string) error {
+        if err := record(hash); err != nil {
+            return err
+        }
+        txHash = hash
+        return nil
+    })
+    if err != nil {
+        if errors.Is(err, blockchain.ErrTxNotSent) {
+            return txHash, transferFailed, err
+        }
+        return txHash, transferPending, err
+    }
+
+    switch err := client.WaitTransfer(ctx, tx); {
+    case err == nil:
+        return txHash, transferCompleted, nil
+    case errors.Is(err, blockchain.ErrTxReverted):
+        return txHash, transferFailed, err
+    default:
+        return txHash, transferPending, err
+    }
+}
+
+// checkBookedTransfer looks up a pending transfer booked at the given time. A transfer without a
+// hash never got signed, and one the node still does not know after bookedTransferDropAfter was
+// dropped; both count as failed once that long has passed.
+func checkBookedTransfer(ctx context.Context, client *blockchain.TokenClient, txHash string, bookedAt time.Time) (transferOutcome, error) {
+    dropped := time.Since(bookedAt) > bookedTransferDropAfter
+    if txHash == "" {
+        if dropped {
+            return transferFailed, nil
+        }
+        return transferPending, nil
+    }
+
+    status, err := client.TransactionStatus(ctx, txHash)
+    if err != nil {
+        return transferPending, err
+    }
+
+    switch status {
+    case blockchain.TxStatusSucceeded:
+        return transferCompleted, nil
+    case blockchain.TxStatusReverted:
+        return transferFailed, nil
+    case blockchain.TxStatusUnknown:
+        if dropped {
+            return transferFailed, nil
+        }
+    }
+    return transferPending, nil
+}
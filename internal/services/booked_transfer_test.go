@@ -0,0 +1,20 @@
+package services
+
+import (
+    "context"
+    "testing"
+    "time"
+)
+
+func TestCheckBookedTransferWithoutHash(t *testing.T) {
+    // A transfer without a hash is never looked up on-chain
+    outcome, err := checkBookedTransfer(context.Background(), nil, "", time.Now().Add(-time.Minute))
+    if err != nil || outcome != transferPending {
+        t.Fatalf("expected a recent unsigned transfer to stay pending, got %v (%v)", outcome, err)
+    }
+
+    outcome, err = checkBookedTransfer(context.Background(), nil, "", time.Now().Add(-bookedTransferDropAfter-time.Minute))
+    if err != nil || outcome != transferFailed {
+        t.Fatalf("expected an old unsigned transfer to fail, got %v (%v)", outcome, err)
+    }
+}
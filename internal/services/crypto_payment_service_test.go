@@ -0,0 +1,28 @@
+package services
+
+import (
+    "testing"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "github.com/ethereum/go-ethereum/common"
+)
+
+const testMnemonic = "test test test test test test test test test test test junk"
+
+func TestNewCryptoPaymentServiceBoundsUnderpayTolerance(t *testing.T) {
+    for _, bps := range []int64{0, 50, 9999} {
+        if _, err := NewCryptoPaymentService(nil, nil, nil, nil, nil, nil, blockchain.FeeCaps{}, testMnemonic,
+            common.Address{}, common.Address{}, time.Minute, 1, bps, false); err != nil {
+            t.Fatalf("tolerance %d: unexpected error %v", bps, err)
+        }
+    }
+
+    // 10000 or more would accept a zero payment
+    for _, bps := range []int64{-1, 10000, 20000} {
+        if _, err := NewCryptoPaymentService(nil, nil, nil, nil, nil, nil, blockchain.FeeCaps{}, testMnemonic,
+            common.Address{}, common.Address{}, time.Minute, 1, bps, false); err == nil {
+            t.Fatalf("expected tolerance %d to be rejected", bps)
+        }
+    }
+}
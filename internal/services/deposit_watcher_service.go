@@ -0,0 +1,501 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "math/big"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ethereum/go-ethereum/ethclient"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// depositCursorName is the ChainCursor row holding the last scanned block
+const depositCursorName = "deposit_watcher"
+
+// depositLogAddressChunk is the number of recipient addresses per eth_getLogs topic filter
+const depositLogAddressChunk = 200
+
+// erc20TransferTopic is the topic of Transfer(address indexed from, address indexed to, uint256 value)
+var erc20TransferTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// DepositWatcherService records ETH and ERC-20 transfers into managed wallets as incoming
+// wallet transactions and confirms them once they are deep enough in the chain.
+// Only top-level ETH transfers are seen; ETH sent by contracts through internal calls is not.
+type DepositWatcherService struct {
+    DB              *gorm.DB
+    EthClient       *ethclient.Client
+    RecoveryService *RecoveryService
+    Tokens          []common.Address // ERC-20 tokens watched for Transfer logs
+    Confirmations   uint64           // Blocks on top of the deposit block before it is confirmed
+    MaxBlocks       uint64           // Blocks scanned per pass at most
+    StartBlock      uint64           // First block scanned without a cursor, 0 = start near the head
+
+    chainID *big.Int
+    tokens  map[common.Address]depositToken
+}
+
+// depositToken caches the display metadata of a watched token
+type depositToken struct {
+    Symbol   string
+    Decimals uint8
+}
+
+// NewDepositWatcherService creates a new deposit watcher service
+func NewDepositWatcherService(db *gorm.DB, ethClient *ethclient.Client, recoveryService *RecoveryService, confirmations, maxBlocks, startBlock uint64, tokens ...common.Address) *DepositWatcherService {
+    if confirmations == 0 {
+        confirmations = 1
+    }
+    if maxBlocks == 0 {
+        maxBlocks = 50
+    }
+
+    // Drop unset and duplicate token addresses
+    unique := make([]common.Address, 0, len(tokens))
+    seen := make(map[common.Address]bool)
+    for _, token := range tokens {
+        if token == (common.Address{}) || seen[token] {
+            continue
+        }
+        seen[token] = true
+        unique = append(unique, token)
+    }
+
+    return &DepositWatcherService{
+        DB:              db,
+        EthClient:       ethClient,
+        RecoveryService: recoveryService,
+        Tokens:          unique,
+        Confirmations:   confirmations,
+        MaxBlocks:       maxBlocks,
+        StartBlock:      startBlock,
+        tokens:          make(map[common.Address]depositToken),
+    }
+}
+
+// Run scans for deposits and confirms them until the process exits
+func (s *DepositWatcherService) Run(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+        if err := s.Scan(ctx); err != nil {
+            log.Printf("Deposit watcher: %v", err)
+        }
+        cancel()
+    }
+}
+
+// Scan processes the next range of blocks and confirms deposits that reached the required depth
+func (s *DepositWatcherService) Scan(ctx context.Context) error {
+    head, err := s.EthClient.BlockNumber(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to get latest block: %w", err)
+    }
+
+    from, resumed, err := s.nextBlock(head)
+    if err != nil {
+        return err
+    }
+
+    to := head
+    if from <= head && to-from+1 > s.MaxBlocks {
+        to = from + s.MaxBlocks - 1
+    }
+
+    // Blocks less than Confirmations deep can still be replaced by a reorg, which may put a
+    // deposit at a height already scanned, so they are scanned again on every pass
+    start := from
+    if resumed {
+        start = from - min(from, s.Confirmations)
+    }
+
+    if start <= to {
+        if err := s.scanRange(ctx, start, to); err != nil {
+            return err
+        }
+    }
+
+    if from <= to {
+        cursor := models.ChainCursor{Name: depositCursorName, BlockNumber: to, UpdatedAt: time.Now()}
+        if err := s.DB.Save(&cursor).Error; err != nil {
+            return fmt.Errorf("failed to save deposit cursor: %w", err)
+        }
+    }
+
+    return s.confirmDeposits(ctx, head)
+}
+
+// nextBlock returns the first block not scanned yet, and whether earlier blocks were scanned
+func (s *DepositWatcherService) nextBlock(head uint64) (uint64, bool, error) {
+    var cursor models.ChainCursor
+    err := s.DB.Where("name = ?", depositCursorName).First(&cursor).Error
+    if err == nil {
+        return cursor.BlockNumber + 1, true, nil
+    }
+    if err != gorm.ErrRecordNotFound {
+        return 0, false, fmt.Errorf("failed to load deposit cursor: %w", err)
+    }
+
+    if s.StartBlock > 0 {
+        return s.StartBlock, false, nil
+    }
+    if head < s.Confirmations {
+        return 0, false, nil
+    }
+    return head - s.Confirmations, false, nil
+}
+
+// scanRange records native and token deposits in blocks from..to
+func (s *DepositWatcherService) scanRange(ctx context.Context, from, to uint64) error {
+    owners, err := s.managedAddresses()
+    if err != nil {
+        return err
+    }
+    if len(owners) == 0 {
+        return nil
+    }
+
+    for number := from; number <= to; number++ {
+        if err := s.scanBlock(ctx, number, owners); err != nil {
+            return err
+        }
+    }
+
+    return s.scanTokenLogs(ctx, from, to, owners)
+}
+
+// scanBlock records ETH transfers to managed addresses in one block
+func (s *DepositWatcherService) scanBlock(ctx context.Context, number uint64, owners map[common.Address]uuid.UUID) error {
+    block, err := s.EthClient.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+    if err != nil {
+        return fmt.Errorf("failed to get block %d: %w", number, err)
+    }
+
+    for _, tx := range block.Transactions() {
+        if tx.To() == nil || tx.Value().Sign() == 0 {
+            continue
+        }
+        userID, ok := owners[*tx.To()]
+        if !ok {
+            continue
+        }
+
+        signer, err := s.txSigner(ctx)
+        if err != nil {
+            return err
+        }
+        sender, err := types.Sender(signer, tx)
+        if err != nil {
+            log.Printf("Deposit watcher: failed to recover sender of %s: %v", tx.Hash().Hex(), err)
+            continue
+        }
+
+        if err := s.recordDeposit(&models.WalletTransaction{
+            UserID:        userID,
+            WalletAddress: tx.To().Hex(),
+            TxHash:        tx.Hash().Hex(),
+            TxType:        "deposit",
+            Amount:        tx.Value().String(),
+            TokenSymbol:   "ETH",
+            ToAddress:     tx.To().Hex(),
+            FromAddress:   sender.Hex(),
+            BlockNumber:   number,
+            BlockHash:     block.Hash().Hex(),
+        }); err != nil {
+            return err
+        }
+    }
+
+    return nil
+}
+
+// scanTokenLogs records Transfer logs of watched tokens to managed addresses
+func (s *DepositWatcherService) scanTokenLogs(ctx context.Context, from, to uint64, owners map[common.Address]uuid.UUID) error {
+    // An empty address list would match the Transfer logs of every contract
+    if len(s.Tokens) == 0 {
+        return nil
+    }
+
+    recipients := make([]common.Hash, 0, len(owners))
+    for address := range owners {
+        recipients = append(recipients, common.BytesToHash(address.Bytes()))
+    }
+
+    for start := 0; start < len(recipients); start += depositLogAddressChunk {
+        end := start + depositLogAddressChunk
+        if end > len(recipients) {
+            end = len(recipients)
+        }
+
+        logs, err := s.EthClient.FilterLogs(ctx, ethereum.FilterQuery{
+            FromBlock: new(big.Int).SetUint64(from),
+            ToBlock:   new(big.Int).SetUint64(to),
+            Addresses: s.Tokens,
+            Topics:    [][]common.Hash{{erc20TransferTopic}, nil, recipients[start:end]},
+        })
+        if err != nil {
+            return fmt.Errorf("failed to filter transfer logs: %w", err)
+        }
+
+        for _, entry := range logs {
+            // Skip removed logs and non-standard Transfer events such as ERC-721
+            if entry.Removed || len(entry.Topics) != 3 || len(entry.Data) != 32 {
+                continue
+            }
+
+            recipient := common.BytesToAddress(entry.Topics[2].Bytes())
+            userID, ok := owners[recipient]
+            if !ok {
+                continue
+            }
+
+            amount := new(big.Int).SetBytes(entry.Data)
+            if amount.Sign() == 0 {
+                continue
+            }
+
+            if err := s.recordDeposit(&models.WalletTransaction{
+                UserID:        userID,
+                WalletAddress: recipient.Hex(),
+                TxHash:        entry.TxHash.Hex(),
+                TxType:        "deposit",
+                Amount:        amount.String(),
+                TokenSymbol:   s.token(ctx, entry.Address).Symbol,
+                TokenAddress:  entry.Address.Hex(),
+                ToAddress:     recipient.Hex(),
+                FromAddress:   common.BytesToAddress(entry.Topics[1].Bytes()).Hex(),
+                BlockNumber:   entry.BlockNumber,
+                BlockHash:     entry.BlockHash.Hex(),
+                LogIndex:      entry.Index,
+            }); err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
+
+// recordDeposit stores a pending incoming transaction unless it was already recorded
+func (s *DepositWatcherService) recordDeposit(walletTx *models.WalletTransaction) error {
+    walletTx.UUID = uuid.New()
+    walletTx.Direction = models.WalletTxDirectionIncoming
+    walletTx.Status = models.WalletTxStatusPending
+    walletTx.CreatedAt = time.Now()
+    walletTx.UpdatedAt = walletTx.CreatedAt
+
+    // Rescanned blocks report the same deposits again; the unique index drops them
+    result := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(walletTx)
+    if result.Error != nil {
+        return fmt.Errorf("failed to record deposit: %w", result.Error)
+    }
+    if result.RowsAffected == 0 {
+        // A deposit failed as dropped can come back in a later block
+        if err := s.DB.Model(&models.WalletTransaction{}).
+            Where("tx_hash = ? AND log_index = ? AND wallet_address = ? AND token_address = ? AND direction = ? AND status = ?",
+                walletTx.TxHash, walletTx.LogIndex, walletTx.WalletAddress, walletTx.TokenAddress, models.WalletTxDirectionIncoming, models.WalletTxStatusFailed).
+            Updates(map[string]interface{}{
+                "status":       models.WalletTxStatusPending,
+                "block_number": walletTx.BlockNumber,
+                "block_hash":   walletTx.BlockHash,
+                "updated_at":   time.Now(),
+            }).Error; err != nil {
+            return fmt.Errorf("failed to restore deposit: %w", err)
+        }
+        return nil
+    }
+
+    log.Printf("Deposit watcher: %s %s to %s in %s", walletTx.Amount, walletTx.TokenSymbol, walletTx.WalletAddress, walletTx.TxHash)
+    return nil
+}
+
+// confirmDeposits settles pending deposits that have enough confirmations.
+// Deposits moved to another block by a reorg wait again; deposits dropped by one are failed.
+func (s *DepositWatcherService) confirmDeposits(ctx context.Context, head uint64) error {
+    if head+1 < s.Confirmations {
+        return nil
+    }
+    maxBlock := head + 1 - s.Confirmations
+
+    var pending []models.WalletTransaction
+    if err := s.DB.Where("direction = ? AND status = ? AND block_number <= ?", models.WalletTxDirectionIncoming, models.WalletTxStatusPending, maxBlock).
+        Order("block_number").Limit(200).Find(&pending).Error; err != nil {
+        return fmt.Errorf("failed to load pending deposits: %w", err)
+    }
+
+    for i := range pending {
+        if err := s.settleDeposit(ctx, &pending[i]); err != nil {
+            log.Printf("Deposit watcher: %s: %v", pending[i].TxHash, err)
+        }
+    }
+
+    return nil
+}
+
+// settleDeposit checks the receipt of a deposit and confirms, fails or re-queues it
+func (s *DepositWatcherService) settleDeposit(ctx context.Context, walletTx *models.WalletTransaction) error {
+    hash := common.HexToHash(walletTx.TxHash)
+
+    receipt, err := s.EthClient.TransactionReceipt(ctx, hash)
+    if err == ethereum.NotFound {
+        if _, _, err := s.EthClient.TransactionByHash(ctx, hash); err != ethereum.NotFound {
+            return nil // Back in the mempool after a reorg, or the node could not tell
+        }
+        return s.updateDeposit(walletTx, map[string]interface{}{"status": models.WalletTxStatusFailed})
+    }
+    if err != nil {
+        return fmt.Errorf("failed to get receipt: %w", err)
+    }
+
+    if !strings.EqualFold(receipt.BlockHash.Hex(), walletTx.BlockHash) {
+        return s.updateDeposit(walletTx, map[string]interface{}{
+            "block_number": receipt.BlockNumber.Uint64(),
+            "block_hash":   receipt.BlockHash.Hex(),
+        })
+    }
+
+    if receipt.Status == types.ReceiptStatusFailed {
+        return s.updateDeposit(walletTx, map[string]interface{}{"status": models.WalletTxStatusFailed})
+    }
+
+    if err := s.updateDeposit(walletTx, map[string]interface{}{"status": models.WalletTxStatusConfirmed}); err != nil {
+        return err
+    }
+
+    s.notify(ctx, walletTx)
+    return nil
+}
+
+// updateDeposit applies column updates to a deposit row
+func (s *DepositWatcherService) updateDeposit(walletTx *models.WalletTransaction, updates map[string]interface{}) error {
+    updates["updated_at"] = time.Now()
+    if err := s.DB.Model(walletTx).Updates(updates).Error; err != nil {
+        return fmt.Errorf("failed to update deposit: %w", err)
+    }
+    return nil
+}
+
+// notify emails the owner of a confirmed deposit
+func (s *DepositWatcherService) notify(ctx context.Context, walletTx *models.WalletTransaction) {
+    if s.RecoveryService == nil {
+        return
+    }
+
+    var user models.User
+    if err := s.DB.Where("uuid = ?", walletTx.UserID).First(&user).Error; err != nil || user.Email == "" {
+        return
+    }
+
+    decimals := uint8(18)
+    if walletTx.TokenAddress != "" {
+        decimals = s.token(ctx, common.HexToAddress(walletTx.TokenAddress)).Decimals
+    }
+
+    amount, ok := new(big.Int).SetString(walletTx.Amount, 10)
+    if !ok {
+        return
+    }
+
+    if err := s.RecoveryService.SendDepositEmail(user.Email, user.Username, walletTx.WalletAddress,
+        formatUnits(amount, decimals), walletTx.TokenSymbol, walletTx.TxHash); err != nil {
+        log.Printf("Deposit watcher: failed to notify user %s: %v", user.UUID, err)
+    }
+}
+
+// txSigner returns a signer able to recover the sender of any transaction type on this chain
+func (s *DepositWatcherService) txSigner(ctx context.Context) (types.Signer, error) {
+    if s.chainID == nil {
+        chainID, err := s.EthClient.ChainID(ctx)
+        if err != nil {
+            return nil, fmt.Errorf("failed to get chain ID: %w", err)
+        }
+        s.chainID = chainID
+    }
+    return types.LatestSignerForChainID(s.chainID), nil
+}
+
+// token returns the cached symbol and decimals of a watched token
+func (s *DepositWatcherService) token(ctx context.Context, address common.Address) depositToken {
+    if meta, ok := s.tokens[address]; ok {
+        return meta
+    }
+
+    meta := depositToken{Symbol: address.Hex(), Decimals: 18}
+    contract, err := blockchain.NewERC20(address, s.EthClient)
+    if err != nil {
+        return meta
+    }
+    if symbol, err := contract.Symbol(&bind.CallOpts{Context: ctx}); err == nil {
+        meta.Symbol = symbol
+    }
+    if decimals, err := contract.Decimals(&bind.CallOpts{Context: ctx}); err == nil {
+        meta.Decimals = decimals
+    }
+
+    s.tokens[address] = meta
+    return meta
+}
+
+// managedAddresses maps every wallet address held by a user to that user
+func (s *DepositWatcherService) managedAddresses() (map[common.Address]uuid.UUID, error) {
+    owners := make(map[common.Address]uuid.UUID)
+
+    var wallets []models.Wallet
+    if err := s.DB.Select("user_id", "wallet_address").Find(&wallets).Error; err != nil {
+        return nil, fmt.Errorf("failed to load wallets: %w", err)
+    }
+    for _, wallet := range wallets {
+        if common.IsHexAddress(wallet.WalletAddress) {
+            owners[common.HexToAddress(wallet.WalletAddress)] = wallet.UserID
+        }
+    }
+
+    var users []models.User
+    if err := s.DB.Select("uuid", "wallet_address").Where("wallet_address <> ''").Find(&users).Error; err != nil {
+        return nil, fmt.Errorf("failed to load user wallets: %w", err)
+    }
+    for _, user := range users {
+        if common.IsHexAddress(user.WalletAddress) {
+            owners[common.HexToAddress(user.WalletAddress)] = user.UUID
+        }
+    }
+
+    return owners, nil
+}
+
+// formatUnits renders an integer amount in the token's display unit
+func formatUnits(amount *big.Int, decimals uint8) string {
+    if decimals == 0 {
+        return amount.String()
+    }
+
+    digits := new(big.Int).Abs(amount).String()
+    if len(digits) <= int(decimals) {
+        digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+    }
+
+    whole := digits[:len(digits)-int(decimals)]
+    fraction := strings.TrimRight(digits[len(digits)-int(decimals):], "0")
+
+    result := whole
+    if fraction != "" {
+        result += "." + fraction
+    }
+    if amount.Sign() < 0 {
+        result = "-" + result
+    }
+    return result
+}
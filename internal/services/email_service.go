@@ -0,0 +1,305 @@
+package services
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/pkg/mailer"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// Outbox delivery tuning
+const (
+    emailBatch        = 50
+    emailSendTimeout  = 30 * time.Second
+    emailLease        = 2 * time.Minute // An email being sent is not picked up again until its lease expires
+    emailRetryBackoff = 30 * time.Second
+    emailMaxBackoff   = 6 * time.Hour
+)
+
+// EmailService renders transactional emails in the recipient's language and queues them in the
+// outbox, from which a background worker delivers them with retries
+type EmailService struct {
+    DB              *gorm.DB
+    Mailer          mailer.Mailer
+    DefaultLanguage string
+    MaxAttempts     int
+    wake            chan struct{}
+}
+
+// NewEmailService creates a new email service
+func NewEmailService(db *gorm.DB, m mailer.Mailer, cfg config.EmailConfig) *EmailService {
+    language := cfg.DefaultLanguage
+    if !IsSupportedLanguage(language) {
+        language = models.LanguageEnglish
+    }
+    return &EmailService{
+        DB:              db,
+        Mailer:          m,
+        DefaultLanguage: language,
+        MaxAttempts:     max(cfg.MaxAttempts, 1),
+        wake:            make(chan struct{}, 1),
+    }
+}
+
+// Send renders a template for a recipient and queues it for delivery. The language is the one
+// chosen by the user owning the address, or the default one. Username defaults to the name.
+func (s *EmailService) Send(to, name, template string, data map[string]interface{}, attachments ...mailer.Attachment) error {
+    language := s.DefaultLanguage
+    var userID *uuid.UUID
+    var user models.User
+    if err := s.DB.Where("email = ?", to).First(&user).Error; err == nil {
+        userID = &user.UUID
+        if IsSupportedLanguage(user.Language) {
+            language = user.Language
+        }
+    }
+
+    if data == nil {
+        data = map[string]interface{}{}
+    }
+    if _, ok := data["Username"]; !ok {
+        data["Username"] = name
+    }
+
+    subject, text, html, err := renderEmail(template, language, data)
+    if err != nil {
+        return err
+    }
+
+    var files []byte
+    if len(attachments) > 0 {
+        if files, err = json.Marshal(attachments); err != nil {
+            return fmt.Errorf("failed to encode attachments: %w", err)
+        }
+    }
+
+    now := time.Now()
+    email := models.EmailOutbox{
+        UUID:          uuid.New(),
+        UserID:        userID,
+        Template:      template,
+        Language:      language,
+        ToEmail:       to,
+        ToName:        name,
+        Subject:       subject,
+        TextBody:      text,
+        HTMLBody:      html,
+        Attachments:   files,
+        Sensitive:     sensitiveEmailTemplates[template],
+        Status:        models.EmailStatusPending,
+        NextAttemptAt: now,
+        CreatedAt:     now,
+        UpdatedAt:     now,
+    }
+    if err := s.DB.Create(&email).Error; err != nil {
+        return fmt.Errorf("failed to queue %s email: %w", template, err)
+    }
+
+    select {
+    case s.wake <- struct{}{}:
+    default:
+    }
+    return nil
+}
+
+// SendSecurityAlert tells a user about a sign-in from a new location or a change to their 2FA
+func (s *EmailService) SendSecurityAlert(user *models.User, event, ipAddress, userAgent string) error {
+    if user.Email == "" {
+        return nil
+    }
+    if userAgent == "" {
+        userAgent = "unknown"
+    }
+    return s.Send(user.Email, user.Username, EmailTemplateSecurityAlert, map[string]interface{}{
+        "Event":     event,
+        "Time":      time.Now().UTC().Format("2006-01-02 15:04 MST"),
+        "IPAddress": ipAddress,
+        "UserAgent": userAgent,
+    })
+}
+
+// Run delivers due emails every interval, and right away when one is queued, after clearing the
+// bodies of finished sensitive emails
+func (s *EmailService) Run(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    // Failed emails used to keep their secrets
+    err := s.DB.Model(&models.EmailOutbox{}).
+        Where("sensitive = ? AND status IN ? AND (text_body <> '' OR html_body <> '' OR attachments IS NOT NULL)",
+            true, []string{models.EmailStatusSent, models.EmailStatusFailed}).
+        Updates(map[string]interface{}{"text_body": "", "html_body": "", "attachments": nil}).Error
+    if err != nil {
+        log.Printf("Emails: failed to clear sent secrets: %v", err)
+    }
+
+    for {
+        select {
+        case <-ticker.C:
+        case <-s.wake:
+        }
+        if err := s.Deliver(context.Background()); err != nil {
+            log.Printf("Emails: %v", err)
+        }
+    }
+}
+
+// Deliver sends the pending emails that are due. Each one is claimed with a lease first, so
+// several instances never send the same email.
+func (s *EmailService) Deliver(ctx context.Context) error {
+    var due []models.EmailOutbox
+    err := s.DB.Select("uuid").Where("status = ? AND next_attempt_at <= ?", models.EmailStatusPending, time.Now()).
+        Order("next_attempt_at").Limit(emailBatch).Find(&due).Error
+    if err != nil {
+        return fmt.Errorf("failed to find due emails: %w", err)
+    }
+
+    for _, row := range due {
+        now := time.Now()
+        claim := s.DB.Model(&models.EmailOutbox{}).
+            Where("uuid = ? AND status = ? AND next_attempt_at <= ?", row.UUID, models.EmailStatusPending, now).
+            Update("next_attempt_at", now.Add(emailLease))
+        if claim.Error != nil {
+            return fmt.Errorf("failed to claim email: %w", claim.Error)
+        }
+        if claim.RowsAffected == 0 {
+            continue
+        }
+
+        var email models.EmailOutbox
+        if err := s.DB.Where("uuid = ?", row.UUID).First(&email).Error; err != nil {
+            return fmt.Errorf("failed to load email: %w", err)
+        }
+        s.deliver(ctx, &email)
+    }
+    return nil
+}
+
+// deliver sends one claimed email and records the outcome, scheduling a retry with exponential
+// backoff on failure
+func (s *EmailService) deliver(ctx context.Context, email *models.EmailOutbox) {
+    err := s.send(ctx, email)
+    now := time.Now()
+    attempts := email.Attempts + 1
+
+    updates := map[string]interface{}{
+        "attempts":   attempts,
+        "updated_at": now,
+    }
+    done := true
+    if err == nil {
+        updates["status"] = models.EmailStatusSent
+        updates["sent_at"] = now
+        updates["last_error"] = ""
+    } else {
+        log.Printf("Emails: %s to %s: %v", email.Template, email.ToEmail, err)
+        updates["last_error"] = err.Error()
+        if attempts >= s.MaxAttempts {
+            updates["status"] = models.EmailStatusFailed
+        } else {
+            updates["next_attempt_at"] = now.Add(emailBackoff(attempts))
+            done = false
+        }
+    }
+
+    // Secrets are not kept once the email is sent or given up on; a failed one cannot be retried
+    // and has to be requested again
+    if done && email.Sensitive {
+        updates["text_body"] = ""
+        updates["html_body"] = ""
+        updates["attachments"] = nil
+    }
+
+    if err := s.DB.Model(&models.EmailOutbox{}).Where("uuid = ?", email.UUID).Updates(updates).Error; err != nil {
+        log.Printf("Emails: failed to record delivery of %s: %v", email.UUID, err)
+    }
+}
+
+// send hands an outbox email to the mailer
+func (s *EmailService) send(ctx context.Context, email *models.EmailOutbox) error {
+    if email.TextBody == "" && email.HTMLBody == "" {
+        return fmt.Errorf("email body is no longer available")
+    }
+
+    msg := &mailer.Message{
+        To:      mailer.Address{Name: email.ToName, Email: email.ToEmail},
+        Subject: email.Subject,
+        Text:    email.TextBody,
+        HTML:    email.HTMLBody,
+    }
+    if len(email.Attachments) > 0 {
+        if err := json.Unmarshal(email.Attachments, &msg.Attachments); err != nil {
+            return fmt.Errorf("failed to decode attachments: %w", err)
+        }
+    }
+
+    ctx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+    defer cancel()
+    return s.Mailer.Send(ctx, msg)
+}
+
+// emailBackoff is the delay before the next attempt, doubling from 30 seconds up to 6 hours
+func emailBackoff(attempts int) time.Duration {
+    delay := emailRetryBackoff
+    for i := 1; i < attempts && delay < emailMaxBackoff; i++ {
+        delay *= 2
+    }
+    return min(delay, emailMaxBackoff)
+}
+
+// Outbox lists outbox emails, newest first, optionally filtered by status
+func (s *EmailService) Outbox(status string, limit, offset int) ([]models.EmailOutbox, int64, error) {
+    query := s.DB.Model(&models.EmailOutbox{})
+    if status != "" {
+        query = query.Where("status = ?", status)
+    }
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count emails: %w", err)
+    }
+
+    var emails []models.EmailOutbox
+    if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&emails).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to list emails: %w", err)
+    }
+    return emails, total, nil
+}
+
+// Retry queues a failed email for another round of attempts
+func (s *EmailService) Retry(id string) (*models.EmailOutbox, error) {
+    var email models.EmailOutbox
+    if err := s.DB.Where("uuid = ?", id).First(&email).Error; err != nil {
+        return nil, fmt.Errorf("email not found")
+    }
+    if email.Status != models.EmailStatusFailed {
+        return nil, fmt.Errorf("only failed emails can be retried")
+    }
+    if email.TextBody == "" && email.HTMLBody == "" {
+        return nil, fmt.Errorf("email body is no longer available")
+    }
+
+    now := time.Now()
+    err := s.DB.Model(&email).Updates(map[string]interface{}{
+        "status":          models.EmailStatusPending,
+        "attempts":        0,
+        "next_attempt_at": now,
+        "updated_at":      now,
+    }).Error
+    if err != nil {
+        return nil, fmt.Errorf("failed to retry email: %w", err)
+    }
+
+    select {
+    case s.wake <- struct{}{}:
+    default:
+    }
+    return &email, nil
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+    "bytes"
+    "fmt"
+    htmltemplate "html/template"
+    texttemplate "text/template"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+)
+
+// Email templates
+const (
+    EmailTemplateWalletRecovery    = "wallet_recovery"
+    EmailTemplate2FARecovery       = "2fa_recovery"
+    EmailTemplateAccountLocked     = "account_locked"
+    EmailTemplateWalletShare       = "wallet_share"
+    EmailTemplateDepositReceived   = "deposit_received"
+    EmailTemplatePurchaseCompleted = "purchase_completed"
+    EmailTemplatePurchaseFailed    = "purchase_failed"
+    EmailTemplatePurchaseRefunded  = "purchase_refunded"
+    EmailTemplateSecurityAlert     = "security_alert"
+)
+
+// Security alert events
+const (
+    SecurityEventNewSignIn    = "new_sign_in"
+    SecurityEvent2FAEnabled   = "2fa_enabled"
+    SecurityEvent2FADisabled  = "2fa_disabled"
+    SecurityEvent2FARecovered = "2fa_recovered"
+)
+
+// Templates whose body holds a secret, cleared from the outbox once sent
+var sensitiveEmailTemplates = map[string]bool{
+    EmailTemplateWalletRecovery: true,
+    EmailTemplate2FARecovery:    true,
+    EmailTemplateAccountLocked:  true,
+    EmailTemplateWalletShare:    true,
+}
+
+// Styles shared by the HTML templates
+const (
+    emailButtonStyle = `padding: 10px 20px; background-color: #4CAF50; color: white; text-decoration: none; border-radius: 5px;`
+    emailCodeStyle   = `word-break: break-all; background: #f8f9fa; padding: 5px 10px; border-radius: 3px;`
+    emailWarnStyle   = `color: #e74c3c; font-weight: bold;`
+)
+
+// emailSource is the subject and bodies of a template in one language. Bodies go between the
+// greeting and sign-off of the language's layout.
+type emailSource struct {
+    Subject string
+    Text    string
+    HTML    string
+}
+
+// emailLayouts wrap every body with the greeting and sign-off of a language
+var emailLayouts = map[string]emailSource{
+    models.LanguageEnglish: {
+        Text: "Hello {{.Username}},\n\n%s\n\nBest regards,\nThe Web3 Tokensale Team",
+        HTML: "<h2>Hello {{.Username}},</h2>%s<p>Best regards,<br>The Web3 Tokensale Team</p>",
+    },
+    models.LanguageIndonesian: {
+        Text: "Halo {{.Username}},\n\n%s\n\nSalam hangat,\nTim Web3 Tokensale",
+        HTML: "<h2>Halo {{.Username}},</h2>%s<p>Salam hangat,<br>Tim Web3 Tokensale</p>",
+    },
+}
+
+// securityEvents describe each security alert event, used by the template's event function
+var securityEvents = map[string]map[string]string{
+    models.LanguageEnglish: {
+        SecurityEventNewSignIn:    "New sign-in to your account",
+        SecurityEvent2FAEnabled:   "Two-factor authentication was enabled",
+        SecurityEvent2FADisabled:  "Two-factor authentication was disabled",
+        SecurityEvent2FARecovered: "Two-factor authentication was reset with a recovery code",
+    },
+    models.LanguageIndonesian: {
+        SecurityEventNewSignIn:    "Login baru ke akun Anda",
+        SecurityEvent2FAEnabled:   "Autentikasi dua faktor telah diaktifkan",
+        SecurityEvent2FADisabled:  "Autentikasi dua faktor telah dinonaktifkan",
+        SecurityEvent2FARecovered: "Autentikasi dua faktor telah direset dengan kode pemulihan",
+    },
+}
+
+var emailSources = map[string]map[string]emailSource{
+    EmailTemplateWalletRecovery: {
+        models.LanguageEnglish: {
+            Subject: "Your Wallet Recovery Link",
+            Text: "You requested to recover your wallet. Click the link below to access your wallet:\n\n{{.Link}}\n\n" +
+                "This link will expire in 24 hours.\n\nIf you did not request this, please ignore this email.",
+            HTML: "<p>You requested to recover your wallet. Click the button below to access your wallet:</p>" +
+                "<p><a href=\"{{.Link}}\" style=\"" + emailButtonStyle + "\">Recover My Wallet</a></p>" +
+                "<p>Or copy this link: <a href=\"{{.Link}}\">{{.Link}}</a></p>" +
+                "<p>This link will expire in 24 hours.</p><p>If you did not request this, please ignore this email.</p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Tautan Pemulihan Dompet Anda",
+            Text: "Anda meminta untuk memulihkan dompet Anda. Klik tautan di bawah untuk mengakses dompet Anda:\n\n{{.Link}}\n\n" +
+                "Tautan ini berlaku selama 24 jam.\n\nJika Anda tidak memintanya, abaikan email ini.",
+            HTML: "<p>Anda meminta untuk memulihkan dompet Anda. Klik tombol di bawah untuk mengakses dompet Anda:</p>" +
+                "<p><a href=\"{{.Link}}\" style=\"" + emailButtonStyle + "\">Pulihkan Dompet Saya</a></p>" +
+                "<p>Atau salin tautan ini: <a href=\"{{.Link}}\">{{.Link}}</a></p>" +
+                "<p>Tautan ini berlaku selama 24 jam.</p><p>Jika Anda tidak memintanya, abaikan email ini.</p>",
+        },
+    },
+    EmailTemplate2FARecovery: {
+        models.LanguageEnglish: {
+            Subject: "2FA Recovery Code",
+            Text: "You requested to recover your Two-Factor Authentication (2FA).\n\nYour recovery code is: {{.Code}}\n\n" +
+                "This code will expire in 30 minutes.\n\n" +
+                "If you didn't request this recovery, please ignore this email or contact support immediately.",
+            HTML: "<p>We received a request to recover your Two-Factor Authentication (2FA).</p>" +
+                "<p>Your recovery code is: <strong style=\"font-size: 18px; letter-spacing: 2px; " + emailCodeStyle + "\">{{.Code}}</strong></p>" +
+                "<p style=\"" + emailWarnStyle + "\">This code will expire in 30 minutes.</p>" +
+                "<p>If you didn't request this recovery, please ignore this email or contact support immediately.</p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Kode Pemulihan 2FA",
+            Text: "Anda meminta untuk memulihkan Autentikasi Dua Faktor (2FA) Anda.\n\nKode pemulihan Anda: {{.Code}}\n\n" +
+                "Kode ini berlaku selama 30 menit.\n\n" +
+                "Jika Anda tidak meminta pemulihan ini, abaikan email ini atau segera hubungi dukungan.",
+            HTML: "<p>Kami menerima permintaan untuk memulihkan Autentikasi Dua Faktor (2FA) Anda.</p>" +
+                "<p>Kode pemulihan Anda: <strong style=\"font-size: 18px; letter-spacing: 2px; " + emailCodeStyle + "\">{{.Code}}</strong></p>" +
+                "<p style=\"" + emailWarnStyle + "\">Kode ini berlaku selama 30 menit.</p>" +
+                "<p>Jika Anda tidak meminta pemulihan ini, abaikan email ini atau segera hubungi dukungan.</p>",
+        },
+    },
+    EmailTemplateAccountLocked: {
+        models.LanguageEnglish: {
+            Subject: "Your Account Has Been Locked",
+            Text: "Your account was locked after too many failed sign-in attempts. It will unlock automatically at {{.Until}}.\n\n" +
+                "If this was you, you can unlock it now with the link below:\n\n{{.Link}}\n\n" +
+                "If this was not you, we recommend changing your password and enabling 2FA.",
+            HTML: "<p>Your account was locked after too many failed sign-in attempts. It will unlock automatically at <strong>{{.Until}}</strong>.</p>" +
+                "<p>If this was you, you can unlock it now:</p>" +
+                "<p><a href=\"{{.Link}}\" style=\"" + emailButtonStyle + "\">Unlock My Account</a></p>" +
+                "<p>Or copy this link: <a href=\"{{.Link}}\">{{.Link}}</a></p>" +
+                "<p style=\"" + emailWarnStyle + "\">If this was not you, we recommend changing your password and enabling 2FA.</p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Akun Anda Telah Dikunci",
+            Text: "Akun Anda dikunci setelah terlalu banyak percobaan login yang gagal. Akun akan terbuka otomatis pada {{.Until}}.\n\n" +
+                "Jika ini Anda, Anda dapat membukanya sekarang dengan tautan di bawah:\n\n{{.Link}}\n\n" +
+                "Jika ini bukan Anda, kami sarankan untuk mengganti kata sandi dan mengaktifkan 2FA.",
+            HTML: "<p>Akun Anda dikunci setelah terlalu banyak percobaan login yang gagal. Akun akan terbuka otomatis pada <strong>{{.Until}}</strong>.</p>" +
+                "<p>Jika ini Anda, Anda dapat membukanya sekarang:</p>" +
+                "<p><a href=\"{{.Link}}\" style=\"" + emailButtonStyle + "\">Buka Kunci Akun Saya</a></p>" +
+                "<p>Atau salin tautan ini: <a href=\"{{.Link}}\">{{.Link}}</a></p>" +
+                "<p style=\"" + emailWarnStyle + "\">Jika ini bukan Anda, kami sarankan untuk mengganti kata sandi dan mengaktifkan 2FA.</p>",
+        },
+    },
+    EmailTemplateWalletShare: {
+        models.LanguageEnglish: {
+            Subject: "Your Wallet Backup Share",
+            Text: "You created a split backup of wallet {{.WalletAddress}}. This email holds share {{.Index}} of {{.Total}}; any {{.Threshold}} shares rebuild your recovery phrase.\n\n" +
+                "Share {{.Index}}: {{.Share}}\n\n" +
+                "Keep this email safe and never forward it. Our support team will never ask for your shares.",
+            HTML: "<p>You created a split backup of wallet <strong>{{.WalletAddress}}</strong>. This email holds share {{.Index}} of {{.Total}}; any {{.Threshold}} shares rebuild your recovery phrase.</p>" +
+                "<p>Share {{.Index}}:</p><p><code style=\"" + emailCodeStyle + "\">{{.Share}}</code></p>" +
+                "<p style=\"" + emailWarnStyle + "\">Keep this email safe and never forward it. Our support team will never ask for your shares.</p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Bagian Cadangan Dompet Anda",
+            Text: "Anda membuat cadangan terpisah untuk dompet {{.WalletAddress}}. Email ini berisi bagian {{.Index}} dari {{.Total}}; {{.Threshold}} bagian mana pun dapat menyusun kembali frasa pemulihan Anda.\n\n" +
+                "Bagian {{.Index}}: {{.Share}}\n\n" +
+                "Simpan email ini dengan aman dan jangan pernah meneruskannya. Tim dukungan kami tidak akan pernah meminta bagian Anda.",
+            HTML: "<p>Anda membuat cadangan terpisah untuk dompet <strong>{{.WalletAddress}}</strong>. Email ini berisi bagian {{.Index}} dari {{.Total}}; {{.Threshold}} bagian mana pun dapat menyusun kembali frasa pemulihan Anda.</p>" +
+                "<p>Bagian {{.Index}}:</p><p><code style=\"" + emailCodeStyle + "\">{{.Share}}</code></p>" +
+                "<p style=\"" + emailWarnStyle + "\">Simpan email ini dengan aman dan jangan pernah meneruskannya. Tim dukungan kami tidak akan pernah meminta bagian Anda.</p>",
+        },
+    },
+    EmailTemplateDepositReceived: {
+        models.LanguageEnglish: {
+            Subject: "You received {{.Amount}} {{.Symbol}}",
+            Text:    "A deposit of {{.Amount}} {{.Symbol}} to your wallet {{.WalletAddress}} has been confirmed.\n\nTransaction: {{.TxHash}}",
+            HTML: "<p>A deposit of <strong>{{.Amount}} {{.Symbol}}</strong> to your wallet <strong>{{.WalletAddress}}</strong> has been confirmed.</p>" +
+                "<p>Transaction: <code style=\"word-break: break-all;\">{{.TxHash}}</code></p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Anda menerima {{.Amount}} {{.Symbol}}",
+            Text:    "Setoran {{.Amount}} {{.Symbol}} ke dompet Anda {{.WalletAddress}} telah dikonfirmasi.\n\nTransaksi: {{.TxHash}}",
+            HTML: "<p>Setoran <strong>{{.Amount}} {{.Symbol}}</strong> ke dompet Anda <strong>{{.WalletAddress}}</strong> telah dikonfirmasi.</p>" +
+                "<p>Transaksi: <code style=\"word-break: break-all;\">{{.TxHash}}</code></p>",
+        },
+    },
+    EmailTemplatePurchaseCompleted: {
+        models.LanguageEnglish: {
+            Subject: "Your receipt for {{.Amount}} {{.Symbol}}",
+            Text: "Your purchase {{.PaymentID}} of {{.Amount}} {{.Symbol}} has completed and the tokens were sent to {{.WalletAddress}}.\n\n" +
+                "Amount paid: {{.FiatAmount}} {{.Currency}}\n{{if .TxHash}}Transaction: {{.TxHash}}\n{{end}}\nThe invoice and receipt are attached.",
+            HTML: "<p>Your purchase <strong>{{.PaymentID}}</strong> of <strong>{{.Amount}} {{.Symbol}}</strong> has completed and the tokens were sent to <strong>{{.WalletAddress}}</strong>.</p>" +
+                "<p>Amount paid: <strong>{{.FiatAmount}} {{.Currency}}</strong></p>" +
+                "{{if .TxHash}}<p>Transaction: <a href=\"{{.ExplorerURL}}\" style=\"word-break: break-all;\">{{.TxHash}}</a></p>{{end}}" +
+                "<p>The invoice and receipt are attached.</p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Tanda terima untuk {{.Amount}} {{.Symbol}}",
+            Text: "Pembelian Anda {{.PaymentID}} sebesar {{.Amount}} {{.Symbol}} telah selesai dan token telah dikirim ke {{.WalletAddress}}.\n\n" +
+                "Jumlah dibayar: {{.FiatAmount}} {{.Currency}}\n{{if .TxHash}}Transaksi: {{.TxHash}}\n{{end}}\nFaktur dan tanda terima terlampir.",
+            HTML: "<p>Pembelian Anda <strong>{{.PaymentID}}</strong> sebesar <strong>{{.Amount}} {{.Symbol}}</strong> telah selesai dan token telah dikirim ke <strong>{{.WalletAddress}}</strong>.</p>" +
+                "<p>Jumlah dibayar: <strong>{{.FiatAmount}} {{.Currency}}</strong></p>" +
+                "{{if .TxHash}}<p>Transaksi: <a href=\"{{.ExplorerURL}}\" style=\"word-break: break-all;\">{{.TxHash}}</a></p>{{end}}" +
+                "<p>Faktur dan tanda terima terlampir.</p>",
+        },
+    },
+    EmailTemplatePurchaseFailed: {
+        models.LanguageEnglish: {
+            Subject: "Your purchase {{.PaymentID}} could not be completed",
+            Text: "We could not complete your purchase {{.PaymentID}} of {{.Amount}} {{.Symbol}} for {{.FiatAmount}} {{.Currency}}.\n\n" +
+                "If you were charged, the payment will be refunded or you can contact support with the purchase ID above.",
+            HTML: "<p>We could not complete your purchase <strong>{{.PaymentID}}</strong> of <strong>{{.Amount}} {{.Symbol}}</strong> for <strong>{{.FiatAmount}} {{.Currency}}</strong>.</p>" +
+                "<p>If you were charged, the payment will be refunded or you can contact support with the purchase ID above.</p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Pembelian {{.PaymentID}} Anda tidak dapat diselesaikan",
+            Text: "Kami tidak dapat menyelesaikan pembelian Anda {{.PaymentID}} sebesar {{.Amount}} {{.Symbol}} seharga {{.FiatAmount}} {{.Currency}}.\n\n" +
+                "Jika Anda sudah dikenai biaya, pembayaran akan dikembalikan atau Anda dapat menghubungi dukungan dengan ID pembelian di atas.",
+            HTML: "<p>Kami tidak dapat menyelesaikan pembelian Anda <strong>{{.PaymentID}}</strong> sebesar <strong>{{.Amount}} {{.Symbol}}</strong> seharga <strong>{{.FiatAmount}} {{.Currency}}</strong>.</p>" +
+                "<p>Jika Anda sudah dikenai biaya, pembayaran akan dikembalikan atau Anda dapat menghubungi dukungan dengan ID pembelian di atas.</p>",
+        },
+    },
+    EmailTemplatePurchaseRefunded: {
+        models.LanguageEnglish: {
+            Subject: "Your purchase {{.PaymentID}} was refunded",
+            Text:    "Your purchase {{.PaymentID}} of {{.Amount}} {{.Symbol}} was refunded. {{.FiatAmount}} {{.Currency}} is on its way back to your original payment method.",
+            HTML:    "<p>Your purchase <strong>{{.PaymentID}}</strong> of <strong>{{.Amount}} {{.Symbol}}</strong> was refunded. <strong>{{.FiatAmount}} {{.Currency}}</strong> is on its way back to your original payment method.</p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Pembelian {{.PaymentID}} Anda telah dikembalikan dananya",
+            Text:    "Dana pembelian Anda {{.PaymentID}} sebesar {{.Amount}} {{.Symbol}} telah dikembalikan. {{.FiatAmount}} {{.Currency}} sedang dikirim kembali ke metode pembayaran awal Anda.",
+            HTML:    "<p>Dana pembelian Anda <strong>{{.PaymentID}}</strong> sebesar <strong>{{.Amount}} {{.Symbol}}</strong> telah dikembalikan. <strong>{{.FiatAmount}} {{.Currency}}</strong> sedang dikirim kembali ke metode pembayaran awal Anda.</p>",
+        },
+    },
+    EmailTemplateSecurityAlert: {
+        models.LanguageEnglish: {
+            Subject: "Security alert: {{event .Event}}",
+            Text: "{{event .Event}}.\n\nTime: {{.Time}}\nIP address: {{.IPAddress}}\nDevice: {{.UserAgent}}\n\n" +
+                "If this was you, no action is needed. If not, change your password right away and contact support.",
+            HTML: "<p><strong>{{event .Event}}.</strong></p>" +
+                "<p>Time: {{.Time}}<br>IP address: {{.IPAddress}}<br>Device: {{.UserAgent}}</p>" +
+                "<p style=\"" + emailWarnStyle + "\">If this was you, no action is needed. If not, change your password right away and contact support.</p>",
+        },
+        models.LanguageIndonesian: {
+            Subject: "Peringatan keamanan: {{event .Event}}",
+            Text: "{{event .Event}}.\n\nWaktu: {{.Time}}\nAlamat IP: {{.IPAddress}}\nPerangkat: {{.UserAgent}}\n\n" +
+                "Jika ini Anda, tidak perlu melakukan apa pun. Jika bukan, segera ganti kata sandi Anda dan hubungi dukungan.",
+            HTML: "<p><strong>{{event .Event}}.</strong></p>" +
+                "<p>Waktu: {{.Time}}<br>Alamat IP: {{.IPAddress}}<br>Perangkat: {{.UserAgent}}</p>" +
+                "<p style=\"" + emailWarnStyle + "\">Jika ini Anda, tidak perlu melakukan apa pun. Jika bukan, segera ganti kata sandi Anda dan hubungi dukungan.</p>",
+        },
+    },
+}
+
+// emailTemplate is a template parsed for one language
+type emailTemplate struct {
+    subject *texttemplate.Template
+    text    *texttemplate.Template
+    html    *htmltemplate.Template
+}
+
+// emailTemplates are the parsed templates by name and language
+var emailTemplates = parseEmailTemplates()
+
+// parseEmailTemplates parses every template in every language, panicking on a broken one at startup
+func parseEmailTemplates() map[string]map[string]*emailTemplate {
+    parsed := map[string]map[string]*emailTemplate{}
+    for name, languages := range emailSources {
+        parsed[name] = map[string]*emailTemplate{}
+        for language, source := range languages {
+            layout := emailLayouts[language]
+            events := securityEvents[language]
+            funcs := map[string]interface{}{
+                "event": func(event string) string { return events[event] },
+            }
+            parsed[name][language] = &emailTemplate{
+                subject: texttemplate.Must(texttemplate.New(name).Option("missingkey=error").Funcs(funcs).Parse(source.Subject)),
+                text:    texttemplate.Must(texttemplate.New(name).Option("missingkey=error").Funcs(funcs).Parse(fmt.Sprintf(layout.Text, source.Text))),
+                html:    htmltemplate.Must(htmltemplate.New(name).Option("missingkey=error").Funcs(funcs).Parse(fmt.Sprintf(layout.HTML, source.HTML))),
+            }
+        }
+    }
+    return parsed
+}
+
+// renderEmail renders a template in a language, falling back to English
+func renderEmail(name, language string, data map[string]interface{}) (subject, text, html string, err error) {
+    languages, ok := emailTemplates[name]
+    if !ok {
+        return "", "", "", fmt.Errorf("unknown email template %q", name)
+    }
+    tmpl, ok := languages[language]
+    if !ok {
+        tmpl = languages[models.LanguageEnglish]
+    }
+
+    var buf bytes.Buffer
+    if err := tmpl.subject.Execute(&buf, data); err != nil {
+        return "", "", "", fmt.Errorf("failed to render %s subject: %w", name, err)
+    }
+    subject = buf.String()
+
+    buf.Reset()
+    if err := tmpl.text.Execute(&buf, data); err != nil {
+        return "", "", "", fmt.Errorf("failed to render %s text: %w", name, err)
+    }
+    text = buf.String()
+
+    buf.Reset()
+    if err := tmpl.html.Execute(&buf, data); err != nil {
+        return "", "", "", fmt.Errorf("failed to render %s html: %w", name, err)
+    }
+    html = buf.String()
+
+    return subject, text, html, nil
+}
+
+// IsSupportedLanguage reports whether emails can be sent in the language
+func IsSupportedLanguage(language string) bool {
+    _, ok := emailLayouts[language]
+    return ok
+}
@@ -6,79 +6,149 @@ import (
     "crypto/rand"
     "encoding/hex"
     "errors"
+    "fmt"
     "io"
 )
 
-// EncryptionService handles encryption and decryption of sensitive data
+// LegacyKeyVersion marks records encrypted directly with the static WALLET_DB_ENCRYPT_KEY
+const LegacyKeyVersion = 0
+
+// EncryptionService handles envelope encryption of sensitive data.
+// Every record gets its own data key, which is wrapped by a versioned master key.
 type EncryptionService struct {
-    Key []byte
+    Keys      KeyProvider
+    LegacyKey []byte // Static key used before envelope encryption, only needed to read old rows
 }
 
-// NewEncryptionService creates a new encryption service with the provided key
-func NewEncryptionService(hexKey string) (*EncryptionService, error) {
-    key, err := hex.DecodeString(hexKey)
-    if err != nil {
-        return nil, err
+// DataKey is a plaintext data key along with its wrapped form and master key version
+type DataKey struct {
+    Plaintext  []byte
+    Wrapped    []byte
+    KeyVersion int
+}
+
+// NewEncryptionService creates a new encryption service with the provided key hierarchy
+func NewEncryptionService(keys KeyProvider, legacyHexKey string) (*EncryptionService, error) {
+    if keys == nil {
+        return nil, errors.New("key provider is required")
     }
-    
-    // Ensure key is 32 bytes (256 bits) for AES-256
-    if len(key) != 32 {
-        return nil, errors.New("encryption key must be 32 bytes (64 hex characters)")
+
+    var legacyKey []byte
+    if legacyHexKey != "" {
+        key, err := hex.DecodeString(legacyHexKey)
+        if err != nil {
+            return nil, err
+        }
+
+        // Ensure key is 32 bytes (256 bits) for AES-256
+        if len(key) != 32 {
+            return nil, errors.New("encryption key must be 32 bytes (64 hex characters)")
+        }
+        legacyKey = key
     }
-    
+
     return &EncryptionService{
-        Key: key,
+        Keys:      keys,
+        LegacyKey: legacyKey,
     }, nil
 }
 
-// Encrypt encrypts data using AES-GCM
-func (s *EncryptionService) Encrypt(plaintext []byte) ([]byte, error) {
-    block, err := aes.NewCipher(s.Key)
+// GenerateDataKey creates a fresh data key wrapped with the current master key
+func (s *EncryptionService) GenerateDataKey() (*DataKey, error) {
+    plaintext := make([]byte, 32)
+    if _, err := io.ReadFull(rand.Reader, plaintext); err != nil {
+        return nil, err
+    }
+
+    version := s.Keys.CurrentVersion()
+    wrapped, err := s.Keys.WrapKey(version, plaintext)
+    if err != nil {
+        return nil, fmt.Errorf("failed to wrap data key: %w", err)
+    }
+
+    return &DataKey{Plaintext: plaintext, Wrapped: wrapped, KeyVersion: version}, nil
+}
+
+// OpenDataKey unwraps a stored data key. Legacy rows have no wrapped key and use the static key.
+func (s *EncryptionService) OpenDataKey(wrapped []byte, version int) (*DataKey, error) {
+    if version == LegacyKeyVersion {
+        if s.LegacyKey == nil {
+            return nil, errors.New("record uses the legacy key but WALLET_DB_ENCRYPT_KEY is not set")
+        }
+        return &DataKey{Plaintext: s.LegacyKey, KeyVersion: LegacyKeyVersion}, nil
+    }
+
+    plaintext, err := s.Keys.UnwrapKey(version, wrapped)
+    if err != nil {
+        return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+    }
+
+    return &DataKey{Plaintext: plaintext, Wrapped: wrapped, KeyVersion: version}, nil
+}
+
+// RewrapDataKey re-wraps a data key under the current master key without touching the ciphertext
+func (s *EncryptionService) RewrapDataKey(dataKey *DataKey) (*DataKey, error) {
+    version := s.Keys.CurrentVersion()
+    wrapped, err := s.Keys.WrapKey(version, dataKey.Plaintext)
+    if err != nil {
+        return nil, fmt.Errorf("failed to wrap data key: %w", err)
+    }
+
+    return &DataKey{Plaintext: dataKey.Plaintext, Wrapped: wrapped, KeyVersion: version}, nil
+}
+
+// Encrypt encrypts data with the given data key using AES-GCM
+func (s *EncryptionService) Encrypt(dataKey *DataKey, plaintext []byte) ([]byte, error) {
+    return sealGCM(dataKey.Plaintext, plaintext, nil)
+}
+
+// Decrypt decrypts data with the given data key using AES-GCM
+func (s *EncryptionService) Decrypt(dataKey *DataKey, ciphertext []byte) ([]byte, error) {
+    return openGCM(dataKey.Plaintext, ciphertext, nil)
+}
+
+// sealGCM encrypts plaintext with AES-GCM, prefixing the random nonce
+func sealGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+    block, err := aes.NewCipher(key)
     if err != nil {
         return nil, err
     }
-    
+
     aesGCM, err := cipher.NewGCM(block)
     if err != nil {
         return nil, err
     }
-    
+
     // Create a nonce
     nonce := make([]byte, aesGCM.NonceSize())
     if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
         return nil, err
     }
-    
+
     // Encrypt and seal the data
-    ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
-    return ciphertext, nil
+    return aesGCM.Seal(nonce, nonce, plaintext, additionalData), nil
 }
 
-// Decrypt decrypts data using AES-GCM
-func (s *EncryptionService) Decrypt(ciphertext []byte) ([]byte, error) {
-    block, err := aes.NewCipher(s.Key)
+// openGCM decrypts a nonce-prefixed AES-GCM ciphertext
+func openGCM(key, ciphertext, additionalData []byte) ([]byte, error) {
+    block, err := aes.NewCipher(key)
     if err != nil {
         return nil, err
     }
-    
+
     aesGCM, err := cipher.NewGCM(block)
     if err != nil {
         return nil, err
     }
-    
+
     // Extract the nonce
     nonceSize := aesGCM.NonceSize()
     if len(ciphertext) < nonceSize {
         return nil, errors.New("ciphertext too short")
     }
-    
+
     nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-    
+
     // Decrypt the data
-    plaintext, err := aesGCM.Open(nil, nonce, ciphertext, nil)
-    if err != nil {
-        return nil, err
-    }
-    
-    return plaintext, nil
-}
\ No newline at end of file
+    return aesGCM.Open(nil, nonce, ciphertext, additionalData)
+}
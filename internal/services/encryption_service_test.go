@@ -0,0 +1,247 @@
+package services
+
+import (
+    "bytes"
+    "encoding/hex"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// newFileEncryptionService builds an encryption service on the file KMS stand-in in a temp dir
+func newFileEncryptionService(t *testing.T, legacyHexKey string) (*EncryptionService, *FileKeyProvider) {
+    t.Helper()
+
+    provider, err := NewFileKeyProvider(t.TempDir(), 0)
+    if err != nil {
+        t.Fatalf("NewFileKeyProvider: %v", err)
+    }
+
+    svc, err := NewEncryptionService(provider, legacyHexKey)
+    if err != nil {
+        t.Fatalf("NewEncryptionService: %v", err)
+    }
+
+    return svc, provider
+}
+
+func TestEnvelopeEncryptionRoundTrip(t *testing.T) {
+    svc, provider := newFileEncryptionService(t, "")
+
+    dataKey, err := svc.GenerateDataKey()
+    if err != nil {
+        t.Fatalf("GenerateDataKey: %v", err)
+    }
+    if dataKey.KeyVersion != 1 || provider.CurrentVersion() != 1 {
+        t.Fatalf("expected master key v1, got data key v%d, provider v%d", dataKey.KeyVersion, provider.CurrentVersion())
+    }
+    if bytes.Contains(dataKey.Wrapped, dataKey.Plaintext) {
+        t.Fatal("wrapped data key contains the plaintext key")
+    }
+
+    secret := []byte("test test test test test test test test test test test junk")
+    ciphertext, err := svc.Encrypt(dataKey, secret)
+    if err != nil {
+        t.Fatalf("Encrypt: %v", err)
+    }
+
+    opened, err := svc.OpenDataKey(dataKey.Wrapped, dataKey.KeyVersion)
+    if err != nil {
+        t.Fatalf("OpenDataKey: %v", err)
+    }
+    plaintext, err := svc.Decrypt(opened, ciphertext)
+    if err != nil {
+        t.Fatalf("Decrypt: %v", err)
+    }
+    if !bytes.Equal(plaintext, secret) {
+        t.Fatalf("round trip mismatch: %q", plaintext)
+    }
+}
+
+func TestEnvelopeEncryptionRejectsWrongVersion(t *testing.T) {
+    svc, provider := newFileEncryptionService(t, "")
+
+    dataKey, err := svc.GenerateDataKey()
+    if err != nil {
+        t.Fatalf("GenerateDataKey: %v", err)
+    }
+    if _, err := provider.CreateVersion(); err != nil {
+        t.Fatalf("CreateVersion: %v", err)
+    }
+
+    // The wrapped key is bound to its master key version
+    if _, err := svc.OpenDataKey(dataKey.Wrapped, 2); err == nil {
+        t.Fatal("expected unwrapping under the wrong version to fail")
+    }
+    if _, err := svc.OpenDataKey(dataKey.Wrapped, 3); err == nil {
+        t.Fatal("expected unwrapping under a missing version to fail")
+    }
+}
+
+func TestFileKeyProviderReloadsVersions(t *testing.T) {
+    dir := t.TempDir()
+
+    provider, err := NewFileKeyProvider(dir, 0)
+    if err != nil {
+        t.Fatalf("NewFileKeyProvider: %v", err)
+    }
+    wrapped, err := provider.WrapKey(1, bytes.Repeat([]byte{7}, 32))
+    if err != nil {
+        t.Fatalf("WrapKey: %v", err)
+    }
+    if _, err := provider.CreateVersion(); err != nil {
+        t.Fatalf("CreateVersion: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(dir, "v2.key")); err != nil {
+        t.Fatalf("expected v2.key on disk: %v", err)
+    }
+
+    reloaded, err := NewFileKeyProvider(dir, 0)
+    if err != nil {
+        t.Fatalf("reload: %v", err)
+    }
+    if reloaded.CurrentVersion() != 2 {
+        t.Fatalf("expected highest version 2 after reload, got %d", reloaded.CurrentVersion())
+    }
+    unwrapped, err := reloaded.UnwrapKey(1, wrapped)
+    if err != nil {
+        t.Fatalf("UnwrapKey after reload: %v", err)
+    }
+    if !bytes.Equal(unwrapped, bytes.Repeat([]byte{7}, 32)) {
+        t.Fatal("unwrapped key does not match")
+    }
+
+    pinned, err := NewFileKeyProvider(dir, 1)
+    if err != nil {
+        t.Fatalf("pinned: %v", err)
+    }
+    if _, err := pinned.CreateVersion(); err != nil {
+        t.Fatalf("CreateVersion: %v", err)
+    }
+    if pinned.CurrentVersion() != 1 {
+        t.Fatalf("pinned provider moved to v%d", pinned.CurrentVersion())
+    }
+}
+
+func TestFileKeyProviderPicksUpVersionsFromAnotherProcess(t *testing.T) {
+    dir := t.TempDir()
+    server, err := NewFileKeyProvider(dir, 0)
+    if err != nil {
+        t.Fatalf("NewFileKeyProvider: %v", err)
+    }
+    other, err := NewFileKeyProvider(dir, 0)
+    if err != nil {
+        t.Fatalf("NewFileKeyProvider: %v", err)
+    }
+
+    // rotatekeys -new-version runs with its own provider on the same directory
+    rotation, err := NewFileKeyProvider(dir, 0)
+    if err != nil {
+        t.Fatalf("NewFileKeyProvider: %v", err)
+    }
+    version, err := rotation.CreateVersion()
+    if err != nil {
+        t.Fatalf("CreateVersion: %v", err)
+    }
+    wrapped, err := rotation.WrapKey(version, bytes.Repeat([]byte{9}, 32))
+    if err != nil {
+        t.Fatalf("WrapKey: %v", err)
+    }
+
+    unwrapped, err := server.UnwrapKey(version, wrapped)
+    if err != nil {
+        t.Fatalf("UnwrapKey of a version created by another process: %v", err)
+    }
+    if !bytes.Equal(unwrapped, bytes.Repeat([]byte{9}, 32)) {
+        t.Fatal("unwrapped key does not match")
+    }
+
+    if other.CurrentVersion() != 1 {
+        t.Fatalf("expected v1 until the reload interval passes, got v%d", other.CurrentVersion())
+    }
+    other.loadedAt = time.Now().Add(-FileKeyReloadInterval - time.Second)
+    if other.CurrentVersion() != version {
+        t.Fatalf("expected the server to move to v%d, got v%d", version, other.CurrentVersion())
+    }
+}
+
+func TestKeyRotationRewrapsEnvelopeRecords(t *testing.T) {
+    svc, provider := newFileEncryptionService(t, "")
+    rotation := NewKeyRotationService(nil, svc, 0)
+
+    dataKey, err := svc.GenerateDataKey()
+    if err != nil {
+        t.Fatalf("GenerateDataKey: %v", err)
+    }
+    secret := []byte("private key")
+    ciphertext, err := svc.Encrypt(dataKey, secret)
+    if err != nil {
+        t.Fatalf("Encrypt: %v", err)
+    }
+
+    if _, err := provider.CreateVersion(); err != nil {
+        t.Fatalf("CreateVersion: %v", err)
+    }
+
+    newKey, fields, err := rotation.rewrap(dataKey.Wrapped, dataKey.KeyVersion, ciphertext)
+    if err != nil {
+        t.Fatalf("rewrap: %v", err)
+    }
+    if newKey.KeyVersion != 2 {
+        t.Fatalf("expected rotation to v2, got v%d", newKey.KeyVersion)
+    }
+    if !bytes.Equal(fields[0], ciphertext) {
+        t.Fatal("envelope rotation should leave the ciphertext untouched")
+    }
+
+    opened, err := svc.OpenDataKey(newKey.Wrapped, newKey.KeyVersion)
+    if err != nil {
+        t.Fatalf("OpenDataKey: %v", err)
+    }
+    plaintext, err := svc.Decrypt(opened, fields[0])
+    if err != nil {
+        t.Fatalf("Decrypt: %v", err)
+    }
+    if !bytes.Equal(plaintext, secret) {
+        t.Fatalf("rotated record decrypts to %q", plaintext)
+    }
+}
+
+func TestKeyRotationReencryptsLegacyRecords(t *testing.T) {
+    legacyKey := bytes.Repeat([]byte{0x42}, 32)
+    svc, _ := newFileEncryptionService(t, hex.EncodeToString(legacyKey))
+    rotation := NewKeyRotationService(nil, svc, 0)
+
+    secret := []byte("legacy mnemonic")
+    ciphertext, err := sealGCM(legacyKey, secret, nil)
+    if err != nil {
+        t.Fatalf("sealGCM: %v", err)
+    }
+
+    newKey, fields, err := rotation.rewrap(nil, LegacyKeyVersion, ciphertext, nil)
+    if err != nil {
+        t.Fatalf("rewrap: %v", err)
+    }
+    if newKey.KeyVersion != 1 || len(newKey.Wrapped) == 0 {
+        t.Fatalf("expected a wrapped v1 data key, got v%d", newKey.KeyVersion)
+    }
+    if bytes.Equal(fields[0], ciphertext) {
+        t.Fatal("legacy rotation should re-encrypt the ciphertext")
+    }
+    if len(fields[1]) != 0 {
+        t.Fatal("empty fields should stay empty")
+    }
+
+    opened, err := svc.OpenDataKey(newKey.Wrapped, newKey.KeyVersion)
+    if err != nil {
+        t.Fatalf("OpenDataKey: %v", err)
+    }
+    plaintext, err := svc.Decrypt(opened, fields[0])
+    if err != nil {
+        t.Fatalf("Decrypt: %v", err)
+    }
+    if !bytes.Equal(plaintext, secret) {
+        t.Fatalf("rotated legacy record decrypts to %q", plaintext)
+    }
+}
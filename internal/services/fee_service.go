@@ -0,0 +1,349 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "math/big"
+    "strings"
+    "sync"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "github.com/ethereum/go-ethereum/ethclient"
+)
+
+// feeHistoryBlocks is the number of recent blocks the presets are derived from
+const feeHistoryBlocks = 20
+
+// feeCacheTTL is how long fee data is reused, about one block
+const feeCacheTTL = 12 * time.Second
+
+// defaultGatewayPaymentGasLimit is the typical gas of creating a payment on the gateway contract
+const defaultGatewayPaymentGasLimit = uint64(200000)
+
+// feePresets are the offered speeds: the priority fee percentile of recent blocks and the
+// base fee multiplier (numerator/denominator) the max fee leaves room for
+var feePresets = []struct {
+    name       string
+    percentile float64
+    baseNum    int64
+    baseDen    int64
+    legacyNum  int64 // Gas price multiplier on chains without a base fee
+    legacyDen  int64
+}{
+    {"slow", 10, 5, 4, 9, 10},
+    {"normal", 50, 2, 1, 1, 1},
+    {"fast", 90, 2, 1, 5, 4},
+}
+
+// feeOperations are the actions fees are quoted for, with their typical gas
+var feeOperations = []struct {
+    name string
+    gas  uint64
+}{
+    {"eth_transfer", 21000},
+    {"token_transfer", defaultTransferGasLimit},
+    {"approve", defaultApproveGasLimit},
+    {"swap", defaultSwapGasLimit},
+    {"gateway_payment", defaultGatewayPaymentGasLimit},
+}
+
+// FeeService derives fee presets from eth_feeHistory and quotes operation fees in ETH and fiat
+type FeeService struct {
+    EthClient    *ethclient.Client
+    PriceService *PriceService
+    Caps         blockchain.FeeCaps // Hot wallet caps, reported alongside the presets
+
+    mu       sync.Mutex
+    cached   *networkFees
+    cachedAt time.Time
+}
+
+// FeePreset is the fee per gas of one speed
+type FeePreset struct {
+    Name                     string `json:"name"`
+    MaxFeePerGas             string `json:"max_fee_per_gas,omitempty"`          // Wei
+    MaxPriorityFeePerGas     string `json:"max_priority_fee_per_gas,omitempty"` // Wei
+    GasPrice                 string `json:"gas_price,omitempty"`                // Wei, legacy chains only
+    MaxFeePerGasGwei         string `json:"max_fee_per_gas_gwei,omitempty"`
+    MaxPriorityFeePerGasGwei string `json:"max_priority_fee_per_gas_gwei,omitempty"`
+    GasPriceGwei             string `json:"gas_price_gwei,omitempty"`
+    ExceedsHotWalletCap      bool   `json:"exceeds_hot_wallet_cap"` // The hot wallet would refuse to send at this fee
+}
+
+// FeeAmount is the fee of one operation at one preset
+type FeeAmount struct {
+    Estimated     string  `json:"estimated"` // Wei, at the current base fee
+    Max           string  `json:"max"`       // Wei, the most the transaction can cost
+    EstimatedETH  string  `json:"estimated_eth"`
+    MaxETH        string  `json:"max_eth"`
+    EstimatedFiat float64 `json:"estimated_fiat"`
+    MaxFiat       float64 `json:"max_fiat"`
+}
+
+// OperationFee is the fee of one operation at every preset
+type OperationFee struct {
+    Operation string               `json:"operation"`
+    Gas       uint64               `json:"gas"`
+    Fees      map[string]FeeAmount `json:"fees"` // By preset name
+}
+
+// HotWalletFeeCaps reports the configured hot wallet caps
+type HotWalletFeeCaps struct {
+    MaxFeePerGasGwei         string `json:"max_fee_per_gas_gwei,omitempty"`
+    MaxPriorityFeePerGasGwei string `json:"max_priority_fee_per_gas_gwei,omitempty"`
+    Exceeded                 bool   `json:"exceeded"` // The base fee alone is above the max fee cap
+}
+
+// FeeEstimate is the current network fees with presets and operation quotes
+type FeeEstimate struct {
+    ChainID       string            `json:"chain_id"`
+    BlockNumber   uint64            `json:"block_number"`
+    EIP1559       bool              `json:"eip1559"`
+    BaseFeePerGas string            `json:"base_fee_per_gas,omitempty"` // Wei, expected for the next block
+    BaseFeeGwei   string            `json:"base_fee_gwei,omitempty"`
+    Currency      string            `json:"currency"`
+    EthPrice      float64           `json:"eth_price"` // In the currency, 0 when unavailable
+    Priced        bool              `json:"priced"`
+    Presets       []FeePreset       `json:"presets"`
+    Operations    []OperationFee    `json:"operations"`
+    HotWalletCaps *HotWalletFeeCaps `json:"hot_wallet_caps,omitempty"`
+    UpdatedAt     time.Time         `json:"updated_at"`
+}
+
+// networkFees is the fee data read from the node
+type networkFees struct {
+    chainID     *big.Int
+    blockNumber uint64
+    baseFee     *big.Int // Nil on legacy chains
+    presets     []presetFee
+}
+
+// presetFee is the fee per gas of one preset
+type presetFee struct {
+    name   string
+    tip    *big.Int // Nil on legacy chains
+    maxFee *big.Int // Gas price on legacy chains
+}
+
+// NewFeeService creates a new fee service
+func NewFeeService(ethClient *ethclient.Client, priceService *PriceService, caps blockchain.FeeCaps) *FeeService {
+    return &FeeService{
+        EthClient:    ethClient,
+        PriceService: priceService,
+        Caps:         caps,
+    }
+}
+
+// Estimate returns the fee presets and the fee of each operation valued in the currency
+func (s *FeeService) Estimate(ctx context.Context, currency string) (*FeeEstimate, error) {
+    fees, err := s.networkFees(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    currency = strings.ToUpper(strings.TrimSpace(currency))
+    if currency == "" {
+        currency = "USD"
+    }
+
+    estimate := &FeeEstimate{
+        ChainID:     fees.chainID.String(),
+        BlockNumber: fees.blockNumber,
+        EIP1559:     fees.baseFee != nil,
+        Currency:    currency,
+        UpdatedAt:   time.Now(),
+    }
+    if fees.baseFee != nil {
+        estimate.BaseFeePerGas = fees.baseFee.String()
+        estimate.BaseFeeGwei = blockchain.FormatGwei(fees.baseFee)
+    }
+
+    // Fees are still quoted in ETH when no price is available
+    if ethUSD, err := s.PriceService.GetEthPriceUSD(ctx); err != nil {
+        log.Printf("Fees: failed to get ETH price: %v", err)
+    } else if rate, err := s.PriceService.GetFiatRate(ctx, currency); err != nil {
+        log.Printf("Fees: failed to get %s rate: %v", currency, err)
+    } else {
+        estimate.EthPrice = ethUSD * rate
+        estimate.Priced = true
+    }
+
+    for _, preset := range fees.presets {
+        entry := FeePreset{Name: preset.name, ExceedsHotWalletCap: s.exceedsCap(fees.baseFee, preset)}
+        if preset.tip != nil {
+            entry.MaxFeePerGas = preset.maxFee.String()
+            entry.MaxPriorityFeePerGas = preset.tip.String()
+            entry.MaxFeePerGasGwei = blockchain.FormatGwei(preset.maxFee)
+            entry.MaxPriorityFeePerGasGwei = blockchain.FormatGwei(preset.tip)
+        } else {
+            entry.GasPrice = preset.maxFee.String()
+            entry.GasPriceGwei = blockchain.FormatGwei(preset.maxFee)
+        }
+        estimate.Presets = append(estimate.Presets, entry)
+    }
+
+    for _, operation := range feeOperations {
+        quote := OperationFee{Operation: operation.name, Gas: operation.gas, Fees: make(map[string]FeeAmount)}
+        gas := new(big.Int).SetUint64(operation.gas)
+
+        for _, preset := range fees.presets {
+            // Legacy transactions pay the full gas price; EIP-1559 ones pay base fee plus tip
+            perGas := preset.maxFee
+            if preset.tip != nil {
+                perGas = new(big.Int).Add(fees.baseFee, preset.tip)
+                if perGas.Cmp(preset.maxFee) > 0 {
+                    perGas = preset.maxFee
+                }
+            }
+            estimated := new(big.Int).Mul(gas, perGas)
+            max := new(big.Int).Mul(gas, preset.maxFee)
+
+            amount := FeeAmount{
+                Estimated:    estimated.String(),
+                Max:          max.String(),
+                EstimatedETH: formatUnits(estimated, 18),
+                MaxETH:       formatUnits(max, 18),
+            }
+            if estimate.Priced {
+                amount.EstimatedFiat = weiToFiat(estimated, estimate.EthPrice)
+                amount.MaxFiat = weiToFiat(max, estimate.EthPrice)
+            }
+            quote.Fees[preset.name] = amount
+        }
+        estimate.Operations = append(estimate.Operations, quote)
+    }
+
+    if s.Caps.Enabled() {
+        caps := &HotWalletFeeCaps{}
+        if s.Caps.MaxFeePerGas != nil {
+            caps.MaxFeePerGasGwei = blockchain.FormatGwei(s.Caps.MaxFeePerGas)
+            current := fees.baseFee
+            if current == nil && len(fees.presets) > 0 {
+                current = fees.presets[0].maxFee
+            }
+            caps.Exceeded = current != nil && current.Cmp(s.Caps.MaxFeePerGas) > 0
+        }
+        if s.Caps.MaxPriorityFeePerGas != nil {
+            caps.MaxPriorityFeePerGasGwei = blockchain.FormatGwei(s.Caps.MaxPriorityFeePerGas)
+        }
+        estimate.HotWalletCaps = caps
+    }
+
+    return estimate, nil
+}
+
+// exceedsCap reports whether the hot wallet would refuse to pay the preset's fee
+func (s *FeeService) exceedsCap(baseFee *big.Int, preset presetFee) bool {
+    if s.Caps.MaxFeePerGas == nil {
+        return false
+    }
+    if preset.tip == nil {
+        return preset.maxFee.Cmp(s.Caps.MaxFeePerGas) > 0
+    }
+
+    tip := preset.tip
+    if s.Caps.MaxPriorityFeePerGas != nil && tip.Cmp(s.Caps.MaxPriorityFeePerGas) > 0 {
+        tip = s.Caps.MaxPriorityFeePerGas
+    }
+    return new(big.Int).Add(baseFee, tip).Cmp(s.Caps.MaxFeePerGas) > 0
+}
+
+// networkFees reads the presets from eth_feeHistory, or the gas price on legacy chains
+func (s *FeeService) networkFees(ctx context.Context) (*networkFees, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.cached != nil && time.Since(s.cachedAt) < feeCacheTTL {
+        return s.cached, nil
+    }
+
+    chainID, err := s.EthClient.ChainID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get chain ID: %w", err)
+    }
+
+    header, err := s.EthClient.HeaderByNumber(ctx, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get latest block: %w", err)
+    }
+
+    fees := &networkFees{chainID: chainID, blockNumber: header.Number.Uint64()}
+
+    if header.BaseFee == nil {
+        gasPrice, err := s.EthClient.SuggestGasPrice(ctx)
+        if err != nil {
+            return nil, fmt.Errorf("failed to suggest gas price: %w", err)
+        }
+        for _, preset := range feePresets {
+            price := new(big.Int).Mul(gasPrice, big.NewInt(preset.legacyNum))
+            price.Div(price, big.NewInt(preset.legacyDen))
+            fees.presets = append(fees.presets, presetFee{name: preset.name, maxFee: price})
+        }
+    } else {
+        percentiles := make([]float64, len(feePresets))
+        for i, preset := range feePresets {
+            percentiles[i] = preset.percentile
+        }
+
+        history, err := s.EthClient.FeeHistory(ctx, feeHistoryBlocks, nil, percentiles)
+        if err != nil {
+            return nil, fmt.Errorf("failed to get fee history: %w", err)
+        }
+
+        // The last base fee is the one expected for the next block
+        fees.baseFee = header.BaseFee
+        if len(history.BaseFee) > 0 {
+            fees.baseFee = history.BaseFee[len(history.BaseFee)-1]
+        }
+
+        var suggestedTip *big.Int
+        for i, preset := range feePresets {
+            tip := averageReward(history.Reward, i)
+            if tip.Sign() == 0 {
+                // Empty blocks carry no rewards, fall back to the node's suggestion
+                if suggestedTip == nil {
+                    suggestedTip, err = s.EthClient.SuggestGasTipCap(ctx)
+                    if err != nil {
+                        return nil, fmt.Errorf("failed to suggest priority fee: %w", err)
+                    }
+                }
+                tip = new(big.Int).Set(suggestedTip)
+            }
+
+            maxFee := new(big.Int).Mul(fees.baseFee, big.NewInt(preset.baseNum))
+            maxFee.Div(maxFee, big.NewInt(preset.baseDen))
+            maxFee.Add(maxFee, tip)
+            fees.presets = append(fees.presets, presetFee{name: preset.name, tip: tip, maxFee: maxFee})
+        }
+    }
+
+    s.cached = fees
+    s.cachedAt = time.Now()
+    return fees, nil
+}
+
+// averageReward averages one percentile column of eth_feeHistory rewards over the blocks that have one
+func averageReward(rewards [][]*big.Int, column int) *big.Int {
+    sum := new(big.Int)
+    count := int64(0)
+    for _, block := range rewards {
+        if column >= len(block) || block[column] == nil || block[column].Sign() == 0 {
+            continue
+        }
+        sum.Add(sum, block[column])
+        count++
+    }
+    if count == 0 {
+        return sum
+    }
+
+    return sum.Div(sum, big.NewInt(count))
+}
+
+// weiToFiat values a wei amount at the ETH price
+func weiToFiat(wei *big.Int, ethPrice float64) float64 {
+    eth, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18)).Float64()
+    return eth * ethPrice
+}
@@ -0,0 +1,393 @@
+package services
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/pkg/mailer"
+    "git.winteraccess.id/walanja/web3-tokensale-be/pkg/pdf"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// ErrReceiptNotAvailable is returned for the receipt of a purchase that has not completed
+var ErrReceiptNotAvailable = errors.New("receipt is only available for completed purchases")
+
+// Completed purchases emailed per pass at most
+const invoiceEmailBatch = 50
+
+// invoiceFigures are what a document states about a purchase, fixed when it is issued so a later
+// refund or change of the purchase does not alter a numbered document
+type invoiceFigures struct {
+    ReceivingWallet  string  `json:"receiving_wallet"`
+    FiatCurrency     string  `json:"fiat_currency"`
+    FiatAmount       float64 `json:"fiat_amount"`
+    DiscountFiat     float64 `json:"discount_fiat"`
+    PromoCode        string  `json:"promo_code"`
+    TokenAmount      float64 `json:"token_amount"`
+    BonusTokens      float64 `json:"bonus_tokens"`
+    TokenSymbol      string  `json:"token_symbol"`
+    EthAmount        float64 `json:"eth_amount"`
+    FXRate           float64 `json:"fx_rate"`
+    PaymentMethod    string  `json:"payment_method"`
+    PaymentReference string  `json:"payment_reference"`
+    GasFee           float64 `json:"gas_fee"`
+    GasFeeFiat       float64 `json:"gas_fee_fiat"`
+}
+
+// newInvoiceFigures takes the figures of a purchase as they are now. Vesting purchases are
+// received by the buyer's wallet, not the treasury holding them.
+func newInvoiceFigures(transaction *models.Transaction) invoiceFigures {
+    wallet := transaction.WalletAddress
+    if transaction.VestingWallet != "" {
+        wallet = transaction.VestingWallet
+    }
+    return invoiceFigures{
+        ReceivingWallet:  wallet,
+        FiatCurrency:     transaction.FiatCurrency,
+        FiatAmount:       transaction.FiatAmount,
+        DiscountFiat:     transaction.DiscountFiat,
+        PromoCode:        transaction.PromoCode,
+        TokenAmount:      transaction.TokenAmount,
+        BonusTokens:      transaction.BonusTokens,
+        TokenSymbol:      transaction.TokenSymbol,
+        EthAmount:        transaction.EthAmount,
+        FXRate:           transaction.FXRate,
+        PaymentMethod:    transaction.PaymentMethod,
+        PaymentReference: transaction.PaymentReference,
+        GasFee:           transaction.GasFee,
+        GasFeeFiat:       transaction.GasFeeFiat,
+    }
+}
+
+// InvoiceService numbers the invoices and receipts of purchases, renders them as PDFs and emails
+// them once a purchase completes
+type InvoiceService struct {
+    DB            *gorm.DB
+    Email         *EmailService
+    IssuerName    string
+    IssuerAddress string
+    ExplorerURL   string
+    EmailLookback time.Duration
+}
+
+// NewInvoiceService creates a new invoice service
+func NewInvoiceService(db *gorm.DB, emailService *EmailService, cfg config.InvoiceConfig) *InvoiceService {
+    return &InvoiceService{
+        DB:            db,
+        Email:         emailService,
+        IssuerName:    cfg.IssuerName,
+        IssuerAddress: cfg.IssuerAddress,
+        ExplorerURL:   strings.TrimRight(cfg.ExplorerURL, "/"),
+        EmailLookback: cfg.EmailLookback,
+    }
+}
+
+// Document issues the invoice or receipt of a purchase if it has none yet and renders it
+func (s *InvoiceService) Document(transaction *models.Transaction, kind string) (*models.Invoice, []byte, error) {
+    invoice, err := s.Issue(transaction, kind)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    content, err := s.Render(invoice, transaction)
+    if err != nil {
+        return nil, nil, err
+    }
+    return invoice, content, nil
+}
+
+// Issue returns the invoice or receipt of a purchase, numbering a new one on first use.
+// Numbers come from a per kind and year counter in the same database transaction, so they have no gaps.
+func (s *InvoiceService) Issue(transaction *models.Transaction, kind string) (*models.Invoice, error) {
+    if kind != models.InvoiceKindInvoice && kind != models.InvoiceKindReceipt {
+        return nil, fmt.Errorf("unknown document kind %q", kind)
+    }
+
+    var invoice models.Invoice
+    err := s.DB.Where("transaction_id = ? AND kind = ?", transaction.UUID, kind).First(&invoice).Error
+    if err == nil {
+        return &invoice, nil
+    }
+    if !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, fmt.Errorf("failed to find %s: %w", kind, err)
+    }
+
+    if kind == models.InvoiceKindReceipt && transaction.Status != models.TransactionStatusCompleted {
+        return nil, ErrReceiptNotAvailable
+    }
+
+    figures, err := json.Marshal(newInvoiceFigures(transaction))
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode %s figures: %w", kind, err)
+    }
+
+    now := time.Now()
+    err = s.DB.Transaction(func(tx *gorm.DB) error {
+        var last int
+        err := tx.Raw(`INSERT INTO invoice_sequences (kind, year, last) VALUES (?, ?, 1)
+            ON CONFLICT (kind, year) DO UPDATE SET last = invoice_sequences.last + 1 RETURNING last`,
+            kind, now.Year()).Scan(&last).Error
+        if err != nil {
+            return fmt.Errorf("failed to number %s: %w", kind, err)
+        }
+
+        prefix := "INV"
+        if kind == models.InvoiceKindReceipt {
+            prefix = "RCT"
+        }
+        invoice = models.Invoice{
+            UUID:          uuid.New(),
+            Number:        fmt.Sprintf("%s-%d-%06d", prefix, now.Year(), last),
+            Kind:          kind,
+            TransactionID: transaction.UUID,
+            UserID:        transaction.UserID,
+            IssuedAt:      now,
+            Figures:       string(figures),
+        }
+        return tx.Create(&invoice).Error
+    })
+    if err != nil {
+        // Another request may have issued it first
+        var existing models.Invoice
+        if s.DB.Where("transaction_id = ? AND kind = ?", transaction.UUID, kind).First(&existing).Error == nil {
+            return &existing, nil
+        }
+        return nil, fmt.Errorf("failed to issue %s: %w", kind, err)
+    }
+
+    return &invoice, nil
+}
+
+// figures returns the figures fixed when the document was issued. Documents issued before figures
+// were kept are fixed to the purchase as it is now.
+func (s *InvoiceService) figures(invoice *models.Invoice, transaction *models.Transaction) (*invoiceFigures, error) {
+    if invoice.Figures != "" {
+        var figures invoiceFigures
+        if err := json.Unmarshal([]byte(invoice.Figures), &figures); err != nil {
+            return nil, fmt.Errorf("failed to decode %s figures: %w", invoice.Number, err)
+        }
+        return &figures, nil
+    }
+
+    figures := newInvoiceFigures(transaction)
+    encoded, err := json.Marshal(figures)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode %s figures: %w", invoice.Number, err)
+    }
+    if err := s.DB.Model(invoice).Where("figures IS NULL OR figures = ''").Update("figures", string(encoded)).Error; err != nil {
+        return nil, fmt.Errorf("failed to save %s figures: %w", invoice.Number, err)
+    }
+    return &figures, nil
+}
+
+// Render draws the invoice or receipt of a purchase as a PDF from the figures of its issue, with
+// the purchase's current status and transaction hashes
+func (s *InvoiceService) Render(invoice *models.Invoice, transaction *models.Transaction) ([]byte, error) {
+    var user models.User
+    if err := s.DB.Where("uuid = ?", transaction.UserID).First(&user).Error; err != nil {
+        return nil, fmt.Errorf("failed to find buyer: %w", err)
+    }
+
+    figures, err := s.figures(invoice, transaction)
+    if err != nil {
+        return nil, err
+    }
+
+    doc := pdf.New()
+    doc.AddPage()
+
+    title := "INVOICE"
+    if invoice.Kind == models.InvoiceKindReceipt {
+        title = "RECEIPT"
+    }
+    doc.Text(50, 780, 22, true, title)
+    doc.Text(350, 785, 12, true, s.IssuerName)
+    if s.IssuerAddress != "" {
+        doc.Text(350, 770, 9, false, s.IssuerAddress)
+    }
+
+    y := 740.0
+    row := func(label, value string) {
+        doc.Text(50, y, 10, false, label)
+        doc.Text(200, y, 10, false, value)
+        y -= 16
+    }
+    heading := func(text string) {
+        y -= 10
+        doc.Text(50, y, 12, true, text)
+        doc.Line(50, y-4, pdf.PageWidth-50, y-4, 0.5)
+        y -= 22
+    }
+
+    row("Number", invoice.Number)
+    row("Issued", invoice.IssuedAt.UTC().Format("2 January 2006 15:04 UTC"))
+    row("Purchase", transaction.PaymentID)
+    row("Status", transaction.Status)
+
+    heading("Billed to")
+    row("Name", user.Username)
+    row("Email", user.Email)
+    row("Receiving wallet", figures.ReceivingWallet)
+
+    currency := figures.FiatCurrency
+    baseTokens := figures.TokenAmount - figures.BonusTokens
+    subtotal := figures.FiatAmount + figures.DiscountFiat
+
+    heading("Purchase")
+    row("Token amount", formatTokens(figures.TokenAmount)+" "+figures.TokenSymbol)
+    if figures.BonusTokens > 0 {
+        row("Promo bonus", formatTokens(figures.BonusTokens)+" "+figures.TokenSymbol)
+    }
+    if baseTokens > 0 {
+        row("Price per token", fmt.Sprintf("%s %s", strconv.FormatFloat(subtotal/baseTokens, 'f', 8, 64), currency))
+    }
+    if figures.EthAmount > 0 {
+        row("ETH price", fmt.Sprintf("1 ETH = %s %s", formatFiat(subtotal/figures.EthAmount), currency))
+    }
+    if figures.FXRate > 0 {
+        row("Exchange rate", fmt.Sprintf("1 USD = %s IDR", formatFiat(figures.FXRate)))
+    }
+    row("Payment method", figures.PaymentMethod)
+    if figures.PaymentReference != "" {
+        row("Payment reference", figures.PaymentReference)
+    }
+
+    heading("Amount")
+    row("Subtotal", formatFiat(subtotal)+" "+currency)
+    if figures.DiscountFiat > 0 {
+        row("Discount ("+figures.PromoCode+")", "-"+formatFiat(figures.DiscountFiat)+" "+currency)
+    }
+    row("Network fee (gas)", fmt.Sprintf("%s %s (%s ETH)", formatFiat(figures.GasFeeFiat), currency, formatTokens(figures.GasFee)))
+    y -= 4
+    doc.Text(50, y, 11, true, "Total")
+    doc.Text(200, y, 11, true, formatFiat(figures.FiatAmount+figures.GasFeeFiat)+" "+currency)
+    y -= 16
+
+    heading("Blockchain")
+    hashes := [][2]string{{"Token transfer", transaction.BlockchainTxHash}}
+    if transaction.SwapTxHash != "" && transaction.SwapTxHash != transaction.BlockchainTxHash {
+        hashes = append(hashes, [2]string{"Swap", transaction.SwapTxHash})
+    }
+    if transaction.BonusTxHash != "" {
+        hashes = append(hashes, [2]string{"Bonus transfer", transaction.BonusTxHash})
+    }
+    for _, hash := range hashes {
+        if hash[1] == "" {
+            row(hash[0], "Not yet on-chain")
+            continue
+        }
+        url := s.ExplorerURL + "/tx/" + hash[1]
+        doc.Text(50, y, 10, false, hash[0])
+        doc.Text(200, y, 8, false, hash[1])
+        doc.Text(200, y-11, 8, false, url)
+        doc.Link(200, y-14, pdf.PageWidth-250, 24, url)
+        y -= 30
+    }
+    if transaction.CompletedAt != nil {
+        row("Completed", transaction.CompletedAt.UTC().Format("2 January 2006 15:04 UTC"))
+    }
+
+    note := "This invoice lists the tokens ordered and the amount charged for them."
+    switch {
+    case transaction.Status == models.TransactionStatusRefunded:
+        note = "This purchase was refunded after this document was issued."
+    case invoice.Kind == models.InvoiceKindReceipt:
+        note = "Payment received in full. Thank you for your purchase."
+    }
+    doc.Line(50, 80, pdf.PageWidth-50, 80, 0.5)
+    doc.Text(50, 64, 9, false, note)
+
+    return doc.Bytes(), nil
+}
+
+// Run emails the receipts of completed purchases until the process exits
+func (s *InvoiceService) Run(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        if err := s.SendReceipts(); err != nil {
+            log.Printf("Invoices: %v", err)
+        }
+    }
+}
+
+// SendReceipts issues and emails the invoice and receipt of purchases completed within EmailLookback
+// whose receipt was not emailed yet. A purchase whose email fails is retried on the next pass.
+func (s *InvoiceService) SendReceipts() error {
+    var transactions []models.Transaction
+    err := s.DB.Where("status = ? AND token_amount > 0 AND completed_at >= ?",
+        models.TransactionStatusCompleted, time.Now().Add(-s.EmailLookback)).
+        Where("NOT EXISTS (SELECT 1 FROM invoices WHERE invoices.transaction_id = transactions.uuid AND invoices.kind = ? AND invoices.emailed_at IS NOT NULL)",
+            models.InvoiceKindReceipt).
+        Order("completed_at").Limit(invoiceEmailBatch).Find(&transactions).Error
+    if err != nil {
+        return fmt.Errorf("failed to find completed purchases: %w", err)
+    }
+
+    for i := range transactions {
+        if err := s.sendReceipt(&transactions[i]); err != nil {
+            log.Printf("Invoices: %s: %v", transactions[i].PaymentID, err)
+        }
+    }
+    return nil
+}
+
+// sendReceipt queues the invoice and receipt of a completed purchase and marks the receipt as sent
+func (s *InvoiceService) sendReceipt(transaction *models.Transaction) error {
+    var user models.User
+    if err := s.DB.Where("uuid = ?", transaction.UserID).First(&user).Error; err != nil {
+        return fmt.Errorf("failed to find buyer: %w", err)
+    }
+    if user.Email == "" {
+        return nil
+    }
+
+    var attachments []mailer.Attachment
+    var receipt *models.Invoice
+    for _, kind := range []string{models.InvoiceKindInvoice, models.InvoiceKindReceipt} {
+        invoice, content, err := s.Document(transaction, kind)
+        if err != nil {
+            return err
+        }
+        attachments = append(attachments, mailer.Attachment{
+            Filename:    invoice.Number + ".pdf",
+            ContentType: "application/pdf",
+            Content:     content,
+        })
+        receipt = invoice
+    }
+
+    data := purchaseEmailData(transaction)
+    if transaction.BlockchainTxHash != "" {
+        data["ExplorerURL"] = s.ExplorerURL + "/tx/" + transaction.BlockchainTxHash
+    }
+    err := s.Email.Send(user.Email, user.Username, EmailTemplatePurchaseCompleted, data, attachments...)
+    if err != nil {
+        return err
+    }
+
+    now := time.Now()
+    if err := s.DB.Model(&models.Invoice{}).Where("uuid = ?", receipt.UUID).Update("emailed_at", now).Error; err != nil {
+        return fmt.Errorf("failed to mark receipt %s as emailed: %w", receipt.Number, err)
+    }
+    return nil
+}
+
+// formatTokens prints a token or ETH amount without trailing zeros
+func formatTokens(amount float64) string {
+    return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+// formatFiat prints a fiat amount with two decimals
+func formatFiat(amount float64) string {
+    return strconv.FormatFloat(amount, 'f', 2, 64)
+}
@@ -0,0 +1,20 @@
+package services
+
+import (
+    "testing"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+)
+
+func TestInvoiceFiguresUseTheBuyersWallet(t *testing.T) {
+    transaction := &models.Transaction{WalletAddress: "0xtreasury", FiatAmount: 100}
+    if wallet := newInvoiceFigures(transaction).ReceivingWallet; wallet != "0xtreasury" {
+        t.Fatalf("expected the delivery wallet, got %s", wallet)
+    }
+
+    // Vesting purchases are delivered to the treasury and claimed by the buyer
+    transaction.VestingWallet = "0xbuyer"
+    if wallet := newInvoiceFigures(transaction).ReceivingWallet; wallet != "0xbuyer" {
+        t.Fatalf("expected the buyer's wallet for a vesting purchase, got %s", wallet)
+    }
+}
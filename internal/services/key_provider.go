@@ -0,0 +1,332 @@
+package services
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+)
+
+// FileKeyReloadInterval is how often a file provider looks for a new current version, such as one
+// created by rotatekeys while the server is running
+const FileKeyReloadInterval = 30 * time.Second
+
+// KeyProvider is the master key hierarchy used to wrap per-record data keys.
+// Implementations can be backed by env vars, local files or a real KMS.
+type KeyProvider interface {
+    // CurrentVersion returns the master key version new data keys are wrapped with
+    CurrentVersion() int
+    // WrapKey encrypts a data key with the given master key version
+    WrapKey(version int, dataKey []byte) ([]byte, error)
+    // UnwrapKey decrypts a data key that was wrapped with the given master key version
+    UnwrapKey(version int, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeyProvider keeps versioned master keys in memory
+type StaticKeyProvider struct {
+    keys    map[int][]byte
+    current int
+}
+
+// NewStaticKeyProvider creates a provider from "version:hexkey" pairs separated by commas.
+// When current is 0 the highest version is used for new data keys.
+func NewStaticKeyProvider(spec string, current int) (*StaticKeyProvider, error) {
+    keys := make(map[int][]byte)
+    for _, pair := range strings.Split(spec, ",") {
+        pair = strings.TrimSpace(pair)
+        if pair == "" {
+            continue
+        }
+
+        parts := strings.SplitN(pair, ":", 2)
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("invalid master key entry %q, expected version:hexkey", pair)
+        }
+
+        version, err := strconv.Atoi(parts[0])
+        if err != nil || version <= 0 {
+            return nil, fmt.Errorf("invalid master key version %q", parts[0])
+        }
+
+        key, err := decodeMasterKey(parts[1])
+        if err != nil {
+            return nil, fmt.Errorf("invalid master key v%d: %w", version, err)
+        }
+        keys[version] = key
+    }
+
+    if len(keys) == 0 {
+        return nil, errors.New("no master keys configured")
+    }
+
+    if current == 0 {
+        current = highestVersion(keys)
+    }
+    if _, ok := keys[current]; !ok {
+        return nil, fmt.Errorf("current master key version %d is not configured", current)
+    }
+
+    return &StaticKeyProvider{keys: keys, current: current}, nil
+}
+
+// CurrentVersion returns the active master key version
+func (p *StaticKeyProvider) CurrentVersion() int {
+    return p.current
+}
+
+// WrapKey encrypts a data key with the given master key version
+func (p *StaticKeyProvider) WrapKey(version int, dataKey []byte) ([]byte, error) {
+    key, ok := p.keys[version]
+    if !ok {
+        return nil, fmt.Errorf("master key version %d not found", version)
+    }
+    return sealGCM(key, dataKey, versionAAD(version))
+}
+
+// UnwrapKey decrypts a data key with the given master key version
+func (p *StaticKeyProvider) UnwrapKey(version int, wrapped []byte) ([]byte, error) {
+    key, ok := p.keys[version]
+    if !ok {
+        return nil, fmt.Errorf("master key version %d not found", version)
+    }
+    return openGCM(key, wrapped, versionAAD(version))
+}
+
+// FileKeyProvider is a local file-based KMS stand-in. Each master key version
+// lives in its own file (v1.key, v2.key, ...) holding the hex encoded key.
+// Versions written by another process are picked up without a restart.
+type FileKeyProvider struct {
+    Dir      string
+    keys     map[int][]byte
+    current  int
+    pinned   bool
+    loadedAt time.Time
+    mu       sync.RWMutex
+}
+
+// NewFileKeyProvider loads master keys from dir, creating the first version if the directory is empty.
+// When current is 0 the highest version on disk is used for new data keys.
+func NewFileKeyProvider(dir string, current int) (*FileKeyProvider, error) {
+    if err := os.MkdirAll(dir, 0700); err != nil {
+        return nil, fmt.Errorf("failed to create key directory: %w", err)
+    }
+
+    p := &FileKeyProvider{
+        Dir:     dir,
+        keys:    make(map[int][]byte),
+        current: current,
+        pinned:  current != 0,
+    }
+
+    if err := p.load(); err != nil {
+        return nil, err
+    }
+    p.loadedAt = time.Now()
+
+    if len(p.keys) == 0 {
+        if _, err := p.CreateVersion(); err != nil {
+            return nil, err
+        }
+    }
+
+    if p.current == 0 {
+        p.current = highestVersion(p.keys)
+    }
+    if _, ok := p.keys[p.current]; !ok {
+        return nil, fmt.Errorf("current master key version %d not found in %s", p.current, dir)
+    }
+
+    return p, nil
+}
+
+// CurrentVersion returns the active master key version, re-reading the key directory every
+// FileKeyReloadInterval unless the version is pinned
+func (p *FileKeyProvider) CurrentVersion() int {
+    p.mu.RLock()
+    stale := !p.pinned && time.Since(p.loadedAt) > FileKeyReloadInterval
+    p.mu.RUnlock()
+
+    if stale {
+        if err := p.reload(); err != nil {
+            log.Printf("Key provider: %v", err)
+        }
+    }
+
+    p.mu.RLock()
+    defer p.mu.RUnlock()
+    return p.current
+}
+
+// CreateVersion generates a new master key file and makes it current unless the version is pinned
+func (p *FileKeyProvider) CreateVersion() (int, error) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    // Another process may have added a version since the last load
+    if err := p.load(); err != nil {
+        return 0, err
+    }
+
+    key := make([]byte, 32)
+    if _, err := rand.Read(key); err != nil {
+        return 0, fmt.Errorf("failed to generate master key: %w", err)
+    }
+
+    version := highestVersion(p.keys) + 1
+    path := filepath.Join(p.Dir, fmt.Sprintf("v%d.key", version))
+    if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0600); err != nil {
+        return 0, fmt.Errorf("failed to write master key: %w", err)
+    }
+
+    p.keys[version] = key
+    if !p.pinned {
+        p.current = version
+    }
+
+    return version, nil
+}
+
+// WrapKey encrypts a data key with the given master key version
+func (p *FileKeyProvider) WrapKey(version int, dataKey []byte) ([]byte, error) {
+    key, err := p.key(version)
+    if err != nil {
+        return nil, err
+    }
+    return sealGCM(key, dataKey, versionAAD(version))
+}
+
+// UnwrapKey decrypts a data key with the given master key version
+func (p *FileKeyProvider) UnwrapKey(version int, wrapped []byte) ([]byte, error) {
+    key, err := p.key(version)
+    if err != nil {
+        return nil, err
+    }
+    return openGCM(key, wrapped, versionAAD(version))
+}
+
+// key returns a master key version, re-reading the key directory when the version is not loaded yet
+func (p *FileKeyProvider) key(version int) ([]byte, error) {
+    p.mu.RLock()
+    key, ok := p.keys[version]
+    p.mu.RUnlock()
+    if ok {
+        return key, nil
+    }
+
+    if err := p.reload(); err != nil {
+        return nil, err
+    }
+
+    p.mu.RLock()
+    key, ok = p.keys[version]
+    p.mu.RUnlock()
+    if !ok {
+        return nil, fmt.Errorf("master key version %d not found", version)
+    }
+    return key, nil
+}
+
+// reload re-reads the key directory and moves to its highest version unless the version is pinned
+func (p *FileKeyProvider) reload() error {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+
+    if err := p.load(); err != nil {
+        return err
+    }
+    p.loadedAt = time.Now()
+    if !p.pinned {
+        p.current = highestVersion(p.keys)
+    }
+    return nil
+}
+
+// load reads every vN.key file from the key directory. The caller holds the lock or owns p.
+func (p *FileKeyProvider) load() error {
+    entries, err := os.ReadDir(p.Dir)
+    if err != nil {
+        return fmt.Errorf("failed to read key directory: %w", err)
+    }
+
+    for _, entry := range entries {
+        name := entry.Name()
+        if entry.IsDir() || !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".key") {
+            continue
+        }
+
+        version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".key"))
+        if err != nil || version <= 0 {
+            continue
+        }
+
+        data, err := os.ReadFile(filepath.Join(p.Dir, name))
+        if err != nil {
+            return fmt.Errorf("failed to read master key %s: %w", name, err)
+        }
+
+        key, err := decodeMasterKey(strings.TrimSpace(string(data)))
+        if err != nil {
+            return fmt.Errorf("invalid master key %s: %w", name, err)
+        }
+        p.keys[version] = key
+    }
+
+    return nil
+}
+
+// NewKeyProvider builds the key provider selected by WALLET_KMS_PROVIDER
+func NewKeyProvider(cfg *config.Config) (KeyProvider, error) {
+    switch cfg.WalletDB.KMSProvider {
+    case "file":
+        return NewFileKeyProvider(cfg.WalletDB.KMSKeyDir, cfg.WalletDB.MasterKeyVersion)
+    case "", "static":
+        spec := cfg.WalletDB.MasterKeys
+        if spec == "" && cfg.WalletDB.EncryptKey != "" {
+            // Fall back to the legacy key as master key version 1
+            spec = "1:" + cfg.WalletDB.EncryptKey
+        }
+        return NewStaticKeyProvider(spec, cfg.WalletDB.MasterKeyVersion)
+    default:
+        return nil, fmt.Errorf("unknown key provider %q", cfg.WalletDB.KMSProvider)
+    }
+}
+
+// decodeMasterKey parses a 64 character hex key
+func decodeMasterKey(hexKey string) ([]byte, error) {
+    key, err := hex.DecodeString(hexKey)
+    if err != nil {
+        return nil, err
+    }
+    if len(key) != 32 {
+        return nil, errors.New("master key must be 32 bytes (64 hex characters)")
+    }
+    return key, nil
+}
+
+// highestVersion returns the largest version in the key map, or 0 when empty
+func highestVersion(keys map[int][]byte) int {
+    versions := make([]int, 0, len(keys))
+    for v := range keys {
+        versions = append(versions, v)
+    }
+    if len(versions) == 0 {
+        return 0
+    }
+    sort.Ints(versions)
+    return versions[len(versions)-1]
+}
+
+// versionAAD binds a wrapped data key to the master key version that wrapped it
+func versionAAD(version int) []byte {
+    return []byte(fmt.Sprintf("master-key-v%d", version))
+}
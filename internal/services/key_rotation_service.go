@@ -0,0 +1,257 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// KeyRotationService re-wraps wallet secrets under the current master key version
+type KeyRotationService struct {
+    WalletDB      *gorm.DB
+    EncryptionSvc *EncryptionService
+    BatchSize     int
+}
+
+// KeyRotationResult summarises a rotation run per table
+type KeyRotationResult struct {
+    TargetVersion int            `json:"target_version"`
+    Rotated       map[string]int `json:"rotated"`
+    Skipped       map[string]int `json:"skipped"` // Rows changed concurrently, picked up by the next run
+    Failed        map[string]int `json:"failed"`
+}
+
+// NewKeyRotationService creates a new key rotation service
+func NewKeyRotationService(walletDB *gorm.DB, encryptionSvc *EncryptionService, batchSize int) *KeyRotationService {
+    if batchSize <= 0 {
+        batchSize = 100
+    }
+
+    return &KeyRotationService{
+        WalletDB:      walletDB,
+        EncryptionSvc: encryptionSvc,
+        BatchSize:     batchSize,
+    }
+}
+
+// Rotate re-wraps every row not yet on the current master key version.
+// Rows are updated one at a time with an optimistic version check, so the
+// service can keep reading and writing credentials while rotation runs.
+func (s *KeyRotationService) Rotate() (*KeyRotationResult, error) {
+    result := &KeyRotationResult{
+        TargetVersion: s.EncryptionSvc.Keys.CurrentVersion(),
+        Rotated:       make(map[string]int),
+        Skipped:       make(map[string]int),
+        Failed:        make(map[string]int),
+    }
+
+    if err := s.rotateWallets(result); err != nil {
+        return result, err
+    }
+    if err := s.rotateMnemonics(result); err != nil {
+        return result, err
+    }
+    if err := s.rotateBackups(result); err != nil {
+        return result, err
+    }
+    if err := s.rotateShares(result); err != nil {
+        return result, err
+    }
+
+    return result, nil
+}
+
+// rotateWallets rotates EncryptedWallet rows
+func (s *KeyRotationService) rotateWallets(result *KeyRotationResult) error {
+    const table = "encrypted_wallets"
+    lastID := uuid.Nil
+
+    for {
+        var rows []models.EncryptedWallet
+        if err := s.WalletDB.Where("key_version <> ? AND uuid > ?", result.TargetVersion, lastID).
+            Order("uuid").Limit(s.BatchSize).Find(&rows).Error; err != nil {
+            return fmt.Errorf("failed to load %s: %w", table, err)
+        }
+        if len(rows) == 0 {
+            return nil
+        }
+
+        for _, row := range rows {
+            lastID = row.UUID
+
+            dataKey, fields, err := s.rewrap(row.EncDataKey, row.KeyVersion, row.EncPrivateKey, row.EncKeystoreJSON)
+            if err != nil {
+                log.Printf("Key rotation: failed to rotate %s %s: %v", table, row.UUID, err)
+                result.Failed[table]++
+                continue
+            }
+
+            s.save(result, table, &models.EncryptedWallet{}, row.UUID, row.KeyVersion, dataKey, map[string]interface{}{
+                "enc_private_key":   fields[0],
+                "enc_keystore_json": fields[1],
+            })
+        }
+    }
+}
+
+// rotateMnemonics rotates WalletMnemonic rows
+func (s *KeyRotationService) rotateMnemonics(result *KeyRotationResult) error {
+    const table = "wallet_mnemonics"
+    lastID := uuid.Nil
+
+    for {
+        var rows []models.WalletMnemonic
+        if err := s.WalletDB.Where("key_version <> ? AND uuid > ?", result.TargetVersion, lastID).
+            Order("uuid").Limit(s.BatchSize).Find(&rows).Error; err != nil {
+            return fmt.Errorf("failed to load %s: %w", table, err)
+        }
+        if len(rows) == 0 {
+            return nil
+        }
+
+        for _, row := range rows {
+            lastID = row.UUID
+
+            dataKey, fields, err := s.rewrap(row.EncDataKey, row.KeyVersion, row.EncMnemonic)
+            if err != nil {
+                log.Printf("Key rotation: failed to rotate %s %s: %v", table, row.UUID, err)
+                result.Failed[table]++
+                continue
+            }
+
+            s.save(result, table, &models.WalletMnemonic{}, row.UUID, row.KeyVersion, dataKey, map[string]interface{}{
+                "enc_mnemonic": fields[0],
+            })
+        }
+    }
+}
+
+// rotateBackups rotates WalletBackup rows
+func (s *KeyRotationService) rotateBackups(result *KeyRotationResult) error {
+    const table = "wallet_backups"
+    lastID := uuid.Nil
+
+    for {
+        var rows []models.WalletBackup
+        if err := s.WalletDB.Where("key_version <> ? AND uuid > ?", result.TargetVersion, lastID).
+            Order("uuid").Limit(s.BatchSize).Find(&rows).Error; err != nil {
+            return fmt.Errorf("failed to load %s: %w", table, err)
+        }
+        if len(rows) == 0 {
+            return nil
+        }
+
+        for _, row := range rows {
+            lastID = row.UUID
+
+            dataKey, fields, err := s.rewrap(row.EncDataKey, row.KeyVersion, row.BackupData)
+            if err != nil {
+                log.Printf("Key rotation: failed to rotate %s %s: %v", table, row.UUID, err)
+                result.Failed[table]++
+                continue
+            }
+
+            s.save(result, table, &models.WalletBackup{}, row.UUID, row.KeyVersion, dataKey, map[string]interface{}{
+                "backup_data": fields[0],
+            })
+        }
+    }
+}
+
+// rotateShares rotates the server vault WalletShare rows
+func (s *KeyRotationService) rotateShares(result *KeyRotationResult) error {
+    const table = "wallet_shares"
+    lastID := uuid.Nil
+
+    for {
+        var rows []models.WalletShare
+        if err := s.WalletDB.Where("holder = ? AND key_version <> ? AND uuid > ?", models.ShareHolderServer, result.TargetVersion, lastID).
+            Order("uuid").Limit(s.BatchSize).Find(&rows).Error; err != nil {
+            return fmt.Errorf("failed to load %s: %w", table, err)
+        }
+        if len(rows) == 0 {
+            return nil
+        }
+
+        for _, row := range rows {
+            lastID = row.UUID
+
+            dataKey, fields, err := s.rewrap(row.EncDataKey, row.KeyVersion, row.EncShare)
+            if err != nil {
+                log.Printf("Key rotation: failed to rotate %s %s: %v", table, row.UUID, err)
+                result.Failed[table]++
+                continue
+            }
+
+            s.save(result, table, &models.WalletShare{}, row.UUID, row.KeyVersion, dataKey, map[string]interface{}{
+                "enc_share": fields[0],
+            })
+        }
+    }
+}
+
+// rewrap moves a record onto the current master key. Envelope rows only need their
+// data key re-wrapped; legacy rows are re-encrypted under a fresh data key.
+func (s *KeyRotationService) rewrap(wrapped []byte, version int, ciphertexts ...[]byte) (*DataKey, [][]byte, error) {
+    oldKey, err := s.EncryptionSvc.OpenDataKey(wrapped, version)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if version != LegacyKeyVersion {
+        newKey, err := s.EncryptionSvc.RewrapDataKey(oldKey)
+        if err != nil {
+            return nil, nil, err
+        }
+        return newKey, ciphertexts, nil
+    }
+
+    newKey, err := s.EncryptionSvc.GenerateDataKey()
+    if err != nil {
+        return nil, nil, err
+    }
+
+    fields := make([][]byte, len(ciphertexts))
+    for i, ciphertext := range ciphertexts {
+        if len(ciphertext) == 0 {
+            fields[i] = ciphertext
+            continue
+        }
+
+        plaintext, err := s.EncryptionSvc.Decrypt(oldKey, ciphertext)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to decrypt legacy ciphertext: %w", err)
+        }
+
+        fields[i], err = s.EncryptionSvc.Encrypt(newKey, plaintext)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to re-encrypt ciphertext: %w", err)
+        }
+    }
+
+    return newKey, fields, nil
+}
+
+// save writes a rotated row, only if nobody rotated or rewrote it in the meantime
+func (s *KeyRotationService) save(result *KeyRotationResult, table string, model interface{}, id uuid.UUID, oldVersion int, dataKey *DataKey, updates map[string]interface{}) {
+    updates["enc_data_key"] = dataKey.Wrapped
+    updates["key_version"] = dataKey.KeyVersion
+    if table != "wallet_backups" && table != "wallet_shares" {
+        updates["updated_at"] = time.Now()
+    }
+
+    res := s.WalletDB.Model(model).Where("uuid = ? AND key_version = ?", id, oldVersion).Updates(updates)
+    switch {
+    case res.Error != nil:
+        log.Printf("Key rotation: failed to save %s %s: %v", table, id, res.Error)
+        result.Failed[table]++
+    case res.RowsAffected == 0:
+        result.Skipped[table]++
+    default:
+        result.Rotated[table]++
+    }
+}
@@ -0,0 +1,412 @@
+package services
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/pkg/kyc"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrKYCLimitExceeded wraps the purchase limit a purchase would break
+var ErrKYCLimitExceeded = errors.New("KYC purchase limit exceeded")
+
+// KYCLimits are the USD purchase limits of a KYC level, 0 = no limit
+type KYCLimits struct {
+    Daily    float64 `json:"daily"`
+    Monthly  float64 `json:"monthly"`
+    Lifetime float64 `json:"lifetime"`
+}
+
+// KYCUsage is what a user spent in each limit window, in USD
+type KYCUsage struct {
+    Daily    float64 `json:"daily"`
+    Monthly  float64 `json:"monthly"`
+    Lifetime float64 `json:"lifetime"`
+}
+
+// KYCStatus is a user's verification level with its limits and usage
+type KYCStatus struct {
+    Level      int                  `json:"level"`
+    Status     string               `json:"status"`
+    Limits     KYCLimits            `json:"limits"`
+    Usage      KYCUsage             `json:"usage"`
+    NextLevel  *int                 `json:"next_level,omitempty"`
+    NextLimits *KYCLimits           `json:"next_limits,omitempty"`
+    LastCheck  *models.KYCCheck     `json:"last_check,omitempty"`
+    Documents  []kyc.DocumentResult `json:"documents,omitempty"`
+}
+
+// KYCService runs identity verification through the provider and enforces the purchase limits of each level
+type KYCService struct {
+    DB       *gorm.DB
+    Provider kyc.Provider
+    Limits   map[int]KYCLimits
+    levels   []int // Configured levels, ascending
+}
+
+// NewKYCService creates a new KYC service from limits written as level=daily/monthly/lifetime
+func NewKYCService(db *gorm.DB, provider kyc.Provider, limitSpecs []string) (*KYCService, error) {
+    limits, err := ParseKYCLimits(limitSpecs)
+    if err != nil {
+        return nil, err
+    }
+
+    levels := make([]int, 0, len(limits))
+    for level := range limits {
+        levels = append(levels, level)
+    }
+    sort.Ints(levels)
+    if levels[0] != 0 {
+        return nil, fmt.Errorf("KYC limits must include level 0")
+    }
+
+    return &KYCService{
+        DB:       db,
+        Provider: provider,
+        Limits:   limits,
+        levels:   levels,
+    }, nil
+}
+
+// ParseKYCLimits parses limits written as level=daily/monthly/lifetime in USD, 0 = no limit
+func ParseKYCLimits(specs []string) (map[int]KYCLimits, error) {
+    limits := make(map[int]KYCLimits)
+    for _, spec := range specs {
+        levelStr, amounts, ok := strings.Cut(spec, "=")
+        if !ok {
+            return nil, fmt.Errorf("invalid KYC limit %q, expected level=daily/monthly/lifetime", spec)
+        }
+        level, err := strconv.Atoi(strings.TrimSpace(levelStr))
+        if err != nil || level < 0 {
+            return nil, fmt.Errorf("invalid KYC level in %q", spec)
+        }
+
+        parts := strings.Split(amounts, "/")
+        if len(parts) != 3 {
+            return nil, fmt.Errorf("invalid KYC limit %q, expected level=daily/monthly/lifetime", spec)
+        }
+        var values [3]float64
+        for i, part := range parts {
+            values[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+            if err != nil || values[i] < 0 {
+                return nil, fmt.Errorf("invalid amount %q in KYC limit %q", part, spec)
+            }
+        }
+
+        limits[level] = KYCLimits{Daily: values[0], Monthly: values[1], Lifetime: values[2]}
+    }
+
+    if len(limits) == 0 {
+        return nil, fmt.Errorf("no KYC limits configured")
+    }
+    return limits, nil
+}
+
+// StartVerification registers the user with the provider for a higher level and returns the
+// check and the URL where the user submits documents
+func (s *KYCService) StartVerification(ctx context.Context, user *models.User, level int) (*models.KYCCheck, string, error) {
+    if _, ok := s.Limits[level]; !ok {
+        return nil, "", fmt.Errorf("unknown KYC level %d", level)
+    }
+    if level <= user.KYCLevel {
+        return nil, "", fmt.Errorf("account is already verified for level %d", user.KYCLevel)
+    }
+
+    var pending int64
+    if err := s.DB.Model(&models.KYCCheck{}).Where("user_id = ? AND status = ?", user.UUID, models.KYCStatusPending).Count(&pending).Error; err != nil {
+        return nil, "", fmt.Errorf("failed to check pending verifications: %w", err)
+    }
+    if pending > 0 {
+        return nil, "", fmt.Errorf("a verification is already in progress")
+    }
+
+    applicantID, verificationURL, err := s.Provider.CreateApplicant(ctx, kyc.Applicant{
+        ExternalID: user.UUID.String(),
+        Email:      user.Email,
+        FullName:   user.FullName,
+        Phone:      user.Phone,
+        Level:      level,
+    })
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to create applicant: %w", err)
+    }
+
+    check := models.KYCCheck{
+        UUID:        uuid.New(),
+        UserID:      user.UUID,
+        Provider:    s.Provider.Name(),
+        ApplicantID: applicantID,
+        Level:       level,
+        Status:      models.KYCStatusPending,
+        CreatedAt:   time.Now(),
+        UpdatedAt:   time.Now(),
+    }
+
+    err = s.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(&check).Error; err != nil {
+            return err
+        }
+        return tx.Model(&models.User{}).Where("uuid = ?", user.UUID).Update("kyc_status", models.KYCStatusPending).Error
+    })
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to save verification: %w", err)
+    }
+
+    return &check, verificationURL, nil
+}
+
+// HandleWebhook applies a provider status webhook. Approval raises the user to the checked level.
+func (s *KYCService) HandleWebhook(ctx context.Context, header http.Header, body []byte) (*models.KYCCheck, error) {
+    result, err := s.Provider.ParseWebhook(header, body)
+    if err != nil {
+        return nil, err
+    }
+
+    var check models.KYCCheck
+    if err := s.DB.Where("applicant_id = ? AND provider = ?", result.ApplicantID, s.Provider.Name()).First(&check).Error; err != nil {
+        return nil, fmt.Errorf("unknown applicant %s", result.ApplicantID)
+    }
+
+    // The webhook only signals a change; the document results come from the provider
+    if result.Status != kyc.StatusPending {
+        if full, err := s.Provider.GetResult(ctx, result.ApplicantID); err == nil && full.Status == result.Status {
+            result = full
+        } else if err != nil {
+            log.Printf("KYC: failed to fetch results for %s, using the webhook: %v", result.ApplicantID, err)
+        }
+    }
+
+    documents, err := json.Marshal(result.Documents)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode document results: %w", err)
+    }
+
+    now := time.Now()
+    check.Status = result.Status
+    check.Reason = result.Reason
+    check.Documents = string(documents)
+    check.UpdatedAt = now
+    if result.Status != kyc.StatusPending {
+        check.ReviewedAt = &now
+    }
+
+    err = s.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Save(&check).Error; err != nil {
+            return err
+        }
+
+        updates := map[string]interface{}{"kyc_status": check.Status}
+        if check.Status == models.KYCStatusApproved {
+            // Never lower a level an earlier check or an admin granted
+            var user models.User
+            if err := tx.Select("kyc_level").Where("uuid = ?", check.UserID).First(&user).Error; err != nil {
+                return err
+            }
+            if check.Level > user.KYCLevel {
+                updates["kyc_level"] = check.Level
+            }
+        }
+        return tx.Model(&models.User{}).Where("uuid = ?", check.UserID).Updates(updates).Error
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to apply verification result: %w", err)
+    }
+
+    return &check, nil
+}
+
+// SetLevel sets a user's level directly, e.g. after a manual review
+func (s *KYCService) SetLevel(userID uuid.UUID, level int) error {
+    if _, ok := s.Limits[level]; !ok {
+        return fmt.Errorf("unknown KYC level %d", level)
+    }
+
+    status := models.KYCStatusApproved
+    if level == 0 {
+        status = models.KYCStatusNone
+    }
+    result := s.DB.Model(&models.User{}).Where("uuid = ?", userID).Updates(map[string]interface{}{
+        "kyc_level":  level,
+        "kyc_status": status,
+    })
+    if result.Error != nil {
+        return fmt.Errorf("failed to update KYC level: %w", result.Error)
+    }
+    if result.RowsAffected == 0 {
+        return fmt.Errorf("user not found")
+    }
+    return nil
+}
+
+// Status reports the user's level, limits, usage and latest verification.
+// idrPerUSD converts IDR purchases to USD.
+func (s *KYCService) Status(user *models.User, idrPerUSD float64) (*KYCStatus, error) {
+    usage, err := s.Usage(user.UUID, idrPerUSD)
+    if err != nil {
+        return nil, err
+    }
+
+    status := &KYCStatus{
+        Level:  user.KYCLevel,
+        Status: user.KYCStatus,
+        Limits: s.limitsFor(user.KYCLevel),
+        Usage:  *usage,
+    }
+    if next, ok := s.nextLevel(user.KYCLevel); ok {
+        nextLimits := s.Limits[next]
+        status.NextLevel = &next
+        status.NextLimits = &nextLimits
+    }
+
+    var check models.KYCCheck
+    if err := s.DB.Where("user_id = ?", user.UUID).Order("created_at DESC").First(&check).Error; err == nil {
+        status.LastCheck = &check
+        if check.Documents != "" {
+            json.Unmarshal([]byte(check.Documents), &status.Documents)
+        }
+    }
+
+    return status, nil
+}
+
+// CheckPurchase returns ErrKYCLimitExceeded when the purchase would take its user over a limit
+// of their KYC level. It runs in the database transaction that saves the purchase, after the
+// insert: the user's row is locked so concurrent purchases are checked one after another, and
+// the purchase itself is left out of the usage it is added to. idrPerUSD converts IDR amounts.
+func (s *KYCService) CheckPurchase(tx *gorm.DB, transaction *models.Transaction, idrPerUSD float64) error {
+    var user models.User
+    if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("uuid", "kyc_level").
+        Where("uuid = ?", transaction.UserID).First(&user).Error; err != nil {
+        return fmt.Errorf("user not found")
+    }
+
+    usdAmount := transaction.FiatAmount
+    if strings.EqualFold(transaction.FiatCurrency, "idr") {
+        usdAmount = transaction.FiatAmount / idrPerUSD
+    }
+
+    usage, err := s.usage(tx, transaction.UserID, idrPerUSD, transaction.UUID)
+    if err != nil {
+        return err
+    }
+
+    return s.checkLimits(user.KYCLevel, usage, usdAmount)
+}
+
+// checkLimits returns ErrKYCLimitExceeded when spending usdAmount on top of the usage breaks a
+// limit of the level
+func (s *KYCService) checkLimits(level int, usage *KYCUsage, usdAmount float64) error {
+    limits := s.limitsFor(level)
+    windows := []struct {
+        name  string
+        used  float64
+        limit float64
+    }{
+        {"daily", usage.Daily, limits.Daily},
+        {"monthly", usage.Monthly, limits.Monthly},
+        {"lifetime", usage.Lifetime, limits.Lifetime},
+    }
+    for _, w := range windows {
+        if w.limit > 0 && w.used+usdAmount > w.limit {
+            detail := fmt.Sprintf("the %s limit of KYC level %d is $%.2f and $%.2f is left", w.name, level, w.limit, max(w.limit-w.used, 0))
+            if next, ok := s.nextLevel(level); ok {
+                detail += fmt.Sprintf(", verify for level %d to raise it", next)
+            }
+            return fmt.Errorf("%w: %s", ErrKYCLimitExceeded, detail)
+        }
+    }
+
+    return nil
+}
+
+// Usage sums the user's purchases in USD over the limit windows. Completed and processing
+// purchases count, and so do pending ones from the last day that may still be paid.
+func (s *KYCService) Usage(userID uuid.UUID, idrPerUSD float64) (*KYCUsage, error) {
+    return s.usage(s.DB, userID, idrPerUSD, uuid.Nil)
+}
+
+// usage sums the user's purchases over the limit windows through db, leaving out one transaction
+func (s *KYCService) usage(db *gorm.DB, userID uuid.UUID, idrPerUSD float64, exclude uuid.UUID) (*KYCUsage, error) {
+    now := time.Now()
+    day, err := s.spent(db, userID, now.Add(-24*time.Hour), idrPerUSD, exclude)
+    if err != nil {
+        return nil, err
+    }
+    month, err := s.spent(db, userID, now.AddDate(0, 0, -30), idrPerUSD, exclude)
+    if err != nil {
+        return nil, err
+    }
+    lifetime, err := s.spent(db, userID, time.Time{}, idrPerUSD, exclude)
+    if err != nil {
+        return nil, err
+    }
+
+    return &KYCUsage{Daily: day, Monthly: month, Lifetime: lifetime}, nil
+}
+
+// spent sums the user's purchases since the given time in USD
+func (s *KYCService) spent(db *gorm.DB, userID uuid.UUID, since time.Time, idrPerUSD float64, exclude uuid.UUID) (float64, error) {
+    var rows []struct {
+        Currency string
+        Total    float64
+    }
+    err := db.Model(&models.Transaction{}).
+        Select("UPPER(fiat_currency) AS currency, COALESCE(SUM(fiat_amount), 0) AS total").
+        Where("user_id = ? AND created_at >= ? AND uuid <> ?", userID, since, exclude).
+        Where("(status IN ? OR (status = ? AND created_at > ?))",
+            []string{models.TransactionStatusCompleted, models.TransactionStatusProcessing},
+            models.TransactionStatusPending, time.Now().Add(-24*time.Hour)).
+        Group("UPPER(fiat_currency)").
+        Scan(&rows).Error
+    if err != nil {
+        return 0, fmt.Errorf("failed to sum purchases: %w", err)
+    }
+
+    var total float64
+    for _, row := range rows {
+        switch row.Currency {
+        case "USD":
+            total += row.Total
+        case "IDR":
+            if idrPerUSD > 0 {
+                total += row.Total / idrPerUSD
+            }
+        default:
+            log.Printf("KYC: purchases in %s are not counted towards the limits", row.Currency)
+        }
+    }
+    return total, nil
+}
+
+// limitsFor returns the limits of the highest configured level at or below the user's level
+func (s *KYCService) limitsFor(level int) KYCLimits {
+    limits := s.Limits[s.levels[0]]
+    for _, l := range s.levels {
+        if l <= level {
+            limits = s.Limits[l]
+        }
+    }
+    return limits
+}
+
+// nextLevel returns the lowest configured level above the given one
+func (s *KYCService) nextLevel(level int) (int, bool) {
+    for _, l := range s.levels {
+        if l > level {
+            return l, true
+        }
+    }
+    return 0, false
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+func newTestKYCService(t *testing.T) *KYCService {
+    t.Helper()
+
+    svc, err := NewKYCService(nil, nil, []string{"0=100/500/1000", "2=0/10000/0", "5=0/0/0"})
+    if err != nil {
+        t.Fatalf("NewKYCService: %v", err)
+    }
+    return svc
+}
+
+func TestParseKYCLimits(t *testing.T) {
+    limits, err := ParseKYCLimits([]string{"0=100/500/1000", " 1 = 2000 / 10000 / 25000 "})
+    if err != nil {
+        t.Fatalf("ParseKYCLimits: %v", err)
+    }
+    if limits[1] != (KYCLimits{Daily: 2000, Monthly: 10000, Lifetime: 25000}) {
+        t.Fatalf("unexpected level 1 limits %+v", limits[1])
+    }
+
+    for _, specs := range [][]string{
+        nil,
+        {"0=100/500"},
+        {"0:100/500/1000"},
+        {"-1=100/500/1000"},
+        {"0=100/-5/1000"},
+    } {
+        if _, err := ParseKYCLimits(specs); err == nil {
+            t.Fatalf("expected %q to be rejected", specs)
+        }
+    }
+
+    if _, err := NewKYCService(nil, nil, []string{"1=100/500/1000"}); err == nil {
+        t.Fatal("expected limits without level 0 to be rejected")
+    }
+}
+
+func TestKYCLevelLimits(t *testing.T) {
+    svc := newTestKYCService(t)
+
+    // Unconfigured levels fall back to the highest configured level below them
+    if svc.limitsFor(1) != svc.Limits[0] || svc.limitsFor(3) != svc.Limits[2] || svc.limitsFor(9) != svc.Limits[5] {
+        t.Fatal("levels should use the limits of the highest configured level at or below them")
+    }
+    if next, ok := svc.nextLevel(0); !ok || next != 2 {
+        t.Fatalf("expected level 2 after 0, got %d", next)
+    }
+    if _, ok := svc.nextLevel(5); ok {
+        t.Fatal("expected no level above the highest")
+    }
+
+    cases := []struct {
+        name   string
+        level  int
+        usage  KYCUsage
+        amount float64
+        window string // Empty when the purchase is allowed
+    }{
+        {"within every limit", 0, KYCUsage{Daily: 40, Monthly: 40, Lifetime: 40}, 60, ""},
+        {"over the daily limit", 0, KYCUsage{Daily: 40, Monthly: 40, Lifetime: 40}, 60.01, "daily"},
+        {"over the monthly limit", 0, KYCUsage{Daily: 0, Monthly: 450, Lifetime: 450}, 60, "monthly"},
+        {"over the lifetime limit", 1, KYCUsage{Lifetime: 990}, 20, "lifetime"},
+        {"no daily limit", 2, KYCUsage{Daily: 50000, Monthly: 0}, 9000, ""},
+        {"over the only limit", 2, KYCUsage{Monthly: 9000}, 1500, "monthly"},
+        {"unlimited", 5, KYCUsage{Daily: 1e9, Monthly: 1e9, Lifetime: 1e9}, 1e9, ""},
+    }
+    for _, tc := range cases {
+        usage := tc.usage
+        err := svc.checkLimits(tc.level, &usage, tc.amount)
+        if tc.window == "" {
+            if err != nil {
+                t.Fatalf("%s: unexpected error %v", tc.name, err)
+            }
+            continue
+        }
+        if !errors.Is(err, ErrKYCLimitExceeded) || !strings.Contains(err.Error(), tc.window) {
+            t.Fatalf("%s: expected the %s limit to be exceeded, got %v", tc.name, tc.window, err)
+        }
+    }
+
+    err := svc.checkLimits(0, &KYCUsage{Daily: 100}, 1)
+    if err == nil || !strings.Contains(err.Error(), "verify for level 2") {
+        t.Fatalf("expected the error to point at the next level, got %v", err)
+    }
+}
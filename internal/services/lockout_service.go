@@ -0,0 +1,161 @@
+package services
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "gorm.io/gorm"
+)
+
+// LockoutService tracks failed authentication attempts and locks accounts progressively
+type LockoutService struct {
+    DB              *gorm.DB
+    RecoveryService *RecoveryService
+    MaxAttempts     int           // Failures allowed before the account is locked
+    BaseDuration    time.Duration // Duration of the first lockout, doubled on every further lockout
+    MaxDuration     time.Duration // Upper bound for a single lockout
+    UnlockTokenTTL  time.Duration // How long an emailed unlock token stays valid
+}
+
+// NewLockoutService creates a new lockout service
+func NewLockoutService(db *gorm.DB, recoveryService *RecoveryService, maxAttempts int, baseDuration, unlockTokenTTL time.Duration) *LockoutService {
+    if maxAttempts <= 0 {
+        maxAttempts = 5
+    }
+    if baseDuration <= 0 {
+        baseDuration = 15 * time.Minute
+    }
+    if unlockTokenTTL <= 0 {
+        unlockTokenTTL = time.Hour
+    }
+
+    return &LockoutService{
+        DB:              db,
+        RecoveryService: recoveryService,
+        MaxAttempts:     maxAttempts,
+        BaseDuration:    baseDuration,
+        MaxDuration:     24 * time.Hour,
+        UnlockTokenTTL:  unlockTokenTTL,
+    }
+}
+
+// IsLocked reports whether the account is currently locked and for how much longer
+func (s *LockoutService) IsLocked(user *models.User) (bool, time.Duration) {
+    if user.LockedUntil == nil {
+        return false, 0
+    }
+
+    remaining := time.Until(*user.LockedUntil)
+    if remaining <= 0 {
+        return false, 0
+    }
+
+    return true, remaining
+}
+
+// RegisterFailure records a failed attempt and locks the account once the threshold is reached.
+// It returns the lock expiry when the account has just been locked.
+func (s *LockoutService) RegisterFailure(user *models.User) (*time.Time, error) {
+    result := s.DB.Model(&models.User{}).Where("uuid = ?", user.UUID).
+        UpdateColumn("failed_login_attempts", gorm.Expr("failed_login_attempts + 1"))
+    if result.Error != nil {
+        return nil, fmt.Errorf("failed to record login failure: %w", result.Error)
+    }
+
+    if err := s.DB.Where("uuid = ?", user.UUID).First(user).Error; err != nil {
+        return nil, fmt.Errorf("failed to reload user: %w", err)
+    }
+
+    if user.FailedLoginAttempts < s.MaxAttempts {
+        return nil, nil
+    }
+
+    return s.lock(user)
+}
+
+// RegisterSuccess clears the failure counters after a successful authentication
+func (s *LockoutService) RegisterSuccess(user *models.User) error {
+    if user.FailedLoginAttempts == 0 && user.LockoutCount == 0 && user.LockedUntil == nil {
+        return nil
+    }
+
+    return s.reset(user)
+}
+
+// UnlockWithToken unlocks the account owning the emailed unlock token
+func (s *LockoutService) UnlockWithToken(token string) (*models.User, error) {
+    var user models.User
+    if result := s.DB.Where("unlock_token = ?", hashUnlockToken(token)).First(&user); result.Error != nil {
+        return nil, fmt.Errorf("invalid or expired unlock token")
+    }
+    if user.UnlockTokenExpiresAt == nil || time.Now().After(*user.UnlockTokenExpiresAt) {
+        return nil, fmt.Errorf("invalid or expired unlock token")
+    }
+
+    if err := s.reset(&user); err != nil {
+        return nil, err
+    }
+
+    return &user, nil
+}
+
+// lock locks the account for a duration that grows with each consecutive lockout
+func (s *LockoutService) lock(user *models.User) (*time.Time, error) {
+    duration := s.BaseDuration << uint(user.LockoutCount)
+    if duration > s.MaxDuration || duration <= 0 {
+        duration = s.MaxDuration
+    }
+    lockedUntil := time.Now().Add(duration)
+
+    token, err := s.RecoveryService.GenerateRecoveryToken()
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate unlock token: %w", err)
+    }
+
+    result := s.DB.Model(user).Updates(map[string]interface{}{
+        "failed_login_attempts":   0,
+        "lockout_count":           user.LockoutCount + 1,
+        "locked_until":            lockedUntil,
+        "unlock_token":            hashUnlockToken(token),
+        "unlock_token_expires_at": time.Now().Add(s.UnlockTokenTTL),
+        "updated_at":              time.Now(),
+    })
+    if result.Error != nil {
+        return nil, fmt.Errorf("failed to lock account: %w", result.Error)
+    }
+
+    if user.Email != "" {
+        if err := s.RecoveryService.SendAccountUnlockEmail(user.Email, user.Username, token, lockedUntil); err != nil {
+            log.Printf("Failed to send unlock email to %s: %v", user.Username, err)
+        }
+    }
+
+    return &lockedUntil, nil
+}
+
+// reset clears all lockout state for the user
+func (s *LockoutService) reset(user *models.User) error {
+    result := s.DB.Model(user).Updates(map[string]interface{}{
+        "failed_login_attempts":   0,
+        "lockout_count":           0,
+        "locked_until":            nil,
+        "unlock_token":            "",
+        "unlock_token_expires_at": nil,
+        "updated_at":              time.Now(),
+    })
+    if result.Error != nil {
+        return fmt.Errorf("failed to reset lockout: %w", result.Error)
+    }
+
+    return nil
+}
+
+// hashUnlockToken hashes unlock tokens so they are never stored in plain text
+func hashUnlockToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
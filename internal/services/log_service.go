@@ -84,16 +84,31 @@ func (s *ActivityLoggerService) LogFromRequest(c *gin.Context, action, descripti
     s.DB.Create(&log)
 }
 
-// getClientIP extracts the client IP from the request
-func getClientIP(c *gin.Context) string {
-    // Check for X-Forwarded-For header
-    if xForwardedFor := c.GetHeader("X-Forwarded-For"); xForwardedFor != "" {
-        return xForwardedFor
+// RecordSignIn logs a successful sign-in and reports whether it came from an IP address the user
+// never signed in from before. A user's first sign-in is not reported as new.
+func (s *ActivityLoggerService) RecordSignIn(c *gin.Context, user *models.User) (bool, error) {
+    ipAddress := getClientIP(c)
+
+    var previous, fromIP int64
+    if err := s.DB.Model(&models.ActivityLog{}).Where("user_id = ? AND action = ? AND status = ?", user.UUID, "login", "success").
+        Count(&previous).Error; err != nil {
+        return false, err
     }
-    // Check for X-Real-IP header
-    if xRealIP := c.GetHeader("X-Real-IP"); xRealIP != "" {
-        return xRealIP
+    if previous > 0 {
+        if err := s.DB.Model(&models.ActivityLog{}).Where("user_id = ? AND action = ? AND status = ? AND ip_address = ?", user.UUID, "login", "success", ipAddress).
+            Count(&fromIP).Error; err != nil {
+            return false, err
+        }
+    }
+
+    if err := s.LogUserActivity(c, user.UUID, user.Username, "login", "User successfully logged in", "user", user.Username, "success", ""); err != nil {
+        return false, err
     }
-    // Use RemoteAddr as fallback
+    return previous > 0 && fromIP == 0, nil
+}
+
+// getClientIP extracts the client IP from the request. Forwarding headers are only honoured
+// when they come from one of the router's trusted proxies.
+func getClientIP(c *gin.Context) string {
     return c.ClientIP()
-}
\ No newline at end of file
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+    "context"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "math/big"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum/accounts"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/common/math"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ethereum/go-ethereum/signer/core/apitypes"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// maxSignMessageSize limits the size of a personal_sign message or typed data payload
+const maxSignMessageSize = 16 * 1024
+
+// siweStatement is the line that marks a Sign-In with Ethereum (EIP-4361) message
+const siweStatement = " wants you to sign in with your Ethereum account:"
+
+// MessageSigningService signs personal_sign messages and EIP-712 typed data with custodial keys,
+// shows what is being signed and keeps an audit trail of every signature
+type MessageSigningService struct {
+    DB            *gorm.DB
+    Transfers     *WalletTransferService // Stored keys and the node client
+    TokenRegistry *TokenRegistryService
+    GatewayToken  common.Address // Default token for EIP-2612 permits
+}
+
+// SignRequest is a message to sign
+type SignRequest struct {
+    Method    string          `json:"method" binding:"required"` // personal_sign or eth_signTypedData_v4
+    Message   string          `json:"message"`                   // personal_sign: text, or 0x-prefixed hex bytes
+    TypedData json.RawMessage `json:"typed_data"`                // eth_signTypedData_v4: the full typed data object
+}
+
+// SigningDomain is the EIP-712 domain of typed data
+type SigningDomain struct {
+    Name              string `json:"name,omitempty"`
+    Version           string `json:"version,omitempty"`
+    ChainID           string `json:"chain_id,omitempty"`
+    VerifyingContract string `json:"verifying_contract,omitempty"`
+}
+
+// SigningPreview is the decoded, human-readable form of a message before it is signed
+type SigningPreview struct {
+    Method      string                    `json:"method"`
+    Signer      string                    `json:"signer"`
+    Summary     string                    `json:"summary"`
+    Text        string                    `json:"text,omitempty"` // personal_sign message as text or hex
+    PrimaryType string                    `json:"primary_type,omitempty"`
+    Domain      *SigningDomain            `json:"domain,omitempty"`
+    Fields      []*apitypes.NameValueType `json:"fields,omitempty"`
+    Warnings    []string                  `json:"warnings"`
+    Digest      string                    `json:"digest"` // Hash that will be signed
+}
+
+// SignedMessage is a signature with the preview it was made from
+type SignedMessage struct {
+    Preview   *SigningPreview `json:"preview"`
+    Signature string          `json:"signature"` // 65 bytes, v = 27 or 28
+    V         uint8           `json:"v"`
+    R         string          `json:"r"`
+    S         string          `json:"s"`
+    AuditID   uuid.UUID       `json:"audit_id"`
+}
+
+// NewMessageSigningService creates a new message signing service
+func NewMessageSigningService(db *gorm.DB, transfers *WalletTransferService, tokenRegistry *TokenRegistryService, gatewayToken common.Address) *MessageSigningService {
+    return &MessageSigningService{
+        DB:            db,
+        Transfers:     transfers,
+        TokenRegistry: tokenRegistry,
+        GatewayToken:  gatewayToken,
+    }
+}
+
+// Preview decodes a message for display without signing it
+func (s *MessageSigningService) Preview(ctx context.Context, signer common.Address, req SignRequest) (*SigningPreview, error) {
+    preview, _, _, err := s.prepare(ctx, signer, req)
+    return preview, err
+}
+
+// Sign signs a message with the stored key of the signer and records it in the audit trail
+func (s *MessageSigningService) Sign(ctx context.Context, userID uuid.UUID, signer common.Address, req SignRequest, ipAddress, userAgent string) (*SignedMessage, error) {
+    preview, digest, payload, err := s.prepare(ctx, signer, req)
+    if err != nil {
+        return nil, err
+    }
+
+    privateKey, err := s.Transfers.storedKey(userID, signer)
+    if err != nil {
+        return nil, err
+    }
+
+    signature, err := crypto.Sign(digest, privateKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to sign message: %w", err)
+    }
+    signature[crypto.RecoveryIDOffset] += 27 // Wallet convention for v
+
+    audit := models.MessageSignature{
+        UUID:          uuid.New(),
+        UserID:        userID,
+        WalletAddress: signer.Hex(),
+        Method:        preview.Method,
+        PrimaryType:   preview.PrimaryType,
+        Digest:        preview.Digest,
+        Summary:       preview.Summary,
+        Payload:       payload,
+        Signature:     "0x" + hex.EncodeToString(signature),
+        IPAddress:     ipAddress,
+        UserAgent:     userAgent,
+        CreatedAt:     time.Now(),
+    }
+    if preview.Domain != nil {
+        audit.DomainName = preview.Domain.Name
+        audit.VerifyingContract = preview.Domain.VerifyingContract
+        audit.ChainID = preview.Domain.ChainID
+    }
+
+    if err := s.DB.Create(&audit).Error; err != nil {
+        return nil, fmt.Errorf("failed to record signature: %w", err)
+    }
+
+    return &SignedMessage{
+        Preview:   preview,
+        Signature: audit.Signature,
+        V:         signature[crypto.RecoveryIDOffset],
+        R:         "0x" + hex.EncodeToString(signature[:32]),
+        S:         "0x" + hex.EncodeToString(signature[32:64]),
+        AuditID:   audit.UUID,
+    }, nil
+}
+
+// BuildPermit builds EIP-2612 permit typed data for the token, the gateway token when unset.
+// The domain is checked against the token's DOMAIN_SEPARATOR so the signature is accepted on-chain.
+func (s *MessageSigningService) BuildPermit(ctx context.Context, owner, token, spender common.Address, value *big.Int, deadline time.Time) (json.RawMessage, error) {
+    if token == (common.Address{}) {
+        token = s.GatewayToken
+    }
+    client := s.Transfers.TxBuilder.EthClient
+    opts := &bind.CallOpts{Context: ctx}
+
+    permit, err := blockchain.NewERC20Permit(token, client)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create token contract: %w", err)
+    }
+    nonce, err := permit.Nonces(opts, owner)
+    if err != nil {
+        return nil, fmt.Errorf("token %s does not support EIP-2612 permits", token.Hex())
+    }
+
+    erc20, err := blockchain.NewERC20(token, client)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create token contract: %w", err)
+    }
+    name, err := erc20.Name(opts)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read token name: %w", err)
+    }
+    version, err := permit.Version(opts)
+    if err != nil || version == "" {
+        version = "1" // OpenZeppelin ERC20Permit default
+    }
+
+    chainID, err := client.ChainID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get chain ID: %w", err)
+    }
+
+    typedData := apitypes.TypedData{
+        Types: apitypes.Types{
+            "EIP712Domain": {
+                {Name: "name", Type: "string"},
+                {Name: "version", Type: "string"},
+                {Name: "chainId", Type: "uint256"},
+                {Name: "verifyingContract", Type: "address"},
+            },
+            "Permit": {
+                {Name: "owner", Type: "address"},
+                {Name: "spender", Type: "address"},
+                {Name: "value", Type: "uint256"},
+                {Name: "nonce", Type: "uint256"},
+                {Name: "deadline", Type: "uint256"},
+            },
+        },
+        PrimaryType: "Permit",
+        Domain: apitypes.TypedDataDomain{
+            Name:              name,
+            Version:           version,
+            ChainId:           (*math.HexOrDecimal256)(chainID),
+            VerifyingContract: token.Hex(),
+        },
+        Message: apitypes.TypedDataMessage{
+            "owner":    owner.Hex(),
+            "spender":  spender.Hex(),
+            "value":    value.String(),
+            "nonce":    nonce.String(),
+            "deadline": fmt.Sprintf("%d", deadline.Unix()),
+        },
+    }
+
+    if separator, err := permit.DomainSeparator(opts); err == nil {
+        domainHash, err := typedData.HashStruct("EIP712Domain", typedData.Domain.Map())
+        if err != nil {
+            return nil, fmt.Errorf("failed to hash permit domain: %w", err)
+        }
+        if common.BytesToHash(domainHash) != separator {
+            return nil, fmt.Errorf("permit domain of token %s does not match its DOMAIN_SEPARATOR", token.Hex())
+        }
+    }
+
+    return json.Marshal(typedData)
+}
+
+// ListSignatures returns the user's signature audit trail, newest first
+func (s *MessageSigningService) ListSignatures(userID uuid.UUID, limit, offset int) ([]models.MessageSignature, int64, error) {
+    query := s.DB.Model(&models.MessageSignature{}).Where("user_id = ?", userID)
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count signatures: %w", err)
+    }
+
+    var signatures []models.MessageSignature
+    if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&signatures).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to list signatures: %w", err)
+    }
+
+    return signatures, total, nil
+}
+
+// prepare decodes a sign request into its preview, the digest to sign and the payload to audit
+func (s *MessageSigningService) prepare(ctx context.Context, signer common.Address, req SignRequest) (*SigningPreview, []byte, string, error) {
+    switch req.Method {
+    case models.SignMethodPersonal:
+        return s.preparePersonal(signer, req.Message)
+    case models.SignMethodTypedData:
+        return s.prepareTypedData(ctx, signer, req.TypedData)
+    default:
+        return nil, nil, "", fmt.Errorf("unsupported method %q, use %s or %s", req.Method, models.SignMethodPersonal, models.SignMethodTypedData)
+    }
+}
+
+// preparePersonal decodes a personal_sign message, recognising Sign-In with Ethereum messages
+func (s *MessageSigningService) preparePersonal(signer common.Address, message string) (*SigningPreview, []byte, string, error) {
+    if message == "" {
+        return nil, nil, "", fmt.Errorf("message is required")
+    }
+    if len(message) > maxSignMessageSize {
+        return nil, nil, "", fmt.Errorf("message is larger than %d bytes", maxSignMessageSize)
+    }
+
+    // Wallets pass hex-encoded bytes with a 0x prefix, anything else is signed as text
+    data := []byte(message)
+    if strings.HasPrefix(message, "0x") {
+        if decoded, err := hex.DecodeString(message[2:]); err == nil {
+            data = decoded
+        }
+    }
+
+    digest := accounts.TextHash(data)
+    preview := &SigningPreview{
+        Method:   models.SignMethodPersonal,
+        Signer:   signer.Hex(),
+        Warnings: []string{},
+        Digest:   "0x" + hex.EncodeToString(digest),
+    }
+
+    if !utf8.Valid(data) {
+        preview.Text = "0x" + hex.EncodeToString(data)
+        preview.Summary = fmt.Sprintf("Sign %d bytes of binary data", len(data))
+        preview.Warnings = append(preview.Warnings, "The message is not readable text. Only sign it if you trust the requester.")
+        if len(data) == 32 {
+            preview.Warnings = append(preview.Warnings, "The message looks like a hash, which can authorize actions you cannot see.")
+        }
+        return preview, digest, message, nil
+    }
+
+    preview.Text = string(data)
+    preview.Summary = "Sign a text message"
+    if fields, ok := parseSIWE(preview.Text); ok {
+        preview.Summary = fmt.Sprintf("Sign in to %s", fields["domain"])
+        for _, key := range []string{"domain", "address", "uri", "chain_id", "nonce", "issued_at", "expiration_time"} {
+            if value, ok := fields[key]; ok {
+                preview.Fields = append(preview.Fields, &apitypes.NameValueType{Name: key, Value: value, Typ: "string"})
+            }
+        }
+        if !strings.EqualFold(fields["address"], signer.Hex()) {
+            preview.Warnings = append(preview.Warnings, fmt.Sprintf("The sign-in message is for %s, not this wallet.", fields["address"]))
+        }
+        if expires, ok := fields["expiration_time"]; ok {
+            if expiresAt, err := time.Parse(time.RFC3339, expires); err == nil && expiresAt.Before(time.Now()) {
+                preview.Warnings = append(preview.Warnings, "The sign-in message has expired.")
+            }
+        }
+    }
+
+    return preview, digest, message, nil
+}
+
+// prepareTypedData hashes EIP-712 typed data and describes it, with a readable summary for permits
+func (s *MessageSigningService) prepareTypedData(ctx context.Context, signer common.Address, raw json.RawMessage) (*SigningPreview, []byte, string, error) {
+    if len(raw) == 0 {
+        return nil, nil, "", fmt.Errorf("typed_data is required")
+    }
+    if len(raw) > maxSignMessageSize {
+        return nil, nil, "", fmt.Errorf("typed_data is larger than %d bytes", maxSignMessageSize)
+    }
+
+    // Some dapps pass typed data as a JSON string instead of an object
+    var encoded string
+    if err := json.Unmarshal(raw, &encoded); err == nil {
+        raw = json.RawMessage(encoded)
+    }
+
+    var typedData apitypes.TypedData
+    if err := json.Unmarshal(raw, &typedData); err != nil {
+        return nil, nil, "", fmt.Errorf("invalid typed data: %w", err)
+    }
+    if typedData.PrimaryType == "" || typedData.PrimaryType == "EIP712Domain" {
+        return nil, nil, "", fmt.Errorf("typed data needs a primary type other than EIP712Domain")
+    }
+
+    digest, _, err := apitypes.TypedDataAndHash(typedData)
+    if err != nil {
+        return nil, nil, "", fmt.Errorf("invalid typed data: %w", err)
+    }
+
+    fields, err := typedData.Format()
+    if err != nil {
+        return nil, nil, "", fmt.Errorf("invalid typed data: %w", err)
+    }
+
+    domain := &SigningDomain{
+        Name:              typedData.Domain.Name,
+        Version:           typedData.Domain.Version,
+        VerifyingContract: typedData.Domain.VerifyingContract,
+    }
+    if typedData.Domain.ChainId != nil {
+        domain.ChainID = (*big.Int)(typedData.Domain.ChainId).String()
+    }
+
+    preview := &SigningPreview{
+        Method:      models.SignMethodTypedData,
+        Signer:      signer.Hex(),
+        Summary:     fmt.Sprintf("Sign %s", typedData.PrimaryType),
+        PrimaryType: typedData.PrimaryType,
+        Domain:      domain,
+        Fields:      fields,
+        Warnings:    []string{},
+        Digest:      "0x" + hex.EncodeToString(digest),
+    }
+    if domain.Name != "" {
+        preview.Summary += " for " + domain.Name
+    }
+
+    if chainID, err := s.Transfers.TxBuilder.EthClient.ChainID(ctx); err == nil && domain.ChainID != "" && domain.ChainID != chainID.String() {
+        preview.Warnings = append(preview.Warnings, fmt.Sprintf("The message is for chain %s, not the connected chain %s.", domain.ChainID, chainID))
+    }
+
+    if typedData.PrimaryType == "Permit" {
+        s.describePermit(ctx, signer, &typedData, preview)
+    }
+
+    return preview, digest, string(raw), nil
+}
+
+// describePermit summarises an EIP-2612 permit as the allowance it grants
+func (s *MessageSigningService) describePermit(ctx context.Context, signer common.Address, typedData *apitypes.TypedData, preview *SigningPreview) {
+    spender, _ := typedData.Message["spender"].(string)
+    owner, _ := typedData.Message["owner"].(string)
+    value, ok := typedDataInt(typedData.Message["value"])
+    if spender == "" || !ok {
+        return
+    }
+
+    symbol, decimals := typedData.Domain.VerifyingContract, uint8(18)
+    if token, err := s.TokenRegistry.GetToken(typedData.Domain.VerifyingContract); err == nil {
+        symbol, decimals = token.Symbol, token.Decimals
+    } else if common.IsHexAddress(typedData.Domain.VerifyingContract) {
+        if erc20, err := blockchain.NewERC20(common.HexToAddress(typedData.Domain.VerifyingContract), s.Transfers.TxBuilder.EthClient); err == nil {
+            opts := &bind.CallOpts{Context: ctx}
+            if tokenSymbol, err := erc20.Symbol(opts); err == nil {
+                symbol = tokenSymbol
+            }
+            if tokenDecimals, err := erc20.Decimals(opts); err == nil {
+                decimals = tokenDecimals
+            }
+        }
+    }
+
+    amount := formatUnits(value, decimals)
+    if value.Cmp(unlimitedAllowance) >= 0 {
+        amount = "an unlimited amount of"
+        preview.Warnings = append(preview.Warnings, "The permit grants an unlimited allowance.")
+    }
+    preview.Summary = fmt.Sprintf("Allow %s to spend %s %s", spender, amount, symbol)
+
+    if deadline, ok := typedDataInt(typedData.Message["deadline"]); ok && deadline.IsInt64() {
+        preview.Summary += " until " + time.Unix(deadline.Int64(), 0).UTC().Format(time.RFC3339)
+    }
+
+    if owner != "" && !strings.EqualFold(owner, signer.Hex()) {
+        preview.Warnings = append(preview.Warnings, fmt.Sprintf("The permit owner is %s, not this wallet.", owner))
+    }
+}
+
+// typedDataInt reads an integer typed data value, sent as a decimal or hex string or a JSON number
+func typedDataInt(value interface{}) (*big.Int, bool) {
+    switch v := value.(type) {
+    case string:
+        return new(big.Int).SetString(v, 0)
+    case float64:
+        result, accuracy := big.NewFloat(v).Int(nil)
+        return result, accuracy == big.Exact
+    }
+    return nil, false
+}
+
+// parseSIWE extracts the fields of an EIP-4361 Sign-In with Ethereum message
+func parseSIWE(message string) (map[string]string, bool) {
+    lines := strings.Split(message, "\n")
+    if len(lines) < 2 || !strings.HasSuffix(lines[0], siweStatement) {
+        return nil, false
+    }
+
+    fields := map[string]string{
+        "domain":  strings.TrimSuffix(lines[0], siweStatement),
+        "address": strings.TrimSpace(lines[1]),
+    }
+
+    keys := map[string]string{
+        "URI":             "uri",
+        "Chain ID":        "chain_id",
+        "Nonce":           "nonce",
+        "Issued At":       "issued_at",
+        "Expiration Time": "expiration_time",
+    }
+    for _, line := range lines[2:] {
+        parts := strings.SplitN(line, ": ", 2)
+        if len(parts) != 2 {
+            continue
+        }
+        if key, ok := keys[parts[0]]; ok {
+            fields[key] = strings.TrimSpace(parts[1])
+        }
+    }
+
+    return fields, true
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "math/big"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/ethclient"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// PortfolioService reads the balances of every wallet a user owns for ETH and every
+// registered token and values them in fiat
+type PortfolioService struct {
+    DB            *gorm.DB
+    EthClient     *ethclient.Client
+    PriceService  *PriceService
+    TokenRegistry *TokenRegistryService
+    Multicall     *blockchain.Multicall3
+    erc20ABI      abi.ABI
+}
+
+// PortfolioBalance is one asset held by one wallet
+type PortfolioBalance struct {
+    Symbol    string  `json:"symbol"`
+    Name      string  `json:"name,omitempty"`
+    Address   string  `json:"address,omitempty"` // Empty for ETH
+    Decimals  uint8   `json:"decimals"`
+    LogoURL   string  `json:"logo_url,omitempty"`
+    Balance   string  `json:"balance"`   // Smallest unit
+    Formatted string  `json:"formatted"` // Display unit
+    Priced    bool    `json:"priced"`    // False when no price was available
+    PriceUSD  float64 `json:"price_usd"`
+    ValueUSD  float64 `json:"value_usd"`
+    ValueIDR  float64 `json:"value_idr"`
+    Value     float64 `json:"value"` // In the portfolio currency
+}
+
+// PortfolioWallet is the holdings of one wallet
+type PortfolioWallet struct {
+    Address   string             `json:"address"`
+    Label     string             `json:"label,omitempty"`
+    IsDefault bool               `json:"is_default"`
+    Balances  []PortfolioBalance `json:"balances"`
+    TotalUSD  float64            `json:"total_usd"`
+    TotalIDR  float64            `json:"total_idr"`
+    Total     float64            `json:"total"`
+}
+
+// Portfolio is the holdings of all of a user's wallets
+type Portfolio struct {
+    Currency  string            `json:"currency"`
+    Wallets   []PortfolioWallet `json:"wallets"`
+    TotalUSD  float64           `json:"total_usd"`
+    TotalIDR  float64           `json:"total_idr"`
+    Total     float64           `json:"total"`
+    UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// portfolioAsset is ETH (nil token) or a registered token
+type portfolioAsset struct {
+    token    *models.Token
+    priceUSD float64
+    priced   bool
+}
+
+// NewPortfolioService creates a new portfolio service
+func NewPortfolioService(db *gorm.DB, ethClient *ethclient.Client, priceService *PriceService, tokenRegistry *TokenRegistryService, multicallAddress common.Address) (*PortfolioService, error) {
+    multicall, err := blockchain.NewMulticall3(multicallAddress, ethClient)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialize multicall: %w", err)
+    }
+
+    erc20ABI, err := abi.JSON(strings.NewReader(blockchain.ERC20ABI))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse ERC20 ABI: %w", err)
+    }
+
+    return &PortfolioService{
+        DB:            db,
+        EthClient:     ethClient,
+        PriceService:  priceService,
+        TokenRegistry: tokenRegistry,
+        Multicall:     multicall,
+        erc20ABI:      erc20ABI,
+    }, nil
+}
+
+// GetPortfolio returns the balances and fiat values of all of the user's wallets.
+// Zero balances are left out unless includeZero is set.
+func (s *PortfolioService) GetPortfolio(ctx context.Context, userID uuid.UUID, currency string, includeZero bool) (*Portfolio, error) {
+    currency = strings.ToUpper(strings.TrimSpace(currency))
+    if currency == "" {
+        currency = "USD"
+    }
+
+    wallets, err := s.userWallets(userID)
+    if err != nil {
+        return nil, err
+    }
+
+    tokens, err := s.TokenRegistry.ListTokens(false)
+    if err != nil {
+        return nil, err
+    }
+
+    assets := make([]portfolioAsset, 0, len(tokens)+1)
+    assets = append(assets, portfolioAsset{})
+    for i := range tokens {
+        assets = append(assets, portfolioAsset{token: &tokens[i]})
+    }
+
+    balances, err := s.readBalances(ctx, wallets, assets)
+    if err != nil {
+        return nil, err
+    }
+
+    // Only price assets somebody actually holds
+    held := make([]bool, len(assets))
+    for _, walletBalances := range balances {
+        for j, balance := range walletBalances {
+            if balance != nil && balance.Sign() > 0 {
+                held[j] = true
+            }
+        }
+    }
+    for j := range assets {
+        if held[j] {
+            s.priceAsset(ctx, &assets[j])
+        }
+    }
+
+    idrRate, err := s.PriceService.GetFiatRate(ctx, "IDR")
+    if err != nil {
+        log.Printf("Warning: failed to get IDR rate: %v", err)
+    }
+    currencyRate, err := s.PriceService.GetFiatRate(ctx, currency)
+    if err != nil {
+        return nil, err
+    }
+
+    portfolio := &Portfolio{
+        Currency:  currency,
+        Wallets:   make([]PortfolioWallet, 0, len(wallets)),
+        UpdatedAt: time.Now(),
+    }
+
+    for i, wallet := range wallets {
+        entry := PortfolioWallet{
+            Address:   wallet.WalletAddress,
+            Label:     wallet.Label,
+            IsDefault: wallet.IsDefault,
+            Balances:  []PortfolioBalance{},
+        }
+
+        for j, asset := range assets {
+            balance := balances[i][j]
+            if balance == nil || (balance.Sign() == 0 && !includeZero) {
+                continue
+            }
+
+            item := PortfolioBalance{
+                Symbol:   "ETH",
+                Name:     "Ether",
+                Decimals: 18,
+                Balance:  balance.String(),
+                Priced:   asset.priced,
+                PriceUSD: asset.priceUSD,
+            }
+            if asset.token != nil {
+                item.Symbol = asset.token.Symbol
+                item.Name = asset.token.Name
+                item.Address = asset.token.Address
+                item.Decimals = asset.token.Decimals
+                item.LogoURL = asset.token.LogoURL
+            }
+            item.Formatted = formatUnits(balance, item.Decimals)
+
+            if asset.priced {
+                amount, _ := new(big.Float).Quo(new(big.Float).SetInt(balance),
+                    new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(item.Decimals)), nil))).Float64()
+                item.ValueUSD = amount * asset.priceUSD
+                item.ValueIDR = item.ValueUSD * idrRate
+                item.Value = item.ValueUSD * currencyRate
+            }
+
+            entry.TotalUSD += item.ValueUSD
+            entry.TotalIDR += item.ValueIDR
+            entry.Total += item.Value
+            entry.Balances = append(entry.Balances, item)
+        }
+
+        portfolio.TotalUSD += entry.TotalUSD
+        portfolio.TotalIDR += entry.TotalIDR
+        portfolio.Total += entry.Total
+        portfolio.Wallets = append(portfolio.Wallets, entry)
+    }
+
+    return portfolio, nil
+}
+
+// userWallets returns the user's accounts, plus the primary address when it has no account row
+func (s *PortfolioService) userWallets(userID uuid.UUID) ([]models.Wallet, error) {
+    var wallets []models.Wallet
+    if err := s.DB.Where("user_id = ?", userID).Order("is_default DESC, created_at ASC").Find(&wallets).Error; err != nil {
+        return nil, fmt.Errorf("failed to load wallets: %w", err)
+    }
+
+    var user models.User
+    if err := s.DB.Select("uuid", "wallet_address").Where("uuid = ?", userID).First(&user).Error; err != nil {
+        return nil, fmt.Errorf("user not found")
+    }
+
+    if common.IsHexAddress(user.WalletAddress) {
+        found := false
+        for _, wallet := range wallets {
+            if strings.EqualFold(wallet.WalletAddress, user.WalletAddress) {
+                found = true
+                break
+            }
+        }
+        if !found {
+            wallets = append([]models.Wallet{{UserID: userID, WalletAddress: user.WalletAddress, IsDefault: len(wallets) == 0}}, wallets...)
+        }
+    }
+
+    return wallets, nil
+}
+
+// readBalances reads every asset balance of every wallet, batched through Multicall3.
+// Falls back to one call per balance when the chain has no Multicall3 contract.
+// A nil balance means the read failed.
+func (s *PortfolioService) readBalances(ctx context.Context, wallets []models.Wallet, assets []portfolioAsset) ([][]*big.Int, error) {
+    calls := make([]blockchain.Multicall3Call, 0, len(wallets)*len(assets))
+    for _, wallet := range wallets {
+        owner := common.HexToAddress(wallet.WalletAddress)
+        for _, asset := range assets {
+            call := blockchain.Multicall3Call{AllowFailure: true}
+            var err error
+            if asset.token == nil {
+                call.Target = s.Multicall.Address()
+                call.CallData, err = s.Multicall.PackGetEthBalance(owner)
+            } else {
+                call.Target = common.HexToAddress(asset.token.Address)
+                call.CallData, err = s.erc20ABI.Pack("balanceOf", owner)
+            }
+            if err != nil {
+                return nil, fmt.Errorf("failed to pack balance call: %w", err)
+            }
+            calls = append(calls, call)
+        }
+    }
+
+    results, err := s.Multicall.Aggregate3(ctx, calls)
+    if err != nil {
+        log.Printf("Portfolio: multicall unavailable, reading balances one by one: %v", err)
+        results, err = s.callEach(ctx, wallets, assets, calls)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    balances := make([][]*big.Int, len(wallets))
+    for i := range wallets {
+        balances[i] = make([]*big.Int, len(assets))
+        for j := range assets {
+            result := results[i*len(assets)+j]
+            if !result.Success {
+                continue
+            }
+            if balance, err := blockchain.UnpackUint256(result.ReturnData); err == nil {
+                balances[i][j] = balance
+            }
+        }
+    }
+
+    return balances, nil
+}
+
+// callEach runs the balance calls without Multicall3
+func (s *PortfolioService) callEach(ctx context.Context, wallets []models.Wallet, assets []portfolioAsset, calls []blockchain.Multicall3Call) ([]blockchain.Multicall3Result, error) {
+    results := make([]blockchain.Multicall3Result, len(calls))
+    for i, wallet := range wallets {
+        owner := common.HexToAddress(wallet.WalletAddress)
+        for j, asset := range assets {
+            index := i*len(assets) + j
+            if asset.token == nil {
+                balance, err := s.EthClient.BalanceAt(ctx, owner, nil)
+                if err != nil {
+                    return nil, fmt.Errorf("failed to get ETH balance: %w", err)
+                }
+                results[index] = blockchain.Multicall3Result{Success: true, ReturnData: common.LeftPadBytes(balance.Bytes(), 32)}
+                continue
+            }
+
+            call := calls[index]
+            output, err := s.EthClient.CallContract(ctx, ethereum.CallMsg{To: &call.Target, Data: call.CallData}, nil)
+            results[index] = blockchain.Multicall3Result{Success: err == nil, ReturnData: output}
+        }
+    }
+    return results, nil
+}
+
+// priceAsset looks up the USD price of ETH or a registered token
+func (s *PortfolioService) priceAsset(ctx context.Context, asset *portfolioAsset) {
+    var price float64
+    var err error
+    if asset.token == nil {
+        price, err = s.PriceService.GetEthPriceUSD(ctx)
+    } else {
+        if asset.token.PriceSource == models.TokenPriceSourceNone {
+            return
+        }
+        price, err = s.PriceService.GetTokenPriceUSD(ctx, asset.token)
+    }
+
+    if err != nil {
+        log.Printf("Portfolio: no price: %v", err)
+        return
+    }
+
+    asset.priceUSD = price
+    asset.priced = true
+}
@@ -2,18 +2,50 @@ package services
 
 import (
     "context"
+    "encoding/json"
     "errors"
     "fmt"
+    "math"
     "math/big"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "sync"
     "time"
 
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
     "git.winteraccess.id/walanja/web3-tokensale-be/pkg/ethereum"
     "github.com/ethereum/go-ethereum/common"
 )
 
+// Cache lifetimes for fiat prices and exchange rates
+const (
+    usdPriceCacheTTL = time.Minute
+    fiatRateCacheTTL = 15 * time.Minute
+)
+
+// ErrNoPriceHistory is returned for price sources that only know the current price
+var ErrNoPriceHistory = errors.New("no price history")
+
 type PriceService struct {
     client *ethereum.Client
     uniswap *ethereum.UniswapClient
+
+    // Cached USD prices by CoinGecko id and USD exchange rates by currency
+    mu          sync.Mutex
+    usdPrices   map[string]cachedUSDPrice
+    fiatRates   map[string]float64
+    fiatFetched time.Time
+
+    // Past USD prices by CoinGecko id and hour, these never change
+    pastPrices map[string]float64
+}
+
+// cachedUSDPrice is a USD price with the time it was fetched
+type cachedUSDPrice struct {
+    Price     float64
+    FetchedAt time.Time
 }
 
 const (
@@ -21,7 +53,13 @@ const (
 )
 
 func NewPriceService(client *ethereum.Client, uniswap *ethereum.UniswapClient) *PriceService {
-    return &PriceService{client: client, uniswap: uniswap}
+    return &PriceService{
+        client:     client,
+        uniswap:    uniswap,
+        usdPrices:  make(map[string]cachedUSDPrice),
+        fiatRates:  make(map[string]float64),
+        pastPrices: make(map[string]float64),
+    }
 }
 
 func (ps *PriceService) GetTokenPrice(ctx context.Context, tokenAddress string) (*big.Float, error) {
@@ -171,4 +209,177 @@ func (ps *PriceService) SwapExactETHForTokens(
         to,
         deadline,
     )
-}
\ No newline at end of file
+}
+
+// GetUSDPrice returns the USD price of a CoinGecko coin id
+func (ps *PriceService) GetUSDPrice(ctx context.Context, coinID string) (float64, error) {
+    ps.mu.Lock()
+    cached, ok := ps.usdPrices[coinID]
+    ps.mu.Unlock()
+    if ok && time.Since(cached.FetchedAt) < usdPriceCacheTTL {
+        return cached.Price, nil
+    }
+
+    endpoint := "https://api.coingecko.com/api/v3/simple/price?vs_currencies=usd&ids=" + url.QueryEscape(coinID)
+    var data map[string]map[string]float64
+    if err := getJSON(ctx, endpoint, &data); err != nil {
+        return 0, fmt.Errorf("failed to fetch %s price: %w", coinID, err)
+    }
+
+    price, ok := data[coinID]["usd"]
+    if !ok {
+        return 0, fmt.Errorf("no USD price for %s", coinID)
+    }
+
+    ps.mu.Lock()
+    ps.usdPrices[coinID] = cachedUSDPrice{Price: price, FetchedAt: time.Now()}
+    ps.mu.Unlock()
+
+    return price, nil
+}
+
+// GetEthPriceUSD returns the USD price of ETH
+func (ps *PriceService) GetEthPriceUSD(ctx context.Context) (float64, error) {
+    return ps.GetUSDPrice(ctx, "ethereum")
+}
+
+// GetUSDPriceAt returns the USD price of a CoinGecko coin id closest to the given time. CoinGecko keeps
+// 5 minute prices for the last day, hourly ones for 90 days and daily ones before that.
+func (ps *PriceService) GetUSDPriceAt(ctx context.Context, coinID string, at time.Time) (float64, error) {
+    key := coinID + "/" + at.UTC().Truncate(time.Hour).Format(time.RFC3339)
+    ps.mu.Lock()
+    cached, ok := ps.pastPrices[key]
+    ps.mu.Unlock()
+    if ok {
+        return cached, nil
+    }
+
+    // A day on either side always holds a daily price
+    endpoint := fmt.Sprintf("https://api.coingecko.com/api/v3/coins/%s/market_chart/range?vs_currency=usd&from=%d&to=%d",
+        url.PathEscape(coinID), at.Add(-24*time.Hour).Unix(), at.Add(24*time.Hour).Unix())
+    var data struct {
+        Prices [][2]float64 `json:"prices"` // [unix ms, price]
+    }
+    if err := getJSON(ctx, endpoint, &data); err != nil {
+        return 0, fmt.Errorf("failed to fetch %s price history: %w", coinID, err)
+    }
+
+    target := float64(at.UnixMilli())
+    price, distance := 0.0, math.Inf(1)
+    for _, point := range data.Prices {
+        if d := math.Abs(point[0] - target); d < distance {
+            price, distance = point[1], d
+        }
+    }
+    if math.IsInf(distance, 1) {
+        return 0, fmt.Errorf("no USD price for %s at %s", coinID, at.Format(time.RFC3339))
+    }
+
+    ps.mu.Lock()
+    ps.pastPrices[key] = price
+    ps.mu.Unlock()
+
+    return price, nil
+}
+
+// GetEthPriceUSDAt returns the USD price of ETH closest to the given time
+func (ps *PriceService) GetEthPriceUSDAt(ctx context.Context, at time.Time) (float64, error) {
+    return ps.GetUSDPriceAt(ctx, "ethereum", at)
+}
+
+// GetFiatRate returns how many units of the currency one USD buys
+func (ps *PriceService) GetFiatRate(ctx context.Context, currency string) (float64, error) {
+    currency = strings.ToUpper(currency)
+    if currency == "USD" {
+        return 1, nil
+    }
+
+    ps.mu.Lock()
+    rates, fetched := ps.fiatRates, ps.fiatFetched
+    ps.mu.Unlock()
+
+    // The lock is not held across the request so a slow API does not block other lookups
+    if fetched.IsZero() || time.Since(fetched) >= fiatRateCacheTTL {
+        var data struct {
+            Rates map[string]float64 `json:"rates"`
+        }
+        if err := getJSON(ctx, "https://api.exchangerate-api.com/v4/latest/USD", &data); err != nil {
+            if len(rates) == 0 {
+                return 0, fmt.Errorf("failed to fetch exchange rates: %w", err)
+            }
+            // Keep serving the stale rates until the API is back
+        } else {
+            rates = data.Rates
+            ps.mu.Lock()
+            ps.fiatRates = data.Rates
+            ps.fiatFetched = time.Now()
+            ps.mu.Unlock()
+        }
+    }
+
+    rate, ok := rates[currency]
+    if !ok {
+        return 0, fmt.Errorf("exchange rate not available for currency: %s", currency)
+    }
+    return rate, nil
+}
+
+// GetTokenPriceUSD returns the USD price of a registered token using its price source
+func (ps *PriceService) GetTokenPriceUSD(ctx context.Context, token *models.Token) (float64, error) {
+    switch token.PriceSource {
+    case models.TokenPriceSourceFixed:
+        price, err := strconv.ParseFloat(token.PriceSourceID, 64)
+        if err != nil {
+            return 0, fmt.Errorf("invalid fixed price for %s: %w", token.Symbol, err)
+        }
+        return price, nil
+    case models.TokenPriceSourceCoinGecko:
+        return ps.GetUSDPrice(ctx, token.PriceSourceID)
+    case models.TokenPriceSourceUniswap:
+        priceInEth, err := ps.GetTokenPriceInEth(ctx, common.HexToAddress(token.Address).Hex())
+        if err != nil {
+            return 0, err
+        }
+        ethPrice, err := ps.GetEthPriceUSD(ctx)
+        if err != nil {
+            return 0, err
+        }
+        price, _ := priceInEth.Float64()
+        return price * ethPrice, nil
+    default:
+        return 0, fmt.Errorf("no price source for %s", token.Symbol)
+    }
+}
+
+// GetTokenPriceUSDAt returns the USD price of a registered token at the given time. Uniswap prices
+// are read from the pool's current state, so they have no history and return ErrNoPriceHistory.
+func (ps *PriceService) GetTokenPriceUSDAt(ctx context.Context, token *models.Token, at time.Time) (float64, error) {
+    switch token.PriceSource {
+    case models.TokenPriceSourceCoinGecko:
+        return ps.GetUSDPriceAt(ctx, token.PriceSourceID, at)
+    case models.TokenPriceSourceUniswap:
+        return 0, fmt.Errorf("%w for %s", ErrNoPriceHistory, token.Symbol)
+    default:
+        return ps.GetTokenPriceUSD(ctx, token)
+    }
+}
+
+// getJSON fetches a URL and decodes its JSON body
+func getJSON(ctx context.Context, endpoint string, out interface{}) error {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+    if err != nil {
+        return err
+    }
+
+    resp, err := http.DefaultClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode >= 400 {
+        return fmt.Errorf("status code %d", resp.StatusCode)
+    }
+
+    return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+)
+
+func TestTokenPriceAtTradeTime(t *testing.T) {
+    ps := NewPriceService(nil, nil)
+    at := time.Now().Add(-30 * 24 * time.Hour)
+
+    fixed := &models.Token{Symbol: "USDC", PriceSource: models.TokenPriceSourceFixed, PriceSourceID: "1"}
+    price, err := ps.GetTokenPriceUSDAt(context.Background(), fixed, at)
+    if err != nil || price != 1 {
+        t.Fatalf("expected a fixed price of 1, got %v (%v)", price, err)
+    }
+
+    // Pool prices are only known for now
+    pooled := &models.Token{Symbol: "CIFO", PriceSource: models.TokenPriceSourceUniswap}
+    if _, err := ps.GetTokenPriceUSDAt(context.Background(), pooled, at); !errors.Is(err, ErrNoPriceHistory) {
+        t.Fatalf("expected ErrNoPriceHistory for a Uniswap token, got %v", err)
+    }
+}
@@ -0,0 +1,532 @@
+package services
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrPromoCodeRejected wraps the reason a promo code cannot be used
+var ErrPromoCodeRejected = errors.New("promo code rejected")
+
+// errBonusTaken is returned when another sender already recorded the bonus transfer
+var errBonusTaken = errors.New("promo bonus is already being sent")
+
+// promoBonusBatch is the number of owed bonuses handled per pass
+const promoBonusBatch = 100
+
+// PromoService manages promo codes, prices purchases with them and redeems them. Bonus tokens of
+// gateway purchases are part of the delivered amount; those of swap purchases are sent from the
+// hot wallet, the TokenClient's signer.
+type PromoService struct {
+    DB          *gorm.DB
+    SaleRounds  *SaleRoundService
+    TokenClient *blockchain.TokenClient
+}
+
+// PromoCodeInput holds the fields of a code creation or update; nil fields are left unchanged
+type PromoCodeInput struct {
+    Code           *string    `json:"code"`
+    Type           *string    `json:"type"`
+    Value          *float64   `json:"value"`
+    Currency       *string    `json:"currency"`
+    StartsAt       *time.Time `json:"starts_at"`
+    EndsAt         *time.Time `json:"ends_at"`
+    MaxRedemptions *int       `json:"max_redemptions"`
+    MaxPerUser     *int       `json:"max_per_user"`
+    SaleRound      *string    `json:"sale_round"` // UUID or name, empty for every round
+    Enabled        *bool      `json:"enabled"`
+}
+
+// PromoCodeStatus is a code with how often it is redeemed
+type PromoCodeStatus struct {
+    models.PromoCode
+    Redeemed int64 `json:"redeemed"` // Redemptions of paid purchases and unpaid orders still reserved
+}
+
+// PromoQuote is what a promo code takes off a purchase or adds to it
+type PromoQuote struct {
+    Promo        *models.PromoCode `json:"-"`
+    Code         string            `json:"code"`
+    Type         string            `json:"type"`
+    DiscountFiat float64           `json:"discount_fiat"` // In the purchase currency
+    BonusTokens  float64           `json:"bonus_tokens"`
+    FiatAmount   float64           `json:"fiat_amount"`  // To pay, after the discount
+    TokenAmount  float64           `json:"token_amount"` // To receive, with the bonus
+}
+
+// Apply records the quote on a purchase. Redeem it when saving the purchase.
+func (q *PromoQuote) Apply(transaction *models.Transaction) {
+    if q == nil {
+        return
+    }
+    transaction.PromoCodeID = &q.Promo.UUID
+    transaction.PromoCode = q.Promo.Code
+    transaction.DiscountFiat = q.DiscountFiat
+    transaction.BonusTokens = q.BonusTokens
+}
+
+// NewPromoService creates a new promo code service
+func NewPromoService(db *gorm.DB, saleRounds *SaleRoundService, tokenClient *blockchain.TokenClient) *PromoService {
+    return &PromoService{
+        DB:          db,
+        SaleRounds:  saleRounds,
+        TokenClient: tokenClient,
+    }
+}
+
+// ListCodes returns every code with its redemption count, newest first
+func (s *PromoService) ListCodes() ([]PromoCodeStatus, error) {
+    var codes []models.PromoCode
+    if err := s.DB.Order("created_at DESC").Find(&codes).Error; err != nil {
+        return nil, fmt.Errorf("failed to list promo codes: %w", err)
+    }
+
+    statuses := make([]PromoCodeStatus, 0, len(codes))
+    for _, code := range codes {
+        redeemed, err := s.countRedemptions(s.DB, code.UUID, nil, uuid.Nil)
+        if err != nil {
+            return nil, err
+        }
+        statuses = append(statuses, PromoCodeStatus{PromoCode: code, Redeemed: redeemed})
+    }
+    return statuses, nil
+}
+
+// GetCode finds a code by UUID or code
+func (s *PromoService) GetCode(id string) (*models.PromoCode, error) {
+    var promo models.PromoCode
+    var err error
+    if promoID, parseErr := uuid.Parse(id); parseErr == nil {
+        err = s.DB.Where("uuid = ?", promoID).First(&promo).Error
+    } else {
+        err = s.DB.Where("code = ?", strings.ToUpper(strings.TrimSpace(id))).First(&promo).Error
+    }
+
+    if err != nil {
+        return nil, fmt.Errorf("promo code not found")
+    }
+    return &promo, nil
+}
+
+// CreateCode adds a code; code, type and value are required. Codes are single use per user unless
+// max_per_user says otherwise.
+func (s *PromoService) CreateCode(input PromoCodeInput) (*models.PromoCode, error) {
+    if input.Code == nil || input.Type == nil || input.Value == nil {
+        return nil, fmt.Errorf("code, type and value are required")
+    }
+
+    promo := models.PromoCode{
+        UUID:       uuid.New(),
+        MaxPerUser: 1,
+        Enabled:    true,
+        CreatedAt:  time.Now(),
+        UpdatedAt:  time.Now(),
+    }
+    if err := s.applyInput(&promo, input); err != nil {
+        return nil, err
+    }
+
+    var count int64
+    if err := s.DB.Model(&models.PromoCode{}).Where("code = ?", promo.Code).Count(&count).Error; err != nil {
+        return nil, fmt.Errorf("failed to check promo code: %w", err)
+    }
+    if count > 0 {
+        return nil, fmt.Errorf("promo code %s already exists", promo.Code)
+    }
+
+    if err := s.DB.Create(&promo).Error; err != nil {
+        return nil, fmt.Errorf("failed to create promo code: %w", err)
+    }
+
+    return &promo, nil
+}
+
+// UpdateCode changes a code's terms, window, limits or enabled flag
+func (s *PromoService) UpdateCode(id string, input PromoCodeInput) (*models.PromoCode, error) {
+    promo, err := s.GetCode(id)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := s.applyInput(promo, input); err != nil {
+        return nil, err
+    }
+    promo.UpdatedAt = time.Now()
+
+    if err := s.DB.Save(promo).Error; err != nil {
+        return nil, fmt.Errorf("failed to update promo code: %w", err)
+    }
+
+    return promo, nil
+}
+
+// Quote prices a purchase of tokenAmount tokens for fiatAmount with the code. Without a user the
+// per-user limit and first purchase condition are not checked.
+func (s *PromoService) Quote(code string, userID *uuid.UUID, fiatAmount float64, fiatCurrency string, idrPerUSD, tokenAmount float64) (*PromoQuote, error) {
+    var promo models.PromoCode
+    if err := s.DB.Where("code = ?", strings.ToUpper(strings.TrimSpace(code))).First(&promo).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, fmt.Errorf("%w: unknown promo code", ErrPromoCodeRejected)
+        }
+        return nil, fmt.Errorf("failed to load promo code: %w", err)
+    }
+
+    round, err := s.SaleRounds.ActiveRound()
+    if err != nil {
+        return nil, err
+    }
+    var roundID *uuid.UUID
+    if round != nil {
+        roundID = &round.UUID
+    }
+    if err := s.validate(s.DB, &promo, userID, roundID, uuid.Nil); err != nil {
+        return nil, err
+    }
+
+    quote := &PromoQuote{
+        Promo:       &promo,
+        Code:        promo.Code,
+        Type:        promo.Type,
+        FiatAmount:  fiatAmount,
+        TokenAmount: tokenAmount,
+    }
+    if promo.IsBonus() {
+        quote.BonusTokens = tokenAmount * promo.Value / 100
+        quote.TokenAmount += quote.BonusTokens
+        return quote, nil
+    }
+
+    discount := promo.Value
+    switch {
+    case strings.EqualFold(promo.Currency, fiatCurrency):
+    case strings.EqualFold(promo.Currency, "usd"):
+        discount = promo.Value * idrPerUSD
+    default:
+        discount = promo.Value / idrPerUSD
+    }
+    if discount >= fiatAmount {
+        return nil, fmt.Errorf("%w: the purchase must be worth more than the %g %s discount", ErrPromoCodeRejected, promo.Value, promo.Currency)
+    }
+    quote.DiscountFiat = discount
+    quote.FiatAmount -= discount
+
+    return quote, nil
+}
+
+// Redeem records the promo code of a purchase within the caller's database transaction, after the
+// transaction row is created. The code row stays locked until the caller commits, so concurrent
+// purchases cannot go over its limits.
+func (s *PromoService) Redeem(tx *gorm.DB, transaction *models.Transaction) error {
+    if transaction.PromoCodeID == nil {
+        return nil
+    }
+
+    var promo models.PromoCode
+    if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", *transaction.PromoCodeID).First(&promo).Error; err != nil {
+        return fmt.Errorf("%w: unknown promo code", ErrPromoCodeRejected)
+    }
+    if err := s.validate(tx, &promo, &transaction.UserID, transaction.SaleRoundID, transaction.UUID); err != nil {
+        return err
+    }
+
+    redemption := models.PromoRedemption{
+        UUID:          uuid.New(),
+        PromoCodeID:   promo.UUID,
+        UserID:        transaction.UserID,
+        TransactionID: transaction.UUID,
+        DiscountFiat:  transaction.DiscountFiat,
+        BonusTokens:   transaction.BonusTokens,
+        CreatedAt:     time.Now(),
+    }
+    if err := tx.Create(&redemption).Error; err != nil {
+        return fmt.Errorf("failed to redeem promo code: %w", err)
+    }
+    return nil
+}
+
+// MarkBonusOwed sets a swap purchase with bonus tokens to owe them. Call it before saving the
+// completed purchase, so the bonus is retried when DeliverBonus does not get to send it.
+func (s *PromoService) MarkBonusOwed(transaction *models.Transaction) {
+    if transaction.BonusTokens > 0 && transaction.BonusStatus == "" {
+        transaction.BonusStatus = models.BonusStatusPending
+    }
+}
+
+// DeliverBonus sends the bonus tokens a swap purchase owes, which the swap itself does not buy. A bonus
+// that could not be sent stays pending and is retried by Run, as is the receipt of one not confirmed yet.
+func (s *PromoService) DeliverBonus(transaction *models.Transaction) error {
+    if transaction.BonusStatus != models.BonusStatusPending || transaction.BonusTxHash != "" {
+        return nil
+    }
+    if s.TokenClient == nil {
+        return fmt.Errorf("promo bonus delivery is not enabled")
+    }
+
+    txHash, outcome, err := sendBookedTransfer(s.TokenClient, common.HexToAddress(transaction.WalletAddress), transaction.BonusInWei(), func(txHash string) error {
+        // Only one sender gets to record a hash, so the bonus is never sent twice
+        result := s.DB.Model(&models.Transaction{}).
+            Where("uuid = ? AND bonus_status = ? AND (bonus_tx_hash = '' OR bonus_tx_hash IS NULL)", transaction.UUID, models.BonusStatusPending).
+            Updates(map[string]interface{}{"bonus_tx_hash": txHash, "bonus_sent_at": time.Now()})
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 {
+            return errBonusTaken
+        }
+        return nil
+    })
+    if errors.Is(err, errBonusTaken) {
+        return nil
+    }
+    transaction.BonusTxHash = txHash
+    if dbErr := s.settleBonus(transaction, outcome, err); dbErr != nil {
+        return fmt.Errorf("failed to record promo bonus: %w", dbErr)
+    }
+    if err != nil {
+        return fmt.Errorf("failed to send promo bonus: %w", err)
+    }
+    return nil
+}
+
+// Run retries owed bonuses and checks the receipts of sent ones at the given interval until the process exits
+func (s *PromoService) Run(interval time.Duration) {
+    if s.TokenClient == nil {
+        return
+    }
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        ctx, cancel := context.WithTimeout(context.Background(), interval)
+        if err := s.RetryBonuses(ctx); err != nil {
+            log.Printf("Promo bonuses: %v", err)
+        }
+        cancel()
+    }
+}
+
+// RetryBonuses settles sent bonuses from their receipts and sends the ones that are owed again. A bonus
+// transfer that reverted or was dropped is sent again.
+func (s *PromoService) RetryBonuses(ctx context.Context) error {
+    var transactions []models.Transaction
+    err := s.DB.Where("bonus_status = ? AND ((bonus_tx_hash = '' OR bonus_tx_hash IS NULL) OR bonus_sent_at < ?)",
+        models.BonusStatusPending, time.Now().Add(-bookedTransferTimeout)).
+        Order("updated_at").Limit(promoBonusBatch).Find(&transactions).Error
+    if err != nil {
+        return fmt.Errorf("failed to list owed bonuses: %w", err)
+    }
+
+    for i := range transactions {
+        if ctx.Err() != nil {
+            break
+        }
+        transaction := &transactions[i]
+
+        if transaction.BonusTxHash == "" {
+            if err := s.DeliverBonus(transaction); err != nil {
+                log.Printf("Promo bonuses: %s: %v", transaction.PaymentID, err)
+            }
+            continue
+        }
+
+        sentAt := transaction.UpdatedAt
+        if transaction.BonusSentAt != nil {
+            sentAt = *transaction.BonusSentAt
+        }
+        outcome, err := checkBookedTransfer(ctx, s.TokenClient, transaction.BonusTxHash, sentAt)
+        if err != nil {
+            log.Printf("Promo bonuses: failed to check %s: %v", transaction.PaymentID, err)
+            continue
+        }
+        if outcome == transferPending {
+            continue
+        }
+        var reason error
+        if outcome == transferFailed {
+            reason = fmt.Errorf("transfer %s reverted or was dropped", transaction.BonusTxHash)
+        }
+        if err := s.settleBonus(transaction, outcome, reason); err != nil {
+            log.Printf("Promo bonuses: failed to update %s: %v", transaction.PaymentID, err)
+        }
+    }
+
+    return nil
+}
+
+// settleBonus records the outcome of a bonus transfer. A bonus that was not sent stays owed with its
+// hash cleared, so the next pass sends it again. A transfer settled meanwhile is left alone.
+func (s *PromoService) settleBonus(transaction *models.Transaction, outcome transferOutcome, transferErr error) error {
+    sentHash := transaction.BonusTxHash
+    if transferErr != nil {
+        transaction.BonusError = transferErr.Error()
+    }
+    switch outcome {
+    case transferCompleted:
+        transaction.BonusStatus = models.BonusStatusCompleted
+        transaction.BonusError = ""
+    case transferFailed:
+        transaction.BonusTxHash = ""
+        transaction.BonusSentAt = nil
+    }
+
+    query := s.DB.Model(&models.Transaction{}).Where("uuid = ? AND bonus_status = ?", transaction.UUID, models.BonusStatusPending)
+    if sentHash != "" {
+        query = query.Where("bonus_tx_hash = ?", sentHash)
+    }
+    return query.Updates(map[string]interface{}{
+        "bonus_status":  transaction.BonusStatus,
+        "bonus_tx_hash": transaction.BonusTxHash,
+        "bonus_sent_at": transaction.BonusSentAt,
+        "bonus_error":   transaction.BonusError,
+    }).Error
+}
+
+// validate checks the code's window, round and limits for a purchase, leaving out the given
+// transaction's own redemption
+func (s *PromoService) validate(db *gorm.DB, promo *models.PromoCode, userID, roundID *uuid.UUID, except uuid.UUID) error {
+    now := time.Now()
+    switch {
+    case !promo.Enabled:
+        return fmt.Errorf("%w: %s is not active", ErrPromoCodeRejected, promo.Code)
+    case promo.StartsAt != nil && now.Before(*promo.StartsAt):
+        return fmt.Errorf("%w: %s is valid from %s", ErrPromoCodeRejected, promo.Code, promo.StartsAt.Format(time.RFC3339))
+    case promo.EndsAt != nil && !now.Before(*promo.EndsAt):
+        return fmt.Errorf("%w: %s has expired", ErrPromoCodeRejected, promo.Code)
+    case promo.SaleRoundID != nil && (roundID == nil || *roundID != *promo.SaleRoundID):
+        return fmt.Errorf("%w: %s is not valid in the current sale round", ErrPromoCodeRejected, promo.Code)
+    }
+
+    if promo.MaxRedemptions > 0 {
+        redeemed, err := s.countRedemptions(db, promo.UUID, nil, except)
+        if err != nil {
+            return err
+        }
+        if redeemed >= int64(promo.MaxRedemptions) {
+            return fmt.Errorf("%w: %s has been fully redeemed", ErrPromoCodeRejected, promo.Code)
+        }
+    }
+
+    if userID == nil {
+        return nil
+    }
+
+    if promo.MaxPerUser > 0 {
+        redeemed, err := s.countRedemptions(db, promo.UUID, userID, except)
+        if err != nil {
+            return err
+        }
+        if redeemed >= int64(promo.MaxPerUser) {
+            return fmt.Errorf("%w: you have already used %s", ErrPromoCodeRejected, promo.Code)
+        }
+    }
+
+    if promo.Type == models.PromoTypeFirstPurchaseBonus {
+        var purchases int64
+        if err := s.live(db.Model(&models.Transaction{})).
+            Where("transactions.user_id = ? AND transactions.uuid <> ?", *userID, except).
+            Count(&purchases).Error; err != nil {
+            return fmt.Errorf("failed to count purchases: %w", err)
+        }
+        if purchases > 0 {
+            return fmt.Errorf("%w: %s is only valid on your first purchase", ErrPromoCodeRejected, promo.Code)
+        }
+    }
+
+    return nil
+}
+
+// countRedemptions counts the redemptions of a code, or of a code by one user, whose purchases are
+// paid or still reserved
+func (s *PromoService) countRedemptions(db *gorm.DB, promoID uuid.UUID, userID *uuid.UUID, except uuid.UUID) (int64, error) {
+    query := db.Model(&models.PromoRedemption{}).
+        Joins("JOIN transactions ON transactions.uuid = promo_redemptions.transaction_id").
+        Where("promo_redemptions.promo_code_id = ? AND promo_redemptions.transaction_id <> ?", promoID, except)
+    if userID != nil {
+        query = query.Where("promo_redemptions.user_id = ?", *userID)
+    }
+
+    var count int64
+    if err := s.live(query).Count(&count).Error; err != nil {
+        return 0, fmt.Errorf("failed to count promo redemptions: %w", err)
+    }
+    return count, nil
+}
+
+// live keeps the transactions that are paid or unpaid orders still holding their reservation
+func (s *PromoService) live(query *gorm.DB) *gorm.DB {
+    paid := []string{models.TransactionStatusCompleted, models.TransactionStatusProcessing}
+    return query.Where("(transactions.status IN ? OR (transactions.status = ? AND transactions.created_at > ?))",
+        paid, models.TransactionStatusPending, time.Now().Add(-s.SaleRounds.ReservationTTL))
+}
+
+// applyInput copies the set fields of the input onto the code and validates the result
+func (s *PromoService) applyInput(promo *models.PromoCode, input PromoCodeInput) error {
+    if input.Code != nil {
+        promo.Code = strings.ToUpper(strings.TrimSpace(*input.Code))
+    }
+    if input.Type != nil {
+        promo.Type = *input.Type
+    }
+    if input.Value != nil {
+        promo.Value = *input.Value
+    }
+    if input.Currency != nil {
+        promo.Currency = strings.ToUpper(strings.TrimSpace(*input.Currency))
+    }
+    if input.StartsAt != nil {
+        promo.StartsAt = input.StartsAt
+    }
+    if input.EndsAt != nil {
+        promo.EndsAt = input.EndsAt
+    }
+    if input.MaxRedemptions != nil {
+        promo.MaxRedemptions = *input.MaxRedemptions
+    }
+    if input.MaxPerUser != nil {
+        promo.MaxPerUser = *input.MaxPerUser
+    }
+    if input.SaleRound != nil {
+        promo.SaleRoundID = nil
+        if *input.SaleRound != "" {
+            round, err := s.SaleRounds.GetRound(*input.SaleRound)
+            if err != nil {
+                return err
+            }
+            promo.SaleRoundID = &round.UUID
+        }
+    }
+    if input.Enabled != nil {
+        promo.Enabled = *input.Enabled
+    }
+
+    switch {
+    case promo.Code == "" || strings.ContainsAny(promo.Code, " \t"):
+        return fmt.Errorf("code is required and may not contain spaces")
+    case promo.Type != models.PromoTypePercentBonus && promo.Type != models.PromoTypeFixedDiscount && promo.Type != models.PromoTypeFirstPurchaseBonus:
+        return fmt.Errorf("type must be %s, %s or %s", models.PromoTypePercentBonus, models.PromoTypeFixedDiscount, models.PromoTypeFirstPurchaseBonus)
+    case promo.Value <= 0:
+        return fmt.Errorf("value must be positive")
+    case promo.IsBonus() && promo.Value > 100:
+        return fmt.Errorf("bonus may not exceed 100 percent")
+    case promo.Type == models.PromoTypeFixedDiscount && promo.Currency != "IDR" && promo.Currency != "USD":
+        return fmt.Errorf("currency must be IDR or USD for a fixed discount")
+    case promo.StartsAt != nil && promo.EndsAt != nil && !promo.EndsAt.After(*promo.StartsAt):
+        return fmt.Errorf("ends_at must be after starts_at")
+    case promo.MaxRedemptions < 0 || promo.MaxPerUser < 0:
+        return fmt.Errorf("limits may not be negative")
+    }
+
+    return nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+    "fmt"
+    "log"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "gorm.io/gorm"
+)
+
+// PurchaseEmailService emails buyers when a purchase fails or is refunded. Completed purchases
+// are emailed with their receipt by the invoice service.
+type PurchaseEmailService struct {
+    DB       *gorm.DB
+    Email    *EmailService
+    Lookback time.Duration
+}
+
+// NewPurchaseEmailService creates a new purchase email service
+func NewPurchaseEmailService(db *gorm.DB, emailService *EmailService, cfg config.EmailConfig) *PurchaseEmailService {
+    return &PurchaseEmailService{
+        DB:       db,
+        Email:    emailService,
+        Lookback: cfg.PurchaseLookback,
+    }
+}
+
+// Run checks for purchases to notify every interval
+func (s *PurchaseEmailService) Run(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        if err := s.NotifyStatusChanges(); err != nil {
+            log.Printf("Purchase emails: %v", err)
+        }
+    }
+}
+
+// NotifyStatusChanges emails purchases that failed or were refunded within Lookback and whose
+// buyer was not told about that status yet
+func (s *PurchaseEmailService) NotifyStatusChanges() error {
+    var transactions []models.Transaction
+    err := s.DB.Where("token_amount > 0 AND status IN ? AND COALESCE(notified_status, '') <> status AND updated_at >= ?",
+        []string{models.TransactionStatusFailed, models.TransactionStatusRefunded}, time.Now().Add(-s.Lookback)).
+        Order("updated_at").Limit(emailBatch).Find(&transactions).Error
+    if err != nil {
+        return fmt.Errorf("failed to find purchases to notify: %w", err)
+    }
+
+    for i := range transactions {
+        if err := s.notify(&transactions[i]); err != nil {
+            log.Printf("Purchase emails: %s: %v", transactions[i].PaymentID, err)
+        }
+    }
+    return nil
+}
+
+// notify queues the email for the purchase's status and records it as notified
+func (s *PurchaseEmailService) notify(transaction *models.Transaction) error {
+    var user models.User
+    if err := s.DB.Where("uuid = ?", transaction.UserID).First(&user).Error; err != nil {
+        return fmt.Errorf("failed to find buyer: %w", err)
+    }
+
+    if user.Email != "" {
+        template := EmailTemplatePurchaseFailed
+        if transaction.Status == models.TransactionStatusRefunded {
+            template = EmailTemplatePurchaseRefunded
+        }
+        if err := s.Email.Send(user.Email, user.Username, template, purchaseEmailData(transaction)); err != nil {
+            return err
+        }
+    }
+
+    err := s.DB.Model(&models.Transaction{}).Where("uuid = ?", transaction.UUID).
+        UpdateColumn("notified_status", transaction.Status).Error
+    if err != nil {
+        return fmt.Errorf("failed to mark purchase as notified: %w", err)
+    }
+    return nil
+}
+
+// purchaseEmailData is the template data shared by the purchase emails
+func purchaseEmailData(transaction *models.Transaction) map[string]interface{} {
+    return map[string]interface{}{
+        "PaymentID":     transaction.PaymentID,
+        "Amount":        formatTokens(transaction.TokenAmount),
+        "Symbol":        transaction.TokenSymbol,
+        "FiatAmount":    formatFiat(transaction.FiatAmount),
+        "Currency":      transaction.FiatCurrency,
+        "WalletAddress": transaction.WalletAddress,
+        "TxHash":        transaction.BlockchainTxHash,
+    }
+}
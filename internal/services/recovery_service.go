@@ -7,29 +7,23 @@ import (
 	"time"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
 	"github.com/google/uuid"
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"gorm.io/gorm"
 )
 
 // RecoveryService handles wallet recovery functionality
 type RecoveryService struct {
     DB              *gorm.DB
-    SendGridAPIKey  string
+    Email           *EmailService
     AppURL          string
     RecoveryExpiry  time.Duration
-    FromEmail       string
-    FromName        string
 }
 // NewRecoveryService creates a new recovery service
-func NewRecoveryService(db *gorm.DB, sendgridAPIKey, appURL, fromEmail, fromName string) *RecoveryService {
+func NewRecoveryService(db *gorm.DB, emailService *EmailService, appURL string) *RecoveryService {
     return &RecoveryService{
         DB:             db,
-        SendGridAPIKey: sendgridAPIKey,
+        Email:          emailService,
         AppURL:         appURL,
         RecoveryExpiry: 24 * time.Hour,
-        FromEmail:      fromEmail,
-        FromName:       fromName,
     }
 }
 
@@ -77,32 +71,10 @@ func (s *RecoveryService) RequestRecovery(email string, keystoreJSON []byte) err
 }
 
 // SendRecoveryEmail sends a recovery link to the user's email
-
 func (s *RecoveryService) SendRecoveryEmail(to, username, token string) error {
-    from := mail.NewEmail(s.FromName, s.FromEmail)
-    subject := "Your Wallet Recovery Link"
-    toEmail := mail.NewEmail(username, to)
-    
-    recoveryLink := fmt.Sprintf("%s/recover?token=%s", s.AppURL, token)
-    
-    plainTextContent := fmt.Sprintf("Hello %s,\n\nYou requested to recover your wallet. "+
-        "Click the link below to access your wallet:\n\n%s\n\n"+
-        "This link will expire in 24 hours.\n\n"+
-        "If you did not request this, please ignore this email.\n\n"+
-        "Best regards,\nThe Web3 Tokensale Team", username, recoveryLink)
-    
-    htmlContent := fmt.Sprintf("<h2>Hello %s,</h2>"+
-        "<p>You requested to recover your wallet. Click the button below to access your wallet:</p>"+
-        "<p><a href=\"%s\" style=\"padding: 10px 20px; background-color: #4CAF50; color: white; text-decoration: none; border-radius: 5px;\">Recover My Wallet</a></p>"+
-        "<p>Or copy this link: <a href=\"%s\">%s</a></p>"+
-        "<p>This link will expire in 24 hours.</p>"+
-        "<p>If you did not request this, please ignore this email.</p>"+
-        "<p>Best regards,<br>The Web3 Tokensale Team</p>", username, recoveryLink, recoveryLink, recoveryLink)
-    
-    message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
-    client := sendgrid.NewSendClient(s.SendGridAPIKey)
-    _, err := client.Send(message)
-    return err
+    return s.Email.Send(to, username, EmailTemplateWalletRecovery, map[string]interface{}{
+        "Link": fmt.Sprintf("%s/recover?token=%s", s.AppURL, token),
+    })
 }
 
 // VerifyRecoveryToken validates and processes a recovery token
@@ -127,37 +99,38 @@ func (s *RecoveryService) VerifyRecoveryToken(token string) ([]byte, error) {
 }
 
 
+// SendRecoveryFAEmail sends a 2FA recovery code to the user's email
 func (s *RecoveryService) SendRecoveryFAEmail(to, username, code string) error {
-    from := mail.NewEmail(s.FromName, s.FromEmail)
-    subject := "2FA Recovery Code"
-    toEmail := mail.NewEmail(username, to)
-    
-    plainTextContent := fmt.Sprintf("Hello %s,\n\n"+
-        "You requested to recover your Two-Factor Authentication (2FA).\n\n"+
-        "Your recovery code is: %s\n\n"+
-        "This code will expire in 30 minutes.\n\n"+
-        "If you didn't request this recovery, please ignore this email or contact support immediately.\n\n"+
-        "Best regards,\nThe Web3 Tokensale Team", username, code)
-    
-    htmlContent := fmt.Sprintf("<h2>Hello %s,</h2>"+
-        "<p>We received a request to recover your Two-Factor Authentication (2FA).</p>"+
-        "<p>Your recovery code is: <strong style=\"font-size: 18px; letter-spacing: 2px; background: #f8f9fa; padding: 5px 10px; border-radius: 3px;\">%s</strong></p>"+
-        "<p style=\"color: #e74c3c; font-weight: bold;\">This code will expire in 30 minutes.</p>"+
-        "<p>If you didn't request this recovery, please ignore this email or contact support immediately.</p>"+
-        "<p style=\"margin-top: 20px; font-size: 12px; color: #7f8c8d;\">This is an automated message, please do not reply.</p>",
-        username, code)
-    
-    message := mail.NewSingleEmail(from, subject, toEmail, plainTextContent, htmlContent)
-    client := sendgrid.NewSendClient(s.SendGridAPIKey)
-    response, err := client.Send(message)
-    
-    if err != nil {
-        return fmt.Errorf("failed to send recovery email: %w", err)
-    }
-    
-    if response.StatusCode >= 400 {
-        return fmt.Errorf("failed to send recovery email: status code %d", response.StatusCode)
-    }
-    
-    return nil
-}
\ No newline at end of file
+    return s.Email.Send(to, username, EmailTemplate2FARecovery, map[string]interface{}{
+        "Code": code,
+    })
+}
+
+// SendAccountUnlockEmail notifies the user that their account was locked and sends an unlock link
+func (s *RecoveryService) SendAccountUnlockEmail(to, username, token string, lockedUntil time.Time) error {
+    return s.Email.Send(to, username, EmailTemplateAccountLocked, map[string]interface{}{
+        "Link":  fmt.Sprintf("%s/unlock?token=%s", s.AppURL, token),
+        "Until": lockedUntil.UTC().Format("2006-01-02 15:04 MST"),
+    })
+}
+
+// SendWalletShareEmail delivers one Shamir share of a wallet backup
+func (s *RecoveryService) SendWalletShareEmail(to, username, walletAddress, share string, index, threshold, total int) error {
+    return s.Email.Send(to, username, EmailTemplateWalletShare, map[string]interface{}{
+        "WalletAddress": walletAddress,
+        "Share":         share,
+        "Index":         index,
+        "Threshold":     threshold,
+        "Total":         total,
+    })
+}
+
+// SendDepositEmail tells a user that a deposit to their wallet was confirmed
+func (s *RecoveryService) SendDepositEmail(to, username, walletAddress, amount, symbol, txHash string) error {
+    return s.Email.Send(to, username, EmailTemplateDepositReceived, map[string]interface{}{
+        "WalletAddress": walletAddress,
+        "Amount":        amount,
+        "Symbol":        symbol,
+        "TxHash":        txHash,
+    })
+}
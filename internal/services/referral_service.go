@@ -0,0 +1,663 @@
+package services
+
+import (
+    "context"
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrInvalidReferralCode is returned when a user signs up with a code nobody owns
+var ErrInvalidReferralCode = errors.New("invalid referral code")
+
+const (
+    referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // No 0/O or 1/I lookalikes
+    referralCodeLength   = 8
+    referralCreditBatch  = 200 // Purchases credited per pass
+)
+
+// ReferralTier is the commission rate once a referrer has brought in MinBuyers referred buyers
+type ReferralTier struct {
+    MinBuyers int `json:"min_buyers"`
+    RateBps   int `json:"rate_bps"`
+}
+
+// ReferralSummary is a user's referral code, tier and commission balance, amounts are in tokens
+type ReferralSummary struct {
+    Code      string        `json:"code"`
+    Link      string        `json:"link"`
+    Referees  int64         `json:"referees"` // Users signed up with the code
+    Buyers    int64         `json:"buyers"`   // Referees with a credited purchase
+    Tier      ReferralTier  `json:"tier"`
+    NextTier  *ReferralTier `json:"next_tier,omitempty"`
+    Balance   float64       `json:"balance"` // Accrued, not paid out yet
+    Paid      float64       `json:"paid"`    // Includes payouts still being sent
+    MinPayout float64       `json:"min_payout"`
+}
+
+// ReferralService credits referrers with a commission on the completed purchases of the users they
+// referred and pays the balances out in the token from the hot wallet, the TokenClient's signer
+type ReferralService struct {
+    DB              *gorm.DB
+    TokenClient     *blockchain.TokenClient
+    Tiers           []ReferralTier // Ascending by MinBuyers
+    MaxPerPurchase  float64        // 0 = no cap
+    MaxPerReferrer  float64        // 0 = no cap
+    MinPayout       float64
+    PayoutBatchSize int
+    PayoutInterval  time.Duration // 0 = payouts only when an admin asks
+    AppURL          string
+}
+
+// NewReferralService creates a new referral service
+func NewReferralService(db *gorm.DB, tokenClient *blockchain.TokenClient, cfg config.ReferralConfig, appURL string) (*ReferralService, error) {
+    tiers, err := ParseReferralTiers(cfg.TiersBps)
+    if err != nil {
+        return nil, err
+    }
+
+    return &ReferralService{
+        DB:              db,
+        TokenClient:     tokenClient,
+        Tiers:           tiers,
+        MaxPerPurchase:  float64(cfg.MaxPerPurchase),
+        MaxPerReferrer:  float64(cfg.MaxPerReferrer),
+        MinPayout:       float64(cfg.MinPayout),
+        PayoutBatchSize: max(cfg.PayoutBatchSize, 1),
+        PayoutInterval:  cfg.PayoutInterval,
+        AppURL:          strings.TrimRight(appURL, "/"),
+    }, nil
+}
+
+// ParseReferralTiers parses tiers written as buyers=rate in basis points, a tier for 0 buyers is required
+func ParseReferralTiers(specs []string) ([]ReferralTier, error) {
+    tiers := make([]ReferralTier, 0, len(specs))
+    seen := make(map[int]bool)
+    for _, spec := range specs {
+        buyersStr, rateStr, ok := strings.Cut(spec, "=")
+        if !ok {
+            return nil, fmt.Errorf("invalid referral tier %q, expected buyers=rate_bps", spec)
+        }
+        buyers, err := strconv.Atoi(strings.TrimSpace(buyersStr))
+        if err != nil || buyers < 0 || seen[buyers] {
+            return nil, fmt.Errorf("invalid buyer count in referral tier %q", spec)
+        }
+        rate, err := strconv.Atoi(strings.TrimSpace(rateStr))
+        if err != nil || rate < 0 || rate > 10000 {
+            return nil, fmt.Errorf("invalid rate in referral tier %q", spec)
+        }
+        seen[buyers] = true
+        tiers = append(tiers, ReferralTier{MinBuyers: buyers, RateBps: rate})
+    }
+
+    sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinBuyers < tiers[j].MinBuyers })
+    if len(tiers) == 0 || tiers[0].MinBuyers != 0 {
+        return nil, fmt.Errorf("referral tiers must include a tier for 0 buyers")
+    }
+    return tiers, nil
+}
+
+// Attribute gives a new user their own referral code and links them to the owner of the code they
+// signed up with, if any. Call before the user is created.
+func (s *ReferralService) Attribute(user *models.User, code, ip string) error {
+    ownCode, err := generateReferralCode()
+    if err != nil {
+        return err
+    }
+    user.ReferralCode = ownCode
+    user.SignupIP = ip
+
+    code = strings.ToUpper(strings.TrimSpace(code))
+    if code == "" {
+        return nil
+    }
+
+    var referrer models.User
+    if err := s.DB.Where("referral_code = ?", code).First(&referrer).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return ErrInvalidReferralCode
+        }
+        return fmt.Errorf("failed to look up referral code: %w", err)
+    }
+    user.ReferredBy = &referrer.UUID
+
+    return nil
+}
+
+// Summary returns the user's referral code, tier and balance, giving accounts from before the
+// referral program a code first
+func (s *ReferralService) Summary(user *models.User) (*ReferralSummary, error) {
+    if err := s.ensureCode(user); err != nil {
+        return nil, err
+    }
+
+    summary := &ReferralSummary{
+        Code:      user.ReferralCode,
+        Link:      s.AppURL + "/register?ref=" + user.ReferralCode,
+        MinPayout: s.MinPayout,
+    }
+    if err := s.DB.Model(&models.User{}).Where("referred_by = ?", user.UUID).Count(&summary.Referees).Error; err != nil {
+        return nil, fmt.Errorf("failed to count referees: %w", err)
+    }
+    buyers, err := s.countBuyers(s.DB, user.UUID, uuid.Nil)
+    if err != nil {
+        return nil, err
+    }
+    summary.Buyers = buyers
+    summary.Tier, summary.NextTier = s.tierFor(buyers)
+
+    var totals []struct {
+        Status string
+        Amount float64
+    }
+    if err := s.DB.Model(&models.ReferralCommission{}).Select("status, COALESCE(SUM(amount), 0) AS amount").
+        Where("referrer_id = ?", user.UUID).Group("status").Scan(&totals).Error; err != nil {
+        return nil, fmt.Errorf("failed to total referral commissions: %w", err)
+    }
+    for _, total := range totals {
+        switch total.Status {
+        case models.ReferralCommissionStatusAccrued:
+            summary.Balance = total.Amount
+        case models.ReferralCommissionStatusPaid:
+            summary.Paid = total.Amount
+        }
+    }
+
+    return summary, nil
+}
+
+// Commissions returns a page of commissions, newest first, and their total count. A nil referrer
+// lists everyone's, an empty status every status.
+func (s *ReferralService) Commissions(referrerID *uuid.UUID, status string, limit, offset int) ([]models.ReferralCommission, int64, error) {
+    query := s.DB.Model(&models.ReferralCommission{})
+    if referrerID != nil {
+        query = query.Where("referrer_id = ?", *referrerID)
+    }
+    if status != "" {
+        query = query.Where("status = ?", status)
+    }
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count referral commissions: %w", err)
+    }
+
+    var commissions []models.ReferralCommission
+    if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&commissions).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to list referral commissions: %w", err)
+    }
+
+    return commissions, total, nil
+}
+
+// Payouts returns a page of payouts, newest first, and their total count. A nil referrer lists everyone's.
+func (s *ReferralService) Payouts(referrerID *uuid.UUID, limit, offset int) ([]models.ReferralPayout, int64, error) {
+    query := s.DB.Model(&models.ReferralPayout{})
+    if referrerID != nil {
+        query = query.Where("referrer_id = ?", *referrerID)
+    }
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count referral payouts: %w", err)
+    }
+
+    var payouts []models.ReferralPayout
+    if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&payouts).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to list referral payouts: %w", err)
+    }
+
+    return payouts, total, nil
+}
+
+// Run credits completed purchases, settles pending payouts and, when a payout interval is set, pays out
+// balances until the process exits
+func (s *ReferralService) Run(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    lastPayout := time.Now()
+    for range ticker.C {
+        if err := s.CreditCommissions(); err != nil {
+            log.Printf("Referrals: %v", err)
+        }
+
+        if s.TokenClient != nil {
+            ctx, cancel := context.WithTimeout(context.Background(), interval)
+            if err := s.ReconcilePayouts(ctx); err != nil {
+                log.Printf("Referrals: %v", err)
+            }
+            cancel()
+        }
+
+        if s.PayoutInterval > 0 && time.Since(lastPayout) >= s.PayoutInterval {
+            lastPayout = time.Now()
+            ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+            if _, err := s.PayOut(ctx); err != nil {
+                log.Printf("Referrals: payout: %v", err)
+            }
+            cancel()
+        }
+    }
+}
+
+// CreditCommissions creates the commissions of completed purchases by referred users that have none
+// yet, and rejects the unpaid commissions of purchases refunded since
+func (s *ReferralService) CreditCommissions() error {
+    var transactions []models.Transaction
+    err := s.DB.Where("status = ? AND token_amount > 0", models.TransactionStatusCompleted).
+        Where("user_id IN (SELECT uuid FROM users WHERE referred_by IS NOT NULL)").
+        Where("NOT EXISTS (SELECT 1 FROM referral_commissions WHERE referral_commissions.transaction_id = transactions.uuid)").
+        Order("created_at").Limit(referralCreditBatch).Find(&transactions).Error
+    if err != nil {
+        return fmt.Errorf("failed to find referred purchases: %w", err)
+    }
+
+    for i := range transactions {
+        if err := s.credit(&transactions[i]); err != nil {
+            log.Printf("Referrals: %s: %v", transactions[i].PaymentID, err)
+        }
+    }
+
+    err = s.DB.Model(&models.ReferralCommission{}).
+        Where("status = ? AND transaction_id IN (SELECT uuid FROM transactions WHERE status = ?)",
+            models.ReferralCommissionStatusAccrued, models.TransactionStatusRefunded).
+        Updates(map[string]interface{}{
+            "status":     models.ReferralCommissionStatusRejected,
+            "reason":     "purchase refunded",
+            "updated_at": time.Now(),
+        }).Error
+    if err != nil {
+        return fmt.Errorf("failed to reject commissions of refunded purchases: %w", err)
+    }
+
+    return nil
+}
+
+// PayOut sends the balances of up to PayoutBatchSize referrers that reached the minimum payout,
+// largest first. A referrer that cannot be paid is logged and skipped.
+func (s *ReferralService) PayOut(ctx context.Context) ([]models.ReferralPayout, error) {
+    if s.TokenClient == nil {
+        return nil, fmt.Errorf("referral payouts are not enabled")
+    }
+
+    var balances []struct {
+        ReferrerID uuid.UUID
+        Amount     float64
+    }
+    err := s.DB.Model(&models.ReferralCommission{}).Select("referrer_id, SUM(amount) AS amount").
+        Where("status = ?", models.ReferralCommissionStatusAccrued).Group("referrer_id").
+        Having("SUM(amount) > 0 AND SUM(amount) >= ?", s.MinPayout).
+        Order("amount DESC").Limit(s.PayoutBatchSize).Scan(&balances).Error
+    if err != nil {
+        return nil, fmt.Errorf("failed to total referral balances: %w", err)
+    }
+
+    payouts := make([]models.ReferralPayout, 0, len(balances))
+    for _, balance := range balances {
+        if ctx.Err() != nil {
+            break
+        }
+        payout, err := s.payOut(balance.ReferrerID)
+        if payout != nil {
+            payouts = append(payouts, *payout)
+        }
+        if err != nil {
+            log.Printf("Referrals: payout to %s: %v", balance.ReferrerID, err)
+        }
+    }
+
+    return payouts, nil
+}
+
+// payOut sends a referrer's accrued commissions in one transfer. The commissions are attached to the
+// payout before the transfer so concurrent batches cannot pay them twice. A payout whose transfer is
+// not confirmed in time stays pending and is settled by ReconcilePayouts.
+func (s *ReferralService) payOut(referrerID uuid.UUID) (*models.ReferralPayout, error) {
+    var payout models.ReferralPayout
+    err := s.DB.Transaction(func(tx *gorm.DB) error {
+        var referrer models.User
+        if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", referrerID).First(&referrer).Error; err != nil {
+            return fmt.Errorf("referrer not found")
+        }
+        if !common.IsHexAddress(referrer.WalletAddress) {
+            return fmt.Errorf("referrer has no wallet to pay out to")
+        }
+
+        var commissions []models.ReferralCommission
+        if err := tx.Where("referrer_id = ? AND status = ?", referrerID, models.ReferralCommissionStatusAccrued).Find(&commissions).Error; err != nil {
+            return fmt.Errorf("failed to load commissions: %w", err)
+        }
+        ids := make([]uuid.UUID, 0, len(commissions))
+        amount := 0.0
+        for _, commission := range commissions {
+            ids = append(ids, commission.UUID)
+            amount += commission.Amount
+        }
+        if amount <= 0 || amount < s.MinPayout {
+            return fmt.Errorf("balance is below the minimum payout")
+        }
+
+        now := time.Now()
+        payout = models.ReferralPayout{
+            UUID:          uuid.New(),
+            ReferrerID:    referrerID,
+            WalletAddress: referrer.WalletAddress,
+            Amount:        amount,
+            Commissions:   len(ids),
+            Status:        models.ReferralPayoutStatusPending,
+            CreatedAt:     now,
+            UpdatedAt:     now,
+        }
+        if err := tx.Create(&payout).Error; err != nil {
+            return fmt.Errorf("failed to save payout: %w", err)
+        }
+        return tx.Model(&models.ReferralCommission{}).Where("uuid IN ?", ids).Updates(map[string]interface{}{
+            "status":     models.ReferralCommissionStatusPaid,
+            "payout_id":  payout.UUID,
+            "updated_at": now,
+        }).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    txHash, outcome, err := sendBookedTransfer(s.TokenClient, common.HexToAddress(payout.WalletAddress), payout.AmountInWei(), func(txHash string) error {
+        return s.DB.Model(&models.ReferralPayout{}).Where("uuid = ?", payout.UUID).Update("tx_hash", txHash).Error
+    })
+    payout.TxHash = txHash
+    if dbErr := s.settlePayout(&payout, outcome, err); dbErr != nil {
+        log.Printf("Referrals: failed to update payout %s: %v", payout.UUID, dbErr)
+    }
+    if outcome == transferFailed {
+        return &payout, fmt.Errorf("failed to send referral payout: %w", err)
+    }
+    if err != nil {
+        log.Printf("Referrals: payout %s not confirmed yet: %v", payout.UUID, err)
+    }
+
+    return &payout, nil
+}
+
+// ReconcilePayouts settles pending payouts from the receipts of their transfers. The commissions of
+// payouts that were never sent or were dropped go back to the referrer's balance.
+func (s *ReferralService) ReconcilePayouts(ctx context.Context) error {
+    var payouts []models.ReferralPayout
+    if err := s.DB.Where("status = ? AND created_at < ?", models.ReferralPayoutStatusPending, time.Now().Add(-bookedTransferTimeout)).
+        Order("created_at").Find(&payouts).Error; err != nil {
+        return fmt.Errorf("failed to list pending payouts: %w", err)
+    }
+
+    for i := range payouts {
+        payout := &payouts[i]
+        outcome, err := checkBookedTransfer(ctx, s.TokenClient, payout.TxHash, payout.CreatedAt)
+        if err != nil {
+            log.Printf("Referrals: failed to check payout %s: %v", payout.UUID, err)
+            continue
+        }
+        if outcome == transferPending {
+            continue
+        }
+
+        var reason error
+        if outcome == transferFailed {
+            reason = fmt.Errorf("transfer was not mined")
+            if payout.TxHash != "" {
+                reason = fmt.Errorf("transfer %s reverted or was dropped", payout.TxHash)
+            }
+        }
+        if err := s.settlePayout(payout, outcome, reason); err != nil {
+            log.Printf("Referrals: failed to update payout %s: %v", payout.UUID, err)
+            continue
+        }
+        log.Printf("Referrals: payout %s is %s", payout.UUID, payout.Status)
+    }
+
+    return nil
+}
+
+// settlePayout records the outcome of a pending payout's transfer, putting its commissions back in
+// the balance when nothing was sent. A payout settled meanwhile is left alone.
+func (s *ReferralService) settlePayout(payout *models.ReferralPayout, outcome transferOutcome, transferErr error) error {
+    payout.UpdatedAt = time.Now()
+    switch outcome {
+    case transferCompleted:
+        payout.Status = models.ReferralPayoutStatusCompleted
+        payout.ErrorMessage = ""
+    case transferFailed:
+        payout.Status = models.ReferralPayoutStatusFailed
+    }
+    if transferErr != nil {
+        payout.ErrorMessage = transferErr.Error()
+    }
+
+    return s.DB.Transaction(func(tx *gorm.DB) error {
+        result := tx.Model(&models.ReferralPayout{}).Where("uuid = ? AND status = ?", payout.UUID, models.ReferralPayoutStatusPending).
+            Updates(map[string]interface{}{
+                "status":        payout.Status,
+                "tx_hash":       payout.TxHash,
+                "error_message": payout.ErrorMessage,
+                "updated_at":    payout.UpdatedAt,
+            })
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 || outcome != transferFailed {
+            return nil
+        }
+        return tx.Model(&models.ReferralCommission{}).Where("payout_id = ?", payout.UUID).Updates(map[string]interface{}{
+            "status":     models.ReferralCommissionStatusAccrued,
+            "payout_id":  nil,
+            "updated_at": payout.UpdatedAt,
+        }).Error
+    })
+}
+
+// credit creates the commission of one purchase at the rate of the referrer's tier, within the caps
+func (s *ReferralService) credit(transaction *models.Transaction) error {
+    var referee models.User
+    if err := s.DB.Where("uuid = ?", transaction.UserID).First(&referee).Error; err != nil {
+        return fmt.Errorf("failed to load buyer: %w", err)
+    }
+    if referee.ReferredBy == nil {
+        return nil
+    }
+
+    return s.DB.Transaction(func(tx *gorm.DB) error {
+        // Locking the referrer serializes their credits and payouts, which keeps the lifetime cap
+        var referrer models.User
+        if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", *referee.ReferredBy).First(&referrer).Error; err != nil {
+            return fmt.Errorf("failed to load referrer: %w", err)
+        }
+
+        buyers, err := s.countBuyers(tx, referrer.UUID, referee.UUID)
+        if err != nil {
+            return err
+        }
+        tier, _ := s.tierFor(buyers + 1)
+
+        amount := transaction.TokenAmount * float64(tier.RateBps) / 10000
+        if s.MaxPerPurchase > 0 {
+            amount = min(amount, s.MaxPerPurchase)
+        }
+        if s.MaxPerReferrer > 0 {
+            var earned float64
+            if err := tx.Model(&models.ReferralCommission{}).Select("COALESCE(SUM(amount), 0)").
+                Where("referrer_id = ? AND status <> ?", referrer.UUID, models.ReferralCommissionStatusRejected).
+                Scan(&earned).Error; err != nil {
+                return fmt.Errorf("failed to total referrer commissions: %w", err)
+            }
+            amount = min(amount, max(s.MaxPerReferrer-earned, 0))
+        }
+
+        now := time.Now()
+        commission := models.ReferralCommission{
+            UUID:          uuid.New(),
+            ReferrerID:    referrer.UUID,
+            RefereeID:     referee.UUID,
+            TransactionID: transaction.UUID,
+            TokenAmount:   transaction.TokenAmount,
+            RateBps:       tier.RateBps,
+            Amount:        amount,
+            Status:        models.ReferralCommissionStatusAccrued,
+            CreatedAt:     now,
+            UpdatedAt:     now,
+        }
+
+        reason, err := s.abuseReason(tx, &referrer, &referee, transaction)
+        if err != nil {
+            return err
+        }
+        if reason != "" {
+            commission.Status = models.ReferralCommissionStatusRejected
+            commission.Reason = reason
+        }
+
+        return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&commission).Error
+    })
+}
+
+// abuseReason explains why a referral looks like the referrer buying through a second account, or
+// returns an empty string
+func (s *ReferralService) abuseReason(db *gorm.DB, referrer, referee *models.User, transaction *models.Transaction) (string, error) {
+    if referrer.UUID == referee.UUID || (referee.Email != "" && normalizeReferralEmail(referrer.Email) == normalizeReferralEmail(referee.Email)) {
+        return "self-referral", nil
+    }
+
+    // The wallets the referee bought with or holds, compared with the referrer's
+    buyerWallet := transaction.WalletAddress
+    if transaction.VestingWallet != "" {
+        buyerWallet = transaction.VestingWallet
+    }
+    refereeWallets := []string{strings.ToLower(buyerWallet)}
+    if referee.WalletAddress != "" {
+        refereeWallets = append(refereeWallets, strings.ToLower(referee.WalletAddress))
+    }
+    var linked []string
+    if err := db.Model(&models.Wallet{}).Where("user_id = ?", referee.UUID).Pluck("LOWER(wallet_address)", &linked).Error; err != nil {
+        return "", fmt.Errorf("failed to load referee wallets: %w", err)
+    }
+    refereeWallets = append(refereeWallets, linked...)
+
+    for _, wallet := range refereeWallets {
+        if referrer.WalletAddress != "" && wallet == strings.ToLower(referrer.WalletAddress) {
+            return "shared wallet", nil
+        }
+    }
+    var sharedWallets int64
+    if err := db.Model(&models.Wallet{}).Where("user_id = ? AND LOWER(wallet_address) IN ?", referrer.UUID, refereeWallets).
+        Count(&sharedWallets).Error; err != nil {
+        return "", fmt.Errorf("failed to compare wallets: %w", err)
+    }
+    if sharedWallets > 0 {
+        return "shared wallet", nil
+    }
+
+    // The referee signed up from an address the referrer uses
+    if referee.SignupIP != "" {
+        if referee.SignupIP == referrer.SignupIP {
+            return "shared IP address", nil
+        }
+        var sharedIPs int64
+        if err := db.Model(&models.ActivityLog{}).Where("user_id = ? AND ip_address = ?", referrer.UUID, referee.SignupIP).
+            Count(&sharedIPs).Error; err != nil {
+            return "", fmt.Errorf("failed to compare IP addresses: %w", err)
+        }
+        if sharedIPs > 0 {
+            return "shared IP address", nil
+        }
+    }
+
+    return "", nil
+}
+
+// countBuyers counts the referrer's referees with a credited purchase, leaving out the given one
+func (s *ReferralService) countBuyers(db *gorm.DB, referrerID, except uuid.UUID) (int64, error) {
+    var buyers int64
+    err := db.Model(&models.ReferralCommission{}).Distinct("referee_id").
+        Where("referrer_id = ? AND referee_id <> ? AND status <> ?", referrerID, except, models.ReferralCommissionStatusRejected).
+        Count(&buyers).Error
+    if err != nil {
+        return 0, fmt.Errorf("failed to count referred buyers: %w", err)
+    }
+    return buyers, nil
+}
+
+// tierFor returns the highest tier reached with the given buyers and the one after it
+func (s *ReferralService) tierFor(buyers int64) (ReferralTier, *ReferralTier) {
+    current := s.Tiers[0]
+    for i, tier := range s.Tiers {
+        if int64(tier.MinBuyers) > buyers {
+            next := s.Tiers[i]
+            return current, &next
+        }
+        current = tier
+    }
+    return current, nil
+}
+
+// ensureCode gives the user a referral code if they have none
+func (s *ReferralService) ensureCode(user *models.User) error {
+    for attempt := 0; user.ReferralCode == "" && attempt < 3; attempt++ {
+        code, err := generateReferralCode()
+        if err != nil {
+            return err
+        }
+        result := s.DB.Model(&models.User{}).Where("uuid = ? AND referral_code IS NULL", user.UUID).Update("referral_code", code)
+        if result.Error != nil {
+            continue // Taken by someone else, try another
+        }
+        if result.RowsAffected == 0 {
+            // Assigned concurrently
+            var current models.User
+            if err := s.DB.Select("referral_code").Where("uuid = ?", user.UUID).First(&current).Error; err != nil {
+                return fmt.Errorf("failed to load referral code: %w", err)
+            }
+            code = current.ReferralCode
+        }
+        user.ReferralCode = code
+    }
+
+    if user.ReferralCode == "" {
+        return fmt.Errorf("failed to assign a referral code")
+    }
+    return nil
+}
+
+// generateReferralCode returns a random code that is easy to read out and type
+func generateReferralCode() (string, error) {
+    code := make([]byte, referralCodeLength)
+    limit := big.NewInt(int64(len(referralCodeAlphabet)))
+    for i := range code {
+        n, err := rand.Int(rand.Reader, limit)
+        if err != nil {
+            return "", fmt.Errorf("failed to generate referral code: %w", err)
+        }
+        code[i] = referralCodeAlphabet[n.Int64()]
+    }
+    return string(code), nil
+}
+
+// normalizeReferralEmail lowercases an address and drops its +tag, so aliases of one mailbox compare equal
+func normalizeReferralEmail(email string) string {
+    local, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+    if !ok {
+        return local
+    }
+    local, _, _ = strings.Cut(local, "+")
+    return local + "@" + domain
+}
@@ -0,0 +1,458 @@
+package services
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrPurchaseRejected wraps the sale rule a purchase breaks
+var ErrPurchaseRejected = errors.New("purchase rejected")
+
+// SaleRoundService manages the sale rounds and enforces their window, caps and per-user limits.
+// Without any configured round the sale is unrestricted.
+type SaleRoundService struct {
+    DB              *gorm.DB
+    ReservationTTL  time.Duration // How long an unpaid order holds its allocation
+    VestingTreasury string        // Receives the tokens of vesting purchases until they are claimed
+}
+
+// SaleRoundInput holds the fields of a round creation or update; nil fields are left unchanged
+type SaleRoundInput struct {
+    Name        *string    `json:"name"`
+    StartsAt    *time.Time `json:"starts_at"`
+    EndsAt      *time.Time `json:"ends_at"`
+    PriceUSD    *float64   `json:"price_usd"`
+    HardCap     *float64   `json:"hard_cap"`
+    SoftCap     *float64   `json:"soft_cap"`
+    MinPurchase *float64   `json:"min_purchase"`
+    MaxPerUser  *float64   `json:"max_per_user"`
+    Enabled     *bool      `json:"enabled"`
+
+    VestingCliffDays *int `json:"vesting_cliff_days"`
+    VestingDays      *int `json:"vesting_days"`
+}
+
+// SaleRoundProgress is a round with its sold and reserved amounts
+type SaleRoundProgress struct {
+    models.SaleRound
+    Status         string  `json:"status"`   // upcoming, active or ended
+    Sold           float64 `json:"sold"`     // Paid purchases
+    Reserved       float64 `json:"reserved"` // Unpaid orders still holding their allocation
+    Remaining      float64 `json:"remaining"`
+    PercentSold    float64 `json:"percent_sold"`
+    SoftCapReached bool    `json:"soft_cap_reached"`
+}
+
+// UserAllocation is what a user bought in a round and may still buy
+type UserAllocation struct {
+    Round       *models.SaleRound `json:"round"`
+    Purchased   float64           `json:"purchased"`
+    Remaining   float64           `json:"remaining"` // Limited by the user's maximum, allowlist allocation and the round's hard cap
+    MinPurchase float64           `json:"min_purchase"`
+
+    // Allocation on a private round's allowlist, 0 when the user is not listed
+    AllowlistAllocation *float64 `json:"allowlist_allocation,omitempty"`
+}
+
+// Round statuses reported by Progress
+const (
+    SaleRoundStatusUpcoming = "upcoming"
+    SaleRoundStatusActive   = "active"
+    SaleRoundStatusEnded    = "ended"
+)
+
+// NewSaleRoundService creates a new sale round service
+func NewSaleRoundService(db *gorm.DB, reservationTTL time.Duration, vestingTreasury string) *SaleRoundService {
+    return &SaleRoundService{
+        DB:              db,
+        ReservationTTL:  reservationTTL,
+        VestingTreasury: vestingTreasury,
+    }
+}
+
+// ListRounds returns all rounds in schedule order
+func (s *SaleRoundService) ListRounds() ([]models.SaleRound, error) {
+    var rounds []models.SaleRound
+    if err := s.DB.Order("starts_at").Find(&rounds).Error; err != nil {
+        return nil, fmt.Errorf("failed to list sale rounds: %w", err)
+    }
+    return rounds, nil
+}
+
+// GetRound finds a round by UUID or name
+func (s *SaleRoundService) GetRound(id string) (*models.SaleRound, error) {
+    var round models.SaleRound
+    var err error
+    if roundID, parseErr := uuid.Parse(id); parseErr == nil {
+        err = s.DB.Where("uuid = ?", roundID).First(&round).Error
+    } else {
+        err = s.DB.Where("name = ?", id).First(&round).Error
+    }
+
+    if err != nil {
+        return nil, fmt.Errorf("sale round not found")
+    }
+    return &round, nil
+}
+
+// CreateRound adds a round; name, window, price and hard cap are required
+func (s *SaleRoundService) CreateRound(input SaleRoundInput) (*models.SaleRound, error) {
+    if input.Name == nil || input.StartsAt == nil || input.EndsAt == nil || input.PriceUSD == nil || input.HardCap == nil {
+        return nil, fmt.Errorf("name, starts_at, ends_at, price_usd and hard_cap are required")
+    }
+
+    round := models.SaleRound{
+        UUID:      uuid.New(),
+        Enabled:   true,
+        CreatedAt: time.Now(),
+        UpdatedAt: time.Now(),
+    }
+    if err := s.applyInput(&round, input); err != nil {
+        return nil, err
+    }
+
+    if err := s.DB.Create(&round).Error; err != nil {
+        return nil, fmt.Errorf("failed to create sale round: %w", err)
+    }
+
+    return &round, nil
+}
+
+// UpdateRound changes a round's window, price, caps, limits or enabled flag
+func (s *SaleRoundService) UpdateRound(id string, input SaleRoundInput) (*models.SaleRound, error) {
+    round, err := s.GetRound(id)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := s.applyInput(round, input); err != nil {
+        return nil, err
+    }
+    round.UpdatedAt = time.Now()
+
+    if err := s.DB.Save(round).Error; err != nil {
+        return nil, fmt.Errorf("failed to update sale round: %w", err)
+    }
+
+    return round, nil
+}
+
+// ActiveRound returns the round open now. It returns nil without an error when no rounds are
+// configured, and ErrPurchaseRejected when there are rounds but none is open.
+func (s *SaleRoundService) ActiveRound() (*models.SaleRound, error) {
+    return s.activeRound(s.DB)
+}
+
+// Reserve checks a purchase against the active round within the caller's database transaction
+// and assigns the transaction to the round. The round row stays locked until the caller commits,
+// so concurrent purchases cannot oversell it. Purchases in a vesting round are delivered to the
+// vesting treasury, with the buyer's wallet kept as the vesting wallet.
+func (s *SaleRoundService) Reserve(tx *gorm.DB, transaction *models.Transaction) error {
+    round, err := s.activeRound(tx.Clauses(clause.Locking{Strength: "UPDATE"}))
+    if err != nil || round == nil {
+        return err
+    }
+
+    var userID *uuid.UUID
+    if transaction.UserID != uuid.Nil {
+        userID = &transaction.UserID
+    }
+    if err := s.check(tx, round, userID, transaction.TokenAmount); err != nil {
+        return err
+    }
+
+    transaction.SaleRoundID = &round.UUID
+    if round.Vests() && transaction.VestingWallet == "" {
+        transaction.VestingWallet = transaction.WalletAddress
+        transaction.WalletAddress = s.VestingTreasury
+    }
+    return nil
+}
+
+// CreatePurchase saves a purchase transaction once it passes the active round's rules. The steps
+// run after the insert in the same database transaction, so a failing step undoes the purchase.
+func (s *SaleRoundService) CreatePurchase(transaction *models.Transaction, steps ...func(tx *gorm.DB) error) error {
+    return s.DB.Transaction(func(tx *gorm.DB) error {
+        if err := s.Reserve(tx, transaction); err != nil {
+            return err
+        }
+        if err := tx.Create(transaction).Error; err != nil {
+            return fmt.Errorf("failed to create transaction record: %w", err)
+        }
+        for _, step := range steps {
+            if err := step(tx); err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+}
+
+// CheckPurchase validates a purchase against the active round without reserving it. A nil user
+// skips the per-user maximum.
+func (s *SaleRoundService) CheckPurchase(userID *uuid.UUID, tokenAmount float64) (*models.SaleRound, error) {
+    round, err := s.ActiveRound()
+    if err != nil || round == nil {
+        return nil, err
+    }
+    if err := s.check(s.DB, round, userID, tokenAmount); err != nil {
+        return nil, err
+    }
+    return round, nil
+}
+
+// Progress reports every enabled round with what was sold, what is reserved and what remains
+func (s *SaleRoundService) Progress() ([]SaleRoundProgress, error) {
+    var rounds []models.SaleRound
+    if err := s.DB.Where("enabled = ?", true).Order("starts_at").Find(&rounds).Error; err != nil {
+        return nil, fmt.Errorf("failed to list sale rounds: %w", err)
+    }
+
+    now := time.Now()
+    progress := make([]SaleRoundProgress, 0, len(rounds))
+    for _, round := range rounds {
+        sold, err := s.sum(s.DB, round.UUID, nil, false)
+        if err != nil {
+            return nil, err
+        }
+        committed, err := s.sum(s.DB, round.UUID, nil, true)
+        if err != nil {
+            return nil, err
+        }
+
+        p := SaleRoundProgress{
+            SaleRound:      round,
+            Status:         SaleRoundStatusUpcoming,
+            Sold:           sold,
+            Reserved:       committed - sold,
+            Remaining:      round.HardCap - committed,
+            SoftCapReached: sold >= round.SoftCap,
+        }
+        if p.Remaining < 0 {
+            p.Remaining = 0
+        }
+        if round.HardCap > 0 {
+            p.PercentSold = sold / round.HardCap * 100
+        }
+        if round.IsActive(now) {
+            p.Status = SaleRoundStatusActive
+        } else if !now.Before(round.EndsAt) {
+            p.Status = SaleRoundStatusEnded
+        }
+        progress = append(progress, p)
+    }
+
+    return progress, nil
+}
+
+// Allocation returns what the user bought in the active round and may still buy
+func (s *SaleRoundService) Allocation(userID uuid.UUID) (*UserAllocation, error) {
+    round, err := s.ActiveRound()
+    if err != nil || round == nil {
+        return nil, err
+    }
+
+    purchased, err := s.sum(s.DB, round.UUID, &userID, true)
+    if err != nil {
+        return nil, err
+    }
+    committed, err := s.sum(s.DB, round.UUID, nil, true)
+    if err != nil {
+        return nil, err
+    }
+
+    remaining := round.HardCap - committed
+    if round.MaxPerUser > 0 && round.MaxPerUser-purchased < remaining {
+        remaining = round.MaxPerUser - purchased
+    }
+
+    var allowlisted *float64
+    if round.IsPrivate() {
+        var user models.User
+        if err := s.DB.Select("uuid", "email", "wallet_address").Where("uuid = ?", userID).First(&user).Error; err != nil {
+            return nil, fmt.Errorf("failed to load user: %w", err)
+        }
+
+        var allocation float64
+        entry, err := findAllowlistEntry(s.DB, round, &user)
+        if err == nil {
+            allocation = entry.Allocation
+        } else if !errors.Is(err, errNotAllowlisted) {
+            return nil, err
+        }
+        allowlisted = &allocation
+        remaining = min(remaining, allocation-purchased)
+    }
+
+    if remaining < 0 {
+        remaining = 0
+    }
+
+    return &UserAllocation{
+        Round:               round,
+        Purchased:           purchased,
+        Remaining:           remaining,
+        MinPurchase:         round.MinPurchase,
+        AllowlistAllocation: allowlisted,
+    }, nil
+}
+
+// activeRound finds the round open now through the given query
+func (s *SaleRoundService) activeRound(db *gorm.DB) (*models.SaleRound, error) {
+    now := time.Now()
+
+    var round models.SaleRound
+    err := db.Where("enabled = ? AND starts_at <= ? AND ends_at > ?", true, now, now).Order("starts_at DESC").First(&round).Error
+    if err == nil {
+        return &round, nil
+    }
+    if !errors.Is(err, gorm.ErrRecordNotFound) {
+        return nil, fmt.Errorf("failed to load active sale round: %w", err)
+    }
+
+    var count int64
+    if err := s.DB.Model(&models.SaleRound{}).Count(&count).Error; err != nil {
+        return nil, fmt.Errorf("failed to count sale rounds: %w", err)
+    }
+    if count == 0 {
+        return nil, nil
+    }
+
+    var next models.SaleRound
+    if err := s.DB.Where("enabled = ? AND starts_at > ?", true, now).Order("starts_at").First(&next).Error; err == nil {
+        return nil, fmt.Errorf("%w: the sale is closed until %s opens at %s", ErrPurchaseRejected, next.Name, next.StartsAt.Format(time.RFC3339))
+    }
+    return nil, fmt.Errorf("%w: the sale is closed", ErrPurchaseRejected)
+}
+
+// check applies the round's minimum, per-user maximum and hard cap to a purchase
+func (s *SaleRoundService) check(db *gorm.DB, round *models.SaleRound, userID *uuid.UUID, tokenAmount float64) error {
+    if tokenAmount < round.MinPurchase {
+        return fmt.Errorf("%w: the minimum purchase in %s is %g tokens", ErrPurchaseRejected, round.Name, round.MinPurchase)
+    }
+
+    if err := s.checkAllowlist(db, round, userID, tokenAmount); err != nil {
+        return err
+    }
+
+    if userID != nil && round.MaxPerUser > 0 {
+        purchased, err := s.sum(db, round.UUID, userID, true)
+        if err != nil {
+            return err
+        }
+        if purchased+tokenAmount > round.MaxPerUser {
+            return fmt.Errorf("%w: %s allows %g tokens per user, %g left for you", ErrPurchaseRejected, round.Name, round.MaxPerUser, max(round.MaxPerUser-purchased, 0))
+        }
+    }
+
+    committed, err := s.sum(db, round.UUID, nil, true)
+    if err != nil {
+        return err
+    }
+    if committed+tokenAmount > round.HardCap {
+        return fmt.Errorf("%w: %s has %g tokens left", ErrPurchaseRejected, round.Name, max(round.HardCap-committed, 0))
+    }
+
+    return nil
+}
+
+// sum adds up the tokens of a round's paid purchases and, with reserved, its unpaid orders
+// that still hold their allocation
+func (s *SaleRoundService) sum(db *gorm.DB, roundID uuid.UUID, userID *uuid.UUID, reserved bool) (float64, error) {
+    query := db.Model(&models.Transaction{}).Where("sale_round_id = ?", roundID)
+    if userID != nil {
+        query = query.Where("user_id = ?", *userID)
+    }
+
+    paid := []string{models.TransactionStatusCompleted, models.TransactionStatusProcessing}
+    if reserved {
+        query = query.Where("(status IN ? OR (status = ? AND created_at > ?))", paid, models.TransactionStatusPending, time.Now().Add(-s.ReservationTTL))
+    } else {
+        query = query.Where("status IN ?", paid)
+    }
+
+    var total float64
+    if err := query.Select("COALESCE(SUM(token_amount), 0)").Scan(&total).Error; err != nil {
+        return 0, fmt.Errorf("failed to sum sale round purchases: %w", err)
+    }
+    return total, nil
+}
+
+// applyInput copies the set fields of the input onto the round and validates the result
+func (s *SaleRoundService) applyInput(round *models.SaleRound, input SaleRoundInput) error {
+    if input.Name != nil {
+        round.Name = strings.TrimSpace(*input.Name)
+    }
+    if input.StartsAt != nil {
+        round.StartsAt = *input.StartsAt
+    }
+    if input.EndsAt != nil {
+        round.EndsAt = *input.EndsAt
+    }
+    if input.PriceUSD != nil {
+        round.PriceUSD = *input.PriceUSD
+    }
+    if input.HardCap != nil {
+        round.HardCap = *input.HardCap
+    }
+    if input.SoftCap != nil {
+        round.SoftCap = *input.SoftCap
+    }
+    if input.MinPurchase != nil {
+        round.MinPurchase = *input.MinPurchase
+    }
+    if input.MaxPerUser != nil {
+        round.MaxPerUser = *input.MaxPerUser
+    }
+    if input.Enabled != nil {
+        round.Enabled = *input.Enabled
+    }
+    if input.VestingCliffDays != nil {
+        round.VestingCliffDays = *input.VestingCliffDays
+    }
+    if input.VestingDays != nil {
+        round.VestingDays = *input.VestingDays
+    }
+
+    switch {
+    case round.Name == "":
+        return fmt.Errorf("name is required")
+    case !round.EndsAt.After(round.StartsAt):
+        return fmt.Errorf("ends_at must be after starts_at")
+    case round.PriceUSD <= 0:
+        return fmt.Errorf("price_usd must be greater than 0")
+    case round.HardCap <= 0:
+        return fmt.Errorf("hard_cap must be greater than 0")
+    case round.SoftCap < 0 || round.SoftCap > round.HardCap:
+        return fmt.Errorf("soft_cap must be between 0 and hard_cap")
+    case round.MinPurchase < 0 || round.MaxPerUser < 0:
+        return fmt.Errorf("min_purchase and max_per_user cannot be negative")
+    case round.MaxPerUser > 0 && round.MinPurchase > round.MaxPerUser:
+        return fmt.Errorf("min_purchase cannot exceed max_per_user")
+    case round.VestingCliffDays < 0 || round.VestingDays < 0:
+        return fmt.Errorf("vesting_cliff_days and vesting_days cannot be negative")
+    case round.VestingCliffDays > round.VestingDays:
+        return fmt.Errorf("vesting_cliff_days cannot exceed vesting_days")
+    }
+
+    if round.Enabled {
+        var overlapping int64
+        if err := s.DB.Model(&models.SaleRound{}).
+            Where("uuid <> ? AND enabled = ? AND starts_at < ? AND ends_at > ?", round.UUID, true, round.EndsAt, round.StartsAt).
+            Count(&overlapping).Error; err != nil {
+            return fmt.Errorf("failed to check overlapping rounds: %w", err)
+        }
+        if overlapping > 0 {
+            return fmt.Errorf("the round overlaps another enabled round")
+        }
+    }
+
+    return nil
+}
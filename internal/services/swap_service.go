@@ -49,6 +49,7 @@ func NewSwapService(
 func (s *SwapService) SwapTokens(
     userID uuid.UUID,
     mnemonic string,
+    accountSelector string,
     fromToken string,
     toToken string,
     amountStr string,
@@ -60,23 +61,10 @@ func (s *SwapService) SwapTokens(
         return "", fmt.Errorf("invalid amount")
     }
 
-    // Validate user's wallet
-    hdWallet, err := blockchain.NewHDWalletFromMnemonic(mnemonic)
+    // Derive the selected account and verify the user owns it
+    account, err := s.WalletService.DeriveSelectedAccount(userID, mnemonic, accountSelector)
     if err != nil {
-        return "", fmt.Errorf("invalid mnemonic: %w", err)
-    }
-
-    // Derive account
-    account, err := hdWallet.DeriveAccount(0)
-    if err != nil {
-        return "", fmt.Errorf("failed to derive account: %w", err)
-    }
-
-    // Verify user owns this wallet
-    var wallet models.Wallet
-    if result := s.DB.Where("user_id = ? AND wallet_address = ?", 
-        userID, account.Address.Hex()).First(&wallet); result.Error != nil {
-        return "", fmt.Errorf("wallet not associated with user")
+        return "", err
     }
 
     // Get token addresses
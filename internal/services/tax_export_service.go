@@ -0,0 +1,838 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum/ethclient"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrInvalidExport wraps why an export request cannot be served
+var ErrInvalidExport = errors.New("invalid export")
+
+// ErrTooManyExports is returned when a user already has MaxPending exports queued or running
+var ErrTooManyExports = errors.New("too many exports in progress")
+
+// Wallet transactions valued and jobs run per pass at most
+const (
+    exportValuationBatch = 200
+    exportJobBatch       = 5
+    exportJobTimeout     = 30 * time.Minute // A job processing longer than this is assumed lost and run again
+
+    exportLivePriceWindow = time.Hour // Wallet transactions mined more recently are valued at the current price
+)
+
+// Currencies exports can be valued in; rates of the others are recorded daily
+var exportCurrencies = []string{"IDR", "USD"}
+
+// Columns of the universal CSV format of Koinly and similar crypto tax tools, followed by the cost basis
+var exportCSVHeader = []string{
+    "Date", "Sent Amount", "Sent Currency", "Received Amount", "Received Currency",
+    "Fee Amount", "Fee Currency", "Net Worth Amount", "Net Worth Currency",
+    "Label", "Description", "TxHash", "Cost Basis", "Cost Basis Currency",
+}
+
+// TaxExportService exports the purchases and wallet transactions of a user with their fiat value at
+// trade time, cost basis and fees. It also values new wallet transactions and records the daily
+// exchange rates those values are converted with.
+type TaxExportService struct {
+    DB           *gorm.DB
+    PriceService *PriceService
+    EthClient    *ethclient.Client // Block times of wallet transactions
+    SyncLimit    int
+    MaxPending   int // Queued and running jobs per user at most
+    Retention    time.Duration
+}
+
+// ExportRequest is the period, format and currency of an export
+type ExportRequest struct {
+    Format   string
+    Currency string
+    From     time.Time
+    To       time.Time // Exclusive
+}
+
+// ExportRecord is one line of an export. Amounts are in display units; values are in Currency.
+type ExportRecord struct {
+    Date             time.Time `json:"date"`
+    Source           string    `json:"source"` // purchase or wallet
+    ID               string    `json:"id"`     // Payment ID or wallet transaction UUID
+    Type             string    `json:"type"`
+    Label            string    `json:"label,omitempty"`
+    SentAmount       string    `json:"sent_amount,omitempty"`
+    SentCurrency     string    `json:"sent_currency,omitempty"`
+    ReceivedAmount   string    `json:"received_amount,omitempty"`
+    ReceivedCurrency string    `json:"received_currency,omitempty"`
+    FeeAmount        string    `json:"fee_amount,omitempty"`
+    FeeCurrency      string    `json:"fee_currency,omitempty"`
+    FeeValue         float64   `json:"fee_value"`
+    Value            float64   `json:"value"`      // Fiat value of the tokens at trade time
+    CostBasis        float64   `json:"cost_basis"` // Paid for acquisitions, average cost of what left for disposals
+    Currency         string    `json:"currency"`
+    Priced           bool      `json:"priced"` // False when the token had no price at trade time
+    TxHash           string    `json:"tx_hash,omitempty"`
+    Description      string    `json:"description,omitempty"`
+}
+
+// NewTaxExportService creates a new tax export service
+func NewTaxExportService(db *gorm.DB, priceService *PriceService, ethClient *ethclient.Client, cfg config.ExportConfig) *TaxExportService {
+    return &TaxExportService{
+        DB:           db,
+        PriceService: priceService,
+        EthClient:    ethClient,
+        SyncLimit:    cfg.SyncLimit,
+        MaxPending:   cfg.MaxPending,
+        Retention:    cfg.Retention,
+    }
+}
+
+// ParseExportRequest reads an export request. Dates are YYYY-MM-DD and inclusive, the period
+// defaults to the current calendar year.
+func ParseExportRequest(from, to, format, currency string) (ExportRequest, error) {
+    now := time.Now().UTC()
+    req := ExportRequest{
+        Format:   strings.ToLower(format),
+        Currency: strings.ToUpper(currency),
+        From:     time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.UTC),
+        To:       time.Date(now.Year()+1, 1, 1, 0, 0, 0, 0, time.UTC),
+    }
+    if req.Format == "" {
+        req.Format = "csv"
+    }
+    if req.Currency == "" {
+        req.Currency = "IDR"
+    }
+
+    if req.Format != "csv" && req.Format != "json" {
+        return req, fmt.Errorf("%w: format must be csv or json", ErrInvalidExport)
+    }
+    supported := false
+    for _, c := range exportCurrencies {
+        supported = supported || c == req.Currency
+    }
+    if !supported {
+        return req, fmt.Errorf("%w: currency must be one of %s", ErrInvalidExport, strings.Join(exportCurrencies, ", "))
+    }
+
+    if from != "" {
+        t, err := time.Parse("2006-01-02", from)
+        if err != nil {
+            return req, fmt.Errorf("%w: from must be a YYYY-MM-DD date", ErrInvalidExport)
+        }
+        req.From = t
+    }
+    if to != "" {
+        t, err := time.Parse("2006-01-02", to)
+        if err != nil {
+            return req, fmt.Errorf("%w: to must be a YYYY-MM-DD date", ErrInvalidExport)
+        }
+        req.To = t.AddDate(0, 0, 1)
+    }
+    if !req.From.Before(req.To) {
+        return req, fmt.Errorf("%w: from must not be after to", ErrInvalidExport)
+    }
+
+    return req, nil
+}
+
+// Filename is the download name of the export
+func (r ExportRequest) Filename() string {
+    return fmt.Sprintf("transactions_%s_%s.%s", r.From.Format("2006-01-02"), r.To.AddDate(0, 0, -1).Format("2006-01-02"), r.Format)
+}
+
+// ContentType is the MIME type of the export
+func (r ExportRequest) ContentType() string {
+    if r.Format == "json" {
+        return "application/json"
+    }
+    return "text/csv"
+}
+
+// CountRecords returns how many records an export of the period would hold
+func (s *TaxExportService) CountRecords(userID uuid.UUID, req ExportRequest) (int64, error) {
+    var purchases, walletTxs int64
+    err := s.purchases(userID, req.To).Where("COALESCE(completed_at, created_at) >= ?", req.From).
+        Model(&models.Transaction{}).Count(&purchases).Error
+    if err != nil {
+        return 0, fmt.Errorf("failed to count purchases: %w", err)
+    }
+    err = s.walletTransactions(userID, req.To).Where("created_at >= ?", req.From).
+        Model(&models.WalletTransaction{}).Count(&walletTxs).Error
+    if err != nil {
+        return 0, fmt.Errorf("failed to count wallet transactions: %w", err)
+    }
+    return purchases + walletTxs, nil
+}
+
+// Generate builds the export file and returns it with its number of records
+func (s *TaxExportService) Generate(ctx context.Context, userID uuid.UUID, req ExportRequest) ([]byte, int, error) {
+    records, err := s.Records(ctx, userID, req)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    if req.Format == "json" {
+        content, err := json.MarshalIndent(map[string]interface{}{
+            "currency":     req.Currency,
+            "from":         req.From.Format("2006-01-02"),
+            "to":           req.To.AddDate(0, 0, -1).Format("2006-01-02"),
+            "generated_at": time.Now().UTC(),
+            "records":      records,
+        }, "", "  ")
+        if err != nil {
+            return nil, 0, fmt.Errorf("failed to encode export: %w", err)
+        }
+        return content, len(records), nil
+    }
+
+    var buf bytes.Buffer
+    w := csv.NewWriter(&buf)
+    w.Write(exportCSVHeader)
+    for _, r := range records {
+        value, costBasis := "", ""
+        if r.Priced {
+            value = formatFiat(r.Value)
+            costBasis = formatFiat(r.CostBasis)
+        }
+        w.Write([]string{
+            r.Date.UTC().Format("2006-01-02 15:04:05 UTC"),
+            r.SentAmount, r.SentCurrency, r.ReceivedAmount, r.ReceivedCurrency,
+            r.FeeAmount, r.FeeCurrency, value, r.Currency,
+            r.Label, r.Description, r.TxHash, costBasis, r.Currency,
+        })
+    }
+    w.Flush()
+    if err := w.Error(); err != nil {
+        return nil, 0, fmt.Errorf("failed to encode export: %w", err)
+    }
+    return buf.Bytes(), len(records), nil
+}
+
+// holding tracks the quantity and total cost of a token for the average cost method
+type holding struct {
+    quantity float64
+    cost     float64
+}
+
+// dispose removes a quantity at its average cost and returns that cost
+func (h *holding) dispose(quantity float64) float64 {
+    if h.quantity <= 0 || quantity <= 0 {
+        return 0
+    }
+    quantity = min(quantity, h.quantity)
+    cost := h.cost * quantity / h.quantity
+    h.quantity -= quantity
+    h.cost -= cost
+    return cost
+}
+
+// Records builds the export records of the period. The whole history before the period is
+// replayed so disposals carry the average cost of everything acquired before them.
+func (s *TaxExportService) Records(ctx context.Context, userID uuid.UUID, req ExportRequest) ([]ExportRecord, error) {
+    var purchases []models.Transaction
+    if err := s.purchases(userID, req.To).Find(&purchases).Error; err != nil {
+        return nil, fmt.Errorf("failed to load purchases: %w", err)
+    }
+    var walletTxs []models.WalletTransaction
+    if err := s.walletTransactions(userID, req.To).Find(&walletTxs).Error; err != nil {
+        return nil, fmt.Errorf("failed to load wallet transactions: %w", err)
+    }
+    var tokens []models.Token
+    if err := s.DB.Find(&tokens).Error; err != nil {
+        return nil, fmt.Errorf("failed to load tokens: %w", err)
+    }
+
+    rates := newRateBook(s, req.Currency)
+    holdings := map[string]*holding{}
+    held := func(symbol string) *holding {
+        symbol = strings.ToUpper(symbol)
+        if holdings[symbol] == nil {
+            holdings[symbol] = &holding{}
+        }
+        return holdings[symbol]
+    }
+
+    type event struct {
+        at       time.Time
+        purchase *models.Transaction
+        walletTx *models.WalletTransaction
+    }
+    events := make([]event, 0, len(purchases)+len(walletTxs))
+    for i := range purchases {
+        at := purchases[i].CreatedAt
+        if purchases[i].CompletedAt != nil {
+            at = *purchases[i].CompletedAt
+        }
+        events = append(events, event{at: at, purchase: &purchases[i]})
+    }
+    for i := range walletTxs {
+        events = append(events, event{at: walletTxs[i].CreatedAt, walletTx: &walletTxs[i]})
+    }
+    sort.SliceStable(events, func(i, j int) bool { return events[i].at.Before(events[j].at) })
+
+    records := []ExportRecord{}
+    for _, e := range events {
+        var record ExportRecord
+        var err error
+        if e.purchase != nil {
+            record, err = s.purchaseRecord(ctx, e.purchase, e.at, rates, held)
+        } else {
+            record, err = s.walletRecord(ctx, e.walletTx, tokens, rates, held)
+        }
+        if err != nil {
+            return nil, err
+        }
+        if !e.at.Before(req.From) {
+            records = append(records, record)
+        }
+    }
+
+    return records, nil
+}
+
+// purchaseRecord is a token purchase; what was paid including gas is the cost basis
+func (s *TaxExportService) purchaseRecord(ctx context.Context, t *models.Transaction, at time.Time, rates *rateBook, held func(string) *holding) (ExportRecord, error) {
+    value, err := rates.convert(ctx, t.FiatAmount, t.FiatCurrency, at)
+    if err != nil {
+        return ExportRecord{}, err
+    }
+    fee, err := rates.convert(ctx, t.GasFeeFiat, t.FiatCurrency, at)
+    if err != nil {
+        return ExportRecord{}, err
+    }
+
+    h := held(t.TokenSymbol)
+    h.quantity += t.TokenAmount
+    h.cost += value + fee
+
+    record := ExportRecord{
+        Date:             at,
+        Source:           "purchase",
+        ID:               t.PaymentID,
+        Type:             "buy",
+        SentAmount:       formatFiat(t.FiatAmount),
+        SentCurrency:     t.FiatCurrency,
+        ReceivedAmount:   formatTokens(t.TokenAmount),
+        ReceivedCurrency: t.TokenSymbol,
+        FeeValue:         fee,
+        Value:            value,
+        CostBasis:        value + fee,
+        Currency:         rates.currency,
+        Priced:           true,
+        TxHash:           t.BlockchainTxHash,
+        Description:      "Token purchase via " + t.PaymentMethod,
+    }
+    if t.GasFeeFiat > 0 {
+        record.FeeAmount = formatFiat(t.GasFeeFiat)
+        record.FeeCurrency = t.FiatCurrency
+    }
+    if t.PromoCode != "" {
+        record.Description += ", promo code " + t.PromoCode
+    }
+    return record, nil
+}
+
+// walletRecord is a deposit, transfer, swap or contract call of one of the user's wallets
+func (s *TaxExportService) walletRecord(ctx context.Context, w *models.WalletTransaction, tokens []models.Token, rates *rateBook, held func(string) *holding) (ExportRecord, error) {
+    rate, err := rates.perUSD(ctx, w.CreatedAt)
+    if err != nil {
+        return ExportRecord{}, err
+    }
+
+    decimals := uint8(18)
+    if token := findToken(tokens, w.TokenAddress, w.TokenSymbol); token != nil {
+        decimals = token.Decimals
+    }
+
+    // Approvals carry the allowance and failed transactions moved nothing, only gas was spent
+    quantity := 0.0
+    amount := ""
+    if w.TxType != "approve" && w.Status == models.WalletTxStatusConfirmed {
+        if raw, ok := new(big.Int).SetString(w.Amount, 10); ok && raw.Sign() > 0 {
+            amount = formatUnits(raw, decimals)
+            quantity, _ = strconv.ParseFloat(amount, 64)
+        }
+    }
+
+    record := ExportRecord{
+        Date:        w.CreatedAt,
+        Source:      "wallet",
+        ID:          w.UUID.String(),
+        Type:        w.TxType,
+        Value:       quantity * w.PriceUSD * rate,
+        Currency:    rates.currency,
+        Priced:      quantity == 0 || w.PriceUSD > 0,
+        TxHash:      w.TxHash,
+        Description: describeWalletTx(w),
+    }
+
+    if w.Direction == models.WalletTxDirectionIncoming {
+        record.ReceivedAmount = amount
+        record.ReceivedCurrency = w.TokenSymbol
+        record.CostBasis = record.Value
+        h := held(w.TokenSymbol)
+        h.quantity += quantity
+        h.cost += record.Value
+        return record, nil
+    }
+
+    if amount != "" {
+        record.SentAmount = amount
+        record.SentCurrency = w.TokenSymbol
+        record.CostBasis = held(w.TokenSymbol).dispose(quantity)
+    }
+    if raw, ok := new(big.Int).SetString(w.FeeWei, 10); ok && raw.Sign() > 0 {
+        record.FeeAmount = formatUnits(raw, 18)
+        record.FeeCurrency = "ETH"
+        fee, _ := strconv.ParseFloat(record.FeeAmount, 64)
+        record.FeeValue = fee * w.EthPriceUSD * rate
+        held("ETH").dispose(fee)
+    }
+    if amount == "" {
+        record.Label = "cost" // Only gas was spent
+    }
+    return record, nil
+}
+
+// describeWalletTx is the description column of a wallet transaction
+func describeWalletTx(w *models.WalletTransaction) string {
+    switch {
+    case w.Status == models.WalletTxStatusFailed:
+        return "Failed " + w.TxType + ", gas only"
+    case w.Direction == models.WalletTxDirectionIncoming:
+        return "Deposit from " + w.FromAddress
+    case w.TxType == "swap":
+        return "Swap of " + w.TokenSymbol + " on Uniswap"
+    case w.ToAddress != "":
+        return strings.ReplaceAll(w.TxType, "_", " ") + " to " + w.ToAddress
+    }
+    return w.TxType
+}
+
+// findToken looks a registered token up by address, or by symbol when the address was not recorded
+func findToken(tokens []models.Token, address, symbol string) *models.Token {
+    for i := range tokens {
+        if address != "" && strings.EqualFold(tokens[i].Address, address) {
+            return &tokens[i]
+        }
+    }
+    for i := range tokens {
+        if address == "" && strings.EqualFold(tokens[i].Symbol, symbol) {
+            return &tokens[i]
+        }
+    }
+    return nil
+}
+
+// purchases queries the completed purchases of a user before the end of a period
+func (s *TaxExportService) purchases(userID uuid.UUID, before time.Time) *gorm.DB {
+    return s.DB.Where("user_id = ? AND status = ? AND token_amount > 0 AND COALESCE(completed_at, created_at) < ?",
+        userID, models.TransactionStatusCompleted, before)
+}
+
+// walletTransactions queries the confirmed wallet transactions of a user before the end of a
+// period, and the failed ones that still cost gas. Deposits of the tokens of an exported purchase,
+// its bonus or a vesting claim of it are left out, since the purchase already acquired them.
+func (s *TaxExportService) walletTransactions(userID uuid.UUID, before time.Time) *gorm.DB {
+    return s.DB.Where("user_id = ? AND created_at < ?", userID, before).
+        Where("status = ? OR (status = ? AND direction = ? AND COALESCE(fee_wei, '') <> '')",
+            models.WalletTxStatusConfirmed, models.WalletTxStatusFailed, models.WalletTxDirectionOutgoing).
+        Where("direction <> ? OR NOT EXISTS (SELECT 1 FROM transactions WHERE transactions.user_id = wallet_transactions.user_id AND transactions.status = ? AND LOWER(wallet_transactions.tx_hash) IN (LOWER(transactions.blockchain_tx_hash), LOWER(transactions.swap_tx_hash), LOWER(transactions.bonus_tx_hash)))",
+            models.WalletTxDirectionIncoming, models.TransactionStatusCompleted).
+        Where("direction <> ? OR NOT EXISTS (SELECT 1 FROM vesting_claims WHERE vesting_claims.user_id = wallet_transactions.user_id AND LOWER(vesting_claims.tx_hash) = LOWER(wallet_transactions.tx_hash))",
+            models.WalletTxDirectionIncoming)
+}
+
+// CreateJob queues an export, reusing a queued or running one of the same request. A user has at most
+// MaxPending exports queued or running, since each finished one keeps its file until it expires.
+func (s *TaxExportService) CreateJob(userID uuid.UUID, req ExportRequest) (*models.TaxExport, error) {
+    var job models.TaxExport
+    err := s.DB.Transaction(func(tx *gorm.DB) error {
+        // Locking the user serializes their job creation, which keeps the cap
+        var user models.User
+        if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ?", userID).First(&user).Error; err != nil {
+            return fmt.Errorf("failed to load user: %w", err)
+        }
+
+        active := tx.Model(&models.TaxExport{}).Where("user_id = ? AND status IN ?",
+            userID, []string{models.TaxExportStatusPending, models.TaxExportStatusProcessing})
+        err := active.Session(&gorm.Session{}).Where("format = ? AND currency = ? AND period_start = ? AND period_end = ?",
+            req.Format, req.Currency, req.From, req.To).Omit("content").First(&job).Error
+        if err == nil {
+            return nil
+        }
+        if !errors.Is(err, gorm.ErrRecordNotFound) {
+            return fmt.Errorf("failed to find export: %w", err)
+        }
+
+        var count int64
+        if err := active.Session(&gorm.Session{}).Count(&count).Error; err != nil {
+            return fmt.Errorf("failed to count exports: %w", err)
+        }
+        if s.MaxPending > 0 && count >= int64(s.MaxPending) {
+            return fmt.Errorf("%w: wait for one of your %d exports to finish", ErrTooManyExports, count)
+        }
+
+        job = models.TaxExport{
+            UUID:        uuid.New(),
+            UserID:      userID,
+            Format:      req.Format,
+            Currency:    req.Currency,
+            PeriodStart: req.From,
+            PeriodEnd:   req.To,
+            Status:      models.TaxExportStatusPending,
+        }
+        if err := tx.Create(&job).Error; err != nil {
+            return fmt.Errorf("failed to queue export: %w", err)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return &job, nil
+}
+
+// Jobs lists the exports of a user, newest first, without their files
+func (s *TaxExportService) Jobs(userID uuid.UUID, limit, offset int) ([]models.TaxExport, int64, error) {
+    query := s.DB.Model(&models.TaxExport{}).Where("user_id = ?", userID)
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count exports: %w", err)
+    }
+
+    var jobs []models.TaxExport
+    if err := query.Omit("content").Order("created_at DESC").Limit(limit).Offset(offset).Find(&jobs).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to list exports: %w", err)
+    }
+    return jobs, total, nil
+}
+
+// Job returns an export of the user with its file
+func (s *TaxExportService) Job(userID uuid.UUID, id string) (*models.TaxExport, error) {
+    exportID, err := uuid.Parse(id)
+    if err != nil {
+        return nil, fmt.Errorf("export not found")
+    }
+
+    var job models.TaxExport
+    if err := s.DB.Where("uuid = ? AND user_id = ?", exportID, userID).First(&job).Error; err != nil {
+        if errors.Is(err, gorm.ErrRecordNotFound) {
+            return nil, fmt.Errorf("export not found")
+        }
+        return nil, fmt.Errorf("failed to find export: %w", err)
+    }
+    return &job, nil
+}
+
+// JobExportRequest returns the export request a job was queued with
+func JobExportRequest(job *models.TaxExport) ExportRequest {
+    return ExportRequest{Format: job.Format, Currency: job.Currency, From: job.PeriodStart, To: job.PeriodEnd}
+}
+
+// Run values new wallet transactions, records exchange rates, runs queued exports and drops expired
+// files until the process exits
+func (s *TaxExportService) Run(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        ctx, cancel := context.WithTimeout(context.Background(), exportJobTimeout)
+        if err := s.RecordRates(ctx); err != nil {
+            log.Printf("Exports: %v", err)
+        }
+        if err := s.ValueWalletTransactions(ctx); err != nil {
+            log.Printf("Exports: %v", err)
+        }
+        if err := s.RunJobs(ctx); err != nil {
+            log.Printf("Exports: %v", err)
+        }
+        cancel()
+
+        err := s.DB.Model(&models.TaxExport{}).
+            Where("status = ? AND expires_at < ? AND content IS NOT NULL", models.TaxExportStatusCompleted, time.Now()).
+            Update("content", nil).Error
+        if err != nil {
+            log.Printf("Exports: failed to drop expired files: %v", err)
+        }
+    }
+}
+
+// RecordRates stores today's rate of every export currency against USD, once a day
+func (s *TaxExportService) RecordRates(ctx context.Context) error {
+    today := time.Now().UTC().Format("2006-01-02")
+    for _, currency := range exportCurrencies {
+        if currency == "USD" {
+            continue
+        }
+
+        var count int64
+        if err := s.DB.Model(&models.ExchangeRate{}).Where("date = ? AND currency = ?", today, currency).Count(&count).Error; err != nil {
+            return fmt.Errorf("failed to check %s rate: %w", currency, err)
+        }
+        if count > 0 {
+            continue
+        }
+
+        rate, err := s.PriceService.GetFiatRate(ctx, currency)
+        if err != nil {
+            return err
+        }
+        err = s.DB.Clauses(clause.OnConflict{DoNothing: true}).
+            Create(&models.ExchangeRate{Date: today, Currency: currency, PerUSD: rate}).Error
+        if err != nil {
+            return fmt.Errorf("failed to record %s rate: %w", currency, err)
+        }
+    }
+    return nil
+}
+
+// ValueWalletTransactions records the USD prices of the token and ETH at trade time on wallet
+// transactions that have none yet. Transactions mined within exportLivePriceWindow get the current
+// prices, older ones the price history at their block time. Tokens priced through Uniswap have no
+// history and are left unpriced when older. Rows valued before trade time was tracked are valued
+// again unless they were valued within the window.
+func (s *TaxExportService) ValueWalletTransactions(ctx context.Context) error {
+    var walletTxs []models.WalletTransaction
+    if err := s.DB.Where("valued_at IS NULL OR priced_at IS NULL").Order("created_at DESC").Limit(exportValuationBatch).Find(&walletTxs).Error; err != nil {
+        return fmt.Errorf("failed to find unvalued wallet transactions: %w", err)
+    }
+    if len(walletTxs) == 0 {
+        return nil
+    }
+
+    var tokens []models.Token
+    if err := s.DB.Find(&tokens).Error; err != nil {
+        return fmt.Errorf("failed to load tokens: %w", err)
+    }
+
+    blockTimes := map[uint64]time.Time{}
+    for _, walletTx := range walletTxs {
+        tradedAt, err := s.tradeTime(ctx, &walletTx, blockTimes)
+    if err != nil {
+            log.Printf("Exports: no block time for %s: %v", walletTx.TxHash, err)
+            continue // Retried next pass
+        }
+
+        // Already valued at the price of its trade time
+        if walletTx.ValuedAt != nil && walletTx.ValuedAt.Sub(tradedAt) < exportLivePriceWindow {
+            if err := s.DB.Model(&models.WalletTransaction{}).Where("uuid = ?", walletTx.UUID).Update("priced_at", tradedAt).Error; err != nil {
+                return fmt.Errorf("failed to value wallet transaction %s: %w", walletTx.UUID, err)
+            }
+            continue
+        }
+
+        live := time.Since(tradedAt) < exportLivePriceWindow
+
+        var ethPrice float64
+        if live {
+            ethPrice, err = s.PriceService.GetEthPriceUSD(ctx)
+        } else {
+            ethPrice, err = s.PriceService.GetEthPriceUSDAt(ctx, tradedAt)
+        }
+        if err != nil {
+            log.Printf("Exports: no ETH price for %s: %v", tradedAt.Format(time.RFC3339), err)
+            continue
+    }
+
+        price := ethPrice
+        if !strings.EqualFold(walletTx.TokenSymbol, "ETH") || walletTx.TokenAddress != "" {
+            token := findToken(tokens, walletTx.TokenAddress, walletTx.TokenSymbol)
+            price = 0 // Unregistered tokens are never valued
+            if token != nil && token.PriceSource != models.TokenPriceSourceNone {
+                if live {
+                    price, err = s.PriceService.GetTokenPriceUSD(ctx, token)
+                } else {
+                    price, err = s.PriceService.GetTokenPriceUSDAt(ctx, token, tradedAt)
+                    }
+                switch {
+                case errors.Is(err, ErrNoPriceHistory):
+                    price = 0
+                case err != nil:
+                    log.Printf("Exports: no price for %s: %v", token.Symbol, err)
+                    continue
+                }
+            }
+        }
+
+        now := time.Now()
+        err = s.DB.Model(&models.WalletTransaction{}).Where("uuid = ?", walletTx.UUID).Updates(map[string]interface{}{
+            "price_usd":     price,
+            "eth_price_usd": ethPrice,
+            "valued_at":     now,
+            "priced_at":     tradedAt,
+        }).Error
+        if err != nil {
+            return fmt.Errorf("failed to value wallet transaction %s: %w", walletTx.UUID, err)
+        }
+    }
+    return nil
+}
+
+// tradeTime returns the time of the block a wallet transaction was mined in, or when it was recorded
+// if it has no block yet
+func (s *TaxExportService) tradeTime(ctx context.Context, walletTx *models.WalletTransaction, blockTimes map[uint64]time.Time) (time.Time, error) {
+    if walletTx.BlockNumber == 0 || s.EthClient == nil {
+        return walletTx.CreatedAt, nil
+    }
+    if at, ok := blockTimes[walletTx.BlockNumber]; ok {
+        return at, nil
+    }
+
+    header, err := s.EthClient.HeaderByNumber(ctx, new(big.Int).SetUint64(walletTx.BlockNumber))
+    if err != nil {
+        return time.Time{}, err
+    }
+    at := time.Unix(int64(header.Time), 0)
+    blockTimes[walletTx.BlockNumber] = at
+    return at, nil
+}
+
+// RunJobs runs queued exports, and ones whose worker was lost
+func (s *TaxExportService) RunJobs(ctx context.Context) error {
+    var jobs []models.TaxExport
+    err := s.DB.Omit("content").
+        Where("status = ? OR (status = ? AND updated_at < ?)",
+            models.TaxExportStatusPending, models.TaxExportStatusProcessing, time.Now().Add(-exportJobTimeout)).
+        Order("created_at").Limit(exportJobBatch).Find(&jobs).Error
+    if err != nil {
+        return fmt.Errorf("failed to find queued exports: %w", err)
+    }
+
+    started := map[uuid.UUID]bool{}
+    for i := range jobs {
+        job := &jobs[i]
+
+        // Run one export per user at a time
+        if started[job.UserID] {
+            continue
+        }
+        var running int64
+        err := s.DB.Model(&models.TaxExport{}).
+            Where("user_id = ? AND uuid <> ? AND status = ? AND updated_at >= ?",
+                job.UserID, job.UUID, models.TaxExportStatusProcessing, time.Now().Add(-exportJobTimeout)).
+            Count(&running).Error
+        if err != nil {
+            return fmt.Errorf("failed to count running exports: %w", err)
+        }
+        if running > 0 {
+            continue
+        }
+        started[job.UserID] = true
+
+        // Claim the job so a second instance skips it
+        claim := s.DB.Model(&models.TaxExport{}).
+            Where("uuid = ? AND status = ? AND updated_at = ?", job.UUID, job.Status, job.UpdatedAt).
+            Updates(map[string]interface{}{"status": models.TaxExportStatusProcessing, "updated_at": time.Now()})
+        if claim.Error != nil {
+            return fmt.Errorf("failed to claim export %s: %w", job.UUID, claim.Error)
+        }
+        if claim.RowsAffected == 0 {
+            continue
+        }
+
+        updates := map[string]interface{}{"updated_at": time.Now()}
+        content, records, err := s.Generate(ctx, job.UserID, JobExportRequest(job))
+        if err != nil {
+            log.Printf("Exports: %s: %v", job.UUID, err)
+            updates["status"] = models.TaxExportStatusFailed
+            updates["error_message"] = err.Error()
+        } else {
+            now := time.Now()
+            expires := now.Add(s.Retention)
+            updates["status"] = models.TaxExportStatusCompleted
+            updates["content"] = content
+            updates["records"] = records
+            updates["completed_at"] = now
+            updates["expires_at"] = expires
+        }
+        if err := s.DB.Model(&models.TaxExport{}).Where("uuid = ?", job.UUID).Updates(updates).Error; err != nil {
+            return fmt.Errorf("failed to save export %s: %w", job.UUID, err)
+        }
+    }
+    return nil
+}
+
+// rateBook converts amounts to the export currency at the rates recorded for their day
+type rateBook struct {
+    service  *TaxExportService
+    currency string
+    days     map[string]float64 // currency/date -> units per USD
+}
+
+func newRateBook(s *TaxExportService, currency string) *rateBook {
+    return &rateBook{service: s, currency: currency, days: map[string]float64{}}
+}
+
+// perUSD returns how many units of the export currency one USD bought on the day
+func (b *rateBook) perUSD(ctx context.Context, at time.Time) (float64, error) {
+    return b.rate(ctx, b.currency, at)
+}
+
+// convert changes an amount from a currency to the export currency at the day's rates
+func (b *rateBook) convert(ctx context.Context, amount float64, currency string, at time.Time) (float64, error) {
+    currency = strings.ToUpper(currency)
+    if amount == 0 || currency == b.currency {
+        return amount, nil
+    }
+    from, err := b.rate(ctx, currency, at)
+    if err != nil {
+        return 0, err
+    }
+    to, err := b.rate(ctx, b.currency, at)
+    if err != nil {
+        return 0, err
+    }
+    return amount / from * to, nil
+}
+
+// rate looks up the recorded rate of a day, falling back to the closest recorded day and then to
+// the live rate
+func (b *rateBook) rate(ctx context.Context, currency string, at time.Time) (float64, error) {
+    if currency == "USD" {
+        return 1, nil
+    }
+
+    date := at.UTC().Format("2006-01-02")
+    key := currency + "/" + date
+    if rate, ok := b.days[key]; ok {
+        return rate, nil
+    }
+
+    var recorded models.ExchangeRate
+    db := b.service.DB
+    err := db.Where("currency = ? AND date <= ?", currency, date).Order("date DESC").First(&recorded).Error
+    if errors.Is(err, gorm.ErrRecordNotFound) {
+        err = db.Where("currency = ? AND date > ?", currency, date).Order("date").First(&recorded).Error
+    }
+
+    rate := recorded.PerUSD
+    switch {
+    case err == nil:
+    case errors.Is(err, gorm.ErrRecordNotFound):
+        if rate, err = b.service.PriceService.GetFiatRate(ctx, currency); err != nil {
+            return 0, err
+        }
+    default:
+        return 0, fmt.Errorf("failed to find %s rate: %w", currency, err)
+    }
+
+    b.days[key] = rate
+    return rate, nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "strconv"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/ethclient"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// TokenRegistryService manages the ERC-20 tokens shown in wallet portfolios
+type TokenRegistryService struct {
+    DB        *gorm.DB
+    EthClient *ethclient.Client
+}
+
+// TokenInput holds the fields of a token registration or update; nil fields are left unchanged
+type TokenInput struct {
+    Symbol        *string `json:"symbol"`
+    Name          *string `json:"name"`
+    Decimals      *uint8  `json:"decimals"`
+    LogoURL       *string `json:"logo_url"`
+    PriceSource   *string `json:"price_source"`
+    PriceSourceID *string `json:"price_source_id"`
+    Enabled       *bool   `json:"enabled"`
+}
+
+// NewTokenRegistryService creates a new token registry service
+func NewTokenRegistryService(db *gorm.DB, ethClient *ethclient.Client) *TokenRegistryService {
+    return &TokenRegistryService{
+        DB:        db,
+        EthClient: ethClient,
+    }
+}
+
+// ListTokens returns registered tokens ordered by symbol
+func (s *TokenRegistryService) ListTokens(includeDisabled bool) ([]models.Token, error) {
+    var tokens []models.Token
+    query := s.DB.Order("symbol")
+    if !includeDisabled {
+        query = query.Where("enabled = ?", true)
+    }
+    if err := query.Find(&tokens).Error; err != nil {
+        return nil, fmt.Errorf("failed to list tokens: %w", err)
+    }
+    return tokens, nil
+}
+
+// RegisterToken adds a token; symbol, name and decimals are read from the contract when not given
+func (s *TokenRegistryService) RegisterToken(ctx context.Context, address string, input TokenInput) (*models.Token, error) {
+    if !common.IsHexAddress(address) {
+        return nil, fmt.Errorf("invalid token address")
+    }
+    tokenAddress := common.HexToAddress(address)
+
+    var count int64
+    if err := s.DB.Model(&models.Token{}).Where("LOWER(address) = LOWER(?)", tokenAddress.Hex()).Count(&count).Error; err != nil {
+        return nil, fmt.Errorf("failed to check token: %w", err)
+    }
+    if count > 0 {
+        return nil, fmt.Errorf("token %s is already registered", tokenAddress.Hex())
+    }
+
+    token := models.Token{
+        UUID:        uuid.New(),
+        Address:     tokenAddress.Hex(),
+        Decimals:    18,
+        PriceSource: models.TokenPriceSourceNone,
+        Enabled:     true,
+        CreatedAt:   time.Now(),
+        UpdatedAt:   time.Now(),
+    }
+
+    // Fill in metadata from the contract, explicit input wins
+    if input.Symbol == nil || input.Decimals == nil || input.Name == nil {
+        if err := s.readMetadata(ctx, &token); err != nil && input.Symbol == nil {
+            return nil, fmt.Errorf("failed to read token metadata: %w", err)
+        }
+    }
+
+    if err := applyTokenInput(&token, input); err != nil {
+        return nil, err
+    }
+
+    if err := s.DB.Create(&token).Error; err != nil {
+        return nil, fmt.Errorf("failed to register token: %w", err)
+    }
+
+    return &token, nil
+}
+
+// GetToken finds a registered token by address or UUID
+func (s *TokenRegistryService) GetToken(id string) (*models.Token, error) {
+    var token models.Token
+    var err error
+    if common.IsHexAddress(id) {
+        err = s.DB.Where("LOWER(address) = LOWER(?)", id).First(&token).Error
+    } else if tokenID, parseErr := uuid.Parse(id); parseErr == nil {
+        err = s.DB.Where("uuid = ?", tokenID).First(&token).Error
+    } else {
+        err = gorm.ErrRecordNotFound
+    }
+
+    if err != nil {
+        return nil, fmt.Errorf("token not found")
+    }
+    return &token, nil
+}
+
+// UpdateToken changes a registered token's metadata, price source or visibility
+func (s *TokenRegistryService) UpdateToken(id string, input TokenInput) (*models.Token, error) {
+    token, err := s.GetToken(id)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := applyTokenInput(token, input); err != nil {
+        return nil, err
+    }
+    token.UpdatedAt = time.Now()
+
+    if err := s.DB.Save(token).Error; err != nil {
+        return nil, fmt.Errorf("failed to update token: %w", err)
+    }
+
+    return token, nil
+}
+
+// SeedToken registers a configured token on startup unless it is already in the registry
+func (s *TokenRegistryService) SeedToken(ctx context.Context, address common.Address, priceSource, priceSourceID string) {
+    if address == (common.Address{}) {
+        return
+    }
+
+    var count int64
+    if err := s.DB.Model(&models.Token{}).Where("LOWER(address) = LOWER(?)", address.Hex()).Count(&count).Error; err != nil || count > 0 {
+        return
+    }
+
+    if _, err := s.RegisterToken(ctx, address.Hex(), TokenInput{
+        PriceSource:   &priceSource,
+        PriceSourceID: &priceSourceID,
+    }); err != nil {
+        log.Printf("Warning: failed to seed token %s: %v", address.Hex(), err)
+    }
+}
+
+// readMetadata reads symbol, name and decimals from the token contract
+func (s *TokenRegistryService) readMetadata(ctx context.Context, token *models.Token) error {
+    contract, err := blockchain.NewERC20(common.HexToAddress(token.Address), s.EthClient)
+    if err != nil {
+        return err
+    }
+    opts := &bind.CallOpts{Context: ctx}
+
+    symbol, err := contract.Symbol(opts)
+    if err != nil {
+        return err
+    }
+    token.Symbol = symbol
+
+    if name, err := contract.Name(opts); err == nil {
+        token.Name = name
+    }
+    if decimals, err := contract.Decimals(opts); err == nil {
+        token.Decimals = decimals
+    }
+
+    return nil
+}
+
+// applyTokenInput copies the set fields of the input onto the token and validates the result
+func applyTokenInput(token *models.Token, input TokenInput) error {
+    if input.Symbol != nil {
+        token.Symbol = strings.TrimSpace(*input.Symbol)
+    }
+    if input.Name != nil {
+        token.Name = strings.TrimSpace(*input.Name)
+    }
+    if input.Decimals != nil {
+        token.Decimals = *input.Decimals
+    }
+    if input.LogoURL != nil {
+        token.LogoURL = strings.TrimSpace(*input.LogoURL)
+    }
+    if input.PriceSource != nil {
+        token.PriceSource = *input.PriceSource
+    }
+    if input.PriceSourceID != nil {
+        token.PriceSourceID = strings.TrimSpace(*input.PriceSourceID)
+    }
+    if input.Enabled != nil {
+        token.Enabled = *input.Enabled
+    }
+
+    if token.Symbol == "" {
+        return fmt.Errorf("token symbol is required")
+    }
+    if token.Decimals > 36 {
+        return fmt.Errorf("token decimals must be at most 36")
+    }
+    if !models.IsValidTokenPriceSource(token.PriceSource) {
+        return fmt.Errorf("unknown price source: %s", token.PriceSource)
+    }
+
+    switch token.PriceSource {
+    case models.TokenPriceSourceCoinGecko:
+        if token.PriceSourceID == "" {
+            return fmt.Errorf("price_source_id must be the CoinGecko coin id")
+        }
+    case models.TokenPriceSourceFixed:
+        if price, err := strconv.ParseFloat(token.PriceSourceID, 64); err != nil || price < 0 {
+            return fmt.Errorf("price_source_id must be the fixed USD price")
+        }
+    }
+
+    return nil
+}
@@ -0,0 +1,633 @@
+package services
+
+import (
+    "context"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "math/big"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/pkg/contracts"
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ethereum/go-ethereum/ethclient"
+    "github.com/ethereum/go-ethereum/rlp"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+)
+
+// Fallback gas limits when a transaction cannot be estimated yet, e.g. a swap waiting on its approval
+const (
+    defaultSwapGasLimit     = uint64(250000)
+    defaultApproveGasLimit  = uint64(60000)
+    defaultTransferGasLimit = uint64(65000)
+)
+
+// droppedTxTimeout is how long a broadcast transaction may be unknown to the node before it is failed
+const droppedTxTimeout = 30 * time.Minute
+
+// TxBuilderService builds unsigned transactions for non-custodial users and
+// broadcasts the transactions they sign client-side
+type TxBuilderService struct {
+    DB              *gorm.DB
+    EthClient       *ethclient.Client
+    UniswapRouter   common.Address
+    WrappedEthToken common.Address
+    CifoToken       common.Address
+    erc20ABI        abi.ABI
+    routerABI       abi.ABI
+}
+
+// UnsignedTx is a fully populated transaction ready for client-side signing
+type UnsignedTx struct {
+    Purpose              string `json:"purpose"` // approve, swap, transfer
+    Type                 uint8  `json:"type"`    // 0 = legacy, 2 = EIP-1559
+    ChainID              string `json:"chain_id"`
+    From                 string `json:"from"`
+    To                   string `json:"to"`
+    Nonce                uint64 `json:"nonce"`
+    Value                string `json:"value"` // wei
+    Data                 string `json:"data"`
+    Gas                  uint64 `json:"gas"`
+    GasPrice             string `json:"gas_price,omitempty"`
+    MaxFeePerGas         string `json:"max_fee_per_gas,omitempty"`
+    MaxPriorityFeePerGas string `json:"max_priority_fee_per_gas,omitempty"`
+    UnsignedRLP          string `json:"unsigned_rlp"` // Signing payload (EIP-2718 typed or EIP-155 legacy)
+    SigningHash          string `json:"signing_hash"` // keccak256 of the signing payload
+}
+
+// NewTxBuilderService creates a new transaction builder service
+func NewTxBuilderService(
+    db *gorm.DB,
+    ethClient *ethclient.Client,
+    uniswapRouter common.Address,
+    wrappedEthToken common.Address,
+    cifoToken common.Address,
+) (*TxBuilderService, error) {
+    erc20ABI, err := abi.JSON(strings.NewReader(blockchain.ERC20ABI))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse ERC20 ABI: %w", err)
+    }
+
+    routerABI, err := abi.JSON(strings.NewReader(contracts.UniswapV2Router02ABI))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse router ABI: %w", err)
+    }
+
+    return &TxBuilderService{
+        DB:              db,
+        EthClient:       ethClient,
+        UniswapRouter:   uniswapRouter,
+        WrappedEthToken: wrappedEthToken,
+        CifoToken:       cifoToken,
+        erc20ABI:        erc20ABI,
+        routerABI:       routerABI,
+    }, nil
+}
+
+// BuildTransfer builds an ETH or ERC-20 transfer
+func (s *TxBuilderService) BuildTransfer(ctx context.Context, from common.Address, token string, to common.Address, amount *big.Int) (*UnsignedTx, error) {
+    tx, chainID, err := s.TransferTx(ctx, from, token, to, amount)
+    if err != nil {
+        return nil, err
+    }
+
+    return newUnsignedTx("transfer", from, tx, chainID)
+}
+
+// TransferTx builds an unsigned ETH or ERC-20 transfer with the next pending nonce
+func (s *TxBuilderService) TransferTx(ctx context.Context, from common.Address, token string, to common.Address, amount *big.Int) (*types.Transaction, *big.Int, error) {
+    nonce, err := s.EthClient.PendingNonceAt(ctx, from)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to get nonce: %w", err)
+    }
+
+    tokenAddr, isETH, err := s.resolveToken(token)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if isETH {
+        return s.buildTx(ctx, from, to, amount, nil, nonce, 21000)
+    }
+
+    data, err := s.erc20ABI.Pack("transfer", to, amount)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to encode transfer: %w", err)
+    }
+
+    return s.buildTx(ctx, from, tokenAddr, big.NewInt(0), data, nonce, 0)
+}
+
+// BuildApprove builds an ERC-20 approval for the spender
+func (s *TxBuilderService) BuildApprove(ctx context.Context, from common.Address, token string, spender common.Address, amount *big.Int) (*UnsignedTx, error) {
+    tx, chainID, err := s.ApproveTx(ctx, from, token, spender, amount)
+    if err != nil {
+        return nil, err
+    }
+
+    return newUnsignedTx("approve", from, tx, chainID)
+}
+
+// ApproveTx builds an unsigned ERC-20 approval with the next pending nonce
+func (s *TxBuilderService) ApproveTx(ctx context.Context, from common.Address, token string, spender common.Address, amount *big.Int) (*types.Transaction, *big.Int, error) {
+    tokenAddr, isETH, err := s.resolveToken(token)
+    if err != nil {
+        return nil, nil, err
+    }
+    if isETH {
+        return nil, nil, fmt.Errorf("ETH does not need an approval")
+    }
+
+    nonce, err := s.EthClient.PendingNonceAt(ctx, from)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to get nonce: %w", err)
+    }
+
+    data, err := s.erc20ABI.Pack("approve", spender, amount)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to encode approve: %w", err)
+    }
+
+    return s.buildTx(ctx, from, tokenAddr, big.NewInt(0), data, nonce, 0)
+}
+
+// BuildSwap builds a Uniswap swap, preceded by an approval when the router allowance is too low.
+// The returned transactions must be signed and broadcast in order.
+func (s *TxBuilderService) BuildSwap(ctx context.Context, from common.Address, fromToken, toToken string, amount *big.Int, slippageTolerance float64) ([]*UnsignedTx, error) {
+    fromAddr, fromETH, err := s.resolveToken(fromToken)
+    if err != nil {
+        return nil, err
+    }
+    toAddr, toETH, err := s.resolveToken(toToken)
+    if err != nil {
+        return nil, err
+    }
+    if fromETH && toETH {
+        return nil, fmt.Errorf("cannot swap ETH for ETH")
+    }
+
+    // Uniswap routes native ETH through WETH
+    if fromETH {
+        fromAddr = s.WrappedEthToken
+    }
+    if toETH {
+        toAddr = s.WrappedEthToken
+    }
+    path := []common.Address{fromAddr, toAddr}
+
+    // Quote the swap and apply slippage
+    router, err := blockchain.NewUniswapRouter(s.UniswapRouter, s.EthClient)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create Uniswap router: %w", err)
+    }
+    amounts, err := router.GetAmountsOut(amount, path)
+    if err != nil || len(amounts) < 2 {
+        return nil, fmt.Errorf("failed to quote swap: %v", err)
+    }
+    minAmountOut := new(big.Int).Div(
+        new(big.Int).Mul(amounts[len(amounts)-1], big.NewInt(int64((100-slippageTolerance)*100))),
+        big.NewInt(10000),
+    )
+    deadline := big.NewInt(time.Now().Add(20 * time.Minute).Unix())
+
+    nonce, err := s.EthClient.PendingNonceAt(ctx, from)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get nonce: %w", err)
+    }
+
+    var txs []*UnsignedTx
+    swapGasLimit := uint64(0)
+
+    // Token input needs a router allowance first
+    if !fromETH {
+        token, err := blockchain.NewERC20(fromAddr, s.EthClient)
+        if err != nil {
+            return nil, fmt.Errorf("failed to create token contract: %w", err)
+        }
+
+        allowance, err := token.Allowance(&bind.CallOpts{Context: ctx}, from, s.UniswapRouter)
+        if err != nil {
+            return nil, fmt.Errorf("failed to check allowance: %w", err)
+        }
+
+        if allowance.Cmp(amount) < 0 {
+            data, err := s.erc20ABI.Pack("approve", s.UniswapRouter, amount)
+            if err != nil {
+                return nil, fmt.Errorf("failed to encode approve: %w", err)
+            }
+
+            approveTx, err := s.unsignedTx(ctx, "approve", from, fromAddr, big.NewInt(0), data, nonce, 0)
+            if err != nil {
+                return nil, err
+            }
+            txs = append(txs, approveTx)
+            nonce++
+
+            // The swap cannot be simulated until the approval is mined
+            swapGasLimit = defaultSwapGasLimit
+        }
+    }
+
+    var (
+        data  []byte
+        value = big.NewInt(0)
+    )
+    switch {
+    case fromETH:
+        value = amount
+        data, err = s.routerABI.Pack("swapExactETHForTokens", minAmountOut, path, from, deadline)
+    case toETH:
+        data, err = s.routerABI.Pack("swapExactTokensForETH", amount, minAmountOut, path, from, deadline)
+    default:
+        data, err = s.routerABI.Pack("swapExactTokensForTokens", amount, minAmountOut, path, from, deadline)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode swap: %w", err)
+    }
+
+    swapTx, err := s.unsignedTx(ctx, "swap", from, s.UniswapRouter, value, data, nonce, swapGasLimit)
+    if err != nil {
+        return nil, err
+    }
+
+    return append(txs, swapTx), nil
+}
+
+// Broadcast submits a client-signed raw transaction and records it for tracking
+func (s *TxBuilderService) Broadcast(ctx context.Context, userID uuid.UUID, rawTxHex string) (*models.WalletTransaction, error) {
+    raw, err := hex.DecodeString(strings.TrimPrefix(rawTxHex, "0x"))
+    if err != nil {
+        return nil, fmt.Errorf("invalid raw transaction encoding")
+    }
+
+    tx := new(types.Transaction)
+    if err := tx.UnmarshalBinary(raw); err != nil {
+        return nil, fmt.Errorf("invalid raw transaction: %w", err)
+    }
+
+    chainID, err := s.EthClient.ChainID(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get chain ID: %w", err)
+    }
+    // Unprotected (pre-EIP-155) transactions could be replayed on any chain
+    if !tx.Protected() {
+        return nil, fmt.Errorf("transaction must be signed with a chain ID (EIP-155)")
+    }
+    if tx.ChainId().Cmp(chainID) != 0 {
+        return nil, fmt.Errorf("transaction is for chain %s, expected %s", tx.ChainId(), chainID)
+    }
+
+    sender, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+    if err != nil {
+        return nil, fmt.Errorf("invalid transaction signature: %w", err)
+    }
+
+    owned, err := s.UserOwnsAddress(userID, sender)
+    if err != nil {
+        return nil, err
+    }
+    if !owned {
+        return nil, fmt.Errorf("transaction sender %s is not linked to this account", sender.Hex())
+    }
+
+    return s.SendAndRecord(ctx, userID, sender, tx)
+}
+
+// SendAndRecord broadcasts a signed transaction and records it as a pending wallet transaction
+func (s *TxBuilderService) SendAndRecord(ctx context.Context, userID uuid.UUID, sender common.Address, tx *types.Transaction) (*models.WalletTransaction, error) {
+    if err := s.EthClient.SendTransaction(ctx, tx); err != nil {
+        return nil, fmt.Errorf("failed to broadcast transaction: %w", err)
+    }
+
+    walletTx := s.describeTx(tx)
+    walletTx.UUID = uuid.New()
+    walletTx.UserID = userID
+    walletTx.WalletAddress = sender.Hex()
+    walletTx.TxHash = tx.Hash().Hex()
+    walletTx.Status = models.WalletTxStatusPending
+    walletTx.CreatedAt = time.Now()
+    walletTx.UpdatedAt = time.Now()
+
+    if result := s.DB.Create(walletTx); result.Error != nil {
+        return nil, fmt.Errorf("failed to save transaction: %w", result.Error)
+    }
+
+    return walletTx, nil
+}
+
+// RefreshStatus updates a pending wallet transaction from its receipt
+func (s *TxBuilderService) RefreshStatus(ctx context.Context, userID uuid.UUID, txHash string) (*models.WalletTransaction, error) {
+    var walletTx models.WalletTransaction
+    if result := s.DB.Where("user_id = ? AND LOWER(tx_hash) = LOWER(?)", userID, txHash).First(&walletTx); result.Error != nil {
+        return nil, fmt.Errorf("transaction not found")
+    }
+
+    if err := s.applyReceipt(ctx, &walletTx); err != nil {
+        return nil, err
+    }
+
+    return &walletTx, nil
+}
+
+// LockSender serializes custodial sends from one address, from reading its pending nonce
+// until the signed transaction is broadcast, so concurrent sends cannot reuse a nonce.
+// It returns the unlock function. The lock is shared with the hot wallet clients.
+func (s *TxBuilderService) LockSender(from common.Address) func() {
+    return blockchain.LockSender(from)
+}
+
+// TrackPending refreshes pending wallet transactions from their receipts until the process exits
+func (s *TxBuilderService) TrackPending(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        var pending []models.WalletTransaction
+        // Incoming deposits wait for confirmations in the DepositWatcherService instead
+        if err := s.DB.Where("status = ? AND direction = ? AND tx_hash <> ''", models.WalletTxStatusPending, models.WalletTxDirectionOutgoing).
+            Order("created_at").Limit(100).Find(&pending).Error; err != nil {
+            log.Printf("Wallet tx tracker: failed to load pending transactions: %v", err)
+            continue
+        }
+
+        for i := range pending {
+            ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+            if err := s.applyReceipt(ctx, &pending[i]); err != nil {
+                log.Printf("Wallet tx tracker: %s: %v", pending[i].TxHash, err)
+            }
+            cancel()
+        }
+    }
+}
+
+// applyReceipt moves a pending wallet transaction to confirmed or failed once it is mined.
+// Transactions the node no longer knows about are failed after droppedTxTimeout.
+func (s *TxBuilderService) applyReceipt(ctx context.Context, walletTx *models.WalletTransaction) error {
+    if walletTx.Status != models.WalletTxStatusPending || walletTx.Direction == models.WalletTxDirectionIncoming {
+        return nil
+    }
+
+    hash := common.HexToHash(walletTx.TxHash)
+    status := ""
+    feeWei := ""
+
+    receipt, err := s.EthClient.TransactionReceipt(ctx, hash)
+    switch {
+    case err == nil:
+        status = models.WalletTxStatusConfirmed
+        if receipt.Status == types.ReceiptStatusFailed {
+            status = models.WalletTxStatusFailed
+        }
+        if receipt.EffectiveGasPrice != nil {
+            feeWei = new(big.Int).Mul(new(big.Int).SetUint64(receipt.GasUsed), receipt.EffectiveGasPrice).String()
+        }
+    case err == ethereum.NotFound:
+        if time.Since(walletTx.CreatedAt) < droppedTxTimeout {
+            return nil
+        }
+        if _, _, err := s.EthClient.TransactionByHash(ctx, hash); err != ethereum.NotFound {
+            return nil // Still in the mempool, or the node could not tell
+        }
+        status = models.WalletTxStatusFailed
+    default:
+        return fmt.Errorf("failed to get receipt: %w", err)
+    }
+
+    walletTx.Status = status
+    walletTx.FeeWei = feeWei
+    walletTx.UpdatedAt = time.Now()
+    return s.DB.Model(walletTx).Updates(map[string]interface{}{
+        "status":     status,
+        "fee_wei":    feeWei,
+        "updated_at": walletTx.UpdatedAt,
+    }).Error
+}
+
+// UserOwnsAddress checks whether the address is the user's primary or a linked wallet
+func (s *TxBuilderService) UserOwnsAddress(userID uuid.UUID, address common.Address) (bool, error) {
+    var count int64
+    if err := s.DB.Model(&models.User{}).
+        Where("uuid = ? AND LOWER(wallet_address) = LOWER(?)", userID, address.Hex()).
+        Count(&count).Error; err != nil {
+        return false, fmt.Errorf("failed to check wallet ownership: %w", err)
+    }
+    if count > 0 {
+        return true, nil
+    }
+
+    if err := s.DB.Model(&models.Wallet{}).
+        Where("user_id = ? AND LOWER(wallet_address) = LOWER(?)", userID, address.Hex()).
+        Count(&count).Error; err != nil {
+        return false, fmt.Errorf("failed to check wallet ownership: %w", err)
+    }
+
+    return count > 0, nil
+}
+
+// unsignedTx builds a transaction and wraps it for client-side signing
+func (s *TxBuilderService) unsignedTx(ctx context.Context, purpose string, from, to common.Address, value *big.Int, data []byte, nonce uint64, gasLimit uint64) (*UnsignedTx, error) {
+    tx, chainID, err := s.buildTx(ctx, from, to, value, data, nonce, gasLimit)
+    if err != nil {
+        return nil, err
+    }
+
+    return newUnsignedTx(purpose, from, tx, chainID)
+}
+
+// buildTx fills in chain ID, fees and gas. A gasLimit of 0 means estimate.
+func (s *TxBuilderService) buildTx(ctx context.Context, from, to common.Address, value *big.Int, data []byte, nonce uint64, gasLimit uint64) (*types.Transaction, *big.Int, error) {
+    chainID, err := s.EthClient.ChainID(ctx)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to get chain ID: %w", err)
+    }
+
+    if gasLimit == 0 {
+        gasLimit, err = s.EthClient.EstimateGas(ctx, ethereum.CallMsg{From: from, To: &to, Value: value, Data: data})
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to estimate gas: %w", err)
+        }
+        // Leave headroom for state changes between build and broadcast
+        gasLimit = gasLimit * 12 / 10
+    }
+
+    header, err := s.EthClient.HeaderByNumber(ctx, nil)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to get latest block: %w", err)
+    }
+
+    var tx *types.Transaction
+    if header.BaseFee != nil {
+        tip, err := s.EthClient.SuggestGasTipCap(ctx)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to suggest priority fee: %w", err)
+        }
+        feeCap := new(big.Int).Add(new(big.Int).Mul(header.BaseFee, big.NewInt(2)), tip)
+
+        tx = types.NewTx(&types.DynamicFeeTx{
+            ChainID:   chainID,
+            Nonce:     nonce,
+            GasTipCap: tip,
+            GasFeeCap: feeCap,
+            Gas:       gasLimit,
+            To:        &to,
+            Value:     value,
+            Data:      data,
+        })
+    } else {
+        gasPrice, err := s.EthClient.SuggestGasPrice(ctx)
+        if err != nil {
+            return nil, nil, fmt.Errorf("failed to suggest gas price: %w", err)
+        }
+
+        tx = types.NewTx(&types.LegacyTx{
+            Nonce:    nonce,
+            GasPrice: gasPrice,
+            Gas:      gasLimit,
+            To:       &to,
+            Value:    value,
+            Data:     data,
+        })
+    }
+
+    return tx, chainID, nil
+}
+
+// newUnsignedTx computes the signing payload of a transaction
+func newUnsignedTx(purpose string, from common.Address, tx *types.Transaction, chainID *big.Int) (*UnsignedTx, error) {
+    payload, err := signingPayload(tx, chainID)
+    if err != nil {
+        return nil, err
+    }
+
+    unsigned := &UnsignedTx{
+        Purpose:     purpose,
+        Type:        tx.Type(),
+        ChainID:     chainID.String(),
+        From:        from.Hex(),
+        To:          tx.To().Hex(),
+        Nonce:       tx.Nonce(),
+        Value:       tx.Value().String(),
+        Data:        "0x" + hex.EncodeToString(tx.Data()),
+        Gas:         tx.Gas(),
+        UnsignedRLP: "0x" + hex.EncodeToString(payload),
+        SigningHash: crypto.Keccak256Hash(payload).Hex(),
+    }
+    if tx.Type() == types.DynamicFeeTxType {
+        unsigned.MaxFeePerGas = tx.GasFeeCap().String()
+        unsigned.MaxPriorityFeePerGas = tx.GasTipCap().String()
+    } else {
+        unsigned.GasPrice = tx.GasPrice().String()
+    }
+
+    return unsigned, nil
+}
+
+// signingPayload returns the RLP payload a wallet hashes and signs for the transaction
+func signingPayload(tx *types.Transaction, chainID *big.Int) ([]byte, error) {
+    if tx.Type() == types.DynamicFeeTxType {
+        body, err := rlp.EncodeToBytes([]interface{}{
+            chainID, tx.Nonce(), tx.GasTipCap(), tx.GasFeeCap(), tx.Gas(), tx.To(), tx.Value(), tx.Data(), types.AccessList{},
+        })
+        if err != nil {
+            return nil, fmt.Errorf("failed to encode transaction: %w", err)
+        }
+        return append([]byte{types.DynamicFeeTxType}, body...), nil
+    }
+
+    // EIP-155 legacy payload
+    payload, err := rlp.EncodeToBytes([]interface{}{
+        tx.Nonce(), tx.GasPrice(), tx.Gas(), tx.To(), tx.Value(), tx.Data(), chainID, uint(0), uint(0),
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode transaction: %w", err)
+    }
+    return payload, nil
+}
+
+// resolveToken maps ETH, CIFO, WETH or a contract address to a token address
+func (s *TxBuilderService) resolveToken(token string) (common.Address, bool, error) {
+    switch strings.ToUpper(token) {
+    case "ETH":
+        return common.Address{}, true, nil
+    case "CIFO":
+        return s.CifoToken, false, nil
+    case "WETH":
+        return s.WrappedEthToken, false, nil
+    }
+
+    if common.IsHexAddress(token) {
+        return common.HexToAddress(token), false, nil
+    }
+
+    return common.Address{}, false, fmt.Errorf("unsupported token: %s", token)
+}
+
+// tokenSymbol returns a display symbol for a known token address
+func (s *TxBuilderService) tokenSymbol(address common.Address) string {
+    switch address {
+    case s.CifoToken:
+        return "CIFO"
+    case s.WrappedEthToken:
+        return "WETH"
+    default:
+        return address.Hex()
+    }
+}
+
+// describeTx derives the wallet transaction type, token and amount from calldata
+func (s *TxBuilderService) describeTx(tx *types.Transaction) *models.WalletTransaction {
+    walletTx := &models.WalletTransaction{
+        TxType:      "contract_call",
+        Amount:      tx.Value().String(),
+        TokenSymbol: "ETH",
+    }
+    if tx.To() != nil {
+        walletTx.ToAddress = tx.To().Hex()
+    }
+
+    data := tx.Data()
+    if len(data) == 0 {
+        walletTx.TxType = "transfer"
+        return walletTx
+    }
+    if len(data) < 4 || tx.To() == nil {
+        return walletTx
+    }
+
+    if method, err := s.erc20ABI.MethodById(data[:4]); err == nil && (method.Name == "transfer" || method.Name == "approve") {
+        args, err := method.Inputs.Unpack(data[4:])
+        if err == nil && len(args) == 2 {
+            walletTx.TxType = method.Name
+            walletTx.TokenSymbol = s.tokenSymbol(*tx.To())
+            walletTx.ToAddress = args[0].(common.Address).Hex()
+            walletTx.Amount = args[1].(*big.Int).String()
+        }
+        return walletTx
+    }
+
+    if *tx.To() == s.UniswapRouter {
+        walletTx.TxType = "swap"
+        if method, err := s.routerABI.MethodById(data[:4]); err == nil && method.Name != "swapExactETHForTokens" {
+            args, err := method.Inputs.Unpack(data[4:])
+            if err == nil && len(args) > 2 {
+                if amountIn, ok := args[0].(*big.Int); ok {
+                    walletTx.Amount = amountIn.String()
+                }
+                if path, ok := args[2].([]common.Address); ok && len(path) > 0 {
+                    walletTx.TokenSymbol = s.tokenSymbol(path[0])
+                }
+            }
+        }
+    }
+
+    return walletTx
+}
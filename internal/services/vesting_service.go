@@ -0,0 +1,294 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// VestingService creates vesting schedules for purchases in vesting rounds and releases the vested
+// tokens from the treasury, which is the TokenClient's signer.
+type VestingService struct {
+    DB          *gorm.DB
+    TokenClient *blockchain.TokenClient
+}
+
+// VestingScheduleStatus is a schedule with what it has vested and what can be claimed now
+type VestingScheduleStatus struct {
+    models.VestingSchedule
+    Vested    float64 `json:"vested"`
+    Claimable float64 `json:"claimable"`
+}
+
+// VestingSummary totals a user's vesting schedules
+type VestingSummary struct {
+    Total     float64                 `json:"total"`
+    Vested    float64                 `json:"vested"`
+    Claimed   float64                 `json:"claimed"`
+    Claimable float64                 `json:"claimable"`
+    Schedules []VestingScheduleStatus `json:"schedules"`
+}
+
+// NewVestingService creates a new vesting service
+func NewVestingService(db *gorm.DB, tokenClient *blockchain.TokenClient) *VestingService {
+    return &VestingService{
+        DB:          db,
+        TokenClient: tokenClient,
+    }
+}
+
+// Schedules returns the user's schedules with their vested and claimable amounts
+func (s *VestingService) Schedules(userID uuid.UUID) (*VestingSummary, error) {
+    if err := s.syncSchedules(userID); err != nil {
+        return nil, err
+    }
+
+    var schedules []models.VestingSchedule
+    if err := s.DB.Where("user_id = ?", userID).Order("starts_at").Find(&schedules).Error; err != nil {
+        return nil, fmt.Errorf("failed to list vesting schedules: %w", err)
+    }
+
+    now := time.Now()
+    summary := &VestingSummary{Schedules: make([]VestingScheduleStatus, 0, len(schedules))}
+    for _, schedule := range schedules {
+        status := VestingScheduleStatus{
+            VestingSchedule: schedule,
+            Vested:          schedule.VestedAmount(now),
+            Claimable:       schedule.ClaimableAmount(now),
+        }
+        summary.Total += schedule.TotalAmount
+        summary.Vested += status.Vested
+        summary.Claimed += schedule.ClaimedAmount
+        summary.Claimable += status.Claimable
+        summary.Schedules = append(summary.Schedules, status)
+    }
+
+    return summary, nil
+}
+
+// Claims returns a page of the user's claims, newest first, and their total count
+func (s *VestingService) Claims(userID uuid.UUID, limit, offset int) ([]models.VestingClaim, int64, error) {
+    query := s.DB.Model(&models.VestingClaim{}).Where("user_id = ?", userID)
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count vesting claims: %w", err)
+    }
+
+    var claims []models.VestingClaim
+    if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&claims).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to list vesting claims: %w", err)
+    }
+
+    return claims, total, nil
+}
+
+// Claim sends what a schedule has vested and not yet released to its beneficiary. The amount is
+// booked against the schedule before the transfer so concurrent claims cannot release it twice.
+// A claim whose transfer is not confirmed in time is returned pending and settled by Run.
+func (s *VestingService) Claim(userID uuid.UUID, scheduleID string) (*models.VestingClaim, error) {
+    if s.TokenClient == nil {
+        return nil, fmt.Errorf("vesting claims are not enabled")
+    }
+    if err := s.syncSchedules(userID); err != nil {
+        return nil, err
+    }
+
+    id, err := uuid.Parse(scheduleID)
+    if err != nil {
+        return nil, fmt.Errorf("vesting schedule not found")
+    }
+
+    var claim models.VestingClaim
+    err = s.DB.Transaction(func(tx *gorm.DB) error {
+        var schedule models.VestingSchedule
+        if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("uuid = ? AND user_id = ?", id, userID).First(&schedule).Error; err != nil {
+            return fmt.Errorf("vesting schedule not found")
+        }
+
+        now := time.Now()
+        amount := schedule.ClaimableAmount(now)
+        if amount <= 0 {
+            if now.Before(schedule.CliffEndsAt) {
+                return fmt.Errorf("nothing to claim before the cliff ends at %s", schedule.CliffEndsAt.Format(time.RFC3339))
+            }
+            return fmt.Errorf("nothing to claim")
+        }
+
+        claim = models.VestingClaim{
+            UUID:        uuid.New(),
+            ScheduleID:  schedule.UUID,
+            UserID:      userID,
+            Beneficiary: schedule.Beneficiary,
+            Amount:      amount,
+            Status:      models.VestingClaimStatusPending,
+            CreatedAt:   now,
+            UpdatedAt:   now,
+        }
+        if err := tx.Create(&claim).Error; err != nil {
+            return fmt.Errorf("failed to save claim: %w", err)
+        }
+        return tx.Model(&schedule).Updates(map[string]interface{}{
+            "claimed_amount": schedule.ClaimedAmount + amount,
+            "updated_at":     now,
+        }).Error
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    txHash, outcome, err := sendBookedTransfer(s.TokenClient, common.HexToAddress(claim.Beneficiary), claim.AmountInWei(), func(txHash string) error {
+        return s.DB.Model(&models.VestingClaim{}).Where("uuid = ?", claim.UUID).Update("tx_hash", txHash).Error
+    })
+    claim.TxHash = txHash
+    if dbErr := s.settleClaim(&claim, outcome, err); dbErr != nil {
+        log.Printf("Vesting: failed to update claim %s: %v", claim.UUID, dbErr)
+    }
+    if outcome == transferFailed {
+        return &claim, fmt.Errorf("failed to release vested tokens: %w", err)
+    }
+    if err != nil {
+        log.Printf("Vesting: claim %s not confirmed yet: %v", claim.UUID, err)
+    }
+
+    return &claim, nil
+}
+
+// Run checks the transfers of pending claims at the given interval until the process exits
+func (s *VestingService) Run(interval time.Duration) {
+    if s.TokenClient == nil {
+        return
+    }
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for range ticker.C {
+        ctx, cancel := context.WithTimeout(context.Background(), interval)
+        if err := s.ReconcileClaims(ctx); err != nil {
+            log.Printf("Vesting: %v", err)
+        }
+        cancel()
+    }
+}
+
+// ReconcileClaims settles pending claims from the receipts of their transfers. Claims that were
+// never sent or were dropped give their amount back to the schedule.
+func (s *VestingService) ReconcileClaims(ctx context.Context) error {
+    var claims []models.VestingClaim
+    if err := s.DB.Where("status = ? AND created_at < ?", models.VestingClaimStatusPending, time.Now().Add(-bookedTransferTimeout)).
+        Order("created_at").Find(&claims).Error; err != nil {
+        return fmt.Errorf("failed to list pending claims: %w", err)
+    }
+
+    for i := range claims {
+        claim := &claims[i]
+        outcome, err := checkBookedTransfer(ctx, s.TokenClient, claim.TxHash, claim.CreatedAt)
+        if err != nil {
+            log.Printf("Vesting: failed to check claim %s: %v", claim.UUID, err)
+            continue
+        }
+        if outcome == transferPending {
+            continue
+        }
+
+        var reason error
+        if outcome == transferFailed {
+            reason = fmt.Errorf("transfer was not mined")
+            if claim.TxHash != "" {
+                reason = fmt.Errorf("transfer %s reverted or was dropped", claim.TxHash)
+            }
+        }
+        if err := s.settleClaim(claim, outcome, reason); err != nil {
+            log.Printf("Vesting: failed to update claim %s: %v", claim.UUID, err)
+            continue
+        }
+        log.Printf("Vesting: claim %s is %s", claim.UUID, claim.Status)
+    }
+
+    return nil
+}
+
+// settleClaim records the outcome of a pending claim's transfer, giving the amount back to the
+// schedule when nothing was sent. A claim settled meanwhile is left alone.
+func (s *VestingService) settleClaim(claim *models.VestingClaim, outcome transferOutcome, transferErr error) error {
+    claim.UpdatedAt = time.Now()
+    switch outcome {
+    case transferCompleted:
+        claim.Status = models.VestingClaimStatusCompleted
+        claim.ErrorMessage = ""
+    case transferFailed:
+        claim.Status = models.VestingClaimStatusFailed
+    }
+    if transferErr != nil {
+        claim.ErrorMessage = transferErr.Error()
+    }
+
+    return s.DB.Transaction(func(tx *gorm.DB) error {
+        result := tx.Model(&models.VestingClaim{}).Where("uuid = ? AND status = ?", claim.UUID, models.VestingClaimStatusPending).
+            Updates(map[string]interface{}{
+                "status":        claim.Status,
+                "tx_hash":       claim.TxHash,
+                "error_message": claim.ErrorMessage,
+                "updated_at":    claim.UpdatedAt,
+            })
+        if result.Error != nil {
+            return result.Error
+        }
+        if result.RowsAffected == 0 || outcome != transferFailed {
+            return nil
+        }
+        return tx.Model(&models.VestingSchedule{}).Where("uuid = ?", claim.ScheduleID).
+            Update("claimed_amount", gorm.Expr("claimed_amount - ?", claim.Amount)).Error
+    })
+}
+
+// syncSchedules creates the schedules of the user's completed vesting purchases that have none yet,
+// with the terms of their round
+func (s *VestingService) syncSchedules(userID uuid.UUID) error {
+    var transactions []models.Transaction
+    err := s.DB.Where("user_id = ? AND status = ? AND sale_round_id IS NOT NULL AND vesting_wallet <> ''", userID, models.TransactionStatusCompleted).
+        Where("NOT EXISTS (SELECT 1 FROM vesting_schedules WHERE vesting_schedules.transaction_id = transactions.uuid)").
+        Find(&transactions).Error
+    if err != nil {
+        return fmt.Errorf("failed to find vesting purchases: %w", err)
+    }
+
+    for _, transaction := range transactions {
+        var round models.SaleRound
+        if err := s.DB.Where("uuid = ?", *transaction.SaleRoundID).First(&round).Error; err != nil {
+            return fmt.Errorf("failed to load sale round of %s: %w", transaction.PaymentID, err)
+        }
+
+        startsAt := transaction.UpdatedAt
+        if transaction.CompletedAt != nil {
+            startsAt = *transaction.CompletedAt
+        }
+        schedule := models.VestingSchedule{
+            UUID:          uuid.New(),
+            UserID:        userID,
+            TransactionID: transaction.UUID,
+            SaleRoundID:   round.UUID,
+            Beneficiary:   transaction.VestingWallet,
+            TotalAmount:   transaction.TokenAmount,
+            StartsAt:      startsAt,
+            CliffEndsAt:   startsAt.AddDate(0, 0, round.VestingCliffDays),
+            EndsAt:        startsAt.AddDate(0, 0, max(round.VestingDays, 1)),
+            CreatedAt:     time.Now(),
+            UpdatedAt:     time.Now(),
+        }
+        if err := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&schedule).Error; err != nil {
+            return fmt.Errorf("failed to create vesting schedule for %s: %w", transaction.PaymentID, err)
+        }
+    }
+
+    return nil
+}
@@ -1,14 +1,37 @@
 package services
 
 import (
+    "crypto/sha256"
+    "encoding/hex"
     "fmt"
+    "strings"
     "time"
 
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
     "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/pkg/shamir"
     "github.com/google/uuid"
+    "github.com/tyler-smith/go-bip39"
     "gorm.io/gorm"
 )
 
+// Limits for Shamir share backups
+const (
+    MinShareThreshold = shamir.MinThreshold
+    MaxShareCount     = 10
+)
+
+// ShareBackup is a mnemonic split into Shamir shares. User and email shares
+// are only available here, at creation time.
+type ShareBackup struct {
+    SetID       uuid.UUID `json:"set_id"`
+    Threshold   int       `json:"threshold"`
+    TotalShares int       `json:"total_shares"`
+    UserShares  []string  `json:"user_shares"`
+    EmailShare  string    `json:"-"`
+    EmailIndex  int       `json:"email_share_index,omitempty"`
+}
+
 // WalletStorageService handles secure storage of wallet credentials
 type WalletStorageService struct {
     WalletDB        *gorm.DB
@@ -33,22 +56,31 @@ func NewWalletStorageService(
 }
 
 // StoreMnemonic stores an encrypted mnemonic for a user's wallet
-func (s *WalletStorageService) StoreMnemonic(userUUID uuid.UUID, walletAddress string, mnemonic string, pathIndex uint32) error {
+func (s *WalletStorageService) StoreMnemonic(userUUID uuid.UUID, walletAddress string, mnemonic string, pathIndex uint32, derivationPath string) error {
+    // Generate a data key for this record
+    dataKey, err := s.EncryptionSvc.GenerateDataKey()
+    if err != nil {
+        return fmt.Errorf("failed to generate data key: %w", err)
+    }
+
     // Encrypt the mnemonic
-    encMnemonic, err := s.EncryptionSvc.Encrypt([]byte(mnemonic))
+    encMnemonic, err := s.EncryptionSvc.Encrypt(dataKey, []byte(mnemonic))
     if err != nil {
         return fmt.Errorf("failed to encrypt mnemonic: %w", err)
     }
 
     // Create mnemonic record
     mnemonicRecord := models.WalletMnemonic{
-        UUID:          uuid.New(),
-        UserUUID:      userUUID,
-        WalletAddress: walletAddress,
-        EncMnemonic:   encMnemonic,
-        PathIndex:     pathIndex,
-        CreatedAt:     time.Now(),
-        UpdatedAt:     time.Now(),
+        UUID:           uuid.New(),
+        UserUUID:       userUUID,
+        WalletAddress:  walletAddress,
+        EncMnemonic:    encMnemonic,
+        PathIndex:      pathIndex,
+        DerivationPath: derivationPath,
+        EncDataKey:     dataKey.Wrapped,
+        KeyVersion:     dataKey.KeyVersion,
+        CreatedAt:      time.Now(),
+        UpdatedAt:      time.Now(),
     }
 
     // Save to wallet database
@@ -61,13 +93,19 @@ func (s *WalletStorageService) StoreMnemonic(userUUID uuid.UUID, walletAddress s
 
 // StorePrivateKey stores an encrypted private key for a user's wallet
 func (s *WalletStorageService) StorePrivateKey(userUUID uuid.UUID, walletAddress string, privateKey string, keystoreJSON []byte) error {
+    // Generate a data key for this record
+    dataKey, err := s.EncryptionSvc.GenerateDataKey()
+    if err != nil {
+        return fmt.Errorf("failed to generate data key: %w", err)
+    }
+
     // Encrypt the private key and keystore JSON
-    encPrivateKey, err := s.EncryptionSvc.Encrypt([]byte(privateKey))
+    encPrivateKey, err := s.EncryptionSvc.Encrypt(dataKey, []byte(privateKey))
     if err != nil {
         return fmt.Errorf("failed to encrypt private key: %w", err)
     }
 
-    encKeystoreJSON, err := s.EncryptionSvc.Encrypt(keystoreJSON)
+    encKeystoreJSON, err := s.EncryptionSvc.Encrypt(dataKey, keystoreJSON)
     if err != nil {
         return fmt.Errorf("failed to encrypt keystore JSON: %w", err)
     }
@@ -79,6 +117,8 @@ func (s *WalletStorageService) StorePrivateKey(userUUID uuid.UUID, walletAddress
         WalletAddress:  walletAddress,
         EncPrivateKey:  encPrivateKey,
         EncKeystoreJSON: encKeystoreJSON,
+        EncDataKey:     dataKey.Wrapped,
+        KeyVersion:     dataKey.KeyVersion,
         CreatedAt:      time.Now(),
         UpdatedAt:      time.Now(),
     }
@@ -101,8 +141,14 @@ func (s *WalletStorageService) GetMnemonic(userUUID uuid.UUID, walletAddress str
         return "", 0, fmt.Errorf("mnemonic not found: %w", result.Error)
     }
 
+    // Unwrap the record's data key
+    dataKey, err := s.EncryptionSvc.OpenDataKey(mnemonicRecord.EncDataKey, mnemonicRecord.KeyVersion)
+    if err != nil {
+        return "", 0, err
+    }
+
     // Decrypt the mnemonic
-    mnemonicBytes, err := s.EncryptionSvc.Decrypt(mnemonicRecord.EncMnemonic)
+    mnemonicBytes, err := s.EncryptionSvc.Decrypt(dataKey, mnemonicRecord.EncMnemonic)
     if err != nil {
         return "", 0, fmt.Errorf("failed to decrypt mnemonic: %w", err)
     }
@@ -120,8 +166,14 @@ func (s *WalletStorageService) GetPrivateKey(userUUID uuid.UUID, walletAddress s
         return "", fmt.Errorf("wallet not found: %w", result.Error)
     }
 
+    // Unwrap the record's data key
+    dataKey, err := s.EncryptionSvc.OpenDataKey(wallet.EncDataKey, wallet.KeyVersion)
+    if err != nil {
+        return "", err
+    }
+
     // Decrypt the private key
-    privateKeyBytes, err := s.EncryptionSvc.Decrypt(wallet.EncPrivateKey)
+    privateKeyBytes, err := s.EncryptionSvc.Decrypt(dataKey, wallet.EncPrivateKey)
     if err != nil {
         return "", fmt.Errorf("failed to decrypt private key: %w", err)
     }
@@ -139,8 +191,14 @@ func (s *WalletStorageService) GetKeystoreJSON(userUUID uuid.UUID, walletAddress
         return nil, fmt.Errorf("wallet not found: %w", result.Error)
     }
 
+    // Unwrap the record's data key
+    dataKey, err := s.EncryptionSvc.OpenDataKey(wallet.EncDataKey, wallet.KeyVersion)
+    if err != nil {
+        return nil, err
+    }
+
     // Decrypt the keystore JSON
-    keystoreBytes, err := s.EncryptionSvc.Decrypt(wallet.EncKeystoreJSON)
+    keystoreBytes, err := s.EncryptionSvc.Decrypt(dataKey, wallet.EncKeystoreJSON)
     if err != nil {
         return nil, fmt.Errorf("failed to decrypt keystore JSON: %w", err)
     }
@@ -150,8 +208,14 @@ func (s *WalletStorageService) GetKeystoreJSON(userUUID uuid.UUID, walletAddress
 
 // CreateBackup creates a backup of wallet data
 func (s *WalletStorageService) CreateBackup(userUUID uuid.UUID, walletAddress string, backupType string, data []byte) error {
+    // Generate a data key for this record
+    dataKey, err := s.EncryptionSvc.GenerateDataKey()
+    if err != nil {
+        return fmt.Errorf("failed to generate data key: %w", err)
+    }
+
     // Encrypt the backup data
-    encData, err := s.EncryptionSvc.Encrypt(data)
+    encData, err := s.EncryptionSvc.Encrypt(dataKey, data)
     if err != nil {
         return fmt.Errorf("failed to encrypt backup data: %w", err)
     }
@@ -163,6 +227,8 @@ func (s *WalletStorageService) CreateBackup(userUUID uuid.UUID, walletAddress st
         WalletAddress: walletAddress,
         BackupType:   backupType,
         BackupData:   encData,
+        EncDataKey:   dataKey.Wrapped,
+        KeyVersion:   dataKey.KeyVersion,
         CreatedAt:    time.Now(),
     }
 
@@ -219,12 +285,251 @@ func (s *WalletStorageService) DeleteWalletCredentials(userUUID uuid.UUID, walle
         return fmt.Errorf("failed to delete backups: %w", err)
     }
 
+    // Delete share backups
+    if err := s.WalletDB.Where("user_uuid = ? AND wallet_address = ?", userUUID, walletAddress).
+        Delete(&models.WalletShare{}).Error; err != nil {
+        return fmt.Errorf("failed to delete share backups: %w", err)
+    }
+
     return nil
 }
 
+// DeleteAllUserCredentials deletes every stored credential for a user
+func (s *WalletStorageService) DeleteAllUserCredentials(userUUID uuid.UUID) error {
+    return s.WalletDB.Transaction(func(tx *gorm.DB) error {
+        for _, model := range []interface{}{&models.WalletMnemonic{}, &models.EncryptedWallet{}, &models.WalletBackup{}, &models.WalletShare{}} {
+            if err := tx.Where("user_uuid = ?", userUUID).Delete(model).Error; err != nil {
+                return fmt.Errorf("failed to delete wallet credentials: %w", err)
+            }
+        }
+        return nil
+    })
+}
+
 // ValidateUser ensures the user exists in the main database
 func (s *WalletStorageService) ValidateUser(userUUID uuid.UUID) (bool, error) {
     var user models.User
     result := s.MainDB.Where("uuid = ?", userUUID).First(&user)
     return result.Error == nil, result.Error
-}
\ No newline at end of file
+}
+
+// CreateShareBackup splits the stored mnemonic into totalShares Shamir shares,
+// any threshold of which rebuild it. The server vault keeps one share, one is
+// set aside for email when requested and the rest go to the user. Creating a
+// new set replaces the previous one.
+func (s *WalletStorageService) CreateShareBackup(userUUID uuid.UUID, walletAddress string, threshold, totalShares int, emailShare bool) (*ShareBackup, error) {
+    if threshold < MinShareThreshold || threshold > totalShares || totalShares > MaxShareCount {
+        return nil, fmt.Errorf("threshold must be between %d and the share count, with at most %d shares", MinShareThreshold, MaxShareCount)
+    }
+
+    // One share stays in the vault and one may go by email, the user gets the rest
+    userShareCount := totalShares - 1
+    if emailShare {
+        userShareCount--
+    }
+    if userShareCount < 1 {
+        return nil, fmt.Errorf("at least one share must be given to the user")
+    }
+
+    mnemonic, _, err := s.GetMnemonic(userUUID, walletAddress)
+    if err != nil {
+        return nil, err
+    }
+
+    // Share the BIP-39 entropy rather than the words to keep shares short
+    entropy, err := bip39.EntropyFromMnemonic(mnemonic)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decode mnemonic: %w", err)
+    }
+
+    shares, err := shamir.Split(entropy, totalShares, threshold)
+    if err != nil {
+        return nil, fmt.Errorf("failed to split mnemonic: %w", err)
+    }
+
+    dataKey, err := s.EncryptionSvc.GenerateDataKey()
+    if err != nil {
+        return nil, fmt.Errorf("failed to generate data key: %w", err)
+    }
+
+    backup := &ShareBackup{
+        SetID:       uuid.New(),
+        Threshold:   threshold,
+        TotalShares: totalShares,
+    }
+
+    records := make([]models.WalletShare, 0, totalShares)
+    for i, share := range shares {
+        record := models.WalletShare{
+            UUID:          uuid.New(),
+            SetID:         backup.SetID,
+            UserUUID:      userUUID,
+            WalletAddress: walletAddress,
+            Threshold:     threshold,
+            TotalShares:   totalShares,
+            ShareIndex:    shamir.Index(share),
+            ShareHash:     hashShare(share),
+            CreatedAt:     time.Now(),
+        }
+
+        switch {
+        case i == 0:
+            record.Holder = models.ShareHolderServer
+            record.EncShare, err = s.EncryptionSvc.Encrypt(dataKey, share)
+            if err != nil {
+                return nil, fmt.Errorf("failed to encrypt vault share: %w", err)
+            }
+            record.EncDataKey = dataKey.Wrapped
+            record.KeyVersion = dataKey.KeyVersion
+        case i == 1 && emailShare:
+            record.Holder = models.ShareHolderEmail
+            backup.EmailShare = hex.EncodeToString(share)
+            backup.EmailIndex = record.ShareIndex
+        default:
+            record.Holder = models.ShareHolderUser
+            backup.UserShares = append(backup.UserShares, hex.EncodeToString(share))
+        }
+
+        records = append(records, record)
+    }
+
+    err = s.WalletDB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Where("user_uuid = ? AND wallet_address = ?", userUUID, walletAddress).
+            Delete(&models.WalletShare{}).Error; err != nil {
+            return err
+        }
+        return tx.Create(&records).Error
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to store share backup: %w", err)
+    }
+
+    return backup, nil
+}
+
+// DeleteShareSet removes a share set, used when its shares could not be delivered
+func (s *WalletStorageService) DeleteShareSet(setID uuid.UUID) error {
+    if err := s.WalletDB.Where("set_id = ?", setID).Delete(&models.WalletShare{}).Error; err != nil {
+        return fmt.Errorf("failed to delete share backup: %w", err)
+    }
+    return nil
+}
+
+// RecoverFromShares rebuilds a mnemonic from hex encoded shares. The vault share is
+// only added when the caller asks for it, after step-up, and fewer than threshold
+// shares are submitted. The result is checked against the stored wallet address.
+func (s *WalletStorageService) RecoverFromShares(userUUID uuid.UUID, walletAddress string, encodedShares []string, useVaultShare bool) (string, error) {
+    shares := make([][]byte, 0, len(encodedShares)+1)
+    hashes := make([]string, 0, len(encodedShares))
+    for _, encoded := range encodedShares {
+        share, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(encoded), "0x"))
+        if err != nil || len(share) < 2 {
+            return "", fmt.Errorf("invalid share format")
+        }
+        shares = append(shares, share)
+        hashes = append(hashes, hashShare(share))
+    }
+
+    if len(shares) == 0 {
+        return "", fmt.Errorf("no shares provided")
+    }
+
+    var records []models.WalletShare
+    if err := s.WalletDB.Where("user_uuid = ? AND wallet_address = ? AND share_hash IN ?", userUUID, walletAddress, hashes).
+        Find(&records).Error; err != nil {
+        return "", fmt.Errorf("failed to load shares: %w", err)
+    }
+
+    if len(records) != len(hashes) {
+        return "", fmt.Errorf("one or more shares do not belong to this wallet's current backup")
+    }
+
+    setID := records[0].SetID
+    threshold := records[0].Threshold
+    includesVault := false
+    for _, record := range records {
+        if record.SetID != setID {
+            return "", fmt.Errorf("shares come from different backups")
+        }
+        if record.Holder == models.ShareHolderServer {
+            includesVault = true
+        }
+    }
+
+    if len(shares) < threshold && useVaultShare && !includesVault {
+        vaultShare, err := s.getVaultShare(setID)
+        if err != nil {
+            return "", err
+        }
+        shares = append(shares, vaultShare)
+    }
+
+    if len(shares) < threshold {
+        return "", fmt.Errorf("%d shares required, %d provided", threshold, len(shares))
+    }
+
+    entropy, err := shamir.Combine(shares)
+    if err != nil {
+        return "", fmt.Errorf("failed to combine shares: %w", err)
+    }
+
+    mnemonic, err := bip39.NewMnemonic(entropy)
+    if err != nil {
+        return "", fmt.Errorf("failed to rebuild mnemonic: %w", err)
+    }
+
+    // Verify the rebuilt mnemonic derives the stored wallet
+    var mnemonicRecord models.WalletMnemonic
+    if err := s.WalletDB.Where("user_uuid = ? AND wallet_address = ?", userUUID, walletAddress).
+        First(&mnemonicRecord).Error; err != nil {
+        return "", fmt.Errorf("mnemonic not found: %w", err)
+    }
+
+    hdWallet, err := blockchain.NewHDWalletFromMnemonic(mnemonic)
+    if err != nil {
+        return "", fmt.Errorf("rebuilt mnemonic is invalid: %w", err)
+    }
+
+    path := mnemonicRecord.DerivationPath
+    if path == "" {
+        path = blockchain.AccountPath(mnemonicRecord.PathIndex)
+    }
+
+    account, err := hdWallet.DeriveAccountFromPath(path)
+    if err != nil {
+        return "", fmt.Errorf("failed to derive account: %w", err)
+    }
+
+    if !strings.EqualFold(account.Address.Hex(), mnemonicRecord.WalletAddress) {
+        return "", fmt.Errorf("rebuilt mnemonic does not match the wallet address")
+    }
+
+    return mnemonic, nil
+}
+
+// getVaultShare decrypts the server-held share of a set
+func (s *WalletStorageService) getVaultShare(setID uuid.UUID) ([]byte, error) {
+    var record models.WalletShare
+    if err := s.WalletDB.Where("set_id = ? AND holder = ?", setID, models.ShareHolderServer).
+        First(&record).Error; err != nil {
+        return nil, fmt.Errorf("vault share not found: %w", err)
+    }
+
+    dataKey, err := s.EncryptionSvc.OpenDataKey(record.EncDataKey, record.KeyVersion)
+    if err != nil {
+        return nil, err
+    }
+
+    share, err := s.EncryptionSvc.Decrypt(dataKey, record.EncShare)
+    if err != nil {
+        return nil, fmt.Errorf("failed to decrypt vault share: %w", err)
+    }
+
+    return share, nil
+}
+
+// hashShare returns the hex SHA-256 of a share
+func hashShare(share []byte) string {
+    sum := sha256.Sum256(share)
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+    "context"
+    "fmt"
+    "math/big"
+    "sync"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Gap limits for wallet discovery
+const (
+    DefaultDiscoveryGapLimit = 20
+    MaxDiscoveryGapLimit     = 50
+    maxDiscoveryScan         = 200 // Indexes probed per layout at most
+)
+
+// WalletDiscoveryService scans the accounts of a mnemonic for on-chain activity
+type WalletDiscoveryService struct {
+    EthClient *ethclient.Client
+    Tokens    []common.Address // ERC-20 tokens checked for balances
+}
+
+// DiscoveredToken is a token balance found on a discovered account
+type DiscoveredToken struct {
+    Address string `json:"address"`
+    Symbol  string `json:"symbol"`
+    Balance string `json:"balance"` // Smallest unit
+}
+
+// DiscoveredAccount is an account with activity found during discovery
+type DiscoveredAccount struct {
+    Layout         string            `json:"layout"`
+    DerivationPath string            `json:"derivation_path"`
+    Index          uint32            `json:"index"`
+    Address        string            `json:"address"`
+    EthBalance     string            `json:"eth_balance"` // Wei
+    Nonce          uint64            `json:"nonce"`
+    Tokens         []DiscoveredToken `json:"tokens,omitempty"`
+    AlreadyAdded   bool              `json:"already_added"`
+}
+
+// NewWalletDiscoveryService creates a new wallet discovery service
+func NewWalletDiscoveryService(ethClient *ethclient.Client, tokens ...common.Address) *WalletDiscoveryService {
+    // Drop unset and duplicate token addresses
+    unique := make([]common.Address, 0, len(tokens))
+    seen := make(map[common.Address]bool)
+    for _, token := range tokens {
+        if token == (common.Address{}) || seen[token] {
+            continue
+        }
+        seen[token] = true
+        unique = append(unique, token)
+    }
+
+    return &WalletDiscoveryService{
+        EthClient: ethClient,
+        Tokens:    unique,
+    }
+}
+
+// Discover scans each layout until gapLimit consecutive unused accounts are
+// found, and returns the accounts that have a balance, a nonce or tokens
+func (s *WalletDiscoveryService) Discover(ctx context.Context, mnemonic string, layouts []string, gapLimit int) ([]DiscoveredAccount, error) {
+    if gapLimit <= 0 {
+        gapLimit = DefaultDiscoveryGapLimit
+    }
+    if gapLimit > MaxDiscoveryGapLimit {
+        gapLimit = MaxDiscoveryGapLimit
+    }
+    if len(layouts) == 0 {
+        layouts = []string{blockchain.PathLayoutBIP44, blockchain.PathLayoutLedgerLive}
+    }
+
+    hdWallet, err := blockchain.NewHDWalletFromMnemonic(mnemonic)
+    if err != nil {
+        return nil, fmt.Errorf("invalid mnemonic: %w", err)
+    }
+
+    symbols := s.tokenSymbols(ctx)
+    discovered := make([]DiscoveredAccount, 0)
+    seen := make(map[string]bool) // Index 0 is the same account in both layouts
+
+    for _, layout := range layouts {
+        if _, err := blockchain.LayoutPath(layout, 0); err != nil {
+            return nil, err
+        }
+
+        lastUsed := -1
+        for start := 0; start < maxDiscoveryScan && start-lastUsed <= gapLimit; start += gapLimit {
+            probes, err := s.probeRange(ctx, hdWallet, layout, uint32(start), gapLimit, symbols)
+            if err != nil {
+                return nil, err
+            }
+
+            for _, probe := range probes {
+                if !probe.used {
+                    continue
+                }
+                lastUsed = int(probe.account.Index)
+                if !seen[probe.account.Address] {
+                    seen[probe.account.Address] = true
+                    discovered = append(discovered, probe.account)
+                }
+            }
+        }
+    }
+
+    return discovered, nil
+}
+
+// discoveryProbe is the result of checking one account
+type discoveryProbe struct {
+    account DiscoveredAccount
+    used    bool
+}
+
+// probeRange checks count consecutive accounts concurrently
+func (s *WalletDiscoveryService) probeRange(ctx context.Context, hdWallet *blockchain.HDWallet, layout string, start uint32, count int, symbols map[common.Address]string) ([]discoveryProbe, error) {
+    probes := make([]discoveryProbe, count)
+    errs := make([]error, count)
+
+    var wg sync.WaitGroup
+    for i := 0; i < count; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            probes[i], errs[i] = s.probe(ctx, hdWallet, layout, start+uint32(i), symbols)
+        }(i)
+    }
+    wg.Wait()
+
+    for _, err := range errs {
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    return probes, nil
+}
+
+// probe derives one account and checks its balance, nonce and token balances
+func (s *WalletDiscoveryService) probe(ctx context.Context, hdWallet *blockchain.HDWallet, layout string, index uint32, symbols map[common.Address]string) (discoveryProbe, error) {
+    path, err := blockchain.LayoutPath(layout, index)
+    if err != nil {
+        return discoveryProbe{}, err
+    }
+
+    account, err := hdWallet.DeriveAccountFromPath(path)
+    if err != nil {
+        return discoveryProbe{}, fmt.Errorf("failed to derive %s: %w", path, err)
+    }
+
+    balance, err := s.EthClient.BalanceAt(ctx, account.Address, nil)
+    if err != nil {
+        return discoveryProbe{}, fmt.Errorf("failed to get balance: %w", err)
+    }
+
+    nonce, err := s.EthClient.NonceAt(ctx, account.Address, nil)
+    if err != nil {
+        return discoveryProbe{}, fmt.Errorf("failed to get nonce: %w", err)
+    }
+
+    result := discoveryProbe{
+        account: DiscoveredAccount{
+            Layout:         layout,
+            DerivationPath: path,
+            Index:          index,
+            Address:        account.Address.Hex(),
+            EthBalance:     balance.String(),
+            Nonce:          nonce,
+        },
+        used: balance.Sign() > 0 || nonce > 0,
+    }
+
+    for _, token := range s.Tokens {
+        tokenBalance, err := s.tokenBalance(ctx, token, account.Address)
+        if err != nil || tokenBalance.Sign() == 0 {
+            continue
+        }
+
+        result.used = true
+        result.account.Tokens = append(result.account.Tokens, DiscoveredToken{
+            Address: token.Hex(),
+            Symbol:  symbols[token],
+            Balance: tokenBalance.String(),
+        })
+    }
+
+    return result, nil
+}
+
+// tokenBalance returns an ERC-20 balance
+func (s *WalletDiscoveryService) tokenBalance(ctx context.Context, token, owner common.Address) (*big.Int, error) {
+    contract, err := blockchain.NewERC20(token, s.EthClient)
+    if err != nil {
+        return nil, err
+    }
+    return contract.BalanceOf(&bind.CallOpts{Context: ctx}, owner)
+}
+
+// tokenSymbols looks up the symbol of each configured token once per scan
+func (s *WalletDiscoveryService) tokenSymbols(ctx context.Context) map[common.Address]string {
+    symbols := make(map[common.Address]string, len(s.Tokens))
+    for _, token := range s.Tokens {
+        symbols[token] = token.Hex()
+        contract, err := blockchain.NewERC20(token, s.EthClient)
+        if err != nil {
+            continue
+        }
+        if symbol, err := contract.Symbol(&bind.CallOpts{Context: ctx}); err == nil {
+            symbols[token] = symbol
+        }
+    }
+    return symbols
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"math/big"
+	"strings"
 	"time"
 
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
@@ -13,6 +14,9 @@ import (
 	"gorm.io/gorm"
 )
 
+// maxAccountIndex bounds the search for an unused account index
+const maxAccountIndex = 1000
+
 // WalletService handles wallet-related operations
 type WalletService struct {
     DB *gorm.DB
@@ -53,11 +57,15 @@ func (s *WalletService) CreateUserWallet(userID uuid.UUID, storeCredentials bool
 
     // Create wallet record in main DB
     wallet := models.Wallet{
-        UUID:          uuid.New(),
-        UserID:        userID,
-        WalletAddress: account.Address.Hex(),
-        CreatedAt:     time.Now(),
-        UpdatedAt:     time.Now(),
+        UUID:           uuid.New(),
+        UserID:         userID,
+        WalletAddress:  account.Address.Hex(),
+        Label:          defaultAccountLabel(0),
+        DerivationPath: blockchain.AccountPath(0),
+        AccountIndex:   0,
+        IsDefault:      true,
+        CreatedAt:      time.Now(),
+        UpdatedAt:      time.Now(),
     }
 
     if result := s.DB.Create(&wallet); result.Error != nil {
@@ -67,7 +75,7 @@ func (s *WalletService) CreateUserWallet(userID uuid.UUID, storeCredentials bool
     // If storing credentials is requested
     if storeCredentials && s.StorageService != nil {
         // Store the mnemonic
-        err = s.StorageService.StoreMnemonic(userID, account.Address.Hex(), hdWallet.Mnemonic, 0)
+        err = s.StorageService.StoreMnemonic(userID, account.Address.Hex(), hdWallet.Mnemonic, 0, blockchain.AccountPath(0))
         if err != nil {
             // Log the error but don't fail the wallet creation
             fmt.Printf("Warning: Failed to store mnemonic: %v\n", err)
@@ -108,13 +116,27 @@ func (s *WalletService) ImportWalletFromMnemonic(userID uuid.UUID, mnemonic stri
         return nil, fmt.Errorf("failed to derive account: %w", err)
     }
 
+    // The first wallet a user adds becomes their default account
+    var existing int64
+    s.DB.Model(&models.Wallet{}).Where("user_id = ?", userID).Count(&existing)
+
+    // Labels select accounts, so keep them unique across imported mnemonics
+    label := defaultAccountLabel(index)
+    if s.checkLabelAvailable(userID, label, uuid.Nil) != nil {
+        label = fmt.Sprintf("%s (%s)", label, account.Address.Hex()[:8])
+    }
+
     // Create wallet record
     wallet := models.Wallet{
-        UUID:          uuid.New(),
-        UserID:        userID,
-        WalletAddress: account.Address.Hex(),
-        CreatedAt:     time.Now(),
-        UpdatedAt:     time.Now(),
+        UUID:           uuid.New(),
+        UserID:         userID,
+        WalletAddress:  account.Address.Hex(),
+        Label:          label,
+        DerivationPath: blockchain.AccountPath(index),
+        AccountIndex:   index,
+        IsDefault:      existing == 0,
+        CreatedAt:      time.Now(),
+        UpdatedAt:      time.Now(),
     }
 
     if result := s.DB.Create(&wallet); result.Error != nil {
@@ -123,26 +145,357 @@ func (s *WalletService) ImportWalletFromMnemonic(userID uuid.UUID, mnemonic stri
 
     // If storing credentials is requested
     if storeCredentials && s.StorageService != nil {
-        // Store the mnemonic
-        err = s.StorageService.StoreMnemonic(userID, account.Address.Hex(), mnemonic, index)
+        if err := s.storeAccountCredentials(userID, account, mnemonic, index, blockchain.AccountPath(index)); err != nil {
+            s.DB.Delete(&wallet)
+            return nil, err
+        }
+    }
+
+    return &wallet, nil
+}
+
+// ListAccounts returns the user's wallet accounts, default first
+func (s *WalletService) ListAccounts(userID uuid.UUID) ([]models.Wallet, error) {
+    var wallets []models.Wallet
+    if err := s.DB.Where("user_id = ?", userID).Order("is_default DESC, created_at ASC").Find(&wallets).Error; err != nil {
+        return nil, fmt.Errorf("failed to list accounts: %w", err)
+    }
+    return wallets, nil
+}
+
+// ResolveAccount finds one of the user's accounts by address, UUID or label.
+// An empty selector returns the default account.
+func (s *WalletService) ResolveAccount(userID uuid.UUID, selector string) (*models.Wallet, error) {
+    selector = strings.TrimSpace(selector)
+    query := s.DB.Where("user_id = ?", userID)
+
+    var wallet models.Wallet
+    var err error
+    switch {
+    case selector == "":
+        err = query.Order("is_default DESC, created_at ASC").First(&wallet).Error
+    case common.IsHexAddress(selector):
+        err = query.Where("LOWER(wallet_address) = LOWER(?)", selector).First(&wallet).Error
+    default:
+        if id, parseErr := uuid.Parse(selector); parseErr == nil {
+            err = query.Where("uuid = ?", id).First(&wallet).Error
+        } else {
+            err = query.Where("LOWER(label) = LOWER(?)", selector).First(&wallet).Error
+        }
+    }
+
+    if err != nil {
+        return nil, fmt.Errorf("account not found")
+    }
+    return &wallet, nil
+}
+
+// DeriveAdditionalAccount derives another account from a mnemonic already linked
+// to the user. Without a mnemonic the stored one of the default account is used,
+// and without an index the first unused index is taken.
+func (s *WalletService) DeriveAdditionalAccount(userID uuid.UUID, mnemonic string, index *uint32, label string, storeCredentials bool) (*models.Wallet, error) {
+    wallets, err := s.ListAccounts(userID)
+    if err != nil {
+        return nil, err
+    }
+    if len(wallets) == 0 {
+        return nil, fmt.Errorf("create or import a wallet first")
+    }
+
+    if mnemonic == "" {
+        if s.StorageService == nil {
+            return nil, fmt.Errorf("mnemonic required")
+        }
+        mnemonic, _, err = s.StorageService.GetMnemonic(userID, wallets[0].WalletAddress)
         if err != nil {
-            fmt.Printf("Warning: Failed to store mnemonic: %v\n", err)
+            return nil, fmt.Errorf("no stored mnemonic for the default account, mnemonic required")
         }
+        // The user already trusts us with this mnemonic
+        storeCredentials = true
+    }
 
-        // Store private key
-        privateKey := account.GetPrivateKeyHex()
-        keystoreJSON, err := account.ExportKeystore("temporary_password")
-        if err == nil {
-            err = s.StorageService.StorePrivateKey(userID, account.Address.Hex(), privateKey, keystoreJSON)
+    hdWallet, err := blockchain.NewHDWalletFromMnemonic(mnemonic)
+    if err != nil {
+        return nil, fmt.Errorf("invalid mnemonic: %w", err)
+    }
+
+    // Only extend mnemonics that already back one of the user's accounts
+    owned := make(map[string]bool, len(wallets))
+    linked := false
+    for _, w := range wallets {
+        owned[strings.ToLower(w.WalletAddress)] = true
+        if linked {
+            continue
+        }
+        if account, err := s.deriveWalletAccount(hdWallet, &w); err == nil && strings.EqualFold(account.Address.Hex(), w.WalletAddress) {
+            linked = true
+        }
+    }
+    if !linked {
+        return nil, fmt.Errorf("mnemonic does not belong to any of your accounts")
+    }
+
+    var account *blockchain.Account
+    if index != nil {
+        account, err = hdWallet.DeriveAccount(*index)
+        if err != nil {
+            return nil, fmt.Errorf("failed to derive account: %w", err)
+        }
+        if owned[strings.ToLower(account.Address.Hex())] {
+            return nil, fmt.Errorf("account %d already added", *index)
+        }
+    } else {
+        for i := uint32(0); i < maxAccountIndex; i++ {
+            account, err = hdWallet.DeriveAccount(i)
             if err != nil {
-                fmt.Printf("Warning: Failed to store private key: %v\n", err)
+                return nil, fmt.Errorf("failed to derive account: %w", err)
             }
+            if !owned[strings.ToLower(account.Address.Hex())] {
+                index = &i
+                break
+            }
+        }
+        if index == nil {
+            return nil, fmt.Errorf("no unused account index below %d", maxAccountIndex)
+        }
+    }
+
+    if label == "" {
+        label = defaultAccountLabel(*index)
+    }
+    if err := s.checkLabelAvailable(userID, label, uuid.Nil); err != nil {
+        return nil, err
+    }
+
+    wallet := models.Wallet{
+        UUID:           uuid.New(),
+        UserID:         userID,
+        WalletAddress:  account.Address.Hex(),
+        Label:          label,
+        DerivationPath: blockchain.AccountPath(*index),
+        AccountIndex:   *index,
+        CreatedAt:      time.Now(),
+        UpdatedAt:      time.Now(),
+    }
+
+    if result := s.DB.Create(&wallet); result.Error != nil {
+        return nil, fmt.Errorf("failed to save wallet: %w", result.Error)
+    }
+
+    if storeCredentials && s.StorageService != nil {
+        if err := s.storeAccountCredentials(userID, account, mnemonic, *index, wallet.DerivationPath); err != nil {
+            s.DB.Delete(&wallet)
+            return nil, err
         }
     }
 
     return &wallet, nil
 }
 
+// AttachDiscoveredAccounts adds the accounts at the given derivation paths of a
+// mnemonic, typically ones picked from WalletDiscoveryService results. Paths the
+// user already has are skipped.
+func (s *WalletService) AttachDiscoveredAccounts(userID uuid.UUID, mnemonic string, paths []string, storeCredentials bool) ([]models.Wallet, error) {
+    if len(paths) == 0 {
+        return nil, fmt.Errorf("no derivation paths selected")
+    }
+
+    hdWallet, err := blockchain.NewHDWalletFromMnemonic(mnemonic)
+    if err != nil {
+        return nil, fmt.Errorf("invalid mnemonic: %w", err)
+    }
+
+    existing, err := s.ListAccounts(userID)
+    if err != nil {
+        return nil, err
+    }
+    owned := make(map[string]bool, len(existing))
+    for _, w := range existing {
+        owned[strings.ToLower(w.WalletAddress)] = true
+    }
+
+    attached := make([]models.Wallet, 0, len(paths))
+    for _, requested := range paths {
+        layout, index, err := blockchain.ParseAccountPath(requested)
+        if err != nil {
+            return attached, err
+        }
+        path, _ := blockchain.LayoutPath(layout, index)
+
+        account, err := hdWallet.DeriveAccountFromPath(path)
+        if err != nil {
+            return attached, fmt.Errorf("failed to derive %s: %w", path, err)
+        }
+        if owned[strings.ToLower(account.Address.Hex())] {
+            continue
+        }
+
+        label := defaultAccountLabel(index)
+        if layout == blockchain.PathLayoutLedgerLive {
+            label = fmt.Sprintf("Ledger %d", index+1)
+        }
+        if s.checkLabelAvailable(userID, label, uuid.Nil) != nil {
+            label = fmt.Sprintf("%s (%s)", label, account.Address.Hex()[:8])
+        }
+
+        wallet := models.Wallet{
+            UUID:           uuid.New(),
+            UserID:         userID,
+            WalletAddress:  account.Address.Hex(),
+            Label:          label,
+            DerivationPath: path,
+            AccountIndex:   index,
+            IsDefault:      len(existing) == 0 && len(attached) == 0,
+            CreatedAt:      time.Now(),
+            UpdatedAt:      time.Now(),
+        }
+
+        if result := s.DB.Create(&wallet); result.Error != nil {
+            return attached, fmt.Errorf("failed to save wallet: %w", result.Error)
+        }
+        if storeCredentials && s.StorageService != nil {
+            if err := s.storeAccountCredentials(userID, account, mnemonic, index, path); err != nil {
+                s.DB.Delete(&wallet)
+                return attached, err
+            }
+        }
+        owned[strings.ToLower(wallet.WalletAddress)] = true
+
+        attached = append(attached, wallet)
+    }
+
+    return attached, nil
+}
+
+// UpdateAccountLabel renames one of the user's accounts
+func (s *WalletService) UpdateAccountLabel(userID uuid.UUID, selector, label string) (*models.Wallet, error) {
+    label = strings.TrimSpace(label)
+    if label == "" || len(label) > 64 {
+        return nil, fmt.Errorf("label must be 1-64 characters")
+    }
+
+    wallet, err := s.ResolveAccount(userID, selector)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := s.checkLabelAvailable(userID, label, wallet.UUID); err != nil {
+        return nil, err
+    }
+
+    if err := s.DB.Model(wallet).Updates(map[string]interface{}{
+        "label":      label,
+        "updated_at": time.Now(),
+    }).Error; err != nil {
+        return nil, fmt.Errorf("failed to update label: %w", err)
+    }
+
+    return wallet, nil
+}
+
+// SetDefaultAccount makes one of the user's accounts the default, which is also
+// the address stored on the user record
+func (s *WalletService) SetDefaultAccount(userID uuid.UUID, selector string) (*models.Wallet, error) {
+    wallet, err := s.ResolveAccount(userID, selector)
+    if err != nil {
+        return nil, err
+    }
+
+    err = s.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Model(&models.Wallet{}).Where("user_id = ?", userID).Update("is_default", false).Error; err != nil {
+            return err
+        }
+        if err := tx.Model(&models.Wallet{}).Where("uuid = ?", wallet.UUID).Update("is_default", true).Error; err != nil {
+            return err
+        }
+        return tx.Model(&models.User{}).Where("uuid = ?", userID).Updates(map[string]interface{}{
+            "wallet_address": wallet.WalletAddress,
+            "updated_at":     time.Now(),
+        }).Error
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to set default account: %w", err)
+    }
+
+    wallet.IsDefault = true
+    return wallet, nil
+}
+
+// DeriveSelectedAccount derives the keys of the selected account from a mnemonic
+// and checks they match the stored address
+func (s *WalletService) DeriveSelectedAccount(userID uuid.UUID, mnemonic, selector string) (*blockchain.Account, error) {
+    wallet, err := s.ResolveAccount(userID, selector)
+    if err != nil {
+        return nil, err
+    }
+
+    hdWallet, err := blockchain.NewHDWalletFromMnemonic(mnemonic)
+    if err != nil {
+        return nil, fmt.Errorf("invalid mnemonic: %w", err)
+    }
+
+    account, err := s.deriveWalletAccount(hdWallet, wallet)
+    if err != nil {
+        return nil, err
+    }
+
+    if account.Address.Hex() != common.HexToAddress(wallet.WalletAddress).Hex() {
+        return nil, fmt.Errorf("mnemonic does not match account %s", wallet.WalletAddress)
+    }
+
+    return account, nil
+}
+
+// deriveWalletAccount derives the account at a wallet's recorded path. Wallets
+// created before paths were recorded fall back to the stored mnemonic index.
+func (s *WalletService) deriveWalletAccount(hdWallet *blockchain.HDWallet, wallet *models.Wallet) (*blockchain.Account, error) {
+    path := wallet.DerivationPath
+    if path == "" {
+        var record models.WalletMnemonic
+        if s.StorageService != nil {
+            s.StorageService.WalletDB.Select("path_index", "derivation_path").
+                Where("user_uuid = ? AND wallet_address = ?", wallet.UserID, wallet.WalletAddress).
+                First(&record)
+        }
+        path = record.DerivationPath
+        if path == "" {
+            path = blockchain.AccountPath(record.PathIndex)
+        }
+    }
+
+    return hdWallet.DeriveAccountFromPath(path)
+}
+
+// checkLabelAvailable ensures labels stay unique per user so they can select accounts
+func (s *WalletService) checkLabelAvailable(userID uuid.UUID, label string, except uuid.UUID) error {
+    var count int64
+    s.DB.Model(&models.Wallet{}).Where("user_id = ? AND LOWER(label) = LOWER(?) AND uuid <> ?", userID, label, except).Count(&count)
+    if count > 0 {
+        return fmt.Errorf("label %q is already used by another account", label)
+    }
+    return nil
+}
+
+// storeAccountCredentials stores the mnemonic and private key of an account. No keystore is
+// kept: the private key is already envelope encrypted, and a keystore under a password the
+// server knows would only be another copy of it.
+func (s *WalletService) storeAccountCredentials(userID uuid.UUID, account *blockchain.Account, mnemonic string, index uint32, path string) error {
+    if err := s.StorageService.StoreMnemonic(userID, account.Address.Hex(), mnemonic, index, path); err != nil {
+        return fmt.Errorf("failed to store mnemonic: %w", err)
+    }
+
+    if err := s.StorageService.StorePrivateKey(userID, account.Address.Hex(), account.GetPrivateKeyHex(), nil); err != nil {
+        return fmt.Errorf("failed to store private key: %w", err)
+    }
+
+    return nil
+}
+
+// defaultAccountLabel names an account after its index
+func defaultAccountLabel(index uint32) string {
+    return fmt.Sprintf("Account %d", index+1)
+}
+
 func (s *WalletService) HasStoredCredentials(userID uuid.UUID, walletAddress string) bool {
     if s.StorageService == nil {
         return false
@@ -176,28 +529,16 @@ func (s *WalletService) RecoverWalletFromStorage(userID uuid.UUID, walletAddress
 func (s *WalletService) CreateSignedTransaction(
     userID uuid.UUID, 
     mnemonic string, 
+    accountSelector string,
     toAddress common.Address, 
     amount *big.Int, 
     gasPrice *big.Int,
     nonce uint64,
 ) (*types.Transaction, error) {
-    // Recreate the HD wallet
-    hdWallet, err := blockchain.NewHDWalletFromMnemonic(mnemonic)
+    // Derive the selected account and check it belongs to the user
+    account, err := s.DeriveSelectedAccount(userID, mnemonic, accountSelector)
     if err != nil {
-        return nil, fmt.Errorf("invalid mnemonic: %w", err)
-    }
-
-    // Derive account (typically the first one)
-    account, err := hdWallet.DeriveAccount(0)
-    if err != nil {
-        return nil, fmt.Errorf("failed to derive account: %w", err)
-    }
-
-    // Validate that this is the user's wallet
-    var wallet models.Wallet
-    if result := s.DB.Where("user_id = ? AND wallet_address = ?", 
-        userID, account.Address.Hex()).First(&wallet); result.Error != nil {
-        return nil, fmt.Errorf("wallet not associated with user")
+        return nil, err
     }
 
     // Create transaction
@@ -0,0 +1,203 @@
+package services
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "fmt"
+    "math/big"
+    "strings"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/google/uuid"
+)
+
+// WalletTransferService sends ETH and ERC-20 tokens from custodial wallets,
+// signing with the credentials kept in the wallet database
+type WalletTransferService struct {
+    StorageService *WalletStorageService
+    TxBuilder      *TxBuilderService
+}
+
+// TransferQuote is the cost of a transfer before it is sent
+type TransferQuote struct {
+    From       string `json:"from"`
+    To         string `json:"to"`
+    Token      string `json:"token"`
+    Amount     string `json:"amount"` // Smallest unit
+    Gas        uint64 `json:"gas"`
+    MaxFee     string `json:"max_fee"`     // Wei, gas limit times the max fee per gas
+    TotalETH   string `json:"total_eth"`   // Wei needed including value
+    EthBalance string `json:"eth_balance"` // Wei
+    Sufficient bool   `json:"sufficient"`
+}
+
+// NewWalletTransferService creates a new wallet transfer service
+func NewWalletTransferService(storageService *WalletStorageService, txBuilder *TxBuilderService) *WalletTransferService {
+    return &WalletTransferService{
+        StorageService: storageService,
+        TxBuilder:      txBuilder,
+    }
+}
+
+// Quote estimates gas for a transfer and checks the balance covers amount and fees
+func (s *WalletTransferService) Quote(ctx context.Context, from common.Address, token string, to common.Address, amount *big.Int) (*TransferQuote, error) {
+    // Gas estimation reverts on an insufficient token balance, so check it first
+    if err := s.checkTokenBalance(ctx, from, token, amount); err != nil {
+        return nil, err
+    }
+
+    tx, _, err := s.TxBuilder.TransferTx(ctx, from, token, to, amount)
+    if err != nil {
+        return nil, err
+    }
+
+    return s.quoteTx(ctx, from, token, to, amount, tx)
+}
+
+// Send signs a transfer with the stored key of the from address, broadcasts it and
+// records a pending wallet transaction. The tracker moves it to confirmed or failed.
+func (s *WalletTransferService) Send(ctx context.Context, userID uuid.UUID, from common.Address, token string, to common.Address, amount *big.Int) (*models.WalletTransaction, *TransferQuote, error) {
+    privateKey, err := s.storedKey(userID, from)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if err := s.checkTokenBalance(ctx, from, token, amount); err != nil {
+        return nil, nil, err
+    }
+
+    unlock := s.TxBuilder.LockSender(from)
+    defer unlock()
+
+    tx, chainID, err := s.TxBuilder.TransferTx(ctx, from, token, to, amount)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    quote, err := s.quoteTx(ctx, from, token, to, amount, tx)
+    if err != nil {
+        return nil, nil, err
+    }
+    if !quote.Sufficient {
+        return nil, quote, fmt.Errorf("insufficient ETH balance: need %s wei for value and fees, have %s wei", quote.TotalETH, quote.EthBalance)
+    }
+
+    walletTx, err := s.signAndSend(ctx, userID, from, privateKey, tx, chainID)
+    if err != nil {
+        return nil, quote, err
+    }
+
+    return walletTx, quote, nil
+}
+
+// SendBuiltTx signs a transaction built by the TxBuilderService with the stored key of
+// the from address and broadcasts it, once the ETH balance covers value and fees.
+// Callers hold LockSender for the from address from building the transaction until it returns.
+func (s *WalletTransferService) SendBuiltTx(ctx context.Context, userID uuid.UUID, from common.Address, tx *types.Transaction, chainID *big.Int) (*models.WalletTransaction, error) {
+    privateKey, err := s.storedKey(userID, from)
+    if err != nil {
+        return nil, err
+    }
+
+    maxFee := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasFeeCap())
+    totalETH := new(big.Int).Add(tx.Value(), maxFee)
+
+    ethBalance, err := s.TxBuilder.EthClient.BalanceAt(ctx, from, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get ETH balance: %w", err)
+    }
+    if ethBalance.Cmp(totalETH) < 0 {
+        return nil, fmt.Errorf("insufficient ETH balance: need %s wei for value and fees, have %s wei", totalETH, ethBalance)
+    }
+
+    return s.signAndSend(ctx, userID, from, privateKey, tx, chainID)
+}
+
+// storedKey loads the stored private key of one of the user's addresses
+func (s *WalletTransferService) storedKey(userID uuid.UUID, from common.Address) (*ecdsa.PrivateKey, error) {
+    owned, err := s.TxBuilder.UserOwnsAddress(userID, from)
+    if err != nil {
+        return nil, err
+    }
+    if !owned {
+        return nil, fmt.Errorf("address %s is not linked to this account", from.Hex())
+    }
+
+    privateKeyHex, err := s.StorageService.GetPrivateKey(userID, from.Hex())
+    if err != nil {
+        return nil, fmt.Errorf("no stored credentials for %s", from.Hex())
+    }
+
+    privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+    if err != nil {
+        return nil, fmt.Errorf("stored private key is invalid")
+    }
+    if crypto.PubkeyToAddress(privateKey.PublicKey) != from {
+        return nil, fmt.Errorf("stored private key does not match %s", from.Hex())
+    }
+
+    return privateKey, nil
+}
+
+// signAndSend signs a transaction, broadcasts it and records a pending wallet transaction
+func (s *WalletTransferService) signAndSend(ctx context.Context, userID uuid.UUID, from common.Address, privateKey *ecdsa.PrivateKey, tx *types.Transaction, chainID *big.Int) (*models.WalletTransaction, error) {
+    signedTx, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), privateKey)
+    if err != nil {
+        return nil, fmt.Errorf("failed to sign transaction: %w", err)
+    }
+
+    return s.TxBuilder.SendAndRecord(ctx, userID, from, signedTx)
+}
+
+// quoteTx works out the fees of a built transfer and whether the sender's ETH covers them
+func (s *WalletTransferService) quoteTx(ctx context.Context, from common.Address, token string, to common.Address, amount *big.Int, tx *types.Transaction) (*TransferQuote, error) {
+    // Fees are bounded by the max fee for EIP-1559 and the gas price for legacy transactions
+    maxFee := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasFeeCap())
+    totalETH := new(big.Int).Add(tx.Value(), maxFee)
+
+    ethBalance, err := s.TxBuilder.EthClient.BalanceAt(ctx, from, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get ETH balance: %w", err)
+    }
+
+    return &TransferQuote{
+        From:       from.Hex(),
+        To:         to.Hex(),
+        Token:      strings.ToUpper(token),
+        Amount:     amount.String(),
+        Gas:        tx.Gas(),
+        MaxFee:     maxFee.String(),
+        TotalETH:   totalETH.String(),
+        EthBalance: ethBalance.String(),
+        Sufficient: ethBalance.Cmp(totalETH) >= 0,
+    }, nil
+}
+
+// checkTokenBalance fails when an ERC-20 transfer exceeds the sender's token balance
+func (s *WalletTransferService) checkTokenBalance(ctx context.Context, from common.Address, token string, amount *big.Int) error {
+    tokenAddr, isETH, err := s.TxBuilder.resolveToken(token)
+    if err != nil || isETH {
+        return err
+    }
+
+    tokenContract, err := blockchain.NewERC20(tokenAddr, s.TxBuilder.EthClient)
+    if err != nil {
+        return fmt.Errorf("failed to create token contract: %w", err)
+    }
+
+    balance, err := tokenContract.BalanceOf(&bind.CallOpts{Context: ctx}, from)
+    if err != nil {
+        return fmt.Errorf("failed to get token balance: %w", err)
+    }
+
+    if balance.Cmp(amount) < 0 {
+        return fmt.Errorf("insufficient token balance: have %s, need %s", balance, amount)
+    }
+
+    return nil
+}
@@ -0,0 +1,627 @@
+package services
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "net/http"
+    "net/url"
+    "regexp"
+    "strings"
+    "time"
+
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+    "git.winteraccess.id/walanja/web3-tokensale-be/internal/models"
+    "git.winteraccess.id/walanja/web3-tokensale-be/pkg/webhook"
+    "github.com/google/uuid"
+    "gorm.io/gorm"
+    "gorm.io/gorm/clause"
+)
+
+// ErrInvalidWebhook is returned for an endpoint with a bad URL or unknown events
+var ErrInvalidWebhook = errors.New("invalid webhook endpoint")
+
+// Webhook delivery tuning
+const (
+    webhookBatch        = 50
+    webhookLease        = 2 * time.Minute // A delivery being sent is not picked up again until its lease expires
+    webhookRetryBackoff = time.Minute
+    webhookMaxBackoff   = 12 * time.Hour
+    webhookResponseMax  = 1024 // Bytes of the response body kept in the attempt log
+)
+
+// partnerCodePattern is the form of partner codes, which buyers' requests carry
+var partnerCodePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,31}$`)
+
+// WebhookEndpointInput creates or updates an endpoint; nil fields are left unchanged
+type WebhookEndpointInput struct {
+    PartnerCode *string  `json:"partner_code"` // Set on creation only
+    Name        *string  `json:"name"`
+    URL         *string  `json:"url"`
+    Events      []string `json:"events"` // Every event type when empty on creation
+    Active      *bool    `json:"active"`
+}
+
+// WebhookPayload is the JSON body posted to endpoints
+type WebhookPayload struct {
+    ID        uuid.UUID          `json:"id"`
+    Type      string             `json:"type"`
+    CreatedAt time.Time          `json:"created_at"`
+    Data      WebhookTransaction `json:"data"`
+}
+
+// WebhookTransaction is the purchase an event is about
+type WebhookTransaction struct {
+    UUID             uuid.UUID  `json:"uuid"`
+    PaymentID        string     `json:"payment_id"`
+    Status           string     `json:"status"`
+    WalletAddress    string     `json:"wallet_address"`
+    FiatAmount       float64    `json:"fiat_amount"`
+    FiatCurrency     string     `json:"fiat_currency"`
+    TokenAmount      float64    `json:"token_amount"`
+    TokenSymbol      string     `json:"token_symbol"`
+    BonusTokens      float64    `json:"bonus_tokens,omitempty"`
+    PaymentMethod    string     `json:"payment_method"`
+    PromoCode        string     `json:"promo_code,omitempty"`
+    BlockchainTxHash string     `json:"blockchain_tx_hash,omitempty"`
+    CreatedAt        time.Time  `json:"created_at"`
+    UpdatedAt        time.Time  `json:"updated_at"`
+    CompletedAt      *time.Time `json:"completed_at,omitempty"`
+}
+
+// WebhookDeliveryLog is a delivery with every request made for it
+type WebhookDeliveryLog struct {
+    models.WebhookDelivery
+    Payload  json.RawMessage         `json:"payload"`
+    Attempts []models.WebhookAttempt `json:"attempt_log"`
+}
+
+// webhookEventStatuses are the purchase statuses that raise each event
+var webhookEventStatuses = map[string][]string{
+    models.WebhookEventTransactionPaid:      {models.TransactionStatusProcessing, models.TransactionStatusCompleted},
+    models.WebhookEventTransactionCompleted: {models.TransactionStatusCompleted},
+    models.WebhookEventTransactionRefunded:  {models.TransactionStatusRefunded},
+}
+
+// WebhookService raises events when purchases change state and delivers them to partner
+// endpoints as signed POST requests, retrying failures with exponential backoff
+type WebhookService struct {
+    DB          *gorm.DB
+    Client      *http.Client
+    MaxAttempts int
+    Lookback    time.Duration
+    wake        chan struct{}
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(db *gorm.DB, cfg config.WebhookConfig) *WebhookService {
+    return &WebhookService{
+        DB: db,
+        Client: &http.Client{
+            Timeout: cfg.Timeout,
+            // A redirect is reported as a failure instead of posting the event somewhere else
+            CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+        },
+        MaxAttempts: max(cfg.MaxAttempts, 1),
+        Lookback:    cfg.Lookback,
+        wake:        make(chan struct{}, 1),
+    }
+}
+
+// Endpoints lists the registered endpoints
+func (s *WebhookService) Endpoints() ([]models.WebhookEndpoint, error) {
+    var endpoints []models.WebhookEndpoint
+    if err := s.DB.Order("created_at").Find(&endpoints).Error; err != nil {
+        return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+    }
+    return endpoints, nil
+}
+
+// Endpoint finds an endpoint by UUID
+func (s *WebhookService) Endpoint(id string) (*models.WebhookEndpoint, error) {
+    endpointID, err := uuid.Parse(id)
+    if err != nil {
+        return nil, fmt.Errorf("webhook endpoint not found")
+    }
+    var endpoint models.WebhookEndpoint
+    if err := s.DB.Where("uuid = ?", endpointID).First(&endpoint).Error; err != nil {
+        return nil, fmt.Errorf("webhook endpoint not found")
+    }
+    return &endpoint, nil
+}
+
+// CreateEndpoint registers an endpoint with a new secret; partner code, name and URL are required
+func (s *WebhookService) CreateEndpoint(input WebhookEndpointInput) (*models.WebhookEndpoint, error) {
+    if input.PartnerCode == nil || input.Name == nil || input.URL == nil {
+        return nil, fmt.Errorf("%w: partner_code, name and url are required", ErrInvalidWebhook)
+    }
+    partnerCode := strings.ToLower(strings.TrimSpace(*input.PartnerCode))
+    if !partnerCodePattern.MatchString(partnerCode) {
+        return nil, fmt.Errorf("%w: partner_code must be 2 to 32 letters, digits, '-' or '_'", ErrInvalidWebhook)
+    }
+    if len(input.Events) == 0 {
+        input.Events = models.WebhookEventTypes
+    }
+
+    secret, err := newWebhookSecret()
+    if err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    endpoint := &models.WebhookEndpoint{
+        UUID:        uuid.New(),
+        PartnerCode: partnerCode,
+        Secret:      secret,
+        Active:      true,
+        CreatedAt:   now,
+        UpdatedAt:   now,
+    }
+    if err := applyWebhookInput(endpoint, input); err != nil {
+        return nil, err
+    }
+
+    if err := s.DB.Create(endpoint).Error; err != nil {
+        return nil, fmt.Errorf("failed to create webhook endpoint: %w", err)
+    }
+    return endpoint, nil
+}
+
+// UpdateEndpoint changes an endpoint's name, URL, events or whether it is active. Its partner is
+// fixed, so queued deliveries never reach another partner.
+func (s *WebhookService) UpdateEndpoint(id string, input WebhookEndpointInput) (*models.WebhookEndpoint, error) {
+    endpoint, err := s.Endpoint(id)
+    if err != nil {
+        return nil, err
+    }
+    if input.PartnerCode != nil && !strings.EqualFold(strings.TrimSpace(*input.PartnerCode), endpoint.PartnerCode) {
+        return nil, fmt.Errorf("%w: partner_code cannot be changed, create a new endpoint", ErrInvalidWebhook)
+    }
+
+    if err := applyWebhookInput(endpoint, input); err != nil {
+        return nil, err
+    }
+    endpoint.UpdatedAt = time.Now()
+
+    if err := s.DB.Save(endpoint).Error; err != nil {
+        return nil, fmt.Errorf("failed to update webhook endpoint: %w", err)
+    }
+    return endpoint, nil
+}
+
+// RotateSecret replaces an endpoint's signing secret. Pending deliveries are signed with the new one.
+func (s *WebhookService) RotateSecret(id string) (*models.WebhookEndpoint, error) {
+    endpoint, err := s.Endpoint(id)
+    if err != nil {
+        return nil, err
+    }
+
+    secret, err := newWebhookSecret()
+    if err != nil {
+        return nil, err
+    }
+    endpoint.Secret = secret
+    endpoint.UpdatedAt = time.Now()
+
+    if err := s.DB.Save(endpoint).Error; err != nil {
+        return nil, fmt.Errorf("failed to rotate webhook secret: %w", err)
+    }
+    return endpoint, nil
+}
+
+// applyWebhookInput validates and copies the set fields of input to the endpoint
+func applyWebhookInput(endpoint *models.WebhookEndpoint, input WebhookEndpointInput) error {
+    if input.Name != nil {
+        name := strings.TrimSpace(*input.Name)
+        if name == "" {
+            return fmt.Errorf("%w: name is required", ErrInvalidWebhook)
+        }
+        endpoint.Name = name
+    }
+
+    if input.URL != nil {
+        parsed, err := url.Parse(strings.TrimSpace(*input.URL))
+        if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+            return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+        }
+        endpoint.URL = parsed.String()
+    }
+
+    if input.Events != nil {
+        if len(input.Events) == 0 {
+            return fmt.Errorf("%w: at least one event is required", ErrInvalidWebhook)
+        }
+        events := make([]string, 0, len(input.Events))
+        for _, event := range input.Events {
+            event = strings.TrimSpace(event)
+            if _, ok := webhookEventStatuses[event]; !ok {
+                return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+            }
+            events = append(events, event)
+        }
+        endpoint.Events = strings.Join(events, ",")
+    }
+
+    if input.Active != nil {
+        endpoint.Active = *input.Active
+    }
+    return nil
+}
+
+// newWebhookSecret generates a random signing secret
+func newWebhookSecret() (string, error) {
+    secret := make([]byte, 32)
+    if _, err := rand.Read(secret); err != nil {
+        return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+    }
+    return "whsec_" + hex.EncodeToString(secret), nil
+}
+
+// PartnerCode returns the partner code of an endpoint matching code, or "" when no endpoint has it
+func (s *WebhookService) PartnerCode(code string) (string, error) {
+    code = strings.ToLower(strings.TrimSpace(code))
+    if !partnerCodePattern.MatchString(code) {
+        return "", nil
+    }
+
+    var count int64
+    if err := s.DB.Model(&models.WebhookEndpoint{}).Where("partner_code = ?", code).Count(&count).Error; err != nil {
+        return "", fmt.Errorf("failed to find partner: %w", err)
+    }
+    if count == 0 {
+        return "", nil
+    }
+    return code, nil
+}
+
+// Run raises new events and delivers due deliveries every interval, and right away after a
+// redelivery is requested
+func (s *WebhookService) Run(interval time.Duration) {
+    if err := s.DropUnattributed(); err != nil {
+        log.Printf("Webhooks: %v", err)
+    }
+
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ticker.C:
+            if err := s.RaiseEvents(); err != nil {
+                log.Printf("Webhooks: %v", err)
+            }
+        case <-s.wake:
+        }
+        if err := s.Deliver(context.Background()); err != nil {
+            log.Printf("Webhooks: %v", err)
+        }
+    }
+}
+
+// DropUnattributed fails the pending deliveries of endpoints registered without a partner code.
+// They were queued every purchase, whichever partner it came from.
+func (s *WebhookService) DropUnattributed() error {
+    err := s.DB.Model(&models.WebhookDelivery{}).
+        Where("status = ? AND endpoint_id IN (SELECT uuid FROM webhook_endpoints WHERE partner_code = '')", models.WebhookDeliveryPending).
+        Updates(map[string]interface{}{
+            "status":     models.WebhookDeliveryFailed,
+            "last_error": "endpoint has no partner code",
+            "updated_at": time.Now(),
+        }).Error
+    if err != nil {
+        return fmt.Errorf("failed to drop unattributed deliveries: %w", err)
+    }
+    return nil
+}
+
+// RaiseEvents raises the events of partner purchases that reached a paid, completed or refunded
+// status within Lookback and queues a delivery for every active endpoint of the partner subscribed
+// to them. Paid is raised before completed, so a purchase that completes at once raises both in order.
+func (s *WebhookService) RaiseEvents() error {
+    for _, eventType := range models.WebhookEventTypes {
+        var transactions []models.Transaction
+        err := s.DB.Where("token_amount > 0 AND status IN ? AND updated_at >= ? AND partner_code <> ''",
+            webhookEventStatuses[eventType], time.Now().Add(-s.Lookback)).
+            Where("NOT EXISTS (SELECT 1 FROM webhook_events WHERE webhook_events.transaction_id = transactions.uuid AND webhook_events.type = ?)", eventType).
+            Order("updated_at").Limit(webhookBatch).Find(&transactions).Error
+        if err != nil {
+            return fmt.Errorf("failed to find purchases for %s: %w", eventType, err)
+        }
+
+        for i := range transactions {
+            if err := s.raise(eventType, &transactions[i]); err != nil {
+                log.Printf("Webhooks: %s %s: %v", eventType, transactions[i].PaymentID, err)
+            }
+        }
+    }
+    return nil
+}
+
+// raise records an event for a purchase and queues its deliveries to the endpoints of the purchase's
+// partner. An event already raised by another instance is skipped.
+func (s *WebhookService) raise(eventType string, transaction *models.Transaction) error {
+    now := time.Now()
+    event := models.WebhookEvent{
+        UUID:          uuid.New(),
+        Type:          eventType,
+        TransactionID: transaction.UUID,
+        CreatedAt:     now,
+    }
+    payload, err := json.Marshal(WebhookPayload{
+        ID:        event.UUID,
+        Type:      eventType,
+        CreatedAt: now,
+        Data:      webhookTransaction(transaction),
+    })
+    if err != nil {
+        return fmt.Errorf("failed to encode payload: %w", err)
+    }
+    event.Payload = string(payload)
+
+    return s.DB.Transaction(func(tx *gorm.DB) error {
+        result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&event)
+        if result.Error != nil {
+            return fmt.Errorf("failed to record event: %w", result.Error)
+        }
+        if result.RowsAffected == 0 {
+            return nil
+        }
+
+        var endpoints []models.WebhookEndpoint
+        if err := tx.Where("active = ? AND partner_code = ?", true, transaction.PartnerCode).Find(&endpoints).Error; err != nil {
+            return fmt.Errorf("failed to find webhook endpoints: %w", err)
+        }
+        for _, endpoint := range endpoints {
+            if !endpoint.Subscribes(eventType) {
+                continue
+            }
+            delivery := models.WebhookDelivery{
+                UUID:          uuid.New(),
+                EndpointID:    endpoint.UUID,
+                EventID:       event.UUID,
+                EventType:     eventType,
+                Status:        models.WebhookDeliveryPending,
+                NextAttemptAt: now,
+                CreatedAt:     now,
+                UpdatedAt:     now,
+            }
+            if err := tx.Create(&delivery).Error; err != nil {
+                return fmt.Errorf("failed to queue delivery: %w", err)
+            }
+        }
+        return nil
+    })
+}
+
+// webhookTransaction is the partner-facing view of a purchase
+func webhookTransaction(transaction *models.Transaction) WebhookTransaction {
+    return WebhookTransaction{
+        UUID:             transaction.UUID,
+        PaymentID:        transaction.PaymentID,
+        Status:           transaction.Status,
+        WalletAddress:    transaction.WalletAddress,
+        FiatAmount:       transaction.FiatAmount,
+        FiatCurrency:     transaction.FiatCurrency,
+        TokenAmount:      transaction.TokenAmount,
+        TokenSymbol:      transaction.TokenSymbol,
+        BonusTokens:      transaction.BonusTokens,
+        PaymentMethod:    transaction.PaymentMethod,
+        PromoCode:        transaction.PromoCode,
+        BlockchainTxHash: transaction.BlockchainTxHash,
+        CreatedAt:        transaction.CreatedAt,
+        UpdatedAt:        transaction.UpdatedAt,
+        CompletedAt:      transaction.CompletedAt,
+    }
+}
+
+// Deliver sends the pending deliveries that are due. Each one is claimed with a lease first, so
+// several instances never send the same delivery at once.
+func (s *WebhookService) Deliver(ctx context.Context) error {
+    var due []models.WebhookDelivery
+    err := s.DB.Select("uuid").Where("status = ? AND next_attempt_at <= ?", models.WebhookDeliveryPending, time.Now()).
+        Order("next_attempt_at").Limit(webhookBatch).Find(&due).Error
+    if err != nil {
+        return fmt.Errorf("failed to find due deliveries: %w", err)
+    }
+
+    for _, row := range due {
+        now := time.Now()
+        claim := s.DB.Model(&models.WebhookDelivery{}).
+            Where("uuid = ? AND status = ? AND next_attempt_at <= ?", row.UUID, models.WebhookDeliveryPending, now).
+            Update("next_attempt_at", now.Add(webhookLease))
+        if claim.Error != nil {
+            return fmt.Errorf("failed to claim delivery: %w", claim.Error)
+        }
+        if claim.RowsAffected == 0 {
+            continue
+        }
+
+        var delivery models.WebhookDelivery
+        if err := s.DB.Where("uuid = ?", row.UUID).First(&delivery).Error; err != nil {
+            return fmt.Errorf("failed to load delivery: %w", err)
+        }
+        s.deliver(ctx, &delivery)
+    }
+    return nil
+}
+
+// deliver makes one attempt at a claimed delivery, logs it and records the outcome, scheduling
+// a retry with exponential backoff on failure
+func (s *WebhookService) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+    attempt := models.WebhookAttempt{
+        UUID:       uuid.New(),
+        DeliveryID: delivery.UUID,
+        CreatedAt:  time.Now(),
+    }
+    statusCode, body, err := s.post(ctx, delivery)
+    attempt.DurationMs = time.Since(attempt.CreatedAt).Milliseconds()
+    attempt.StatusCode = statusCode
+    attempt.ResponseBody = body
+    if err == nil && (statusCode < 200 || statusCode >= 300) {
+        err = fmt.Errorf("endpoint responded with status %d", statusCode)
+    }
+    if err != nil {
+        attempt.Error = err.Error()
+    }
+    if logErr := s.DB.Create(&attempt).Error; logErr != nil {
+        log.Printf("Webhooks: failed to log attempt of %s: %v", delivery.UUID, logErr)
+    }
+
+    now := time.Now()
+    attempts := delivery.Attempts + 1
+    updates := map[string]interface{}{
+        "attempts":         attempts,
+        "last_status_code": statusCode,
+        "updated_at":       now,
+    }
+    if err == nil {
+        updates["status"] = models.WebhookDeliveryDelivered
+        updates["delivered_at"] = now
+        updates["last_error"] = ""
+    } else {
+        updates["last_error"] = err.Error()
+        if attempts >= s.MaxAttempts {
+            updates["status"] = models.WebhookDeliveryFailed
+        } else {
+            updates["next_attempt_at"] = now.Add(webhookBackoff(attempts))
+        }
+    }
+
+    if err := s.DB.Model(&models.WebhookDelivery{}).Where("uuid = ?", delivery.UUID).Updates(updates).Error; err != nil {
+        log.Printf("Webhooks: failed to record delivery of %s: %v", delivery.UUID, err)
+    }
+}
+
+// post signs the event payload with the endpoint's secret and posts it, returning the status code
+// and the start of the response body
+func (s *WebhookService) post(ctx context.Context, delivery *models.WebhookDelivery) (int, string, error) {
+    var endpoint models.WebhookEndpoint
+    if err := s.DB.Where("uuid = ?", delivery.EndpointID).First(&endpoint).Error; err != nil {
+        return 0, "", fmt.Errorf("failed to find endpoint: %w", err)
+    }
+    if !endpoint.Active {
+        return 0, "", fmt.Errorf("endpoint is disabled")
+    }
+    var event models.WebhookEvent
+    if err := s.DB.Where("uuid = ?", delivery.EventID).First(&event).Error; err != nil {
+        return 0, "", fmt.Errorf("failed to find event: %w", err)
+    }
+
+    payload := []byte(event.Payload)
+    now := time.Now()
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(payload))
+    if err != nil {
+        return 0, "", fmt.Errorf("failed to build request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "Web3Tokensale-Webhooks/1.0")
+    req.Header.Set(webhook.EventHeader, event.Type)
+    req.Header.Set(webhook.EventIDHeader, event.UUID.String())
+    req.Header.Set(webhook.TimestampHeader, fmt.Sprintf("%d", now.Unix()))
+    req.Header.Set(webhook.SignatureHeader, webhook.SignatureHeaderValue(endpoint.Secret, now, payload))
+
+    resp, err := s.Client.Do(req)
+    if err != nil {
+        return 0, "", err
+    }
+    defer resp.Body.Close()
+
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseMax))
+    return resp.StatusCode, string(body), nil
+}
+
+// webhookBackoff is the delay before the next attempt, doubling from a minute up to 12 hours
+func webhookBackoff(attempts int) time.Duration {
+    delay := webhookRetryBackoff
+    for i := 1; i < attempts && delay < webhookMaxBackoff; i++ {
+        delay *= 2
+    }
+    return min(delay, webhookMaxBackoff)
+}
+
+// Deliveries lists an endpoint's deliveries, newest first, optionally filtered by status
+func (s *WebhookService) Deliveries(endpointID uuid.UUID, status string, limit, offset int) ([]models.WebhookDelivery, int64, error) {
+    query := s.DB.Model(&models.WebhookDelivery{}).Where("endpoint_id = ?", endpointID)
+    if status != "" {
+        query = query.Where("status = ?", status)
+    }
+
+    var total int64
+    if err := query.Count(&total).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to count deliveries: %w", err)
+    }
+
+    var deliveries []models.WebhookDelivery
+    if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&deliveries).Error; err != nil {
+        return nil, 0, fmt.Errorf("failed to list deliveries: %w", err)
+    }
+    return deliveries, total, nil
+}
+
+// Delivery returns a delivery with its payload and attempt log
+func (s *WebhookService) Delivery(id string) (*WebhookDeliveryLog, error) {
+    deliveryID, err := uuid.Parse(id)
+    if err != nil {
+        return nil, fmt.Errorf("webhook delivery not found")
+    }
+
+    var entry WebhookDeliveryLog
+    if err := s.DB.Where("uuid = ?", deliveryID).First(&entry.WebhookDelivery).Error; err != nil {
+        return nil, fmt.Errorf("webhook delivery not found")
+    }
+
+    var event models.WebhookEvent
+    if err := s.DB.Where("uuid = ?", entry.EventID).First(&event).Error; err != nil {
+        return nil, fmt.Errorf("failed to find event: %w", err)
+    }
+    entry.Payload = json.RawMessage(event.Payload)
+
+    if err := s.DB.Where("delivery_id = ?", deliveryID).Order("created_at").Find(&entry.Attempts).Error; err != nil {
+        return nil, fmt.Errorf("failed to load attempts: %w", err)
+    }
+    return &entry, nil
+}
+
+// Redeliver queues a delivery to be sent again right away with a fresh round of attempts,
+// whether it failed or was already delivered
+func (s *WebhookService) Redeliver(id string) (*models.WebhookDelivery, error) {
+    entry, err := s.Delivery(id)
+    if err != nil {
+        return nil, err
+    }
+
+    var endpoint models.WebhookEndpoint
+    if err := s.DB.Where("uuid = ?", entry.EndpointID).First(&endpoint).Error; err != nil {
+        return nil, fmt.Errorf("webhook endpoint not found")
+    }
+    if !endpoint.Active {
+        return nil, fmt.Errorf("webhook endpoint is disabled")
+    }
+    if endpoint.PartnerCode == "" {
+        return nil, fmt.Errorf("webhook endpoint has no partner code")
+    }
+
+    delivery := entry.WebhookDelivery
+    now := time.Now()
+    err = s.DB.Model(&delivery).Updates(map[string]interface{}{
+        "status":          models.WebhookDeliveryPending,
+        "attempts":        0,
+        "next_attempt_at": now,
+        "updated_at":      now,
+    }).Error
+    if err != nil {
+        return nil, fmt.Errorf("failed to redeliver: %w", err)
+    }
+
+    select {
+    case s.wake <- struct{}{}:
+    default:
+    }
+    return &delivery, nil
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+    "errors"
+    "testing"
+)
+
+func TestCreateEndpointRequiresPartnerCode(t *testing.T) {
+    s := &WebhookService{}
+    name, url := "Partner", "https://partner.example.com/hooks"
+
+    if _, err := s.CreateEndpoint(WebhookEndpointInput{Name: &name, URL: &url}); !errors.Is(err, ErrInvalidWebhook) {
+        t.Fatalf("expected an endpoint without a partner code to be rejected, got %v", err)
+    }
+
+    for _, code := range []string{"", "a", "bad code", "-partner", "partner!", "abcdefghijklmnopqrstuvwxyz0123456"} {
+        if _, err := s.CreateEndpoint(WebhookEndpointInput{PartnerCode: &code, Name: &name, URL: &url}); !errors.Is(err, ErrInvalidWebhook) {
+            t.Fatalf("expected partner code %q to be rejected, got %v", code, err)
+        }
+    }
+}
+
+func TestPartnerCodeIgnoresMalformedCodes(t *testing.T) {
+    // Malformed codes are dropped before the database is queried
+    s := &WebhookService{}
+    for _, code := range []string{"", "x", "not a code", "partner/../admin"} {
+        if partnerCode, err := s.PartnerCode(code); partnerCode != "" || err != nil {
+            t.Fatalf("expected %q to be ignored, got %q (%v)", code, partnerCode, err)
+        }
+    }
+}
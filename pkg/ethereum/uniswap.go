@@ -2,7 +2,6 @@ package ethereum
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
 	"log"
@@ -10,12 +9,13 @@ import (
 	"strings"
 	"time"
 
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/blockchain"
 	"git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
 	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/contracts"
+	"git.winteraccess.id/walanja/web3-tokensale-be/pkg/signer"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -30,10 +30,12 @@ type UniswapClient struct {
     Config    *config.Config  // Change to uppercase to make it exported
     ethClient *ethclient.Client
     router *contracts.UniswapV2Router02
-    privateKey *ecdsa.PrivateKey
+    signer     signer.Signer
+    feeCaps    blockchain.FeeCaps
 }
 
-func NewUniswapClient(client *rpc.Client, cfg *config.Config) *UniswapClient {
+// NewUniswapClient creates a Uniswap client; txSigner may be nil for quote-only use
+func NewUniswapClient(client *rpc.Client, cfg *config.Config, txSigner signer.Signer) *UniswapClient {
     ethClient := ethclient.NewClient(client)
 
     // initialize the Uniswap router contract
@@ -42,15 +44,8 @@ func NewUniswapClient(client *rpc.Client, cfg *config.Config) *UniswapClient {
     if err != nil {
         log.Printf("Warning: Failed to initialize Uniswap router: %v", err)
     }
-    // Parse private key from config
-    var privateKey *ecdsa.PrivateKey
-    if cfg.WalletPrivateKey != "" {
-        privateKey, err = crypto.HexToECDSA(cfg.WalletPrivateKey)
-        if err != nil {
-            log.Printf("Warning: Failed to parse private key: %v", err)
-        }
-    } else {
-        log.Printf("Warning: No wallet private key provided in config")
+    if txSigner == nil {
+        log.Printf("Warning: No signer provided, Uniswap swaps are disabled")
     }
 
     return &UniswapClient{
@@ -58,7 +53,7 @@ func NewUniswapClient(client *rpc.Client, cfg *config.Config) *UniswapClient {
         Config:     cfg,
         ethClient:  ethClient,
         router:     router,
-        privateKey: privateKey,
+        signer:     txSigner,
     }
 }
 
@@ -317,51 +312,48 @@ func (uc *UniswapClient) QuoteExactInputSingleNoRetry(
     return amountOut, nil
 }
 
-func (c *UniswapClient) createTransactor(ctx context.Context) (*bind.TransactOpts, error) {
-    if c.privateKey == nil {
-        return nil, fmt.Errorf("private key not initialized")
+// createTransactor holds the signer's sender lock until the returned unlock is called, which must
+// be right after the transaction is broadcast
+func (c *UniswapClient) createTransactor(ctx context.Context) (*bind.TransactOpts, func(), error) {
+    if c.signer == nil {
+        return nil, nil, fmt.Errorf("signer not initialized")
     }
     
     // Get the chainID
     chainID, err := c.ethClient.ChainID(ctx)
     if err != nil {
-        return nil, fmt.Errorf("failed to get chain ID: %v", err)
+        return nil, nil, fmt.Errorf("failed to get chain ID: %v", err)
     }
     
     // Create the transaction signer
-    auth, err := bind.NewKeyedTransactorWithChainID(c.privateKey, chainID)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create transactor: %v", err)
-    }
-    
-    // Get the wallet address from private key
-    publicKey := c.privateKey.Public()
-    publicKeyECDSA, ok := publicKey.(*ecdsa.PublicKey)
-    if !ok {
-        return nil, fmt.Errorf("error casting public key to ECDSA")
-    }
-    
-    fromAddress := crypto.PubkeyToAddress(*publicKeyECDSA)
+    auth := signer.NewTransactOpts(ctx, c.signer, chainID)
+
+    fromAddress := c.signer.Address()
+    unlock := blockchain.LockSender(fromAddress)
     
     // Get the next nonce
     nonce, err := c.ethClient.PendingNonceAt(ctx, fromAddress)
     if err != nil {
-        return nil, fmt.Errorf("failed to get nonce: %v", err)
+        unlock()
+        return nil, nil, fmt.Errorf("failed to get nonce: %v", err)
     }
     
     auth.Nonce = big.NewInt(int64(nonce))
     auth.Value = big.NewInt(0)      // Default 0 ETH sent
     auth.GasLimit = uint64(3000000) // Default gas limit
     
-    // Get gas price from the network
-    gasPrice, err := c.ethClient.SuggestGasPrice(ctx)
-    if err != nil {
-        return nil, fmt.Errorf("failed to get gas price: %v", err)
+    // Set fees within the hot wallet caps
+    if err := c.feeCaps.Apply(ctx, c.ethClient, auth); err != nil {
+        unlock()
+        return nil, nil, err
     }
     
-    auth.GasPrice = gasPrice
-    
-    return auth, nil
+    return auth, unlock, nil
+}
+
+// SetFeeCaps limits the fees of swaps sent by the signer
+func (c *UniswapClient) SetFeeCaps(caps blockchain.FeeCaps) {
+    c.feeCaps = caps
 }
 
 func (c *UniswapClient) SwapExactETHForTokens(
@@ -378,7 +370,7 @@ func (c *UniswapClient) SwapExactETHForTokens(
     }
     
     // Create a transactor with ETH value
-    auth, err := c.createTransactor(ctx)
+    auth, unlock, err := c.createTransactor(ctx)
     if err != nil {
         return "", err
     }
@@ -394,6 +386,7 @@ func (c *UniswapClient) SwapExactETHForTokens(
         to,
         big.NewInt(deadline),
     )
+    unlock()
     if err != nil {
         return "", fmt.Errorf("swap failed: %v", err)
     }
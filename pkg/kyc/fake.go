@@ -0,0 +1,106 @@
+package kyc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of a fake provider webhook body
+const SignatureHeader = "X-KYC-Signature"
+
+// FakeProvider is a local stand-in for a KYC vendor. Applicants stay pending until a signed
+// webhook reports their result, which lets development and tests drive any outcome.
+type FakeProvider struct {
+	secret string
+	appURL string
+
+	mu         sync.Mutex
+	applicants map[string]*Result
+}
+
+// NewFakeProvider creates a fake provider whose webhooks are signed with the secret
+func NewFakeProvider(secret, appURL string) *FakeProvider {
+	return &FakeProvider{
+		secret:     secret,
+		appURL:     strings.TrimRight(appURL, "/"),
+		applicants: make(map[string]*Result),
+	}
+}
+
+// Name identifies the fake provider
+func (p *FakeProvider) Name() string {
+	return TypeFake
+}
+
+// CreateApplicant registers a pending applicant
+func (p *FakeProvider) CreateApplicant(ctx context.Context, applicant Applicant) (string, string, error) {
+	if applicant.ExternalID == "" {
+		return "", "", fmt.Errorf("applicant external ID is required")
+	}
+
+	applicantID := "fake-" + uuid.New().String()
+
+	p.mu.Lock()
+	p.applicants[applicantID] = &Result{ApplicantID: applicantID, Status: StatusPending}
+	p.mu.Unlock()
+
+	return applicantID, fmt.Sprintf("%s/kyc/verify?applicant=%s", p.appURL, applicantID), nil
+}
+
+// ParseWebhook checks the body's signature and records the reported result
+func (p *FakeProvider) ParseWebhook(header http.Header, body []byte) (*Result, error) {
+	if p.secret == "" {
+		return nil, fmt.Errorf("KYC webhook secret is not configured")
+	}
+	if !hmac.Equal([]byte(p.Sign(body)), []byte(strings.ToLower(header.Get(SignatureHeader)))) {
+		return nil, fmt.Errorf("invalid webhook signature")
+	}
+
+	var result Result
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %v", err)
+	}
+	if result.ApplicantID == "" {
+		return nil, fmt.Errorf("webhook has no applicant ID")
+	}
+	switch result.Status {
+	case StatusPending, StatusApproved, StatusRejected:
+	default:
+		return nil, fmt.Errorf("unknown status %q", result.Status)
+	}
+
+	p.mu.Lock()
+	p.applicants[result.ApplicantID] = &result
+	p.mu.Unlock()
+
+	return &result, nil
+}
+
+// GetResult returns the last result reported for the applicant
+func (p *FakeProvider) GetResult(ctx context.Context, applicantID string) (*Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result, ok := p.applicants[applicantID]
+	if !ok {
+		return nil, fmt.Errorf("applicant %s not found", applicantID)
+	}
+	copied := *result
+	return &copied, nil
+}
+
+// Sign returns the signature a webhook body needs, for tests and local tooling
+func (p *FakeProvider) Sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
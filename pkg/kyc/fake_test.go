@@ -0,0 +1,95 @@
+package kyc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func signedHeader(p *FakeProvider, body []byte) http.Header {
+	header := http.Header{}
+	header.Set(SignatureHeader, p.Sign(body))
+	return header
+}
+
+func TestFakeProviderApplicantLifecycle(t *testing.T) {
+	p := NewFakeProvider("webhook-secret", "https://app.example.com/")
+
+	applicantID, url, err := p.CreateApplicant(context.Background(), Applicant{ExternalID: "user-1", Level: 1})
+	if err != nil {
+		t.Fatalf("CreateApplicant: %v", err)
+	}
+	if url != "https://app.example.com/kyc/verify?applicant="+applicantID {
+		t.Fatalf("unexpected verification URL %s", url)
+	}
+
+	result, err := p.GetResult(context.Background(), applicantID)
+	if err != nil || result.Status != StatusPending {
+		t.Fatalf("expected a pending applicant, got %+v (%v)", result, err)
+	}
+
+	body := []byte(`{"applicant_id":"` + applicantID + `","status":"approved","documents":[{"type":"passport","status":"approved"}]}`)
+	reported, err := p.ParseWebhook(signedHeader(p, body), body)
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	if reported.Status != StatusApproved || len(reported.Documents) != 1 {
+		t.Fatalf("unexpected webhook result %+v", reported)
+	}
+
+	result, err = p.GetResult(context.Background(), applicantID)
+	if err != nil || result.Status != StatusApproved {
+		t.Fatalf("expected the webhook result to be recorded, got %+v (%v)", result, err)
+	}
+
+	if _, _, err := p.CreateApplicant(context.Background(), Applicant{}); err == nil {
+		t.Fatal("expected an applicant without an external ID to be rejected")
+	}
+}
+
+func TestFakeProviderWebhookSignature(t *testing.T) {
+	p := NewFakeProvider("webhook-secret", "")
+	body := []byte(`{"applicant_id":"fake-1","status":"rejected","reason":"blurry"}`)
+
+	// The signature header is accepted in any case
+	header := http.Header{}
+	header.Set(SignatureHeader, strings.ToUpper(p.Sign(body)))
+	if _, err := p.ParseWebhook(header, body); err != nil {
+		t.Fatalf("expected an upper case signature to verify: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		header http.Header
+		body   []byte
+	}{
+		{"missing signature", http.Header{}, body},
+		{"other secret", signedHeader(NewFakeProvider("other-secret", ""), body), body},
+		{"tampered body", signedHeader(p, body), []byte(`{"applicant_id":"fake-1","status":"approved"}`)},
+	}
+	for _, tc := range cases {
+		if _, err := p.ParseWebhook(tc.header, tc.body); err == nil || !strings.Contains(err.Error(), "signature") {
+			t.Fatalf("%s: expected a signature error, got %v", tc.name, err)
+		}
+	}
+
+	unconfigured := NewFakeProvider("", "")
+	if _, err := unconfigured.ParseWebhook(signedHeader(unconfigured, body), body); err == nil {
+		t.Fatal("expected webhooks to be refused without a secret")
+	}
+}
+
+func TestFakeProviderRejectsInvalidPayloads(t *testing.T) {
+	p := NewFakeProvider("webhook-secret", "")
+
+	for name, body := range map[string]string{
+		"not json":       `approved`,
+		"no applicant":   `{"status":"approved"}`,
+		"unknown status": `{"applicant_id":"fake-1","status":"maybe"}`,
+	} {
+		if _, err := p.ParseWebhook(signedHeader(p, []byte(body)), []byte(body)); err == nil {
+			t.Fatalf("%s: expected the payload to be rejected", name)
+		}
+	}
+}
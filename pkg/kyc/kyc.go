@@ -0,0 +1,68 @@
+package kyc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+)
+
+// Provider types selectable through KYC_PROVIDER
+const (
+	TypeFake = "fake"
+)
+
+// Verification statuses reported by providers
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Applicant is the user sent to the provider for verification
+type Applicant struct {
+	ExternalID string // Our user ID
+	Email      string
+	FullName   string
+	Phone      string
+	Level      int // KYC level applied for
+}
+
+// DocumentResult is the provider's verdict on one submitted document
+type DocumentResult struct {
+	Type   string `json:"type"`   // e.g. id_card, passport, selfie, proof_of_address
+	Status string `json:"status"` // approved or rejected
+	Reason string `json:"reason,omitempty"`
+}
+
+// Result is the state of an applicant's verification
+type Result struct {
+	ApplicantID string           `json:"applicant_id"`
+	Status      string           `json:"status"`
+	Reason      string           `json:"reason,omitempty"`
+	Documents   []DocumentResult `json:"documents,omitempty"`
+}
+
+// Provider verifies user identities without exposing which vendor does it
+type Provider interface {
+	// Name identifies the provider in stored checks
+	Name() string
+	// CreateApplicant registers the user and returns the applicant ID and the URL where the user submits documents
+	CreateApplicant(ctx context.Context, applicant Applicant) (applicantID string, verificationURL string, err error)
+	// ParseWebhook authenticates a status webhook and returns the reported result
+	ParseWebhook(header http.Header, body []byte) (*Result, error)
+	// GetResult fetches the current status and document results of an applicant
+	GetResult(ctx context.Context, applicantID string) (*Result, error)
+}
+
+// NewFromConfig builds the provider selected by KYC_PROVIDER.
+// appURL is where the fake provider's verification page is linked.
+func NewFromConfig(cfg config.KYCConfig, appURL string) (Provider, error) {
+	switch cfg.Provider {
+	case "", TypeFake:
+		return NewFakeProvider(cfg.WebhookSecret, appURL), nil
+	default:
+		return nil, fmt.Errorf("unknown KYC provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,43 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var unsafeFilename = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+// FileSink saves messages as .eml files instead of sending them, for development and tests
+type FileSink struct {
+	dir  string
+	from Address
+}
+
+// NewFileSink creates a file sink writing to dir, creating it when missing
+func NewFileSink(dir string, from Address) (*FileSink, error) {
+	if dir == "" {
+		dir = "mail"
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileSink{dir: dir, from: from}, nil
+}
+
+// Send writes the message to <dir>/<time>-<recipient>.eml
+func (f *FileSink) Send(ctx context.Context, msg *Message) error {
+	body, err := buildMIME(f.from, msg)
+	if err != nil {
+		return fmt.Errorf("file sink: failed to build message: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), unsafeFilename.ReplaceAllString(msg.To.Email, "_"))
+	if err := os.WriteFile(filepath.Join(f.dir, name), body, 0o640); err != nil {
+		return fmt.Errorf("file sink: %w", err)
+	}
+	return nil
+}
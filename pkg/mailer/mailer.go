@@ -0,0 +1,73 @@
+// Package mailer sends email through SendGrid, an SMTP server or, for development, a directory of
+// .eml files.
+package mailer
+
+import (
+	"context"
+	"fmt"
+
+	"git.winteraccess.id/walanja/web3-tokensale-be/internal/config"
+)
+
+// Driver types selectable through EMAIL_DRIVER
+const (
+	TypeSendGrid = "sendgrid"
+	TypeSMTP     = "smtp"
+	TypeFile     = "file"
+)
+
+// Address is a mailbox with an optional display name
+type Address struct {
+	Name  string
+	Email string
+}
+
+// Attachment is a file sent along with a message
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// Message is an email with a plain text and an HTML body
+type Message struct {
+	To          Address
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Mailer delivers messages from a fixed sender
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewFromConfig creates the mailer selected by the email configuration. Without a driver,
+// SendGrid is used when an API key is set and the file sink otherwise.
+func NewFromConfig(cfg config.EmailConfig, sendGridAPIKey string, from Address) (Mailer, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = TypeFile
+		if sendGridAPIKey != "" {
+			driver = TypeSendGrid
+		}
+	}
+
+	switch driver {
+	case TypeSendGrid:
+		if sendGridAPIKey == "" {
+			return nil, fmt.Errorf("SENDGRID_API_KEY is required for the sendgrid email driver")
+		}
+		return NewSendGrid(sendGridAPIKey, from), nil
+	case TypeSMTP:
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp email driver")
+		}
+		return NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, from), nil
+	case TypeFile:
+		return NewFileSink(cfg.FileDir, from)
+	default:
+		return nil, fmt.Errorf("unknown email driver %q", driver)
+	}
+}
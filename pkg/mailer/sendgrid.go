@@ -0,0 +1,49 @@
+package mailer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// SendGrid sends messages through the SendGrid v3 API
+type SendGrid struct {
+	apiKey string
+	from   Address
+}
+
+// NewSendGrid creates a SendGrid mailer
+func NewSendGrid(apiKey string, from Address) *SendGrid {
+	return &SendGrid{apiKey: apiKey, from: from}
+}
+
+// Send delivers a message, failing on any non-2xx response
+func (s *SendGrid) Send(ctx context.Context, msg *Message) error {
+	message := mail.NewSingleEmail(
+		mail.NewEmail(s.from.Name, s.from.Email),
+		msg.Subject,
+		mail.NewEmail(msg.To.Name, msg.To.Email),
+		msg.Text,
+		msg.HTML,
+	)
+	for _, file := range msg.Attachments {
+		attachment := mail.NewAttachment()
+		attachment.SetContent(base64.StdEncoding.EncodeToString(file.Content))
+		attachment.SetType(file.ContentType)
+		attachment.SetFilename(file.Filename)
+		attachment.SetDisposition("attachment")
+		message.AddAttachment(attachment)
+	}
+
+	response, err := sendgrid.NewSendClient(s.apiKey).SendWithContext(ctx, message)
+	if err != nil {
+		return fmt.Errorf("sendgrid: %w", err)
+	}
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid: status code %d: %s", response.StatusCode, response.Body)
+	}
+	return nil
+}
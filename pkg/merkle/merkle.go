@@ -0,0 +1,86 @@
+// Package merkle builds keccak256 Merkle trees whose proofs verify with OpenZeppelin's MerkleProof.
+package merkle
+
+import (
+	"bytes"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tree is a Merkle tree over a fixed list of leaves. Pairs are hashed in sorted order and an
+// unpaired node moves up a level unchanged, as MerkleProof.verify expects.
+type Tree struct {
+	levels [][]common.Hash // levels[0] are the leaves, the last level is the root
+}
+
+// Leaf hashes an account and amount the way Solidity would with
+// keccak256(bytes.concat(keccak256(abi.encode(account, amount)))).
+// The double hash keeps leaves from being mistaken for inner nodes.
+func Leaf(account common.Hash, amount *big.Int) common.Hash {
+	encoded := make([]byte, 0, 64)
+	encoded = append(encoded, account.Bytes()...)
+	encoded = append(encoded, common.LeftPadBytes(amount.Bytes(), 32)...)
+	return crypto.Keccak256Hash(crypto.Keccak256(encoded))
+}
+
+// New builds the tree over the leaves in the given order
+func New(leaves []common.Hash) *Tree {
+	level := make([]common.Hash, len(leaves))
+	copy(level, leaves)
+
+	tree := &Tree{levels: [][]common.Hash{level}}
+	for len(level) > 1 {
+		next := make([]common.Hash, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, hashPair(level[i], level[i+1]))
+		}
+		tree.levels = append(tree.levels, next)
+		level = next
+	}
+	return tree
+}
+
+// Root returns the tree's root, the zero hash for an empty tree
+func (t *Tree) Root() common.Hash {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return common.Hash{}
+	}
+	return top[0]
+}
+
+// Proof returns the sibling hashes from the leaf at index up to the root
+func (t *Tree) Proof(index int) []common.Hash {
+	proof := []common.Hash{}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, level[sibling])
+		}
+		index /= 2
+	}
+	return proof
+}
+
+// Verify reports whether the proof leads from the leaf to the root
+func Verify(proof []common.Hash, root, leaf common.Hash) bool {
+	computed := leaf
+	for _, sibling := range proof {
+		computed = hashPair(computed, sibling)
+	}
+	return computed == root
+}
+
+// hashPair hashes two nodes in sorted order
+func hashPair(a, b common.Hash) common.Hash {
+	if bytes.Compare(a.Bytes(), b.Bytes()) > 0 {
+		a, b = b, a
+	}
+	return crypto.Keccak256Hash(a.Bytes(), b.Bytes())
+}
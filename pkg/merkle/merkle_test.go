@@ -0,0 +1,96 @@
+package merkle
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func addressLeaf(address string, amount string) common.Hash {
+	value, _ := new(big.Int).SetString(amount, 10)
+	return Leaf(common.BytesToHash(common.HexToAddress(address).Bytes()), value)
+}
+
+// processProof mirrors OpenZeppelin's MerkleProof.processProof with its commutative keccak256 pair hash
+func processProof(proof []common.Hash, leaf common.Hash) common.Hash {
+	computed := leaf
+	for _, sibling := range proof {
+		if bytes.Compare(computed.Bytes(), sibling.Bytes()) < 0 {
+			computed = crypto.Keccak256Hash(computed.Bytes(), sibling.Bytes())
+		} else {
+			computed = crypto.Keccak256Hash(sibling.Bytes(), computed.Bytes())
+		}
+	}
+	return computed
+}
+
+// The root of the address,uint256 example in the @openzeppelin/merkle-tree README, whose
+// StandardMerkleTree leaves are keccak256(bytes.concat(keccak256(abi.encode(account, amount))))
+func TestOpenZeppelinFixture(t *testing.T) {
+	leaves := []common.Hash{
+		addressLeaf("0x1111111111111111111111111111111111111111", "5000000000000000000"),
+		addressLeaf("0x2222222222222222222222222222222222222222", "2500000000000000000"),
+	}
+	want := common.HexToHash("0xd4dee0beab2d53f2cc83e567171bd2820e49898130a22622b10ead383e90bd77")
+
+	tree := New(leaves)
+	if tree.Root() != want {
+		t.Fatalf("root %s, expected %s", tree.Root().Hex(), want.Hex())
+	}
+	for i, leaf := range leaves {
+		if processProof(tree.Proof(i), leaf) != want {
+			t.Fatalf("proof of leaf %d does not verify with MerkleProof", i)
+		}
+	}
+}
+
+func TestProofsVerifyForEveryTreeSize(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		leaves := make([]common.Hash, size)
+		for i := range leaves {
+			leaves[i] = Leaf(common.BigToHash(big.NewInt(int64(i+1))), big.NewInt(int64(1000*(i+1))))
+		}
+		tree := New(leaves)
+
+		for i, leaf := range leaves {
+			proof := tree.Proof(i)
+			if processProof(proof, leaf) != tree.Root() {
+				t.Fatalf("size %d: proof of leaf %d does not verify with MerkleProof", size, i)
+			}
+			if !Verify(proof, tree.Root(), leaf) {
+				t.Fatalf("size %d: Verify rejects the proof of leaf %d", size, i)
+			}
+		}
+	}
+
+	single := Leaf(common.Hash{1}, big.NewInt(1))
+	if tree := New([]common.Hash{single}); tree.Root() != single || len(tree.Proof(0)) != 0 {
+		t.Fatal("a single leaf should be its own root with an empty proof")
+	}
+	if New(nil).Root() != (common.Hash{}) {
+		t.Fatal("an empty tree should have the zero root")
+	}
+}
+
+func TestVerifyRejectsForgedLeaves(t *testing.T) {
+	leaves := []common.Hash{
+		addressLeaf("0x1111111111111111111111111111111111111111", "5000000000000000000"),
+		addressLeaf("0x2222222222222222222222222222222222222222", "2500000000000000000"),
+		addressLeaf("0x3333333333333333333333333333333333333333", "1000000000000000000"),
+	}
+	tree := New(leaves)
+	proof := tree.Proof(1)
+
+	// A larger allocation for a listed account
+	forged := addressLeaf("0x2222222222222222222222222222222222222222", "9000000000000000000")
+	if Verify(proof, tree.Root(), forged) {
+		t.Fatal("a forged allocation verified")
+	}
+
+	if Verify(proof[:len(proof)-1], tree.Root(), leaves[1]) {
+		t.Fatal("a truncated proof verified")
+	}
+}
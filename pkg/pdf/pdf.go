@@ -0,0 +1,139 @@
+// Package pdf writes simple text documents as PDF 1.4 using the standard Helvetica fonts,
+// enough for invoices and receipts without pulling in a layout engine.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595
+	PageHeight = 842
+)
+
+// Document is a PDF under construction. Coordinates are in points from the bottom left of the page.
+type Document struct {
+	pages []*page
+}
+
+type page struct {
+	content bytes.Buffer
+	links   []link
+}
+
+type link struct {
+	x, y, w, h float64
+	uri        string
+}
+
+// New starts an empty document
+func New() *Document {
+	return &Document{}
+}
+
+// AddPage starts a new page, later drawing goes to it
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &page{})
+}
+
+func (d *Document) current() *page {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// Text draws a line of text with its baseline at x, y
+func (d *Document) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&d.current().content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(s))
+}
+
+// Line draws a straight line of the given width
+func (d *Document) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&d.current().content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+// Link makes a rectangle of the current page open uri when clicked
+func (d *Document) Link(x, y, w, h float64, uri string) {
+	p := d.current()
+	p.links = append(p.links, link{x: x, y: y, w: w, h: h, uri: uri})
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() []byte {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	// Objects 1-4 are the catalog, page tree and fonts, each page adds itself, its content
+	// stream and its link annotations
+	var objects []string
+	add := func(body string) int {
+		objects = append(objects, body)
+		return len(objects)
+	}
+	add("<< /Type /Catalog /Pages 2 0 R >>")
+	add("") // Page tree, filled in once the page objects are numbered
+	add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	add("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+
+	kids := make([]string, 0, len(d.pages))
+	for _, p := range d.pages {
+		var annots []string
+		for _, l := range p.links {
+			id := add(fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect [%.2f %.2f %.2f %.2f] /Border [0 0 0] /A << /S /URI /URI (%s) >> >>",
+				l.x, l.y, l.x+l.w, l.y+l.h, escape(l.uri)))
+			annots = append(annots, fmt.Sprintf("%d 0 R", id))
+		}
+		contentID := add(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", p.content.Len(), p.content.String()))
+
+		pageObject := fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R",
+			PageWidth, PageHeight, contentID)
+		if len(annots) > 0 {
+			pageObject += " /Annots [" + strings.Join(annots, " ") + "]"
+		}
+		kids = append(kids, fmt.Sprintf("%d 0 R", add(pageObject+" >>")))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids))
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, body := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// escape encodes s as the body of a PDF string literal in WinAnsiEncoding. Characters outside
+// Latin-1 have no glyph in the standard fonts and become '?'.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r >= 32 && r <= 126, r >= 160 && r <= 255:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
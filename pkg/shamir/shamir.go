@@ -0,0 +1,171 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8).
+//
+// Each byte of the secret is shared with its own random polynomial of degree
+// threshold-1. A share is the polynomial values followed by a one byte
+// x coordinate, so any threshold shares rebuild the secret and fewer reveal
+// nothing about it.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const (
+	// MaxShares is the largest number of shares a secret can be split into
+	MaxShares = 255
+	// MinThreshold is the smallest useful threshold
+	MinThreshold = 2
+)
+
+var (
+	ErrInvalidShares   = errors.New("shamir: shares must be the same length and carry distinct indexes")
+	ErrTooFewShares    = errors.New("shamir: at least two shares are required")
+	ErrEmptySecret     = errors.New("shamir: secret is empty")
+	ErrInvalidSettings = errors.New("shamir: threshold must be between 2 and the number of shares")
+)
+
+// Split divides secret into parts shares, any threshold of which can rebuild it
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, ErrEmptySecret
+	}
+	if parts > MaxShares || threshold < MinThreshold || threshold > parts {
+		return nil, ErrInvalidSettings
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][len(secret)] = byte(i + 1) // x coordinates 1..parts, 0 would expose the secret
+	}
+
+	coefficients := make([]byte, threshold)
+	for idx, b := range secret {
+		coefficients[0] = b
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("shamir: failed to generate coefficients: %w", err)
+		}
+
+		for i := range shares {
+			shares[i][idx] = evaluate(coefficients, byte(i+1))
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine rebuilds the secret from shares produced by Split. It cannot tell
+// whether enough shares were given; too few yield an unrelated secret, so
+// callers must verify the result.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < MinThreshold {
+		return nil, ErrTooFewShares
+	}
+
+	size := len(shares[0])
+	if size < 2 {
+		return nil, ErrInvalidShares
+	}
+
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool, len(shares))
+	for i, share := range shares {
+		if len(share) != size {
+			return nil, ErrInvalidShares
+		}
+
+		x := share[size-1]
+		if x == 0 || seen[x] {
+			return nil, ErrInvalidShares
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	secret := make([]byte, size-1)
+	ys := make([]byte, len(shares))
+	for idx := range secret {
+		for i, share := range shares {
+			ys[i] = share[idx]
+		}
+		secret[idx] = interpolateAtZero(xs, ys)
+	}
+
+	return secret, nil
+}
+
+// Index returns the x coordinate of a share
+func Index(share []byte) int {
+	if len(share) == 0 {
+		return 0
+	}
+	return int(share[len(share)-1])
+}
+
+// evaluate computes the polynomial at x using Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	var result byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		result = add(mul(result, x), coefficients[i])
+	}
+	return result
+}
+
+// interpolateAtZero returns the Lagrange interpolation of the points at x = 0
+func interpolateAtZero(xs, ys []byte) byte {
+	var result byte
+	for i := range xs {
+		basis := byte(1)
+		for j := range xs {
+			if i == j {
+				continue
+			}
+			// At x = 0 the term (0 - xj) / (xi - xj) is xj / (xi ^ xj) in GF(2^8)
+			basis = mul(basis, div(xs[j], add(xs[i], xs[j])))
+		}
+		result = add(result, mul(ys[i], basis))
+	}
+	return result
+}
+
+// add is addition (and subtraction) in GF(2^8)
+func add(a, b byte) byte {
+	return a ^ b
+}
+
+// mul multiplies in GF(2^8) with the AES polynomial x^8 + x^4 + x^3 + x + 1
+func mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+// div divides in GF(2^8); b must not be zero
+func div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return expTable[(int(logTable[a])-int(logTable[b])+255)%255]
+}
+
+var expTable, logTable [256]byte
+
+func init() {
+	// 3 generates the multiplicative group of GF(2^8)
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		expTable[i] = x
+		logTable[x] = byte(i)
+
+		// x *= 3, i.e. x ^ (x * 2) with reduction
+		doubled := x << 1
+		if x&0x80 != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+	expTable[255] = expTable[0]
+}
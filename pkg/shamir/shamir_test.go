@@ -0,0 +1,151 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func randomSecret(t *testing.T, size int) []byte {
+	t.Helper()
+	secret := make([]byte, size)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatalf("rand: %v", err)
+	}
+	return secret
+}
+
+// subsets returns every combination of k indexes out of n
+func subsets(n, k int) [][]int {
+	var result [][]int
+	var walk func(start int, current []int)
+	walk = func(start int, current []int) {
+		if len(current) == k {
+			result = append(result, append([]int{}, current...))
+			return
+		}
+		for i := start; i < n; i++ {
+			walk(i+1, append(current, i))
+		}
+	}
+	walk(0, nil)
+	return result
+}
+
+func pick(shares [][]byte, indexes []int) [][]byte {
+	picked := make([][]byte, len(indexes))
+	for i, index := range indexes {
+		picked[i] = shares[index]
+	}
+	return picked
+}
+
+func TestSplitCombineRoundTrip(t *testing.T) {
+	settings := []struct{ parts, threshold int }{{3, 2}, {5, 3}, {5, 5}, {7, 4}}
+
+	for _, setting := range settings {
+		secret := randomSecret(t, 32)
+		shares, err := Split(secret, setting.parts, setting.threshold)
+		if err != nil {
+			t.Fatalf("Split(%d, %d): %v", setting.parts, setting.threshold, err)
+		}
+		if len(shares) != setting.parts {
+			t.Fatalf("expected %d shares, got %d", setting.parts, len(shares))
+		}
+
+		for i, share := range shares {
+			if Index(share) != i+1 {
+				t.Fatalf("share %d has index %d", i, Index(share))
+			}
+		}
+
+		// Every subset of threshold or more shares rebuilds the secret
+		for k := setting.threshold; k <= setting.parts; k++ {
+			for _, indexes := range subsets(setting.parts, k) {
+				combined, err := Combine(pick(shares, indexes))
+				if err != nil {
+					t.Fatalf("%d-of-%d, shares %v: Combine: %v", setting.threshold, setting.parts, indexes, err)
+				}
+				if !bytes.Equal(combined, secret) {
+					t.Fatalf("%d-of-%d, shares %v: rebuilt a different secret", setting.threshold, setting.parts, indexes)
+				}
+			}
+		}
+	}
+}
+
+func TestCombineBelowThreshold(t *testing.T) {
+	secret := randomSecret(t, 32)
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	// Two shares of a 3-of-5 split interpolate a line, not the secret
+	for _, indexes := range subsets(5, 2) {
+		combined, err := Combine(pick(shares, indexes))
+		if err != nil {
+			t.Fatalf("shares %v: Combine: %v", indexes, err)
+		}
+		if bytes.Equal(combined, secret) {
+			t.Fatalf("shares %v: rebuilt the secret below the threshold", indexes)
+		}
+	}
+
+	if _, err := Combine(shares[:1]); !errors.Is(err, ErrTooFewShares) {
+		t.Fatalf("expected ErrTooFewShares for one share, got %v", err)
+	}
+}
+
+func TestSplitRejectsInvalidSettings(t *testing.T) {
+	secret := []byte("secret")
+
+	if _, err := Split(nil, 3, 2); !errors.Is(err, ErrEmptySecret) {
+		t.Fatalf("expected ErrEmptySecret, got %v", err)
+	}
+	for _, setting := range []struct{ parts, threshold int }{{3, 1}, {2, 3}, {256, 2}} {
+		if _, err := Split(secret, setting.parts, setting.threshold); !errors.Is(err, ErrInvalidSettings) {
+			t.Fatalf("Split(%d, %d): expected ErrInvalidSettings, got %v", setting.parts, setting.threshold, err)
+		}
+	}
+}
+
+func TestCombineRejectsMalformedShares(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	duplicate := [][]byte{shares[0], shares[0]}
+	if _, err := Combine(duplicate); !errors.Is(err, ErrInvalidShares) {
+		t.Fatalf("expected ErrInvalidShares for duplicate indexes, got %v", err)
+	}
+
+	truncated := [][]byte{shares[0], shares[1][1:]}
+	if _, err := Combine(truncated); !errors.Is(err, ErrInvalidShares) {
+		t.Fatalf("expected ErrInvalidShares for mismatched lengths, got %v", err)
+	}
+
+	zeroIndex := append([]byte{}, shares[1]...)
+	zeroIndex[len(zeroIndex)-1] = 0
+	if _, err := Combine([][]byte{shares[0], zeroIndex}); !errors.Is(err, ErrInvalidShares) {
+		t.Fatalf("expected ErrInvalidShares for a zero index, got %v", err)
+	}
+}
+
+func TestFieldArithmetic(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			product := mul(byte(a), byte(b))
+			if div(product, byte(b)) != byte(a) {
+				t.Fatalf("div(mul(%d, %d), %d) != %d", a, b, b, a)
+			}
+		}
+	}
+
+	// 0x53 and 0xCA are inverses under the AES polynomial
+	if mul(0x53, 0xca) != 1 {
+		t.Fatalf("mul(0x53, 0xca) = %#x, expected 1", mul(0x53, 0xca))
+	}
+}
@@ -0,0 +1,28 @@
+package signer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+)
+
+// NewKeystoreSigner creates a signer from an encrypted keystore (V3) file.
+// The key stays encrypted at rest and is only decrypted when the signer is built.
+func NewKeystoreSigner(path, password string) (*LocalSigner, error) {
+	if path == "" {
+		return nil, fmt.Errorf("keystore path not provided")
+	}
+
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keystore file: %v", err)
+	}
+
+	key, err := keystore.DecryptKey(keyJSON, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt keystore: %v", err)
+	}
+
+	return NewLocalSignerFromKey(key.PrivateKey), nil
+}
@@ -0,0 +1,64 @@
+package signer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// LocalSigner signs with a private key held in process memory
+type LocalSigner struct {
+	privateKey *ecdsa.PrivateKey
+	address    common.Address
+}
+
+// NewLocalSigner creates a signer from a hex encoded private key
+func NewLocalSigner(privateKeyHex string) (*LocalSigner, error) {
+	if privateKeyHex == "" {
+		return nil, fmt.Errorf("private key not provided")
+	}
+
+	privateKey, err := crypto.HexToECDSA(strings.TrimPrefix(privateKeyHex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+
+	return NewLocalSignerFromKey(privateKey), nil
+}
+
+// NewLocalSignerFromKey creates a signer from an already parsed private key
+func NewLocalSignerFromKey(privateKey *ecdsa.PrivateKey) *LocalSigner {
+	return &LocalSigner{
+		privateKey: privateKey,
+		address:    crypto.PubkeyToAddress(privateKey.PublicKey),
+	}
+}
+
+// Address returns the signer's account address
+func (s *LocalSigner) Address() common.Address {
+	return s.address
+}
+
+// SignTx signs a transaction with the latest signer for the chain
+func (s *LocalSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.privateKey)
+}
+
+// SignPersonalMessage signs data using the Ethereum signed message prefix
+func (s *LocalSigner) SignPersonalMessage(ctx context.Context, data []byte) ([]byte, error) {
+	signature, err := crypto.Sign(accounts.TextHash(data), s.privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use the 27/28 recovery id expected by ecrecover
+	signature[64] += 27
+	return signature, nil
+}
@@ -0,0 +1,222 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RemoteSigner delegates signing to an external signer speaking the
+// Web3Signer / eth_signTransaction JSON-RPC protocol, so the key never
+// enters the API process
+type RemoteSigner struct {
+	client  *rpc.Client
+	address common.Address
+}
+
+// TransactionArgs is the eth_signTransaction request object
+type TransactionArgs struct {
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to,omitempty"`
+	Gas                  *hexutil.Uint64 `json:"gas,omitempty"`
+	GasPrice             *hexutil.Big    `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	Value                *hexutil.Big    `json:"value,omitempty"`
+	Nonce                *hexutil.Uint64 `json:"nonce,omitempty"`
+	Data                 *hexutil.Bytes  `json:"data,omitempty"`
+	ChainID              *hexutil.Big    `json:"chainId,omitempty"`
+}
+
+// NewRemoteSigner connects to a remote signer. When address is empty the
+// first account reported by eth_accounts is used.
+func NewRemoteSigner(ctx context.Context, url, address string) (*RemoteSigner, error) {
+	if url == "" {
+		return nil, fmt.Errorf("remote signer URL not provided")
+	}
+
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to remote signer: %v", err)
+	}
+
+	var accounts []common.Address
+	if err := client.CallContext(ctx, &accounts, "eth_accounts"); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to list remote signer accounts: %v", err)
+	}
+
+	var signerAddress common.Address
+	if address != "" {
+		if !common.IsHexAddress(address) {
+			client.Close()
+			return nil, fmt.Errorf("invalid signer address %q", address)
+		}
+		signerAddress = common.HexToAddress(address)
+
+		found := false
+		for _, account := range accounts {
+			if account == signerAddress {
+				found = true
+				break
+			}
+		}
+		if !found {
+			client.Close()
+			return nil, fmt.Errorf("remote signer does not manage %s", signerAddress.Hex())
+		}
+	} else {
+		if len(accounts) == 0 {
+			client.Close()
+			return nil, fmt.Errorf("remote signer has no accounts")
+		}
+		signerAddress = accounts[0]
+	}
+
+	return &RemoteSigner{client: client, address: signerAddress}, nil
+}
+
+// Address returns the remote account address
+func (s *RemoteSigner) Address() common.Address {
+	return s.address
+}
+
+// SignTx asks the remote signer to sign the transaction and checks the returned sender
+func (s *RemoteSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := NewTransactionArgs(s.address, tx, chainID)
+
+	var raw hexutil.Bytes
+	if err := s.client.CallContext(ctx, &raw, "eth_signTransaction", args); err != nil {
+		return nil, fmt.Errorf("remote signer failed to sign transaction: %v", err)
+	}
+
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(raw); err != nil {
+		return nil, fmt.Errorf("failed to decode signed transaction: %v", err)
+	}
+
+	// Never trust the remote blindly: the signature must be ours, replay protected on the
+	// requested chain, and the payload and fees unchanged
+	if !signed.Protected() || signed.ChainId().Cmp(chainID) != 0 {
+		return nil, fmt.Errorf("remote signer signed for chain %s, expected %s", signed.ChainId(), chainID)
+	}
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover signer: %v", err)
+	}
+	if sender != s.address {
+		return nil, fmt.Errorf("remote signer signed with %s, expected %s", sender.Hex(), s.address.Hex())
+	}
+	if signed.Nonce() != tx.Nonce() || signed.Gas() != tx.Gas() || signed.Value().Cmp(tx.Value()) != 0 ||
+		!equalAddress(signed.To(), tx.To()) || common.Bytes2Hex(signed.Data()) != common.Bytes2Hex(tx.Data()) {
+		return nil, fmt.Errorf("remote signer returned a different transaction")
+	}
+	if signed.Type() != tx.Type() || signed.GasPrice().Cmp(tx.GasPrice()) != 0 ||
+		signed.GasFeeCap().Cmp(tx.GasFeeCap()) != 0 || signed.GasTipCap().Cmp(tx.GasTipCap()) != 0 {
+		return nil, fmt.Errorf("remote signer changed the transaction fees")
+	}
+
+	return signed, nil
+}
+
+// SignPersonalMessage signs data through eth_sign
+func (s *RemoteSigner) SignPersonalMessage(ctx context.Context, data []byte) ([]byte, error) {
+	var signature hexutil.Bytes
+	if err := s.client.CallContext(ctx, &signature, "eth_sign", s.address, hexutil.Bytes(data)); err != nil {
+		return nil, fmt.Errorf("remote signer failed to sign message: %v", err)
+	}
+
+	if len(signature) != 65 {
+		return nil, fmt.Errorf("unexpected signature length %d", len(signature))
+	}
+	if signature[64] < 27 {
+		signature[64] += 27
+	}
+
+	return signature, nil
+}
+
+// NewTransactionArgs converts an unsigned transaction into eth_signTransaction arguments
+func NewTransactionArgs(from common.Address, tx *types.Transaction, chainID *big.Int) TransactionArgs {
+	gas := hexutil.Uint64(tx.Gas())
+	nonce := hexutil.Uint64(tx.Nonce())
+	data := hexutil.Bytes(tx.Data())
+
+	args := TransactionArgs{
+		From:    from,
+		To:      tx.To(),
+		Gas:     &gas,
+		Value:   (*hexutil.Big)(tx.Value()),
+		Nonce:   &nonce,
+		Data:    &data,
+		ChainID: (*hexutil.Big)(chainID),
+	}
+
+	if tx.Type() == types.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+
+	return args
+}
+
+// ToTransaction rebuilds the unsigned transaction described by the arguments
+func (args TransactionArgs) ToTransaction() (*types.Transaction, error) {
+	if args.Gas == nil || args.Nonce == nil {
+		return nil, fmt.Errorf("gas and nonce are required")
+	}
+
+	value := new(big.Int)
+	if args.Value != nil {
+		value = args.Value.ToInt()
+	}
+
+	var data []byte
+	if args.Data != nil {
+		data = *args.Data
+	}
+
+	if args.MaxFeePerGas != nil {
+		if args.ChainID == nil || args.MaxPriorityFeePerGas == nil {
+			return nil, fmt.Errorf("chainId and maxPriorityFeePerGas are required for EIP-1559 transactions")
+		}
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   args.ChainID.ToInt(),
+			Nonce:     uint64(*args.Nonce),
+			GasTipCap: args.MaxPriorityFeePerGas.ToInt(),
+			GasFeeCap: args.MaxFeePerGas.ToInt(),
+			Gas:       uint64(*args.Gas),
+			To:        args.To,
+			Value:     value,
+			Data:      data,
+		}), nil
+	}
+
+	if args.GasPrice == nil {
+		return nil, fmt.Errorf("gasPrice is required")
+	}
+
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    uint64(*args.Nonce),
+		GasPrice: args.GasPrice.ToInt(),
+		Gas:      uint64(*args.Gas),
+		To:       args.To,
+		Value:    value,
+		Data:     data,
+	}), nil
+}
+
+// equalAddress compares two optional addresses
+func equalAddress(a, b *common.Address) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,60 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// signerAPI exposes a local signer over the eth_* signing methods
+type signerAPI struct {
+	signer *LocalSigner
+}
+
+// NewServer creates a JSON-RPC server that acts as a local stand-in for a
+// remote signer such as Web3Signer. It serves eth_accounts, eth_signTransaction and eth_sign.
+func NewServer(s *LocalSigner) (*rpc.Server, error) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", &signerAPI{signer: s}); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// Accounts implements eth_accounts
+func (api *signerAPI) Accounts() []common.Address {
+	return []common.Address{api.signer.Address()}
+}
+
+// SignTransaction implements eth_signTransaction and returns the raw signed transaction
+func (api *signerAPI) SignTransaction(ctx context.Context, args TransactionArgs) (hexutil.Bytes, error) {
+	if args.From != api.signer.Address() {
+		return nil, fmt.Errorf("unknown account %s", args.From.Hex())
+	}
+	if args.ChainID == nil {
+		return nil, fmt.Errorf("chainId is required")
+	}
+
+	tx, err := args.ToTransaction()
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := api.signer.SignTx(ctx, tx, args.ChainID.ToInt())
+	if err != nil {
+		return nil, err
+	}
+
+	return signed.MarshalBinary()
+}
+
+// Sign implements eth_sign
+func (api *signerAPI) Sign(ctx context.Context, address common.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if address != api.signer.Address() {
+		return nil, fmt.Errorf("unknown account %s", address.Hex())
+	}
+	return api.signer.SignPersonalMessage(ctx, data)
+}
@@ -0,0 +1,68 @@
+package signer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Signer types selectable through SIGNER_TYPE
+const (
+	TypeLocal    = "local"
+	TypeKeystore = "keystore"
+	TypeRemote   = "remote"
+)
+
+// Signer signs transactions and messages for a single account without
+// exposing how or where the private key is held
+type Signer interface {
+	// Address returns the account the signer signs for
+	Address() common.Address
+	// SignTx signs a transaction for the given chain
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+	// SignPersonalMessage signs data with the "\x19Ethereum Signed Message" prefix (eth_sign)
+	SignPersonalMessage(ctx context.Context, data []byte) ([]byte, error)
+}
+
+// NewTransactOpts creates transact options whose signing is delegated to the signer
+func NewTransactOpts(ctx context.Context, s Signer, chainID *big.Int) *bind.TransactOpts {
+	from := s.Address()
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != from {
+				return nil, bind.ErrNotAuthorized
+			}
+			return s.SignTx(ctx, tx, chainID)
+		},
+		Context: ctx,
+	}
+}
+
+// Config selects the signer implementation and where its key comes from
+type Config struct {
+	Type             string // local, keystore or remote
+	KeystorePath     string // Encrypted keystore file for the keystore signer
+	KeystorePassword string
+	RemoteURL        string // Web3Signer / eth_signTransaction JSON-RPC endpoint
+	Address          string // Account to use on the remote signer, defaults to the first one
+}
+
+// NewFromConfig builds the signer selected by cfg.Type.
+// privateKeyHex is only used by the local signer.
+func NewFromConfig(ctx context.Context, cfg Config, privateKeyHex string) (Signer, error) {
+	switch cfg.Type {
+	case "", TypeLocal:
+		return NewLocalSigner(privateKeyHex)
+	case TypeKeystore:
+		return NewKeystoreSigner(cfg.KeystorePath, cfg.KeystorePassword)
+	case TypeRemote:
+		return NewRemoteSigner(ctx, cfg.RemoteURL, cfg.Address)
+	default:
+		return nil, fmt.Errorf("unknown signer type %q", cfg.Type)
+	}
+}
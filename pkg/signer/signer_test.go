@@ -0,0 +1,266 @@
+package signer
+
+import (
+	"context"
+	"math/big"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Well-known development key, never funded on a real chain
+const testKey = "ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80"
+
+var testChainID = big.NewInt(11155111)
+
+func newTestSigner(t *testing.T) *LocalSigner {
+	t.Helper()
+	s, err := NewLocalSigner("0x" + testKey)
+	if err != nil {
+		t.Fatalf("NewLocalSigner: %v", err)
+	}
+	return s
+}
+
+func testTransactions() map[string]*types.Transaction {
+	to := common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8")
+	return map[string]*types.Transaction{
+		"legacy": types.NewTx(&types.LegacyTx{
+			Nonce:    7,
+			GasPrice: big.NewInt(30e9),
+			Gas:      21000,
+			To:       &to,
+			Value:    big.NewInt(1e15),
+		}),
+		"dynamic": types.NewTx(&types.DynamicFeeTx{
+			ChainID:   testChainID,
+			Nonce:     8,
+			GasTipCap: big.NewInt(2e9),
+			GasFeeCap: big.NewInt(40e9),
+			Gas:       60000,
+			To:        &to,
+			Data:      []byte{0xa9, 0x05, 0x9c, 0xbb},
+		}),
+	}
+}
+
+// startRemote serves api as the "eth" namespace and connects a RemoteSigner to it
+func startRemote(t *testing.T, api interface{}) *RemoteSigner {
+	t.Helper()
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatalf("RegisterName: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	remote, err := NewRemoteSigner(context.Background(), httpServer.URL, "")
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+	return remote
+}
+
+func TestLocalSignerSignsForChain(t *testing.T) {
+	s := newTestSigner(t)
+
+	for name, tx := range testTransactions() {
+		signed, err := s.SignTx(context.Background(), tx, testChainID)
+		if err != nil {
+			t.Fatalf("%s: SignTx: %v", name, err)
+		}
+		if !signed.Protected() || signed.ChainId().Cmp(testChainID) != 0 {
+			t.Fatalf("%s: expected replay protection for chain %s, got %s", name, testChainID, signed.ChainId())
+		}
+		sender, err := types.Sender(types.LatestSignerForChainID(testChainID), signed)
+		if err != nil || sender != s.Address() {
+			t.Fatalf("%s: recovered %s (%v), expected %s", name, sender.Hex(), err, s.Address().Hex())
+		}
+	}
+}
+
+func TestLocalSignerPersonalMessage(t *testing.T) {
+	s := newTestSigner(t)
+	message := []byte("Sign in to the token sale")
+
+	signature, err := s.SignPersonalMessage(context.Background(), message)
+	if err != nil {
+		t.Fatalf("SignPersonalMessage: %v", err)
+	}
+	if signature[64] != 27 && signature[64] != 28 {
+		t.Fatalf("unexpected recovery id %d", signature[64])
+	}
+
+	recoverable := append([]byte{}, signature...)
+	recoverable[64] -= 27
+	publicKey, err := crypto.SigToPub(accounts.TextHash(message), recoverable)
+	if err != nil {
+		t.Fatalf("SigToPub: %v", err)
+	}
+	if crypto.PubkeyToAddress(*publicKey) != s.Address() {
+		t.Fatal("signature does not recover to the signer")
+	}
+}
+
+func TestRemoteSignerRoundTrip(t *testing.T) {
+	local := newTestSigner(t)
+	server, err := NewServer(local)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	remote, err := NewRemoteSigner(context.Background(), httpServer.URL, local.Address().Hex())
+	if err != nil {
+		t.Fatalf("NewRemoteSigner: %v", err)
+	}
+	if remote.Address() != local.Address() {
+		t.Fatalf("remote address %s, expected %s", remote.Address().Hex(), local.Address().Hex())
+	}
+
+	for name, tx := range testTransactions() {
+		signed, err := remote.SignTx(context.Background(), tx, testChainID)
+		if err != nil {
+			t.Fatalf("%s: SignTx: %v", name, err)
+		}
+		if signed.Hash() == tx.Hash() {
+			t.Fatalf("%s: transaction was not signed", name)
+		}
+	}
+
+	if _, err := NewRemoteSigner(context.Background(), httpServer.URL, "0x70997970C51812dc3A010C7d01b50e0d17dc79C8"); err == nil {
+		t.Fatal("expected an error for an account the remote does not manage")
+	}
+}
+
+// tamperingAPI is a misbehaving remote signer that alters the request before signing it
+type tamperingAPI struct {
+	signer *LocalSigner
+	tamper func(args *TransactionArgs) (*types.Transaction, types.Signer)
+}
+
+func (api *tamperingAPI) Accounts() []common.Address {
+	return []common.Address{api.signer.Address()}
+}
+
+func (api *tamperingAPI) SignTransaction(ctx context.Context, args TransactionArgs) (hexutil.Bytes, error) {
+	tx, txSigner := api.tamper(&args)
+	signed, err := types.SignTx(tx, txSigner, api.signer.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return signed.MarshalBinary()
+}
+
+func TestRemoteSignerRejectsTamperedTransactions(t *testing.T) {
+	local := newTestSigner(t)
+	legacy := testTransactions()["legacy"]
+	dynamic := testTransactions()["dynamic"]
+
+	cases := []struct {
+		name   string
+		tx     *types.Transaction
+		tamper func(args *TransactionArgs) (*types.Transaction, types.Signer)
+		want   string
+	}{
+		{
+			name: "unprotected legacy",
+			tx:   legacy,
+			tamper: func(args *TransactionArgs) (*types.Transaction, types.Signer) {
+				tx, _ := args.ToTransaction()
+				return tx, types.HomesteadSigner{}
+			},
+			want: "chain",
+		},
+		{
+			name: "other chain",
+			tx:   legacy,
+			tamper: func(args *TransactionArgs) (*types.Transaction, types.Signer) {
+				tx, _ := args.ToTransaction()
+				return tx, types.LatestSignerForChainID(big.NewInt(1))
+			},
+			want: "chain",
+		},
+		{
+			name: "raised gas price",
+			tx:   legacy,
+			tamper: func(args *TransactionArgs) (*types.Transaction, types.Signer) {
+				args.GasPrice = (*hexutil.Big)(big.NewInt(300e9))
+				tx, _ := args.ToTransaction()
+				return tx, types.LatestSignerForChainID(testChainID)
+			},
+			want: "fees",
+		},
+		{
+			name: "raised priority fee",
+			tx:   dynamic,
+			tamper: func(args *TransactionArgs) (*types.Transaction, types.Signer) {
+				args.MaxPriorityFeePerGas = (*hexutil.Big)(big.NewInt(20e9))
+				tx, _ := args.ToTransaction()
+				return tx, types.LatestSignerForChainID(testChainID)
+			},
+			want: "fees",
+		},
+		{
+			name: "downgraded to legacy",
+			tx:   dynamic,
+			tamper: func(args *TransactionArgs) (*types.Transaction, types.Signer) {
+				args.GasPrice = args.MaxFeePerGas
+				args.MaxFeePerGas, args.MaxPriorityFeePerGas = nil, nil
+				tx, _ := args.ToTransaction()
+				return tx, types.LatestSignerForChainID(testChainID)
+			},
+			want: "fees",
+		},
+		{
+			name: "changed value",
+			tx:   legacy,
+			tamper: func(args *TransactionArgs) (*types.Transaction, types.Signer) {
+				args.Value = (*hexutil.Big)(big.NewInt(1e18))
+				tx, _ := args.ToTransaction()
+				return tx, types.LatestSignerForChainID(testChainID)
+			},
+			want: "different transaction",
+		},
+	}
+
+	for _, tc := range cases {
+		remote := startRemote(t, &tamperingAPI{signer: local, tamper: tc.tamper})
+		_, err := remote.SignTx(context.Background(), tc.tx, testChainID)
+		if err == nil {
+			t.Fatalf("%s: expected the signed transaction to be rejected", tc.name)
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s: unexpected error %v", tc.name, err)
+		}
+	}
+}
+
+func TestTransactionArgsRoundTrip(t *testing.T) {
+	from := newTestSigner(t).Address()
+
+	for name, tx := range testTransactions() {
+		rebuilt, err := NewTransactionArgs(from, tx, testChainID).ToTransaction()
+		if err != nil {
+			t.Fatalf("%s: ToTransaction: %v", name, err)
+		}
+		if rebuilt.Type() != tx.Type() || rebuilt.Nonce() != tx.Nonce() || rebuilt.Gas() != tx.Gas() ||
+			rebuilt.GasFeeCap().Cmp(tx.GasFeeCap()) != 0 || rebuilt.GasTipCap().Cmp(tx.GasTipCap()) != 0 ||
+			rebuilt.Value().Cmp(tx.Value()) != 0 || string(rebuilt.Data()) != string(tx.Data()) {
+			t.Fatalf("%s: rebuilt transaction differs", name)
+		}
+	}
+
+	if _, err := (TransactionArgs{From: from}).ToTransaction(); err == nil {
+		t.Fatal("expected missing gas and nonce to be rejected")
+	}
+}